@@ -4,6 +4,6 @@ set GOOS=linux
 for /f %%i in ('git rev-parse HEAD') do set git_command=%%i
 echo %git_command%
 
-go build cmd/drones.go
+go build -o drones ./cmd
 
 scp -r drones config.dev.json my_linux:/service/go-playground
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/drone"
+)
+
+//prefix of the routes of the versioned api
+const apiV1Prefix = "/api/v1"
+
+//add the routes of the drones of the versioned api, returning its router so the other resources are added to it
+func (env *environment) addAPIv1Routes() *mux.Router {
+
+	v1 := env.Router.PathPrefix(apiV1Prefix).Subrouter()
+	v1.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("there is not a route %s %s", r.Method, r.URL.Path))
+	})
+	v1.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed in %s", r.Method, r.URL.Path))
+	})
+
+	v1.HandleFunc("/drones", env.createDrone).Methods("POST")
+	v1.HandleFunc("/drones", env.getDrones).Methods("GET")
+	v1.HandleFunc("/drones/{serial_number}", env.getDroneBySerialNumber).Methods("GET")
+	v1.HandleFunc("/drones/{serial_number}/medications", env.loadMedicationsOnDrone).Methods("POST")
+	v1.HandleFunc("/drones/{serial_number}/medications", env.getMedicationsOfDrone).Methods("GET")
+	v1.HandleFunc("/drones/{serial_number}/medications", env.unloadAllMedicationsFromDrone).Methods("DELETE")
+	v1.HandleFunc("/drones/{serial_number}/medications/{code}", env.unloadMedicationsByCodeFromDrone).Methods("DELETE")
+	v1.HandleFunc("/drones/{serial_number}/battery", env.getBatteryOfDrone).Methods("GET")
+	v1.HandleFunc("/drones/{serial_number}/battery/history", env.getBatteryHistoryOfDrone).Methods("GET")
+	v1.HandleFunc("/drones/{serial_number}/state", env.changeStateOfDrone).Methods("PUT")
+	v1.HandleFunc("/drones/{serial_number}/stops/next", env.deliverNextStopOfDrone).Methods("POST")
+
+	return v1
+}
+
+//http handler to register a new drone
+func (env *environment) createDrone(w http.ResponseWriter, r *http.Request) {
+
+	dto := drone.DroneDTO{}
+
+	err := json.NewDecoder(r.Body).Decode(&dto)
+	if err != nil {
+		errMessage := "could not decode drone json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	droneObj, err := env.newDroneOfRequest(dto)
+	if err != nil {
+		errMessage := fmt.Sprintf("drone is not valid: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	//a drone registered at the same time with the same serial number is a conflict as well
+	err = env.registerNewDrone(r, droneObj)
+	if errors.Is(err, errDroneExists) {
+		errMessage := err.Error()
+		log.Println(errMessage)
+		writeError(w, http.StatusConflict, errMessage)
+		return
+	}
+	if err != nil {
+		errMessage := fmt.Sprintf("could not add new drone: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	writeCreated(w, "/drones/"+droneObj.GetSerialNumber())
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("new drone with serial number %s added", droneObj.GetSerialNumber()),
+		Drones:  []drone.DroneDTO{*snapshotOfDrone(droneObj)},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("new drone added: %s", droneObj.GetSerialNumber())
+}
+
+//http handler to get a page of the registered drones, filtered and sorted by the parameters of the request
+func (env *environment) getDrones(w http.ResponseWriter, r *http.Request) {
+
+	drones, page, err := env.listDrones(r, env.getRegisteredDrones())
+	if err != nil {
+		errMessage := fmt.Sprintf("could not list drones: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("this are %d of the %d drones found", len(drones), page.Total),
+		Drones:  drones,
+		Page:    &page,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to get a drone
+func (env *environment) getDroneBySerialNumber(w http.ResponseWriter, r *http.Request) {
+
+	droneObj := env.droneOfRequest(w, r)
+	if droneObj == nil {
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("this is the drone with serial number %s", droneObj.GetSerialNumber()),
+		Drones:  []drone.DroneDTO{*snapshotOfDrone(droneObj)},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to get the medications loaded on a drone (an empty list when it has none)
+func (env *environment) getMedicationsOfDrone(w http.ResponseWriter, r *http.Request) {
+
+	droneObj := env.droneOfRequest(w, r)
+	if droneObj == nil {
+		return
+	}
+
+	dto := droneObj.GetDTOWithSerialNumberAndMedications()
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("this are the %d medications loaded in drone with serial number %s", len(dto.Medications), dto.SerialNumber),
+		Drones:  []drone.DroneDTO{dto},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to load medications (and items of the catalog) on a drone
+func (env *environment) loadMedicationsOnDrone(w http.ResponseWriter, r *http.Request) {
+
+	droneObj := env.droneOfRequest(w, r)
+	if droneObj == nil {
+		return
+	}
+
+	load := drone.DroneDTO{}
+
+	err := json.NewDecoder(r.Body).Decode(&load)
+	if err != nil {
+		errMessage := "could not decode load json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+	load.SerialNumber = droneObj.GetSerialNumber()
+
+	err = env.loadDrone(r, load)
+	if err != nil {
+		//the state or the battery of the drone do not allow loading it when the medications are not rejected
+		writeLoadError(w, fmt.Sprintf("could not load medications on drone: %s", err.Error()), err, http.StatusConflict)
+		return
+	}
+
+	dto := droneObj.GetDTOWithSerialNumberStateAndMedications()
+
+	writeCreated(w, "/drones/"+dto.SerialNumber+"/medications")
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("medications loaded in drone with serial number %s", dto.SerialNumber),
+		Drones:  []drone.DroneDTO{dto},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("medications loaded in drone %s", dto.SerialNumber)
+}
+
+//http handler to get the battery level of a drone
+func (env *environment) getBatteryOfDrone(w http.ResponseWriter, r *http.Request) {
+
+	droneObj := env.droneOfRequest(w, r)
+	if droneObj == nil {
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("this is the battery capacity of drone with serial number %s", droneObj.GetSerialNumber()),
+		Drones:  []drone.DroneDTO{droneObj.GetDTOWithSerialNumberAndBatteryCapacity()},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//get the drone of the 'serial_number' of the route, writing the response when it is not found
+func (env *environment) droneOfRequest(w http.ResponseWriter, r *http.Request) *drone.Drone {
+
+	serialNumber := mux.Vars(r)["serial_number"]
+	droneObj := env.getDrone(serialNumber)
+	if droneObj == nil {
+		errMessage := fmt.Sprintf("drone with serial number '%s' was not found", serialNumber)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+	}
+
+	return droneObj
+}
+
+//write the status of a created resource with its location in the versioned api
+func writeCreated(w http.ResponseWriter, location string) {
+	w.Header().Set("Location", apiV1Prefix+location)
+	w.WriteHeader(http.StatusCreated)
+}
+
+//wrap a handler of a legacy route of the drones, so it keeps the status codes it returned before the api was versioned:
+//200 instead of 201 and 400 instead of 422 (the resources added later keep the codes of the versioned api)
+func withLegacyStatusCodes(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(legacyResponseWriter{w}, r)
+	})
+}
+
+//writer of the responses of the legacy routes
+type legacyResponseWriter struct {
+	http.ResponseWriter
+}
+
+//write the status code that the legacy routes returned before the api was versioned
+func (w legacyResponseWriter) WriteHeader(statusCode int) {
+
+	switch statusCode {
+	case http.StatusCreated:
+		statusCode = http.StatusOK
+	case http.StatusUnprocessableEntity:
+		statusCode = http.StatusBadRequest
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func Test_APIv1_drones(t *testing.T) {
+
+	server := newTestServer(t, "")
+
+	status, header := sendRequestWithHeaders(t, server, "POST", "/api/v1/drones", nil, `{"serial_number":"DRONE-1","model":"Middleweight","weight_limit":300,"battery_capacity":100,"state":"IDLE"}`)
+	if status != http.StatusCreated || header.Get("Location") != "/api/v1/drones/DRONE-1" {
+		t.Fatalf("drone must be created with its location but status was %d and location %q", status, header.Get("Location"))
+	}
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"drone that already exists", "POST", "/api/v1/drones", `{"serial_number":"DRONE-1","model":"Middleweight","weight_limit":300,"battery_capacity":100,"state":"IDLE"}`, http.StatusConflict},
+		{"drone that is not valid", "POST", "/api/v1/drones", `{"serial_number":"DRONE-2","model":"Middleweight","weight_limit":900,"battery_capacity":100,"state":"IDLE"}`, http.StatusUnprocessableEntity},
+		{"malformed drone", "POST", "/api/v1/drones", `{"serial_number":`, http.StatusBadRequest},
+		{"registered drone", "GET", "/api/v1/drones/DRONE-1", "", http.StatusOK},
+		{"drone that does not exist", "GET", "/api/v1/drones/DRONE-9", "", http.StatusNotFound},
+		{"medications over the weight limit", "POST", "/api/v1/drones/DRONE-1/medications", `{"medications":[{"name":"heavy","code":"HEAVY","weight":400}]}`, http.StatusUnprocessableEntity},
+		{"medications", "POST", "/api/v1/drones/DRONE-1/medications", `{"medications":[{"name":"aspirin","code":"ASP_20","weight":20}]}`, http.StatusCreated},
+		{"route that does not exist", "GET", "/api/v1/unknown", "", http.StatusNotFound},
+		{"method that is not allowed", "PATCH", "/api/v1/drones", "", http.StatusMethodNotAllowed},
+	}
+	for _, v := range steps {
+		if status, response := sendRequest(t, server, v.method, v.path, v.body); status != v.status {
+			t.Errorf("%s must return %d but returned %d: %s", v.name, v.status, status, response.Details)
+		}
+	}
+
+	_, response := sendRequest(t, server, "POST", "/api/v1/drones/DRONE-1/medications", `{"medications":[{"name":"heavy","code":"HEAVY","weight":400}]}`)
+	if len(response.Rejected) != 1 || response.Rejected[0].Code != "HEAVY" {
+		t.Errorf("the rejected medications must be returned but they were %+v", response.Rejected)
+	}
+}
+
+func Test_APIv1_concurrentRegistration(t *testing.T) {
+
+	server := newTestServer(t, "")
+
+	const requests = 10
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, _ := sendRequest(t, server, "POST", "/api/v1/drones", `{"serial_number":"DRONE-1","model":"Middleweight","weight_limit":300,"battery_capacity":100,"state":"IDLE"}`)
+			statuses <- status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	count := make(map[int]int)
+	for v := range statuses {
+		count[v]++
+	}
+	if count[http.StatusCreated] != 1 || count[http.StatusConflict] != requests-1 {
+		t.Errorf("one registration must be created and the rest must be conflicts but status codes were %v", count)
+	}
+}
+
+func Test_legacyRoutes(t *testing.T) {
+
+	server := newTestServer(t, "")
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"drone", "POST", "/drone/register", `{"serial_number":"DRONE-1","model":"Middleweight","weight_limit":300,"battery_capacity":100,"state":"IDLE"}`, http.StatusOK},
+		{"drone that already exists", "POST", "/drone/register", `{"serial_number":"DRONE-1","model":"Middleweight","weight_limit":300,"battery_capacity":100,"state":"IDLE"}`, http.StatusBadRequest},
+		{"drone that is not valid", "POST", "/drone/register", `{"serial_number":"DRONE-2","model":"Middleweight","weight_limit":900,"battery_capacity":100,"state":"IDLE"}`, http.StatusBadRequest},
+		{"medications over the weight limit", "POST", "/drone/load", `{"serial_number":"DRONE-1","medications":[{"name":"heavy","code":"HEAVY","weight":400}]}`, http.StatusBadRequest},
+		{"medications", "POST", "/drone/load", `{"serial_number":"DRONE-1","medications":[{"name":"aspirin","code":"ASP_20","weight":20}]}`, http.StatusOK},
+		{"medications of a drone that does not exist", "POST", "/drone/load", `{"serial_number":"DRONE-9","medications":[{"name":"aspirin","code":"ASP_20","weight":20}]}`, http.StatusBadRequest},
+		{"medications of the drone", "GET", "/drone/medications?serial_number=DRONE-1", "", http.StatusOK},
+		{"drones", "GET", "/drone/all", "", http.StatusOK},
+		//the resources added after the api was versioned keep its status codes without the prefix
+		{"medication of the catalog", "POST", "/medications", `{"code":"DIP_10","name":"dipirona","weight":110,"stock":1}`, http.StatusCreated},
+		{"medication of the catalog that is not valid", "POST", "/medications", `{"code":"DIP 10","name":"dipirona","weight":110}`, http.StatusUnprocessableEntity},
+	}
+	for _, v := range steps {
+		if status, response := sendRequest(t, server, v.method, v.path, v.body); status != v.status {
+			t.Errorf("%s must return %d but returned %d: %s", v.name, v.status, status, response.Details)
+		}
+	}
+
+	//a drone registered in the legacy routes is in the versioned api, with what was loaded on it
+	status, response := sendRequest(t, server, "GET", "/api/v1/drones/DRONE-1/medications", "")
+	if status != http.StatusOK || len(response.Drones) != 1 || len(response.Drones[0].Medications) != 1 {
+		t.Errorf("the medications loaded in the legacy routes must be in the versioned api but response was %d %+v", status, response.Drones)
+	}
+}
+
+func Test_APIv1_medicationsAndStock(t *testing.T) {
+
+	server := newTestServer(t, "")
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"medication of the catalog", "POST", "/api/v1/medications", `{"code":"ASP_20","name":"aspirin","weight":20,"stock":1}`, http.StatusCreated},
+		{"drone", "POST", "/api/v1/drones", `{"serial_number":"DRONE-1","model":"Middleweight","weight_limit":300,"battery_capacity":100,"state":"IDLE"}`, http.StatusCreated},
+		{"medication in stock", "POST", "/api/v1/drones/DRONE-1/medications", `{"medications":[{"name":"aspirin","code":"ASP_20","weight":20}]}`, http.StatusCreated},
+		{"medication out of stock", "POST", "/api/v1/drones/DRONE-1/medications", `{"medications":[{"name":"aspirin","code":"ASP_20","weight":20}]}`, http.StatusUnprocessableEntity},
+		{"item out of stock", "POST", "/api/v1/drones/DRONE-1/medications", `{"items":[{"code":"ASP_20","quantity":1}]}`, http.StatusUnprocessableEntity},
+	}
+	for _, v := range steps {
+		if status, response := sendRequest(t, server, v.method, v.path, v.body); status != v.status {
+			t.Fatalf("%s must return %d but returned %d: %s", v.name, v.status, status, response.Details)
+		}
+	}
+
+	_, response := sendRequest(t, server, "GET", "/api/v1/medications/ASP_20", "")
+	if len(response.Medications) != 1 || response.Medications[0].Stock != 0 {
+		t.Fatalf("the unit loaded with all its data must be taken from the stock but catalog was %+v", response.Medications)
+	}
+
+	status, _ := sendRequest(t, server, "DELETE", "/api/v1/drones/DRONE-1/medications/ASP_20", "")
+	if status != http.StatusOK {
+		t.Fatalf("medication must be unloaded but status was %d", status)
+	}
+
+	_, response = sendRequest(t, server, "GET", "/api/v1/medications/ASP_20", "")
+	if len(response.Medications) != 1 || response.Medications[0].Stock != 1 {
+		t.Errorf("the unloaded unit must be given back to the stock but catalog was %+v", response.Medications)
+	}
+}
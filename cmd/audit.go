@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/audit"
+	"drones/pkg/auth"
+	"drones/pkg/drone"
+)
+
+//header with the id of a request (given by the client or generated)
+const requestIDHeader = "X-Request-ID"
+
+//ids of requests accepted from the clients
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+//add the routes of the audit log to a router
+func (env *environment) addAuditRoutes(router *mux.Router) {
+	router.HandleFunc("/audit", env.getAuditEntries).Methods("GET")
+	router.HandleFunc("/audit/verify", env.verifyAuditLog).Methods("GET")
+}
+
+//http handler to get the audit entries filtered by the optional parameters 'serial', 'from' and 'to' (RFC 3339)
+func (env *environment) getAuditEntries(w http.ResponseWriter, r *http.Request) {
+
+	filter := audit.Filter{SerialNumber: r.URL.Query().Get("serial")}
+
+	for _, parameter := range []string{"from", "to"} {
+		value := r.URL.Query().Get(parameter)
+		if value == "" {
+			continue
+		}
+		limit, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errMessage := fmt.Sprintf("parameter '%s' must be a RFC 3339 date: %s", parameter, err.Error())
+			log.Println(errMessage)
+			writeError(w, http.StatusBadRequest, errMessage)
+			return
+		}
+		if parameter == "from" {
+			filter.From = limit
+		} else {
+			filter.To = limit
+		}
+	}
+
+	entries := env.audit.Query(filter)
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("this are the %d audit entries", len(entries)),
+		Audit:   entries,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to check that the chain of the audit log has not been tampered with
+func (env *environment) verifyAuditLog(w http.ResponseWriter, r *http.Request) {
+
+	result, err := env.audit.Verify()
+	if err != nil {
+		errMessage := fmt.Sprintf("could not verify audit log: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	details := fmt.Sprintf("the %d audit entries are chained", result.Entries)
+	if !result.OK {
+		details = fmt.Sprintf("the audit log is broken at line %d: %s", result.BrokenAt, result.Reason)
+		log.Printf("WARNING: %s", details)
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:           result.OK,
+		Details:      details,
+		Verification: &result,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//record in the audit log an operation of a request on a drone, with the data of the drone before it (nil when it is new)
+func (env *environment) recordAudit(r *http.Request, action string, missionID string, before *drone.DroneDTO, droneObj *drone.Drone) {
+
+	if env.audit == nil || droneObj == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Actor:        "anonymous",
+		RequestID:    requestIDOf(r),
+		Action:       action,
+		SerialNumber: droneObj.GetSerialNumber(),
+		MissionID:    missionID,
+		Before:       before,
+		After:        snapshotOfDrone(droneObj),
+	}
+
+	if principal, ok := auth.FromContext(r.Context()); ok {
+		entry.Actor, entry.Role = principal.Subject, principal.Role
+	}
+
+	_, err := env.audit.Record(entry)
+	if err != nil {
+		log.Printf("ERROR: %s of drone %s by %s (request %s) could not be audited: %v", action, entry.SerialNumber, entry.Actor, entry.RequestID, err)
+	}
+}
+
+//get the current data of a drone (nil when there is no drone)
+func snapshotOfDrone(droneObj *drone.Drone) *drone.DroneDTO {
+
+	if droneObj == nil {
+		return nil
+	}
+
+	dto := droneObj.GetDTO()
+
+	return &dto
+}
+
+//middleware that gives every request an id (the one sent by the client when it is valid) and returns it in the response
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDRegexp.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+//get the id of a request
+func requestIDOf(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+//get a random id for a request
+func newRequestID() string {
+
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Printf("could not generate request id: %v", err)
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
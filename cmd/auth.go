@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/auth"
+)
+
+var (
+	//roles that may read the state of the fleet
+	readers = []string{auth.RoleOperator, auth.RolePharmacist, auth.RoleViewer}
+
+	//roles allowed on each route ("METHOD path template", the same in the versioned api and in the legacy routes),
+	//a route that is not here is forbidden to everyone
+	routePermissions = map[string][]string{
+		"GET /openapi.json":                                 readers,
+		"POST /drones":                                      {auth.RoleOperator},
+		"GET /drones":                                       readers,
+		"GET /drones/{serial_number}":                       readers,
+		"POST /drones/{serial_number}/medications":          {auth.RolePharmacist},
+		"GET /drones/{serial_number}/medications":           readers,
+		"DELETE /drones/{serial_number}/medications":        {auth.RolePharmacist},
+		"DELETE /drones/{serial_number}/medications/{code}": {auth.RolePharmacist},
+		"GET /drones/{serial_number}/battery":               readers,
+		"GET /drones/{serial_number}/battery/history":       readers,
+		"PUT /drones/{serial_number}/state":                 {auth.RoleOperator},
+		"POST /drones/{serial_number}/stops/next":           {auth.RoleOperator},
+		"POST /drone/register":                              {auth.RoleOperator},
+		"POST /drone/load":                                  {auth.RolePharmacist},
+		"GET /drone/medications":                            readers,
+		"GET /drone/battery":                                readers,
+		"GET /drone/{serial_number}/battery/history":        readers,
+		"GET /drone/all/availables":                         readers,
+		"GET /drone/all/service":                            readers,
+		"GET /drone/all":                                    readers,
+		"POST /drone/{serial_number}/state":                 {auth.RoleOperator},
+		"POST /drone/{serial_number}/stops/next":            {auth.RoleOperator},
+		"DELETE /drone/{serial_number}/medications":         {auth.RolePharmacist},
+		"DELETE /drone/{serial_number}/medications/{code}":  {auth.RolePharmacist},
+		"POST /missions":                                    {auth.RolePharmacist},
+		"GET /missions":                                     readers,
+		"GET /missions/{id}":                                readers,
+		"POST /missions/{id}/start":                         {auth.RoleOperator},
+		"POST /missions/{id}/stops/next":                    {auth.RoleOperator},
+		"POST /missions/{id}/complete":                      {auth.RoleOperator},
+		"POST /missions/{id}/abort":                         {auth.RoleOperator},
+		"POST /missions/{id}/return":                        {auth.RoleOperator},
+		"POST /dispatch/plan":                               {auth.RoleOperator, auth.RolePharmacist},
+		"POST /webhooks":                                    {auth.RoleOperator},
+		"GET /webhooks":                                     {auth.RoleOperator},
+		"GET /webhooks/dead-letters":                        {auth.RoleOperator},
+		"GET /webhooks/{id}":                                {auth.RoleOperator},
+		"DELETE /webhooks/{id}":                             {auth.RoleOperator},
+		"POST /medications":                                 {auth.RolePharmacist},
+		"GET /medications":                                  readers,
+		"GET /medications/{code}":                           readers,
+		"PUT /medications/{code}/stock":                     {auth.RolePharmacist},
+		"POST /medications/{code}/image":                    {auth.RolePharmacist},
+		"GET /medications/{code}/image":                     readers,
+		"GET /events":                                       readers,
+		"GET /events/ws":                                    readers,
+		"POST /telemetry":                                   {auth.RoleDevice},
+		"POST /telemetry/batch":                             {auth.RoleDevice},
+		"POST /geofences":                                   {auth.RoleOperator},
+		"GET /geofences":                                    readers,
+		"POST /geofences/check":                             readers,
+		"GET /geofences/{id}":                               readers,
+		"PUT /geofences/{id}":                               {auth.RoleOperator},
+		"DELETE /geofences/{id}":                            {auth.RoleOperator},
+		"POST /routes/plan":                                 readers,
+		"POST /stations":                                    {auth.RoleOperator},
+		"GET /stations":                                     readers,
+		"GET /stations/{id}":                                readers,
+		"DELETE /stations/{id}":                             {auth.RoleOperator},
+		"GET /models":                                       readers,
+		"GET /models/{name}":                                readers,
+		"GET /audit":                                        {auth.RoleOperator, auth.RolePharmacist},
+		"GET /audit/verify":                                 {auth.RoleOperator, auth.RolePharmacist},
+	}
+
+	//routes that accept a bearer token in the query, since their clients in browsers (EventSource and WebSocket) can not set headers
+	queryTokenRoutes = map[string]bool{
+		"GET /events":    true,
+		"GET /events/ws": true,
+	}
+)
+
+//middleware that authenticates every request and checks that the role of its client is allowed on the route
+func (env *environment) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		route := routeOf(r)
+
+		principal, err := env.auth.Authenticate(r)
+		if errors.Is(err, auth.ErrNoCredentials) && queryTokenRoutes[route] {
+			principal, err = env.auth.AuthenticateQuery(r)
+		}
+		if err != nil {
+			errMessage := fmt.Sprintf("request %s %s is not authenticated: %s", r.Method, r.URL.Path, err.Error())
+			log.Println(errMessage)
+			if errors.Is(err, auth.ErrNoCredentials) {
+				errMessage = "credentials are required (an API key or a bearer token)"
+			} else {
+				errMessage = "credentials are not valid"
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="drones"`)
+			writeError(w, http.StatusUnauthorized, errMessage)
+			return
+		}
+
+		if !principal.HasRole(routePermissions[route]...) {
+			errMessage := fmt.Sprintf("%s (%s) is not allowed to call %s", principal.Subject, principal.Role, route)
+			log.Println(errMessage)
+			writeError(w, http.StatusForbidden, errMessage)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+	})
+}
+
+//get the method and the path template of the route matched by a request
+func routeOf(r *http.Request) string {
+
+	template := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if t, err := route.GetPathTemplate(); err == nil {
+			template = t
+		}
+	}
+
+	return permissionKey(r.Method, template)
+}
+
+//get the key of a route in the permissions
+func permissionKey(method string, template string) string {
+	return method + " " + strings.TrimPrefix(template, apiV1Prefix)
+}
+
+//log the routes of the router that have no permissions (they are forbidden to everyone)
+func (env *environment) checkRoutePermissions() {
+	for _, v := range env.routeKeys() {
+		if _, ok := routePermissions[v]; !ok {
+			log.Printf("route %s has no permissions, so it is forbidden to everyone", v)
+		}
+	}
+}
+
+//get the keys in the permissions of every route of the router
+func (env *environment) routeKeys() []string {
+
+	keys := make([]string, 0)
+	_ = env.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		for _, v := range methods {
+			keys = append(keys, permissionKey(v, template))
+		}
+		return nil
+	})
+
+	return keys
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"drones/pkg/auth"
+	"drones/pkg/config"
+)
+
+//secret of the JWTs of the tests of the authentication
+var testJWTKey = auth.JWTKey{ID: "2026-10", Secret: "test-secret-0123456789"}
+
+//send a request with the given headers to a test server, getting the status code and the headers of the response
+//(the body is not read, so streams of events are closed once their headers are received)
+func sendRequestWithHeaders(t *testing.T, server *httptest.Server, method string, path string, headers map[string]string, body string) (int, http.Header) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("error while creating request %s %s:%v", method, path, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		request.Header.Set(k, v)
+	}
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatalf("error while sending request %s %s:%v", method, path, err)
+	}
+	defer response.Body.Close()
+
+	return response.StatusCode, response.Header
+}
+
+//get a token of a client signed with the key of the tests
+func testToken(t *testing.T, subject string, role string) string {
+
+	token, err := auth.SignToken(testJWTKey, auth.Claims{Subject: subject, Role: role, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("error while signing token for test:%v", err)
+	}
+
+	return token
+}
+
+func Test_routePermissions(t *testing.T) {
+
+	env := &environment{Config: &config.Config{}}
+	env.newRouter()
+
+	routes := make(map[string]bool)
+	for _, v := range env.routeKeys() {
+		routes[v] = true
+		if _, ok := routePermissions[v]; !ok {
+			t.Errorf("route %s must have permissions", v)
+		}
+	}
+
+	for k, v := range routePermissions {
+		if !routes[k] {
+			t.Errorf("permissions of %s must be of a route of the router", k)
+		}
+		if len(v) == 0 {
+			t.Errorf("route %s must allow some role", k)
+		}
+		for _, role := range v {
+			if !auth.IsValidRole(role) {
+				t.Errorf("route %s allows a role that is not valid: %s", k, role)
+			}
+		}
+	}
+
+	for k := range queryTokenRoutes {
+		if _, ok := routePermissions[k]; !ok {
+			t.Errorf("route %s that accepts a token in the query must have permissions", k)
+		}
+	}
+}
+
+func Test_authenticate(t *testing.T) {
+
+	server := newTestServer(t, fmt.Sprintf(`, "auth_enabled":true, "api_keys":[{"key":"op-key-0123456789","name":"ops","role":"operator"},{"key":"viewer-key-0123456789","name":"dashboard","role":"viewer"}], "jwt_keys":[{"id":%q,"secret":%q}]`,
+		testJWTKey.ID, testJWTKey.Secret))
+
+	operator := map[string]string{auth.APIKeyHeader: "op-key-0123456789"}
+	viewer := map[string]string{auth.APIKeyHeader: "viewer-key-0123456789"}
+	viewerToken := testToken(t, "dashboard", auth.RoleViewer)
+	device := map[string]string{auth.AuthorizationHeader: "Bearer " + testToken(t, "DRONE-1", auth.RoleDevice)}
+
+	for _, v := range []string{"DRONE-1", "DRONE-2"} {
+		body := fmt.Sprintf(`{"serial_number":%q,"model":"Lightweight","weight_limit":100,"battery_capacity":90,"state":"IDLE"}`, v)
+		if status, _ := sendRequestWithHeaders(t, server, "POST", "/api/v1/drones", operator, body); status != http.StatusCreated {
+			t.Fatalf("operator must register drone %s but status was %d", v, status)
+		}
+	}
+
+	status, header := sendRequestWithHeaders(t, server, "GET", "/drone/all", nil, "")
+	if status != http.StatusUnauthorized || header.Get("WWW-Authenticate") == "" {
+		t.Errorf("a request without credentials must be refused with 401 and a challenge but status was %d", status)
+	}
+
+	reading := func(serialNumber string) string {
+		return fmt.Sprintf(`{"serial_number":%q,"timestamp":%q,"battery_capacity":80}`, serialNumber, time.Now().UTC().Format(time.RFC3339))
+	}
+
+	steps := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		body    string
+		status  int
+	}{
+		{"unknown API key", "GET", "/drone/all", map[string]string{auth.APIKeyHeader: "unknown-key-0123456789"}, "", http.StatusUnauthorized},
+		{"malformed bearer token", "GET", "/drone/all", map[string]string{auth.AuthorizationHeader: "Bearer not-a-token"}, "", http.StatusUnauthorized},
+		{"viewer reading drones", "GET", "/drone/all", viewer, "", http.StatusOK},
+		{"viewer reading drones with a token", "GET", "/api/v1/drones", map[string]string{auth.AuthorizationHeader: "Bearer " + viewerToken}, "", http.StatusOK},
+		{"viewer registering a drone", "POST", "/drone/register", viewer, `{}`, http.StatusForbidden},
+		{"token in the query of a route that does not accept it", "GET", "/drone/all?" + auth.TokenParameter + "=" + viewerToken, nil, "", http.StatusUnauthorized},
+		{"token in the query of the events", "GET", "/events?" + auth.TokenParameter + "=" + viewerToken, nil, "", http.StatusOK},
+		{"token in the query of the versioned events", "GET", "/api/v1/events?" + auth.TokenParameter + "=" + viewerToken, nil, "", http.StatusOK},
+		{"malformed token in the query of the events", "GET", "/events?" + auth.TokenParameter + "=not-a-token", nil, "", http.StatusUnauthorized},
+		{"drone device reading the events", "GET", "/events?" + auth.TokenParameter + "=" + testToken(t, "DRONE-1", auth.RoleDevice), nil, "", http.StatusForbidden},
+		{"drone device reporting its readings", "POST", "/telemetry", device, reading("DRONE-1"), http.StatusOK},
+		{"drone device reporting the readings of another drone", "POST", "/telemetry", device, reading("DRONE-2"), http.StatusForbidden},
+		{"operator reporting readings", "POST", "/telemetry", operator, reading("DRONE-1"), http.StatusForbidden},
+	}
+	for _, v := range steps {
+		if status, _ := sendRequestWithHeaders(t, server, v.method, v.path, v.headers, v.body); status != v.status {
+			t.Errorf("%s must return %d but returned %d", v.name, v.status, status)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/catalog"
+)
+
+//add the routes of the catalog of medications to a router
+func (env *environment) addCatalogRoutes(router *mux.Router) {
+	router.HandleFunc("/medications", env.registerMedication).Methods("POST")
+	router.HandleFunc("/medications", env.getAllMedications).Methods("GET")
+	router.HandleFunc("/medications/{code}", env.getMedication).Methods("GET")
+	router.HandleFunc("/medications/{code}/stock", env.setStockOfMedication).Methods("PUT")
+}
+
+//http handler to register a new medication in the catalog
+func (env *environment) registerMedication(w http.ResponseWriter, r *http.Request) {
+
+	dto := catalog.EntryDTO{}
+
+	err := json.NewDecoder(r.Body).Decode(&dto)
+	if err != nil {
+		errMessage := "could not decode medication json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	if _, ok := env.catalog.Get(dto.Code); ok {
+		errMessage := fmt.Sprintf("medication with code %s is already registered", dto.Code)
+		log.Println(errMessage)
+		writeError(w, http.StatusConflict, errMessage)
+		return
+	}
+
+	err = env.catalog.Register(dto)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not register medication: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	writeCreated(w, "/medications/"+dto.Code)
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("new medication with code %s registered", dto.Code),
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("new medication registered: %s (%s, %d gr, %d units)", dto.Code, dto.Name, dto.Weight, dto.Stock)
+}
+
+//http handler to get all medications of the catalog
+func (env *environment) getAllMedications(w http.ResponseWriter, r *http.Request) {
+
+	medications := env.catalog.GetAll()
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:          true,
+		Details:     fmt.Sprintf("this are the %d medications of the catalog", len(medications)),
+		Medications: medications,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to get a medication of the catalog
+func (env *environment) getMedication(w http.ResponseWriter, r *http.Request) {
+
+	code := mux.Vars(r)["code"]
+	dto, ok := env.catalog.Get(code)
+	if !ok {
+		errMessage := fmt.Sprintf("medication with code '%s' was not found", code)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:          true,
+		Details:     fmt.Sprintf("this is the medication with code %s", code),
+		Medications: []catalog.EntryDTO{dto},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to set the units available of a medication of the catalog
+func (env *environment) setStockOfMedication(w http.ResponseWriter, r *http.Request) {
+
+	code := mux.Vars(r)["code"]
+	if _, ok := env.catalog.Get(code); !ok {
+		errMessage := fmt.Sprintf("medication with code '%s' was not found", code)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	dto := catalog.EntryDTO{}
+
+	err := json.NewDecoder(r.Body).Decode(&dto)
+	if err != nil {
+		errMessage := "could not decode medication json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	err = env.catalog.SetStock(code, dto.Stock)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not set stock of medication: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("stock of medication with code %s set to %d units", code, dto.Stock),
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("stock of medication %s set to %d units", code, dto.Stock)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/audit"
+	"drones/pkg/auth"
+	"drones/pkg/catalog"
+	"drones/pkg/client"
+	"drones/pkg/config"
+	"drones/pkg/drone"
+	"drones/pkg/events"
+	"drones/pkg/geofence"
+	"drones/pkg/history"
+	"drones/pkg/imagestore"
+	"drones/pkg/medication"
+	"drones/pkg/openapi"
+	"drones/pkg/repository"
+	"drones/pkg/station"
+	"drones/pkg/telemetry"
+	"drones/pkg/webhook"
+)
+
+//get a server of the real router, with its files in a temporary directory and the given settings of the config
+func newTestServer(t *testing.T, settings string) *httptest.Server {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	data := fmt.Sprintf(`{
+		"data_file":%q, "catalog_file":%q, "images_dir":%q, "battery_history_file":%q, "webhooks_file":%q,
+		"geofences_file":%q, "stations_file":%q, "audit_file":%q, "home_base":{"latitude":40.4168,"longitude":-3.7038}%s
+	}`, filepath.Join(dir, "drones.jsonl"), filepath.Join(dir, "catalog.json"), filepath.Join(dir, "images"), filepath.Join(dir, "history.jsonl"),
+		filepath.Join(dir, "webhooks.json"), filepath.Join(dir, "geofences.geojson"), filepath.Join(dir, "stations.json"), filepath.Join(dir, "audit.jsonl"), settings)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("error while writing config for test:%v", err)
+	}
+
+	cfg, err := config.Parse(path)
+	if err != nil {
+		t.Fatalf("error while parsing config for test:%v", err)
+	}
+
+	env := environment{
+		Config:           cfg,
+		registeredDrones: make(map[string]*drone.Drone),
+		events:           events.NewBus(),
+		telemetry:        telemetry.NewIngestor(time.Minute),
+	}
+
+	if cfg.AuthEnabled {
+		env.auth, err = auth.NewAuthenticator(cfg.APIKeys, cfg.JWTKeys)
+		if err != nil {
+			t.Fatalf("error while creating authenticator for test:%v", err)
+		}
+	}
+	if env.images, err = imagestore.NewStore(cfg.ImagesDir, 1024*1024); err != nil {
+		t.Fatalf("error while creating image store for test:%v", err)
+	}
+	if env.repository, err = repository.NewFileRepository(cfg.DataFile); err != nil {
+		t.Fatalf("error while creating repository for test:%v", err)
+	}
+	if env.catalog, err = catalog.NewCatalog(cfg.CatalogFile, env.imageReference); err != nil {
+		t.Fatalf("error while creating catalog for test:%v", err)
+	}
+	if env.geofences, err = geofence.NewStore(cfg.GeofencesFile); err != nil {
+		t.Fatalf("error while creating geofences for test:%v", err)
+	}
+	if env.stations, err = station.NewManager(cfg.StationsFile); err != nil {
+		t.Fatalf("error while creating stations for test:%v", err)
+	}
+	if env.audit, err = audit.NewLog(cfg.AuditFile); err != nil {
+		t.Fatalf("error while creating audit log for test:%v", err)
+	}
+	if env.batteryHistory, err = history.NewBatteryHistory(10, cfg.BatteryHistoryFile); err != nil {
+		t.Fatalf("error while creating battery history for test:%v", err)
+	}
+	if env.webhooks, err = webhook.NewDispatcher(cfg.WebhooksFile, 1, time.Second); err != nil {
+		t.Fatalf("error while creating webhooks for test:%v", err)
+	}
+
+	server := httptest.NewServer(env.newRouter())
+	t.Cleanup(func() {
+		server.Close()
+		env.repository.Close()
+		env.batteryHistory.Close()
+		env.audit.Close()
+	})
+
+	return server
+}
+
+func Test_Client(t *testing.T) {
+
+	server := newTestServer(t, "")
+	c := client.New(server.URL)
+	ctx := context.Background()
+
+	for i, v := range []uint8{90, 40, 70} {
+		dto, err := c.RegisterDrone(ctx, drone.DroneDTO{SerialNumber: fmt.Sprintf("DRONE-%d", i+1), Model: drone.ModelCruiserweight, WeightLimit: 350, BatteryCapacity: v, State: drone.StateIdle})
+		if err != nil || dto.SerialNumber != fmt.Sprintf("DRONE-%d", i+1) {
+			t.Fatalf("drone must be registered but it was %+v (%v)", dto, err)
+		}
+	}
+
+	apiErr := &client.Error{}
+	if _, err := c.RegisterDrone(ctx, drone.DroneDTO{SerialNumber: "DRONE-1", Model: drone.ModelCruiserweight, WeightLimit: 350, BatteryCapacity: 90, State: drone.StateIdle}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("a drone that already exists must be a conflict but error was %v", err)
+	}
+	if _, err := c.GetDrone(ctx, "DRONE-9"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("a drone that does not exist must not be found but error was %v", err)
+	}
+
+	loaded, err := c.LoadMedications(ctx, "DRONE-1", []medication.MedicationDTO{{Name: "dipirona", Weight: 110, Code: "DIP_10"}}, nil)
+	if err != nil || len(loaded.Medications) != 1 {
+		t.Fatalf("medications must be loaded but drone was %+v (%v)", loaded, err)
+	}
+
+	_, err = c.LoadMedications(ctx, "DRONE-1", []medication.MedicationDTO{{Name: "paracetamol", Weight: 300, Code: "PAR_1"}}, nil)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity || len(apiErr.Rejected) != 1 {
+		t.Errorf("medications over the weight limit must be rejected but error was %v", err)
+	}
+
+	medications, err := c.GetMedications(ctx, "DRONE-1")
+	if err != nil || len(medications) != 1 || medications[0].Code != "DIP_10" {
+		t.Errorf("medications of DRONE-1 must be returned but they were %+v (%v)", medications, err)
+	}
+
+	battery, err := c.GetBattery(ctx, "DRONE-2")
+	if err != nil || battery != 40 {
+		t.Errorf("battery of DRONE-2 must be 40 but it was %d (%v)", battery, err)
+	}
+
+	//every drone is listed once, page by page
+	serialNumbers := make([]string, 0)
+	options := client.ListOptions{Limit: 2, Sort: "-battery"}
+	for {
+		drones, page, err := c.ListDrones(ctx, options)
+		if err != nil || page.Total != 3 {
+			t.Fatalf("drones must be listed but page was %+v (%v)", page, err)
+		}
+		for _, v := range drones {
+			serialNumbers = append(serialNumbers, v.SerialNumber)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		options.Cursor = page.NextCursor
+	}
+	if fmt.Sprint(serialNumbers) != "[DRONE-1 DRONE-3 DRONE-2]" {
+		t.Errorf("drones must be sorted by battery but they were %v", serialNumbers)
+	}
+
+	hasMedications := false
+	drones, _, err := c.ListDrones(ctx, client.ListOptions{HasMedications: &hasMedications, States: []string{drone.StateIdle}})
+	if err != nil || len(drones) != 2 {
+		t.Errorf("the drones without medications must be listed but they were %+v (%v)", drones, err)
+	}
+
+	unloaded, err := c.UnloadMedications(ctx, "DRONE-1", "")
+	if err != nil || len(unloaded.Medications) != 0 || unloaded.State != drone.StateIdle {
+		t.Errorf("medications must be unloaded but drone was %+v (%v)", unloaded, err)
+	}
+}
+
+func Test_Client_auth(t *testing.T) {
+
+	server := newTestServer(t, `, "auth_enabled":true, "api_keys":[{"key":"op-key-0123456789","name":"ops","role":"operator"},{"key":"viewer-key-0123456789","name":"dashboard","role":"viewer"}]`)
+	ctx := context.Background()
+	apiErr := &client.Error{}
+
+	if _, _, err := client.New(server.URL).ListDrones(ctx, client.ListOptions{}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("a client without credentials must not be authenticated but error was %v", err)
+	}
+
+	viewer := client.New(server.URL, client.WithAPIKey("viewer-key-0123456789"))
+	if _, err := viewer.RegisterDrone(ctx, drone.DroneDTO{SerialNumber: "DRONE-1"}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Errorf("a viewer must not register drones but error was %v", err)
+	}
+
+	operator := client.New(server.URL, client.WithAPIKey("op-key-0123456789"))
+	if _, err := operator.RegisterDrone(ctx, drone.DroneDTO{SerialNumber: "DRONE-1", Model: drone.ModelLightweight, WeightLimit: 100, BatteryCapacity: 90, State: drone.StateIdle}); err != nil {
+		t.Errorf("an operator must register drones: %v", err)
+	}
+	if _, _, err := viewer.ListDrones(ctx, client.ListOptions{}); err != nil {
+		t.Errorf("a viewer must list drones: %v", err)
+	}
+}
+
+func Test_OpenAPIDocument(t *testing.T) {
+
+	server := newTestServer(t, "")
+
+	response, err := http.Get(server.URL + "/openapi.json")
+	if err != nil {
+		t.Fatalf("error while getting OpenAPI document for test:%v", err)
+	}
+	defer response.Body.Close()
+
+	doc := openapi.Document{}
+	if err = json.NewDecoder(response.Body).Decode(&doc); err != nil {
+		t.Fatalf("OpenAPI document must be json: %v", err)
+	}
+
+	if doc.OpenAPI != openapi.Version || len(doc.Paths) == 0 {
+		t.Fatalf("OpenAPI document must have the paths of the api but it was %+v", doc)
+	}
+
+	for _, v := range []string{"DroneDTO", "MedicationDTO", "Response"} {
+		if doc.Components.Schemas[v] == nil {
+			t.Errorf("schema %s must be in the components", v)
+		}
+	}
+
+	create := doc.Paths["/api/v1/drones"]["post"]
+	if _, ok := create.Responses["201"]; !ok || create.RequestBody == nil || create.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/DroneDTO" {
+		t.Errorf("registering a drone must take a DroneDTO and return 201 but it was %+v", create)
+	}
+
+	//every route of the router is documented
+	env := environment{Config: &config.Config{}}
+	_ = env.newRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		for _, v := range methods {
+			if _, ok := routeDocs[permissionKey(v, template)]; !ok {
+				t.Errorf("route %s %s must be documented", v, template)
+			}
+			if _, ok := doc.Paths[template][strings.ToLower(v)]; !ok {
+				t.Errorf("route %s %s must be in the OpenAPI document", v, template)
+			}
+		}
+		return nil
+	})
+}
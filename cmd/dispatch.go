@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/dispatch"
+	"drones/pkg/drone"
+)
+
+//add the routes of the dispatch planning to a router
+func (env *environment) addDispatchRoutes(router *mux.Router) {
+	router.HandleFunc("/dispatch/plan", env.planDispatch).Methods("POST")
+}
+
+//http handler to get which available drones should carry a list of medications
+func (env *environment) planDispatch(w http.ResponseWriter, r *http.Request) {
+
+	request := dispatch.PlanRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		errMessage := "could not decode plan request json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	drones := env.getRegisteredDrones()
+
+	//drones that would fly over a no-fly zone to reach the destination are left out
+	if request.Destination != nil {
+		err = env.geofences.CheckPoint(*request.Destination)
+		if err != nil {
+			writeGeofenceError(w, fmt.Sprintf("destination is not allowed: %s", err.Error()), err)
+			return
+		}
+
+		allowed := make([]*drone.Drone, 0, len(drones))
+		for _, v := range drones {
+			if env.checkFlightOfDrone(v, *request.Destination) == nil {
+				allowed = append(allowed, v)
+			}
+		}
+		drones = allowed
+	}
+
+	plan, err := dispatch.PlanLoad(request, drones)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not plan the dispatch: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	if len(plan.Assignments) == 0 {
+		errMessage := "there is not available drones for loading the medications"
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	details := fmt.Sprintf("medications assigned to %d drones", len(plan.Assignments))
+	if len(plan.Unassigned) > 0 {
+		details += fmt.Sprintf(", %d medications can not be carried by any available drone", len(plan.Unassigned))
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      len(plan.Unassigned) == 0,
+		Details: details,
+		Plan:    &plan,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("dispatch planned: %s", details)
+}
@@ -1,11 +1,11 @@
 // Implements a service via REST API that allows clients to communicate with the drones (i.e. **dispatch controller**).
-// The specific communication with the drone is outside the scope of this app.
+//Drones report their readings through the telemetry endpoints; any other communication with them is outside the scope of this app.
 package main
 
 import (
 	"bufio"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -21,26 +21,78 @@ import (
 	"github.com/Pallinder/go-randomdata"
 	"github.com/gorilla/mux"
 
+	"drones/pkg/audit"
+	"drones/pkg/auth"
+	"drones/pkg/catalog"
 	"drones/pkg/config"
+	"drones/pkg/dispatch"
 	"drones/pkg/drone"
+	"drones/pkg/events"
+	"drones/pkg/geofence"
+	"drones/pkg/history"
+	"drones/pkg/imagestore"
 	"drones/pkg/medication"
+	"drones/pkg/mission"
+	"drones/pkg/query"
+	"drones/pkg/repository"
+	"drones/pkg/route"
+	"drones/pkg/simulation"
+	"drones/pkg/station"
+	"drones/pkg/telemetry"
+	"drones/pkg/webhook"
 )
 
+//interval at which the battery levels changed by the simulation are persisted (a change of state is persisted at once)
+const simulationPersistInterval = time.Minute
+
+//returned when a drone is registered with the serial number of another one
+var errDroneExists = errors.New("drone already exists")
+
 type (
 	//contains all the global variables to use in the app
 	environment struct {
-		HttpServer                *http.Server
-		Router                    *mux.Router
-		Config                    *config.Config
-		registeredDrones          map[string]*drone.Drone // use SerialNumber as key
-		samplMedicationCaseBase64 string
+		HttpServer               *http.Server
+		Router                   *mux.Router
+		Config                   *config.Config
+		registeredDrones         map[string]*drone.Drone // use SerialNumber as key
+		dronesMutex              sync.RWMutex            // protects registeredDrones
+		repository               repository.Repository
+		missions                 map[string]*mission.Mission // use mission id as key
+		missionsMutex            sync.RWMutex                // protects missions
+		batteryHistory           *history.BatteryHistory
+		catalog                  *catalog.Catalog
+		samplMedicationCaseImage string // reference of the sample image in the image store
+		images                   *imagestore.Store
+		events                   *events.Bus
+		webhooks                 *webhook.Dispatcher
+		telemetry                *telemetry.Ingestor
+		geofences                *geofence.Store
+		stations                 *station.Manager
+		auth                     *auth.Authenticator // nil when the authentication is disabled
+		audit                    *audit.Log
+		openAPI                  []byte // json of the OpenAPI document of the routes
 	}
 
 	//a http response body
 	Response struct {
-		OK      bool             `json:"ok"`
-		Details string           `json:"details,omitempty"`
-		Drones  []drone.DroneDTO `json:"drones,omitempty"`
+		OK             bool                       `json:"ok"`
+		Details        string                     `json:"details,omitempty"`
+		Drones         []drone.DroneDTO           `json:"drones,omitempty"`
+		Missions       []mission.MissionDTO       `json:"missions,omitempty"`
+		BatteryHistory []history.Sample           `json:"battery_history,omitempty"`
+		Plan           *dispatch.Plan             `json:"plan,omitempty"`
+		Rejected       []drone.RejectedMedication `json:"rejected,omitempty"` // medications that were not loaded
+		Medications    []catalog.EntryDTO         `json:"medications,omitempty"`
+		Webhooks       []webhook.SubscriptionDTO  `json:"webhooks,omitempty"`
+		DeadLetters    []webhook.DeadLetter       `json:"dead_letters,omitempty"`
+		Telemetry      []telemetry.Result         `json:"telemetry,omitempty"`
+		Geofences      []geofence.Feature         `json:"geofences,omitempty"`
+		Route          *route.Feature             `json:"route,omitempty"` // GeoJSON LineString
+		Stations       []station.StationDTO       `json:"stations,omitempty"`
+		Models         []drone.ModelProfile       `json:"models,omitempty"`
+		Audit          []audit.Entry              `json:"audit,omitempty"`
+		Verification   *audit.Verification        `json:"verification,omitempty"` // of the chain of the audit log
+		Page           *query.Page                `json:"page,omitempty"`         // of a list of drones or missions
 	}
 )
 
@@ -61,18 +113,113 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err := drone.RegisterModels(cfg.Models); err != nil {
+		log.Fatalf("error registering the models of the config: %v", err)
+	}
+
+	//the thresholds of the config that are disabled (negative) are not checked
+	thresholds := drone.ServiceThresholds{}
+	if cfg.ServiceFlightHours > 0 {
+		thresholds.FlightHours = cfg.ServiceFlightHours
+	}
+	if cfg.ServiceCycles > 0 {
+		thresholds.Cycles = uint32(cfg.ServiceCycles)
+	}
+	if cfg.ServiceBatteryCycles > 0 {
+		thresholds.BatteryCycles = cfg.ServiceBatteryCycles
+	}
+	drone.SetServiceThresholds(thresholds)
+
 	env := environment{
-		Config: cfg,
+		Config:    cfg,
+		events:    events.NewBus(),
+		telemetry: telemetry.NewIngestor(time.Duration(cfg.TelemetryMaxAgeSeconds) * time.Second),
+	}
+
+	if cfg.AuthEnabled {
+		env.auth, err = auth.NewAuthenticator(cfg.APIKeys, cfg.JWTKeys)
+		if err != nil {
+			log.Fatalf("could not set up authentication: %v", err)
+		}
+	} else {
+		log.Println("authentication is disabled, every route is open")
+	}
+
+	log.Println("opening image store...")
+	env.images, err = imagestore.NewStore(cfg.ImagesDir, int(cfg.MaxImageSizeKB)*1024)
+	if err != nil {
+		log.Fatalf("could not open image store: %v", err)
 	}
 
-	err = env.preloadData()
+	log.Println("opening repository of drones...")
+	repo, err := repository.NewFileRepository(cfg.DataFile)
 	if err != nil {
-		log.Fatalf("preload of data failed: %v", err)
+		log.Fatalf("could not open repository of drones: %v", err)
 	}
-	log.Println("preload of data successfully completed...")
+	env.repository = repo
+
+	err = env.loadRegisteredDrones()
+	if err != nil {
+		log.Fatalf("load of registered drones failed: %v", err)
+	}
+	log.Printf("load of %d registered drones successfully completed...", len(env.registeredDrones))
+
+	log.Println("opening catalog of medications...")
+	env.catalog, err = catalog.NewCatalog(cfg.CatalogFile, env.imageReference)
+	if err != nil {
+		log.Fatalf("could not open catalog of medications: %v", err)
+	}
+
+	log.Println("opening geofences...")
+	env.geofences, err = geofence.NewStore(cfg.GeofencesFile)
+	if err != nil {
+		log.Fatalf("could not open geofences: %v", err)
+	}
+	//the drones do not fly over the no-fly zones on any leg of their rounds
+	drone.SetLegCheck(env.geofences.CheckFlight)
+
+	log.Println("opening charging stations...")
+	env.stations, err = station.NewManager(cfg.StationsFile)
+	if err != nil {
+		log.Fatalf("could not open charging stations: %v", err)
+	}
+	//the stations must not miss a drone that is back to base, so their subscription does not drop events
+	stationEvents := env.events.SubscribeLossless(events.Filter{Types: []string{events.TypeStateChanged, events.TypeBatteryUpdated}})
+	go env.stations.Run(stationEvents.Events())
+
+	log.Println("opening audit log...")
+	env.audit, err = audit.NewLog(cfg.AuditFile)
+	if err != nil {
+		log.Fatalf("could not open audit log: %v", err)
+	}
+
+	log.Println("opening battery history...")
+	env.batteryHistory, err = history.NewBatteryHistory(cfg.BatteryHistorySize, cfg.BatteryHistoryFile)
+	if err != nil {
+		log.Fatalf("could not open battery history: %v", err)
+	}
+
+	log.Println("opening webhooks...")
+	env.webhooks, err = webhook.NewDispatcher(cfg.WebhooksFile, int(cfg.WebhookMaxAttempts), time.Duration(cfg.WebhookBackoffSeconds)*time.Second)
+	if err != nil {
+		log.Fatalf("could not open webhooks: %v", err)
+	}
+	//a receiver must not miss a delivery or a low battery, so the webhooks do not drop the events that they notify either
+	//(registrations are kept because a drone may be registered with its battery already low)
+	webhookEvents := env.events.SubscribeLossless(events.Filter{Types: []string{events.TypeDroneRegistered, events.TypeMedicationsLoaded,
+		events.TypeStateChanged, events.TypeBatteryUpdated}})
+	go env.webhooks.Run(webhookEvents.Events())
 
 	go env.checkDronesBatteryLevelsPeriodically()
 
+	stopSimulation := make(chan struct{})
+	simulationDone := make(chan struct{})
+	if cfg.SimulationEnabled {
+		go env.runBatterySimulation(stopSimulation, simulationDone)
+	} else {
+		close(simulationDone)
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 	//capturing signal of closing of the application
@@ -85,6 +232,29 @@ func main() {
 
 	go env.startServer(cfg)
 	wg.Wait()
+	close(stopSimulation)
+	<-simulationDone
+
+	env.events.Unsubscribe(stationEvents)
+
+	//the pending retries of webhooks are kept as dead letters
+	env.events.Unsubscribe(webhookEvents)
+	env.webhooks.Close()
+
+	err = env.repository.Close()
+	if err != nil {
+		log.Printf("could not close repository of drones: %v", err)
+	}
+
+	err = env.batteryHistory.Close()
+	if err != nil {
+		log.Printf("could not close battery history: %v", err)
+	}
+
+	err = env.audit.Close()
+	if err != nil {
+		log.Printf("could not close audit log: %v", err)
+	}
 
 	log.Println("Drones Management API is now closed")
 }
@@ -92,17 +262,8 @@ func main() {
 //start http client
 func (env *environment) startServer(cfg *config.Config) {
 
-	env.Router = mux.NewRouter()
-
-	env.Router.HandleFunc("/drone/register", env.registerDrone).Methods("POST")
-	env.Router.HandleFunc("/drone/load", env.loadMedications).Methods("POST")
-	env.Router.HandleFunc("/drone/medications", env.getMedicationsFromDrone).Methods("GET")
-	env.Router.HandleFunc("/drone/battery", env.getBatteryLevelFromDrone).Methods("GET")
-	env.Router.HandleFunc("/drone/all/availables", env.getDronesAvailablesForLoading).Methods("GET")
-	env.Router.HandleFunc("/drone/all", env.getAllDrones).Methods("GET")
-
 	env.HttpServer = &http.Server{
-		Handler:           env.Router,
+		Handler:           env.newRouter(),
 		Addr:              fmt.Sprintf(":%s", env.Config.ApiPort),
 		WriteTimeout:      60 * time.Second,
 		ReadTimeout:       5 * time.Second,
@@ -113,6 +274,54 @@ func (env *environment) startServer(cfg *config.Config) {
 	log.Fatal(env.HttpServer.ListenAndServe())
 }
 
+//set up the router with every route of the api and its middlewares
+func (env *environment) newRouter() *mux.Router {
+
+	env.Router = mux.NewRouter()
+	env.addOpenAPIRoutes(env.Router)
+
+	//legacy routes of the drones, kept for the clients of the api before it was versioned (with the status codes they returned then)
+	env.Router.Handle("/drone/register", withLegacyStatusCodes(env.registerDrone)).Methods("POST")
+	env.Router.Handle("/drone/load", withLegacyStatusCodes(env.loadMedications)).Methods("POST")
+	env.Router.Handle("/drone/medications", withLegacyStatusCodes(env.getMedicationsFromDrone)).Methods("GET")
+	env.Router.Handle("/drone/battery", withLegacyStatusCodes(env.getBatteryLevelFromDrone)).Methods("GET")
+	env.Router.Handle("/drone/{serial_number}/battery/history", withLegacyStatusCodes(env.getBatteryHistoryOfDrone)).Methods("GET")
+	env.Router.Handle("/drone/all/availables", withLegacyStatusCodes(env.getDronesAvailablesForLoading)).Methods("GET")
+	env.Router.Handle("/drone/all/service", withLegacyStatusCodes(env.getDronesDueForService)).Methods("GET")
+	env.Router.Handle("/drone/all", withLegacyStatusCodes(env.getAllDrones)).Methods("GET")
+	env.Router.Handle("/drone/{serial_number}/state", withLegacyStatusCodes(env.changeStateOfDrone)).Methods("POST")
+	env.Router.Handle("/drone/{serial_number}/stops/next", withLegacyStatusCodes(env.deliverNextStopOfDrone)).Methods("POST")
+	env.Router.Handle("/drone/{serial_number}/medications", withLegacyStatusCodes(env.unloadAllMedicationsFromDrone)).Methods("DELETE")
+	env.Router.Handle("/drone/{serial_number}/medications/{code}", withLegacyStatusCodes(env.unloadMedicationsByCodeFromDrone)).Methods("DELETE")
+
+	v1 := env.addAPIv1Routes()
+
+	//the other resources are served both in the versioned api and in the legacy routes
+	for _, router := range []*mux.Router{v1, env.Router} {
+		env.addMissionRoutes(router)
+		env.addDispatchRoutes(router)
+		env.addWebhookRoutes(router)
+		env.addCatalogRoutes(router)
+		env.addImageRoutes(router)
+		env.addEventRoutes(router)
+		env.addTelemetryRoutes(router)
+		env.addGeofenceRoutes(router)
+		env.addRoutePlanningRoutes(router)
+		env.addStationRoutes(router)
+		env.addModelRoutes(router)
+		env.addAuditRoutes(router)
+	}
+
+	env.Router.Use(withRequestID)
+	if env.auth != nil {
+		env.checkRoutePermissions()
+		env.Router.Use(env.authenticate)
+	}
+	env.setUpOpenAPIDocument()
+
+	return env.Router
+}
+
 //http handler to register a new drone
 func (env *environment) registerDrone(w http.ResponseWriter, r *http.Request) {
 	d := drone.DroneDTO{}
@@ -125,7 +334,7 @@ func (env *environment) registerDrone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	droneObj, err := drone.NewDrone(d)
+	droneObj, err := env.newDroneOfRequest(d)
 	if err != nil {
 		errMessage := fmt.Sprintf("could not obtain drone object from dto: %s", err.Error())
 		log.Println(errMessage)
@@ -133,7 +342,7 @@ func (env *environment) registerDrone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = env.addNewDrone(droneObj)
+	err = env.registerNewDrone(r, droneObj)
 	if err != nil {
 		errMessage := fmt.Sprintf("could not add new drone: %s", err.Error())
 		log.Println(errMessage)
@@ -174,11 +383,9 @@ func (env *environment) loadMedications(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = env.setLoadForDrone(dto)
+	err = env.loadDrone(r, dto)
 	if err != nil {
-		errMessage := fmt.Sprintf("error while trying to load medications on drone: %s", err.Error())
-		log.Println(errMessage)
-		writeError(w, http.StatusBadRequest, errMessage)
+		writeLoadError(w, fmt.Sprintf("error while trying to load medications on drone: %s", err.Error()), err, http.StatusBadRequest)
 		return
 	}
 
@@ -210,7 +417,7 @@ func (env *environment) getMedicationsFromDrone(w http.ResponseWriter, r *http.R
 	}
 
 	serialNumber := k[0]
-	droneObj := env.registeredDrones[serialNumber]
+	droneObj := env.getDrone(serialNumber)
 	if droneObj == nil {
 		errMessage := fmt.Sprintf("drone with serial number '%s' was not found", serialNumber)
 		log.Println(errMessage)
@@ -260,7 +467,7 @@ func (env *environment) getBatteryLevelFromDrone(w http.ResponseWriter, r *http.
 	}
 
 	serialNumber := k[0]
-	droneObj := env.registeredDrones[serialNumber]
+	droneObj := env.getDrone(serialNumber)
 	if droneObj == nil {
 		errMessage := fmt.Sprintf("drone with serial number '%s' was not found", serialNumber)
 		log.Println(errMessage)
@@ -289,30 +496,94 @@ func (env *environment) getBatteryLevelFromDrone(w http.ResponseWriter, r *http.
 
 }
 
-//http handler to get all drones availables for loading
-func (env *environment) getDronesAvailablesForLoading(w http.ResponseWriter, r *http.Request) {
+//http handler to get the battery levels recorded for a drone between the optional parameters 'from' and 'to' (RFC 3339)
+func (env *environment) getBatteryHistoryOfDrone(w http.ResponseWriter, r *http.Request) {
 
-	drones := make([]drone.DroneDTO, 0)
+	serialNumber := mux.Vars(r)["serial_number"]
+	droneObj := env.getDrone(serialNumber)
+	if droneObj == nil {
+		errMessage := fmt.Sprintf("drone with serial number '%s' was not found", serialNumber)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
 
-	for _, v := range env.registeredDrones {
+	limits := make(map[string]time.Time)
+	for _, parameter := range []string{"from", "to"} {
+		value := r.URL.Query().Get(parameter)
+		if value == "" {
+			continue
+		}
+		limit, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errMessage := fmt.Sprintf("parameter '%s' must be a RFC 3339 date: %s", parameter, err.Error())
+			log.Println(errMessage)
+			writeError(w, http.StatusBadRequest, errMessage)
+			return
+		}
+		limits[parameter] = limit
+	}
+
+	samples := env.batteryHistory.Get(serialNumber, limits["from"], limits["to"])
+
+	//samples in which the drone was LOADING with a battery level below the allowed one
+	violations := 0
+	for _, v := range samples {
+		if v.State == drone.StateLoading && v.BatteryCapacity < drone.MinBatteryLevelForLoading {
+			violations++
+		}
+	}
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:             true,
+		Details:        fmt.Sprintf("this are the %d battery levels recorded for drone with serial number %s (%d of them LOADING below %d %%)", len(samples), serialNumber, violations, drone.MinBatteryLevelForLoading),
+		BatteryHistory: samples,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("battery history of drone %s: %d samples", serialNumber, len(samples))
+}
+
+//http handler to get the drones availables for loading, filtered, sorted and paged by the parameters of the request
+func (env *environment) getDronesAvailablesForLoading(w http.ResponseWriter, r *http.Request) {
+
+	availables := make([]*drone.Drone, 0)
+	for _, v := range env.getRegisteredDrones() {
 		if v.IsAvailableForLoading() {
-			drones = append(drones, v.GetDTOWithSerialNumber())
-		} /* else {
-			log.Printf("not available S/N: %s State: %s Battery: %d", v.GetSerialNumber(), v.GetState(), v.GetBatteryCapacity())
-		} */
+			availables = append(availables, v)
+		}
+	}
+
+	list, page, err := env.listDrones(r, availables)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not list drones: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
 	}
 
-	if len(drones) == 0 {
+	if page.Total == 0 {
 		errMessage := "there is not available drones for loading"
 		log.Println(errMessage)
 		writeError(w, http.StatusNotFound, errMessage)
 		return
 	}
 
-	err := json.NewEncoder(w).Encode(Response{
+	drones := make([]drone.DroneDTO, 0, len(list))
+	for _, v := range list {
+		drones = append(drones, drone.DroneDTO{SerialNumber: v.SerialNumber})
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
 		OK:      true,
-		Details: fmt.Sprintf("this are the %d available drones for loading", len(drones)),
+		Details: fmt.Sprintf("this are %d of the %d available drones for loading", len(drones), page.Total),
 		Drones:  drones,
+		Page:    &page,
 	})
 	if err != nil {
 		errMessage := "could not encode response"
@@ -330,16 +601,56 @@ func (env *environment) getDronesAvailablesForLoading(w http.ResponseWriter, r *
 
 }
 
-//http handler to get all registered drones
-func (env *environment) getAllDrones(w http.ResponseWriter, r *http.Request) {
+//http handler to get the drones due for service, with their usage and the reasons
+func (env *environment) getDronesDueForService(w http.ResponseWriter, r *http.Request) {
 
-	drones := make([]drone.DroneDTO, 0)
+	due := make([]*drone.Drone, 0)
+	for _, v := range env.getRegisteredDrones() {
+		if len(v.ServiceDue()) > 0 {
+			due = append(due, v)
+		}
+	}
 
-	for _, v := range env.registeredDrones {
-		drones = append(drones, v.GetDTO())
+	list, page, err := env.listDrones(r, due)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not list drones: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
 	}
 
-	err := json.NewEncoder(w).Encode(drones)
+	drones := make([]drone.DroneDTO, 0, len(list))
+	for _, v := range list {
+		drones = append(drones, drone.DroneDTO{SerialNumber: v.SerialNumber, State: v.State, Usage: v.Usage, ServiceDue: v.ServiceDue})
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("this are %d of the %d drones due for service", len(drones), page.Total),
+		Drones:  drones,
+		Page:    &page,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to get all registered drones, or a page of them when the client gives a limit (in the headers of the response)
+func (env *environment) getAllDrones(w http.ResponseWriter, r *http.Request) {
+
+	drones, page, err := env.listDrones(r, env.getRegisteredDrones())
+	if err != nil {
+		errMessage := fmt.Sprintf("could not list drones: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	writePageHeaders(w, page)
+	err = json.NewEncoder(w).Encode(drones)
 	if err != nil {
 		errMessage := "could not encode response"
 		log.Println(errMessage, ":", err)
@@ -350,15 +661,332 @@ func (env *environment) getAllDrones(w http.ResponseWriter, r *http.Request) {
 	env.printDataOfDrones(drones)
 }
 
-//add a new drone to the list of registered drones
+//http handler to move a drone to a new state
+func (env *environment) changeStateOfDrone(w http.ResponseWriter, r *http.Request) {
+
+	serialNumber := mux.Vars(r)["serial_number"]
+	droneObj := env.getDrone(serialNumber)
+	if droneObj == nil {
+		errMessage := fmt.Sprintf("drone with serial number '%s' was not found", serialNumber)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	dto := drone.DroneDTO{}
+
+	err := json.NewDecoder(r.Body).Decode(&dto)
+	if err != nil {
+		errMessage := "could not decode drone json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	//a drone held by a mission is only changed by the mission
+	env.missionsMutex.RLock()
+	defer env.missionsMutex.RUnlock()
+	if env.writeHeldByMission(w, serialNumber) {
+		return
+	}
+
+	previousState := droneObj.GetState()
+	before := snapshotOfDrone(droneObj)
+
+	//the stops of the round are ordered from where the drone departs, with the payload it departs with
+	if dto.State == drone.StateDelivering && previousState == drone.StateLoaded {
+		err = droneObj.Depart()
+	} else {
+		err = droneObj.Transition(dto.State)
+	}
+	if err != nil {
+		errMessage := fmt.Sprintf("could not change state of drone: %s", err.Error())
+		//a leg over a no-fly zone is refused with the offending zone
+		if errors.As(err, new(*geofence.ViolationError)) {
+			writeGeofenceError(w, errMessage, err)
+			return
+		}
+		log.Println(errMessage)
+		writeError(w, http.StatusConflict, errMessage)
+		return
+	}
+
+	env.publishStateChange(droneObj, previousState)
+	env.recordAudit(r, audit.ActionStateChange, "", before, droneObj)
+
+	err = env.persistDrone(droneObj)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not persist new state of drone: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("drone with serial number %s moved from %s to %s", serialNumber, previousState, droneObj.GetState()),
+		Drones:  []drone.DroneDTO{droneObj.GetDTOWithSerialNumberAndState()},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("drone %s moved from %s to %s", serialNumber, previousState, droneObj.GetState())
+}
+
+//http handler to drop off the medications of the next stop of the round of a drone
+func (env *environment) deliverNextStopOfDrone(w http.ResponseWriter, r *http.Request) {
+
+	serialNumber := mux.Vars(r)["serial_number"]
+	droneObj := env.getDrone(serialNumber)
+	if droneObj == nil {
+		errMessage := fmt.Sprintf("drone with serial number '%s' was not found", serialNumber)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	//a drone held by a mission is only changed by the mission
+	env.missionsMutex.RLock()
+	defer env.missionsMutex.RUnlock()
+	if env.writeHeldByMission(w, serialNumber) {
+		return
+	}
+
+	before := snapshotOfDrone(droneObj)
+
+	stop, err := droneObj.DeliverNextStop()
+	if err != nil {
+		errMessage := fmt.Sprintf("could not deliver the next stop of drone: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusConflict, errMessage)
+		return
+	}
+
+	env.publishEvent(events.TypeMedicationsUnloaded, droneObj)
+	env.recordAudit(r, audit.ActionDeliverStop, "", before, droneObj)
+
+	err = env.persistDrone(droneObj)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not persist delivery of drone: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	dto := droneObj.GetDTOWithSerialNumberStateAndMedications()
+	dto.Round = droneObj.GetRound()
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("%d medications dropped off by drone with serial number %s", len(stop.Medications), serialNumber),
+		Drones:  []drone.DroneDTO{dto},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("%d medications dropped off by drone %s", len(stop.Medications), serialNumber)
+}
+
+//http handler to unload all medications from a drone
+func (env *environment) unloadAllMedicationsFromDrone(w http.ResponseWriter, r *http.Request) {
+	env.unloadMedicationsFromDrone(w, r, func(droneObj *drone.Drone) ([]medication.Medication, error) {
+		return droneObj.UnloadAll()
+	})
+}
+
+//http handler to unload from a drone the medications with a code
+func (env *environment) unloadMedicationsByCodeFromDrone(w http.ResponseWriter, r *http.Request) {
+	code := mux.Vars(r)["code"]
+	env.unloadMedicationsFromDrone(w, r, func(droneObj *drone.Drone) ([]medication.Medication, error) {
+		return droneObj.UnloadByCode(code)
+	})
+}
+
+//unload medications from the drone of the request and write the response
+func (env *environment) unloadMedicationsFromDrone(w http.ResponseWriter, r *http.Request, unload func(*drone.Drone) ([]medication.Medication, error)) {
+
+	serialNumber := mux.Vars(r)["serial_number"]
+	droneObj := env.getDrone(serialNumber)
+	if droneObj == nil {
+		errMessage := fmt.Sprintf("drone with serial number '%s' was not found", serialNumber)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	//a drone held by a mission is only changed by the mission
+	env.missionsMutex.RLock()
+	defer env.missionsMutex.RUnlock()
+	if env.writeHeldByMission(w, serialNumber) {
+		return
+	}
+
+	if !droneObj.HasMedications() {
+		errMessage := fmt.Sprintf("drone with serial number '%s' has not loaded medications", serialNumber)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	if droneObj.GetState() == drone.StateDelivering {
+		errMessage := fmt.Sprintf("medications can not be unloaded from drone with serial number '%s' while it is %s", serialNumber, drone.StateDelivering)
+		log.Println(errMessage)
+		writeError(w, http.StatusConflict, errMessage)
+		return
+	}
+
+	previousState := droneObj.GetState()
+	before := snapshotOfDrone(droneObj)
+
+	unloaded, err := unload(droneObj)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not unload medications from drone: %s", err.Error())
+		log.Println(errMessage)
+		if errors.Is(err, drone.ErrMedicationNotLoaded) {
+			writeError(w, http.StatusNotFound, errMessage)
+			return
+		}
+		//the state of the drone does not allow unloading it
+		writeError(w, http.StatusConflict, errMessage)
+		return
+	}
+
+	//the units of the unloaded medications whose code is registered go back to the stock
+	unloadedDTOs := make([]medication.MedicationDTO, 0, len(unloaded))
+	for _, v := range unloaded {
+		unloadedDTOs = append(unloadedDTOs, v.GetDTO())
+	}
+	err = env.catalog.Release(env.catalog.ItemsOf(unloadedDTOs))
+	if err != nil {
+		log.Printf("stock of medications unloaded from drone %s could not be given back to the catalog: %v", serialNumber, err)
+	}
+
+	env.publishEvent(events.TypeMedicationsUnloaded, droneObj)
+	env.publishStateChange(droneObj, previousState)
+	env.recordAudit(r, audit.ActionUnload, "", before, droneObj)
+
+	err = env.persistDrone(droneObj)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not persist unload of drone: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("%d medications unloaded from drone with serial number %s", len(unloaded), serialNumber),
+		Drones:  []drone.DroneDTO{droneObj.GetDTOWithSerialNumberStateAndMedications()},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("%d medications unloaded from drone %s", len(unloaded), serialNumber)
+}
+
+//get a new drone from the dto of a request: the images of its medications must be in the store,
+//and it gets the home base of the config when it has none
+func (env *environment) newDroneOfRequest(dto drone.DroneDTO) (*drone.Drone, error) {
+
+	err := env.normalizeImages(dto.Medications)
+	if err != nil {
+		return nil, fmt.Errorf("images of medications are not valid: %w", err)
+	}
+
+	if dto.HomeBase == nil {
+		dto.HomeBase = env.Config.HomeBase
+	}
+
+	return drone.NewDrone(dto)
+}
+
+//add a new drone sent in a request to the registered drones, publishing and auditing its registration
+func (env *environment) registerNewDrone(r *http.Request, droneObj *drone.Drone) error {
+
+	err := env.addNewDrone(droneObj)
+	if err != nil {
+		return err
+	}
+
+	env.publishEvent(events.TypeDroneRegistered, droneObj)
+	env.recordAudit(r, audit.ActionRegister, "", nil, droneObj)
+
+	return nil
+}
+
+//load medications sent in a request on a drone, auditing the load
+func (env *environment) loadDrone(r *http.Request, load drone.DroneDTO) error {
+
+	droneObj := env.getDrone(load.SerialNumber)
+	before := snapshotOfDrone(droneObj)
+
+	err := env.setLoadForDrone(load)
+	if err != nil {
+		return err
+	}
+
+	env.recordAudit(r, audit.ActionLoad, "", before, droneObj)
+
+	return nil
+}
+
+//print the error of a load of medications: the rejected medications when they were not valid, the offending zone when
+//a drop-off is inside one, 422 when their images are not valid, and the given status code for any other error (like a state
+//that does not allow loading)
+func writeLoadError(w http.ResponseWriter, errMessage string, err error, otherStatusCode int) {
+
+	log.Println(errMessage)
+
+	loadErr := &drone.LoadError{}
+	catalogErr := &catalog.CatalogError{}
+	violation := &geofence.ViolationError{}
+	switch {
+	case errors.As(err, &loadErr):
+		writeErrorResponse(w, http.StatusUnprocessableEntity, Response{Details: errMessage, Rejected: loadErr.Rejected})
+	case errors.As(err, &catalogErr):
+		response := Response{Details: errMessage}
+		for _, v := range catalogErr.Rejected {
+			response.Rejected = append(response.Rejected, drone.RejectedMedication(v))
+		}
+		writeErrorResponse(w, http.StatusUnprocessableEntity, response)
+	case errors.As(err, &violation):
+		writeGeofenceError(w, errMessage, err)
+	case errors.Is(err, errImagesNotValid):
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+	default:
+		writeError(w, otherStatusCode, errMessage)
+	}
+}
+
+//add a new drone to the list of registered drones (the check of its serial number and the insert are made under the same lock)
 func (env *environment) addNewDrone(droneObj *drone.Drone) error {
 
+	env.dronesMutex.Lock()
+	defer env.dronesMutex.Unlock()
+
 	if env.registeredDrones == nil {
 		env.registeredDrones = make(map[string]*drone.Drone)
 	}
 
 	if env.registeredDrones[droneObj.GetSerialNumber()] != nil {
-		return fmt.Errorf("drone with serial number %s already exists", droneObj.GetSerialNumber())
+		return fmt.Errorf("%w with serial number %s", errDroneExists, droneObj.GetSerialNumber())
+	}
+
+	err := env.persistDrone(droneObj)
+	if err != nil {
+		return err
 	}
 
 	env.registeredDrones[droneObj.GetSerialNumber()] = droneObj
@@ -366,20 +994,189 @@ func (env *environment) addNewDrone(droneObj *drone.Drone) error {
 	return nil
 }
 
+//get a registered drone by its serial number (nil when there is not such drone)
+func (env *environment) getDrone(serialNumber string) *drone.Drone {
+
+	env.dronesMutex.RLock()
+	defer env.dronesMutex.RUnlock()
+
+	return env.registeredDrones[serialNumber]
+}
+
+//get the list of registered drones
+func (env *environment) getRegisteredDrones() []*drone.Drone {
+
+	env.dronesMutex.RLock()
+	defer env.dronesMutex.RUnlock()
+
+	drones := make([]*drone.Drone, 0, len(env.registeredDrones))
+	for _, v := range env.registeredDrones {
+		drones = append(drones, v)
+	}
+
+	return drones
+}
+
+//keep the current data of a drone (state and medications included) in the repository
+func (env *environment) persistDrone(droneObj *drone.Drone) error {
+
+	dto := droneObj.GetDTOWithImages()
+
+	err := env.repository.Save(dto)
+	if err != nil {
+		return fmt.Errorf("could not persist drone with serial number %s: %v", dto.SerialNumber, err)
+	}
+
+	return nil
+}
+
+//load the drones kept in the repository, preloading some sample drones when there is none
+func (env *environment) loadRegisteredDrones() error {
+
+	dtos, err := env.repository.GetAll()
+	if err != nil {
+		return fmt.Errorf("could not read drones from repository: %v", err)
+	}
+
+	if len(dtos) == 0 {
+		log.Println("repository is empty, preloading sample drones...")
+		err = env.preloadData()
+		if err != nil {
+			return fmt.Errorf("preload of data failed: %v", err)
+		}
+
+		for _, v := range env.getRegisteredDrones() {
+			if v.GetHomeBase() == nil && env.Config.HomeBase != nil {
+				err = v.SetHomeBase(*env.Config.HomeBase)
+				if err != nil {
+					return err
+				}
+			}
+			err = env.persistDrone(v)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	env.dronesMutex.Lock()
+	defer env.dronesMutex.Unlock()
+
+	env.registeredDrones = make(map[string]*drone.Drone)
+	for _, v := range dtos {
+		//drones stored before images were kept as references have their images in base64
+		migrated := false
+		for _, m := range v.Medications {
+			migrated = migrated || (m.Image != "" && !imagestore.IsReference(m.Image))
+		}
+
+		//drones stored before they had a home base get the one of the config
+		if v.HomeBase == nil && env.Config.HomeBase != nil {
+			v.HomeBase = env.Config.HomeBase
+			migrated = true
+		}
+
+		err = env.migrateImages(v.Medications)
+		if err != nil {
+			return fmt.Errorf("error while restoring images of drone with serial number %s:%v", v.SerialNumber, err)
+		}
+
+		droneObj, err := drone.RestoreDrone(v)
+		if err != nil {
+			return fmt.Errorf("error while restoring drone with serial number %s:%v", v.SerialNumber, err)
+		}
+		env.registeredDrones[v.SerialNumber] = droneObj
+
+		if migrated {
+			err = env.persistDrone(droneObj)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 //set load for a drone using a DTO with the information of the serial number of the drone and the medications to load
 func (env *environment) setLoadForDrone(load drone.DroneDTO) error {
 
-	if env.registeredDrones[load.SerialNumber] == nil {
+	droneObj := env.getDrone(load.SerialNumber)
+	if droneObj == nil {
 		return fmt.Errorf("there is not a drone with serial number %s", load.SerialNumber)
 	}
+	previousState := droneObj.GetState()
+
+	err := env.normalizeImages(load.Medications)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errImagesNotValid, err)
+	}
+
+	//medications sent with all their data must agree with the catalog when their code is registered
+	err = env.catalog.Check(load.Medications)
+	if err != nil {
+		return err
+	}
+
+	err = env.checkDropOffs(load.Medications)
+	if err != nil {
+		return err
+	}
 
-	return env.registeredDrones[load.SerialNumber].LoadSetOfMedications(load.Medications)
+	//the units of the medications whose code is registered are taken from the stock together with the items,
+	//so either all of them are taken or none is
+	stocked := env.catalog.ItemsOf(load.Medications)
+	items := append(append(make([]medication.ItemDTO, 0), stocked...), load.Items...)
+	medications := load.Medications
+	if len(items) > 0 {
+		reserved, err := env.catalog.Reserve(items)
+		if err != nil {
+			return err
+		}
+		//the medications sent with all their data are loaded as they were sent, and the items as units of the catalog
+		units := 0
+		for _, v := range stocked {
+			units += int(v.Quantity)
+		}
+		medications = append(append(make([]medication.MedicationDTO, 0), load.Medications...), reserved[units:]...)
+	}
+
+	//a drone held by a mission only carries the payload of the mission
+	env.missionsMutex.RLock()
+	if missionObj := env.openMissionOfDrone(load.SerialNumber); missionObj != nil {
+		err = fmt.Errorf("drone is held by the open mission %s", missionObj.GetID())
+	} else {
+		err = droneObj.LoadSetOfMedications(medications)
+	}
+	env.missionsMutex.RUnlock()
+	if err != nil {
+		if len(items) > 0 {
+			releaseErr := env.catalog.Release(items)
+			if releaseErr != nil {
+				log.Printf("stock of items could not be given back to the catalog: %v", releaseErr)
+			}
+		}
+		return err
+	}
+
+	//the round is planned again on departure, so a drone out of range is refused then
+	err = droneObj.PlanRound()
+	if err != nil {
+		log.Printf("round of drone %s could not be planned: %v", load.SerialNumber, err)
+	}
+
+	env.publishEvent(events.TypeMedicationsLoaded, droneObj)
+	env.publishStateChange(droneObj, previousState)
+
+	return env.persistDrone(droneObj)
 }
 
 //preload during the start of the app, a list with some drones
 func (env *environment) preloadData() error {
 
-	env.loadSamplMedicationCaseBase64()
+	env.loadSamplMedicationCaseImage()
 
 	env.registeredDrones = make(map[string]*drone.Drone)
 
@@ -394,25 +1191,25 @@ func (env *environment) preloadData() error {
 				Name:   "Medication-A",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 20,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 			{
 				Name:   "Medication-B",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 40,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 			{
 				Name:   "Medication-C",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 25,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 			{
 				Name:   "Medication-D",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 10,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 		},
 	}
@@ -433,25 +1230,25 @@ func (env *environment) preloadData() error {
 				Name:   "Medication-A",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 200,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 			{
 				Name:   "Medication-B",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 80,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 			{
 				Name:   "Medication-C",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 50,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 			{
 				Name:   "Medication-D",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 60,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 		},
 	}
@@ -485,13 +1282,13 @@ func (env *environment) preloadData() error {
 				Name:   "Medication-C",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 300,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 			{
 				Name:   "Medication-D",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 90,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 		},
 	}
@@ -525,13 +1322,13 @@ func (env *environment) preloadData() error {
 				Name:   "Medication-Y",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 60,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 			{
 				Name:   "Medication-Z",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 30,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 		},
 	}
@@ -552,7 +1349,7 @@ func (env *environment) preloadData() error {
 				Name:   "Medication-X",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 400,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 		},
 	}
@@ -586,25 +1383,25 @@ func (env *environment) preloadData() error {
 				Name:   "Medication-A",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 200,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 			{
 				Name:   "Medication-B",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 80,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 			{
 				Name:   "Medication-C",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 50,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 			{
 				Name:   "Medication-D",
 				Code:   strings.ToUpper(randomdata.Alphanumeric(32)),
 				Weight: 60,
-				Image:  env.samplMedicationCaseBase64,
+				Image:  env.samplMedicationCaseImage,
 			},
 		},
 	}
@@ -639,7 +1436,7 @@ func (env *environment) printDataOfDrones(drones []drone.DroneDTO) {
 		drones = make([]drone.DroneDTO, 0)
 	}
 
-	for _, v := range env.registeredDrones {
+	for _, v := range env.getRegisteredDrones() {
 		drones = append(drones, v.GetDTO())
 	}
 
@@ -666,9 +1463,19 @@ func (env *environment) checkDronesBatteryLevelsPeriodically() {
 		return */
 		case <-ticker.C:
 			drones := make([]drone.DroneDTO, 0)
-			log.Printf("check of (%d) drones's battery levels:", len(env.registeredDrones))
-			for _, v := range env.registeredDrones {
+			registeredDrones := env.getRegisteredDrones()
+			now := time.Now()
+			log.Printf("check of (%d) drones's battery levels:", len(registeredDrones))
+			for _, v := range registeredDrones {
 				drones = append(drones, v.GetDTOWithSerialNumberAndBatteryCapacity())
+				err := env.batteryHistory.Record(v.GetSerialNumber(), history.Sample{
+					Timestamp:       now,
+					BatteryCapacity: v.GetBatteryCapacity(),
+					State:           v.GetState(),
+				})
+				if err != nil {
+					log.Printf("battery level of drone %s could not be recorded: %v", v.GetSerialNumber(), err)
+				}
 				//log.Printf("drone serial number: %s has a battery level of %d %%", k, v.GetBatteryCapacity())
 			}
 
@@ -682,8 +1489,51 @@ func (env *environment) checkDronesBatteryLevelsPeriodically() {
 	}
 }
 
-//load of sample of medication case image (convert the image to base64)
-func (env *environment) loadSamplMedicationCaseBase64() {
+//simulate the drain and charge of the batteries of the registered drones
+func (env *environment) runBatterySimulation(stop <-chan struct{}, done chan<- struct{}) {
+
+	defer close(done)
+
+	interval := time.Duration(env.Config.SimulationTickSeconds) * time.Second
+	log.Printf("battery simulation started with a tick of %v", interval)
+
+	//the battery levels are persisted at most once per interval, instead of writing every drone on every tick
+	pending := make(map[string]*drone.Drone)
+	persistedAt := time.Now()
+
+	engine := simulation.NewEngine(interval)
+	engine.SetChargeRate(env.stations.ChargeRate)
+	engine.Run(stop, env.getRegisteredDrones, func(changed []*drone.Drone) {
+		for _, v := range changed {
+			env.publishEvent(events.TypeBatteryUpdated, v)
+			pending[v.GetSerialNumber()] = v
+		}
+		if time.Since(persistedAt) >= simulationPersistInterval {
+			env.persistDrones(pending)
+			pending = make(map[string]*drone.Drone)
+			persistedAt = time.Now()
+		}
+	})
+
+	//the levels that are still pending are persisted before the repository is closed
+	env.persistDrones(pending)
+
+	log.Println("battery simulation stopped")
+}
+
+//keep the current data of some drones in the repository
+func (env *environment) persistDrones(drones map[string]*drone.Drone) {
+
+	for _, v := range drones {
+		err := env.persistDrone(v)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+//load of sample of medication case image (keep the image in the image store)
+func (env *environment) loadSamplMedicationCaseImage() {
 	// Open file on disk.
 	imagePath := "sample_medication_case_base64.jpg"
 	f, err := os.Open(imagePath)
@@ -697,17 +1547,23 @@ func (env *environment) loadSamplMedicationCaseBase64() {
 	if err != nil {
 		log.Printf("error reading content of file %s: %v", imagePath, err)
 	}
-	// Encode as base64.
-	env.samplMedicationCaseBase64 = base64.StdEncoding.EncodeToString(content)
+	//Keep it in the image store, so every medication only carries its reference.
+	env.samplMedicationCaseImage, err = env.images.Put(content)
+	if err != nil {
+		log.Printf("error keeping content of file %s in the image store: %v", imagePath, err)
+	}
 }
 
 //print error responses
 func writeError(w http.ResponseWriter, statusCode int, errMessage string) {
+	writeErrorResponse(w, statusCode, Response{Details: errMessage})
+}
 
-	response := Response{
-		OK:      false,
-		Details: errMessage,
-	}
+//print error responses that carry more information than the error message
+func writeErrorResponse(w http.ResponseWriter, statusCode int, response Response) {
+
+	response.OK = false
+	errMessage := response.Details
 
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/drone"
+	"drones/pkg/events"
+	"drones/pkg/query"
+	"drones/pkg/websocket"
+)
+
+const (
+	//period of the messages sent to keep idle streams alive
+	eventsKeepAlivePeriod = 15 * time.Second
+	//time that a stream of server-sent events is closed before the write timeout of the server cuts it
+	eventsStreamMargin = 5 * time.Second
+)
+
+//add the routes of the fleet events to a router
+func (env *environment) addEventRoutes(router *mux.Router) {
+	router.HandleFunc("/events", env.streamEvents).Methods("GET")
+	router.HandleFunc("/events/ws", env.streamEventsOverWebSocket).Methods("GET")
+}
+
+//http handler to stream fleet events as server-sent events (filtered by the optional parameters 'serial_number' and 'type')
+func (env *environment) streamEvents(w http.ResponseWriter, r *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errMessage := "streaming is not supported by the connection"
+		log.Println(errMessage)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	filter := eventFilter(r)
+	subscription := env.events.Subscribe(filter)
+	defer env.events.Unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	//clients reconnect right away when the stream is closed before the write timeout of the server
+	_, _ = fmt.Fprint(w, "retry: 1000\n\n")
+
+	//events missed by a client that reconnects are replayed from the last one it received
+	lastID := lastEventID(r)
+	for _, v := range env.events.Since(lastID, filter) {
+		if writeServerSentEvent(w, v) != nil {
+			return
+		}
+		lastID = v.ID
+	}
+	flusher.Flush()
+
+	var streamEnd <-chan time.Time
+	if env.HttpServer != nil && env.HttpServer.WriteTimeout > eventsStreamMargin {
+		timer := time.NewTimer(env.HttpServer.WriteTimeout - eventsStreamMargin)
+		defer timer.Stop()
+		streamEnd = timer.C
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlivePeriod)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-streamEnd:
+			return
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if writeServerSentEvent(w, event) != nil {
+				return
+			}
+			lastID = event.ID
+			flusher.Flush()
+		}
+	}
+}
+
+//http handler to stream fleet events over a WebSocket (filtered by the optional parameters 'serial_number' and 'type')
+func (env *environment) streamEventsOverWebSocket(w http.ResponseWriter, r *http.Request) {
+
+	conn, err := websocket.Upgrade(w, r, env.Config.AllowedOrigins)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not upgrade to WebSocket: %s", err.Error())
+		log.Println(errMessage)
+		if errors.Is(err, websocket.ErrOriginNotAllowed) {
+			writeError(w, http.StatusForbidden, errMessage)
+			return
+		}
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+	defer conn.Close()
+
+	filter := eventFilter(r)
+	subscription := env.events.Subscribe(filter)
+	defer env.events.Unsubscribe(subscription)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		_ = conn.ReadUntilClosed()
+	}()
+
+	lastID := lastEventID(r)
+	for _, v := range env.events.Since(lastID, filter) {
+		if writeWebSocketEvent(conn, v) != nil {
+			return
+		}
+		lastID = v.ID
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlivePeriod)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-keepAlive.C:
+			if conn.WritePing() != nil {
+				return
+			}
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if writeWebSocketEvent(conn, event) != nil {
+				return
+			}
+			lastID = event.ID
+		}
+	}
+}
+
+//publish an event with the current data of a drone
+func (env *environment) publishEvent(eventType string, droneObj *drone.Drone) {
+
+	if env.events == nil {
+		return
+	}
+
+	dto := droneObj.GetDTO()
+
+	env.events.Publish(eventType, dto)
+}
+
+//publish a change of state of a drone, when its state is not the previous one anymore
+func (env *environment) publishStateChange(droneObj *drone.Drone, previousState string) {
+
+	if droneObj.GetState() != previousState {
+		env.publishEvent(events.TypeStateChanged, droneObj)
+	}
+}
+
+//get the filter of events from the parameters 'serial_number' and 'type' (repeated or comma separated)
+func eventFilter(r *http.Request) events.Filter {
+	return events.Filter{
+		SerialNumbers: query.Strings(r.URL.Query(), "serial_number"),
+		Types:         query.Strings(r.URL.Query(), "type"),
+	}
+}
+
+//get the id of the last event received by a client, from the header Last-Event-ID or the parameter 'last_event_id'
+func lastEventID(r *http.Request) uint64 {
+
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return id
+}
+
+//write an event in the format of server-sent events
+func writeServerSentEvent(w http.ResponseWriter, event events.Event) error {
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("event %d could not be marshaled: %v", event.ID, err)
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+
+	return err
+}
+
+//write an event as a WebSocket text message
+func writeWebSocketEvent(conn *websocket.Conn, event events.Event) error {
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("event %d could not be marshaled: %v", event.ID, err)
+		return nil
+	}
+
+	return conn.WriteText(data)
+}
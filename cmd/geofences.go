@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/drone"
+	"drones/pkg/geo"
+	"drones/pkg/geofence"
+	"drones/pkg/medication"
+)
+
+type (
+	//a request to check a point, a flight between two points or the flight of a drone from its base against the no-fly zones
+	GeofenceCheck struct {
+		Point        *geo.Point `json:"point,omitempty"`
+		From         *geo.Point `json:"from,omitempty"`
+		To           *geo.Point `json:"to,omitempty"`
+		SerialNumber string     `json:"serial_number,omitempty"` // drone flying from its base to 'to'
+	}
+)
+
+//add the routes of the no-fly zones to a router
+func (env *environment) addGeofenceRoutes(router *mux.Router) {
+	router.HandleFunc("/geofences", env.addGeofence).Methods("POST")
+	router.HandleFunc("/geofences", env.getAllGeofences).Methods("GET")
+	router.HandleFunc("/geofences/check", env.checkGeofences).Methods("POST")
+	router.HandleFunc("/geofences/{id}", env.getGeofence).Methods("GET")
+	router.HandleFunc("/geofences/{id}", env.updateGeofence).Methods("PUT")
+	router.HandleFunc("/geofences/{id}", env.deleteGeofence).Methods("DELETE")
+}
+
+//http handler to add a no-fly zone (a GeoJSON feature)
+func (env *environment) addGeofence(w http.ResponseWriter, r *http.Request) {
+
+	feature := geofence.Feature{}
+
+	err := json.NewDecoder(r.Body).Decode(&feature)
+	if err != nil {
+		errMessage := "could not decode geofence json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	if _, ok := env.geofences.Get(feature.ID); ok && feature.ID != "" {
+		errMessage := fmt.Sprintf("geofence with id %s already exists", feature.ID)
+		log.Println(errMessage)
+		writeError(w, http.StatusConflict, errMessage)
+		return
+	}
+
+	feature, err = env.geofences.Add(feature)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not add geofence: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	writeCreated(w, "/geofences/"+feature.ID)
+	err = json.NewEncoder(w).Encode(Response{
+		OK:        true,
+		Details:   fmt.Sprintf("new geofence with id %s added", feature.ID),
+		Geofences: []geofence.Feature{feature},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("new geofence added: %s (%s)", feature.ID, feature.Properties.Name)
+}
+
+//http handler to get all no-fly zones
+func (env *environment) getAllGeofences(w http.ResponseWriter, r *http.Request) {
+
+	features := env.geofences.GetAll()
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:        true,
+		Details:   fmt.Sprintf("this are the %d geofences", len(features)),
+		Geofences: features,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to get a no-fly zone
+func (env *environment) getGeofence(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	feature, ok := env.geofences.Get(id)
+	if !ok {
+		errMessage := fmt.Sprintf("geofence with id '%s' was not found", id)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:        true,
+		Details:   fmt.Sprintf("this is the geofence with id %s", id),
+		Geofences: []geofence.Feature{feature},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to replace a no-fly zone
+func (env *environment) updateGeofence(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	if _, ok := env.geofences.Get(id); !ok {
+		errMessage := fmt.Sprintf("geofence with id '%s' was not found", id)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	feature := geofence.Feature{}
+
+	err := json.NewDecoder(r.Body).Decode(&feature)
+	if err != nil {
+		errMessage := "could not decode geofence json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	feature, err = env.geofences.Update(id, feature)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not update geofence: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:        true,
+		Details:   fmt.Sprintf("geofence with id %s updated", id),
+		Geofences: []geofence.Feature{feature},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("geofence %s updated", id)
+}
+
+//http handler to remove a no-fly zone
+func (env *environment) deleteGeofence(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	if _, ok := env.geofences.Get(id); !ok {
+		errMessage := fmt.Sprintf("geofence with id '%s' was not found", id)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	err := env.geofences.Delete(id)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not remove geofence: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("geofence with id %s removed", id),
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("geofence %s removed", id)
+}
+
+//http handler to check a point, a flight or the flight of a drone from its base against the no-fly zones
+func (env *environment) checkGeofences(w http.ResponseWriter, r *http.Request) {
+
+	check := GeofenceCheck{}
+
+	err := json.NewDecoder(r.Body).Decode(&check)
+	if err != nil {
+		errMessage := "could not decode geofence check json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	var subject string
+	switch {
+	case check.Point != nil:
+		subject = "point"
+		err = env.geofences.CheckPoint(*check.Point)
+	case check.SerialNumber != "" && check.To != nil:
+		droneObj := env.getDrone(check.SerialNumber)
+		if droneObj == nil {
+			errMessage := fmt.Sprintf("drone with serial number '%s' was not found", check.SerialNumber)
+			log.Println(errMessage)
+			writeError(w, http.StatusNotFound, errMessage)
+			return
+		}
+		subject = fmt.Sprintf("flight of drone %s", check.SerialNumber)
+		err = env.checkFlightOfDrone(droneObj, *check.To)
+	case check.From != nil && check.To != nil:
+		subject = "flight"
+		err = env.geofences.CheckFlight(*check.From, *check.To)
+	default:
+		errMessage := "a point, a flight (from and to) or a drone and a destination (serial_number and to) are needed"
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	if err != nil {
+		writeGeofenceError(w, fmt.Sprintf("%s is not allowed: %s", subject, err.Error()), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("%s is outside every geofence", subject),
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//check the flights of a drone to a destination (from its base and from where it is) against the no-fly zones
+func (env *environment) checkFlightOfDrone(droneObj *drone.Drone, destination geo.Point) error {
+
+	err := env.geofences.CheckPoint(destination)
+	if err != nil {
+		return err
+	}
+
+	homeBase := droneObj.GetHomeBase()
+	if homeBase != nil {
+		err = env.geofences.CheckFlight(*homeBase, destination)
+		if err != nil {
+			return err
+		}
+	}
+
+	location := droneObj.GetLocation()
+	if location != nil && (homeBase == nil || *location != *homeBase) {
+		err = env.geofences.CheckFlight(*location, destination)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//check that the drop-offs of the medications are not inside the no-fly zones
+func (env *environment) checkDropOffs(medications []medication.MedicationDTO) error {
+
+	for _, v := range medications {
+		if v.DropOff == nil {
+			continue
+		}
+		err := env.geofences.CheckPoint(*v.DropOff)
+		if err != nil {
+			return fmt.Errorf("drop-off of medication %s: %w", v.Code, err)
+		}
+	}
+
+	return nil
+}
+
+//print the error of a check against the no-fly zones, with the offending zone when there is one
+func writeGeofenceError(w http.ResponseWriter, errMessage string, err error) {
+
+	log.Println(errMessage)
+
+	violation := &geofence.ViolationError{}
+	if errors.As(err, &violation) {
+		writeErrorResponse(w, http.StatusConflict, Response{
+			Details:   errMessage,
+			Geofences: []geofence.Feature{violation.Zone},
+		})
+		return
+	}
+
+	writeError(w, http.StatusUnprocessableEntity, errMessage)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/catalog"
+	"drones/pkg/imagestore"
+	"drones/pkg/medication"
+)
+
+//returned when the images of the medications of a request are not valid
+var errImagesNotValid = errors.New("images of medications are not valid")
+
+//add the routes of the images of medications to a router
+func (env *environment) addImageRoutes(router *mux.Router) {
+	router.HandleFunc("/medications/{code}/image", env.uploadImageOfMedication).Methods("POST")
+	router.HandleFunc("/medications/{code}/image", env.getImageOfMedication).Methods("GET")
+}
+
+//http handler to upload the image of a medication of the catalog (multipart form with the file in the field 'image')
+func (env *environment) uploadImageOfMedication(w http.ResponseWriter, r *http.Request) {
+
+	code := mux.Vars(r)["code"]
+	if _, ok := env.catalog.Get(code); !ok {
+		errMessage := fmt.Sprintf("medication with code '%s' was not found", code)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	//the body is limited a bit over the max size of an image, to leave room for the rest of the form
+	r.Body = http.MaxBytesReader(w, r.Body, int64(env.images.MaxSize())+64*1024)
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		errMessage := "could not read field 'image' of the multipart form"
+		log.Println(errMessage, ":", err)
+		statusCode := http.StatusBadRequest
+		if r.ContentLength > int64(env.images.MaxSize())+64*1024 {
+			errMessage = imagestore.ErrTooLarge.Error()
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, statusCode, errMessage)
+		return
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		errMessage := "could not read uploaded image"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	ref, err := env.images.Put(content)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not keep uploaded image: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, imageErrorStatusCode(err), errMessage)
+		return
+	}
+
+	err = env.catalog.SetImage(code, ref)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not set image of medication: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	dto, _ := env.catalog.Get(code)
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:          true,
+		Details:     fmt.Sprintf("image of medication with code %s uploaded", code),
+		Medications: []catalog.EntryDTO{dto},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("image %s uploaded for medication %s", ref, code)
+}
+
+//http handler to get the image of a medication of the catalog
+func (env *environment) getImageOfMedication(w http.ResponseWriter, r *http.Request) {
+
+	code := mux.Vars(r)["code"]
+	dto, ok := env.catalog.Get(code)
+	if !ok {
+		errMessage := fmt.Sprintf("medication with code '%s' was not found", code)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	if dto.Image == "" {
+		errMessage := fmt.Sprintf("medication with code '%s' has not an image", code)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	content, mime, err := env.images.Get(dto.Image)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not read image of medication: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, imageErrorStatusCode(err), errMessage)
+		return
+	}
+
+	w.Header().Set("Content-Type", mime)
+	w.Header().Set("ETag", fmt.Sprintf("%q", dto.Image))
+	_, err = w.Write(content)
+	if err != nil {
+		log.Printf("could not write image of medication %s: %v", code, err)
+	}
+}
+
+//get the reference of an image, keeping it in the image store when it comes in base64 (as loads used to send them)
+//(a reference must be of an image that is in the store)
+func (env *environment) imageReference(image string) (string, error) {
+
+	if image == "" {
+		return image, nil
+	}
+
+	if imagestore.IsReference(image) {
+		if !env.images.Exists(image) {
+			return "", fmt.Errorf("image %s is not in the image store: %w", image, imagestore.ErrNotFound)
+		}
+		return image, nil
+	}
+
+	content, err := base64.StdEncoding.DecodeString(image)
+	if err != nil {
+		return "", fmt.Errorf("image must be a reference of the image store or a base64 encoded image: %v", err)
+	}
+
+	return env.images.Put(content)
+}
+
+//replace the images of the medications with their references
+func (env *environment) normalizeImages(medications []medication.MedicationDTO) error {
+
+	for i, v := range medications {
+		ref, err := env.imageReference(v.Image)
+		if err != nil {
+			return fmt.Errorf("medication %d (%s): %v", i, v.Code, err)
+		}
+		medications[i].Image = ref
+	}
+
+	return nil
+}
+
+//replace the base64 images of stored medications with their references (stored references are kept as they are)
+func (env *environment) migrateImages(medications []medication.MedicationDTO) error {
+
+	for i, v := range medications {
+		if imagestore.IsReference(v.Image) {
+			continue
+		}
+		ref, err := env.imageReference(v.Image)
+		if err != nil {
+			return fmt.Errorf("medication %d (%s): %v", i, v.Code, err)
+		}
+		medications[i].Image = ref
+	}
+
+	return nil
+}
+
+//get the http status code for an error of the image store
+func imageErrorStatusCode(err error) int {
+
+	switch {
+	case errors.Is(err, imagestore.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, imagestore.ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, imagestore.ErrNotFound):
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func Test_Images_unknownReference(t *testing.T) {
+
+	server := newTestServer(t, "")
+
+	unknown := "0000000000000000000000000000000000000000000000000000000000000000"
+	requests := []struct {
+		path string
+		body string
+	}{
+		{"/api/v1/drones", `{"serial_number":"DRONE-1","model":"Middleweight","weight_limit":300,"battery_capacity":100,"state":"IDLE","medications":[{"name":"aspirin","code":"ASP_20","weight":20,"image":"` + unknown + `"}]}`},
+		{"/api/v1/medications", `{"code":"ASP_20","name":"aspirin","weight":20,"image":"` + unknown + `"}`},
+		{"/api/v1/drones/DRONE-2/medications", `{"medications":[{"name":"aspirin","code":"ASP_20","weight":20,"image":"` + unknown + `"}]}`},
+	}
+
+	status, _ := sendRequest(t, server, "POST", "/api/v1/drones", `{"serial_number":"DRONE-2","model":"Middleweight","weight_limit":300,"battery_capacity":100,"state":"IDLE"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("drone must be registered but status was %d", status)
+	}
+
+	for _, v := range requests {
+		if status, response := sendRequest(t, server, "POST", v.path, v.body); status != http.StatusUnprocessableEntity {
+			t.Errorf("POST %s with a reference of an image that is not in the store must return 422 but returned %d: %s", v.path, status, response.Details)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"drones/pkg/drone"
+	"drones/pkg/mission"
+	"drones/pkg/query"
+)
+
+const (
+	//number of items of a page of the versioned api when the client does not give a limit (the legacy routes return every item)
+	defaultPageLimit = 100
+
+	//headers with the page of the legacy routes that return a bare array
+	totalCountHeader = "X-Total-Count"
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+var (
+	//fields to sort the lists of drones and missions (the first is the default)
+	droneSortFields   = []string{"serial", "battery", "free_capacity"}
+	missionSortFields = []string{"created_at", "id"}
+)
+
+type (
+	//filters of a list of drones, from the parameters 'model', 'state', 'min_battery', 'has_medications' and 'min_free_capacity'
+	droneFilter struct {
+		Models          []string
+		States          []string
+		MinBattery      *int
+		HasMedications  *bool
+		MinFreeCapacity *int // grams
+	}
+
+	//filters of a list of missions, from the parameters 'status' and 'serial_number'
+	missionFilter struct {
+		Statuses      []string
+		SerialNumbers []string
+	}
+
+	//drones to be sorted and paged
+	droneList []drone.DroneDTO
+
+	//missions to be sorted and paged
+	missionList []mission.MissionDTO
+)
+
+//get the requested page of a list of drones, with the filters, the order and the cursor of the parameters of the request
+func (env *environment) listDrones(r *http.Request, drones []*drone.Drone) ([]drone.DroneDTO, query.Page, error) {
+
+	values := r.URL.Query()
+
+	params, err := query.Parse(values, droneSortFields, pageLimitOf(r))
+	if err != nil {
+		return nil, query.Page{}, err
+	}
+
+	filter, err := newDroneFilter(values)
+	if err != nil {
+		return nil, query.Page{}, err
+	}
+
+	list := make(droneList, 0, len(drones))
+	for _, v := range drones {
+		dto := snapshotOfDrone(v)
+		if filter.matches(*dto) {
+			list = append(list, *dto)
+		}
+	}
+
+	indexes, page := query.Apply(list, params)
+
+	result := make([]drone.DroneDTO, 0, len(indexes))
+	for _, i := range indexes {
+		result = append(result, list[i])
+	}
+
+	return result, page, nil
+}
+
+//get the requested page of a list of missions, with the filters, the order and the cursor of the parameters of the request
+func (env *environment) listMissions(r *http.Request, missions []*mission.Mission) ([]mission.MissionDTO, query.Page, error) {
+
+	values := r.URL.Query()
+
+	params, err := query.Parse(values, missionSortFields, pageLimitOf(r))
+	if err != nil {
+		return nil, query.Page{}, err
+	}
+
+	filter := missionFilter{
+		Statuses:      query.Strings(values, "status"),
+		SerialNumbers: query.Strings(values, "serial_number"),
+	}
+
+	list := make(missionList, 0, len(missions))
+	for _, v := range missions {
+		dto := v.GetDTO()
+		if filter.matches(dto) {
+			list = append(list, dto)
+		}
+	}
+
+	indexes, page := query.Apply(list, params)
+
+	result := make([]mission.MissionDTO, 0, len(indexes))
+	for _, i := range indexes {
+		result = append(result, list[i])
+	}
+
+	return result, page, nil
+}
+
+//get the filter of drones from the parameters of a request
+func newDroneFilter(values url.Values) (droneFilter, error) {
+
+	filter := droneFilter{
+		Models: query.Strings(values, "model"),
+		States: query.Strings(values, "state"),
+	}
+
+	var err error
+
+	filter.MinBattery, err = query.Int(values, "min_battery")
+	if err != nil {
+		return droneFilter{}, err
+	}
+
+	filter.HasMedications, err = query.Bool(values, "has_medications")
+	if err != nil {
+		return droneFilter{}, err
+	}
+
+	filter.MinFreeCapacity, err = query.Int(values, "min_free_capacity")
+	if err != nil {
+		return droneFilter{}, err
+	}
+
+	return filter, nil
+}
+
+//check whether a drone passes the filter
+func (f droneFilter) matches(dto drone.DroneDTO) bool {
+
+	if len(f.Models) > 0 && !containsFold(f.Models, dto.Model) {
+		return false
+	}
+
+	if len(f.States) > 0 && !containsFold(f.States, dto.State) {
+		return false
+	}
+
+	if f.MinBattery != nil && int(dto.BatteryCapacity) < *f.MinBattery {
+		return false
+	}
+
+	if f.HasMedications != nil && (len(dto.Medications) > 0) != *f.HasMedications {
+		return false
+	}
+
+	if f.MinFreeCapacity != nil && freeCapacityOf(dto) < *f.MinFreeCapacity {
+		return false
+	}
+
+	return true
+}
+
+//check whether a mission passes the filter
+func (f missionFilter) matches(dto mission.MissionDTO) bool {
+
+	if len(f.Statuses) > 0 && !containsFold(f.Statuses, dto.Status) {
+		return false
+	}
+
+	if len(f.SerialNumbers) > 0 && !containsFold(f.SerialNumbers, dto.SerialNumber) {
+		return false
+	}
+
+	return true
+}
+
+func (l droneList) Len() int        { return len(l) }
+func (l droneList) ID(i int) string { return l[i].SerialNumber }
+
+//get the value of a sortable field of a drone
+func (l droneList) Value(i int, field string) query.Value {
+
+	switch field {
+	case "battery":
+		return query.Number(float64(l[i].BatteryCapacity))
+	case "free_capacity":
+		return query.Number(float64(freeCapacityOf(l[i])))
+	}
+
+	return query.Text(l[i].SerialNumber)
+}
+
+func (l missionList) Len() int        { return len(l) }
+func (l missionList) ID(i int) string { return l[i].ID }
+
+//get the value of a sortable field of a mission
+func (l missionList) Value(i int, field string) query.Value {
+
+	if field == "created_at" && l[i].CreatedAt != nil {
+		//nanoseconds do not fit in a float, so the time is compared as a text of fixed length
+		return query.Text(l[i].CreatedAt.UTC().Format("2006-01-02T15:04:05.000000000Z"))
+	}
+
+	return query.Text(l[i].ID)
+}
+
+//get the grams that can still be loaded on a drone
+func freeCapacityOf(dto drone.DroneDTO) int {
+
+	free := int(dto.WeightLimit)
+	for _, v := range dto.Medications {
+		free -= int(v.Weight)
+	}
+
+	return free
+}
+
+//get the default limit of a page: the legacy routes return every item unless the client asks for a page
+func pageLimitOf(r *http.Request) int {
+
+	if strings.HasPrefix(r.URL.Path, apiV1Prefix+"/") {
+		return defaultPageLimit
+	}
+
+	return 0
+}
+
+//write the page of a legacy route that returns a bare array in the headers of the response
+func writePageHeaders(w http.ResponseWriter, page query.Page) {
+
+	w.Header().Set(totalCountHeader, strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Set(nextCursorHeader, page.NextCursor)
+	}
+}
+
+//check whether a list of strings contains a value, ignoring the case
+func containsFold(list []string, value string) bool {
+
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
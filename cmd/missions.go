@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/audit"
+	"drones/pkg/catalog"
+	"drones/pkg/drone"
+	"drones/pkg/events"
+	"drones/pkg/mission"
+)
+
+//add the routes of the delivery missions to a router
+func (env *environment) addMissionRoutes(router *mux.Router) {
+	router.HandleFunc("/missions", env.createMission).Methods("POST")
+	router.HandleFunc("/missions", env.getAllMissions).Methods("GET")
+	router.HandleFunc("/missions/{id}", env.getMission).Methods("GET")
+	router.HandleFunc("/missions/{id}/start", env.startMission).Methods("POST")
+	router.HandleFunc("/missions/{id}/stops/next", env.deliverStopOfMission).Methods("POST")
+	router.HandleFunc("/missions/{id}/complete", env.completeMission).Methods("POST")
+	router.HandleFunc("/missions/{id}/abort", env.abortMission).Methods("POST")
+	router.HandleFunc("/missions/{id}/return", env.returnMission).Methods("POST")
+}
+
+//http handler to create a mission, loading its medications on the drone
+func (env *environment) createMission(w http.ResponseWriter, r *http.Request) {
+
+	dto := mission.MissionDTO{}
+
+	err := json.NewDecoder(r.Body).Decode(&dto)
+	if err != nil {
+		errMessage := "could not decode mission json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	missionObj, err := mission.NewMission(dto)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not obtain mission object from dto: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	droneObj := env.getDrone(dto.SerialNumber)
+	if droneObj == nil {
+		errMessage := fmt.Sprintf("drone with serial number '%s' was not found", dto.SerialNumber)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	if dto.Coordinates != nil {
+		err = env.checkFlightOfDrone(droneObj, *dto.Coordinates)
+		if err != nil {
+			writeGeofenceError(w, fmt.Sprintf("destination of mission is not allowed: %s", err.Error()), err)
+			return
+		}
+	}
+
+	err = env.checkDropOffs(dto.Medications)
+	if err != nil {
+		writeGeofenceError(w, fmt.Sprintf("drop-offs of mission are not allowed: %s", err.Error()), err)
+		return
+	}
+
+	err = env.normalizeImages(dto.Medications)
+	if err != nil {
+		errMessage := fmt.Sprintf("images of medications are not valid: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	err = env.catalog.Check(dto.Medications)
+	if err != nil {
+		errMessage := fmt.Sprintf("medications of mission do not agree with the catalog: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	previousState := droneObj.GetState()
+	before := snapshotOfDrone(droneObj)
+
+	err = env.loadMission(missionObj, droneObj)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not load medications of mission on drone: %s", err.Error())
+		log.Println(errMessage)
+		catalogErr := &catalog.CatalogError{}
+		if errors.As(err, &catalogErr) {
+			response := Response{Details: errMessage}
+			for _, v := range catalogErr.Rejected {
+				response.Rejected = append(response.Rejected, drone.RejectedMedication(v))
+			}
+			writeErrorResponse(w, http.StatusUnprocessableEntity, response)
+			return
+		}
+		writeError(w, http.StatusConflict, errMessage)
+		return
+	}
+
+	env.publishEvent(events.TypeMedicationsLoaded, droneObj)
+	env.publishStateChange(droneObj, previousState)
+	env.recordAudit(r, audit.ActionLoad, missionObj.GetID(), before, droneObj)
+
+	err = env.persistDrone(droneObj)
+	if err != nil {
+		log.Println(err)
+	}
+
+	writeCreated(w, "/missions/"+missionObj.GetID())
+	err = json.NewEncoder(w).Encode(Response{
+		OK:       true,
+		Details:  fmt.Sprintf("new mission %s created for drone with serial number %s", missionObj.GetID(), dto.SerialNumber),
+		Missions: []mission.MissionDTO{missionObj.GetDTO()},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("new mission %s created for drone %s", missionObj.GetID(), dto.SerialNumber)
+}
+
+//http handler to get the missions, filtered by the parameters 'status' and 'serial_number', sorted and paged
+func (env *environment) getAllMissions(w http.ResponseWriter, r *http.Request) {
+
+	missions, page, err := env.listMissions(r, env.getMissions())
+	if err != nil {
+		errMessage := fmt.Sprintf("could not list missions: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:       true,
+		Details:  fmt.Sprintf("this are %d of the %d missions found", len(missions), page.Total),
+		Missions: missions,
+		Page:     &page,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to get a mission
+func (env *environment) getMission(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	missionObj := env.getMissionByID(id)
+	if missionObj == nil {
+		errMessage := fmt.Sprintf("mission with id '%s' was not found", id)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:       true,
+		Details:  fmt.Sprintf("this is the mission with id %s", id),
+		Missions: []mission.MissionDTO{missionObj.GetDTO()},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to make the drone of a mission depart
+func (env *environment) startMission(w http.ResponseWriter, r *http.Request) {
+	env.advanceMission(w, r, "started", audit.ActionStateChange, (*mission.Mission).Start)
+}
+
+//http handler to drop off the medications of the next stop of the round of a mission
+func (env *environment) deliverStopOfMission(w http.ResponseWriter, r *http.Request) {
+	env.advanceMission(w, r, "delivered at its next stop", audit.ActionDeliverStop, (*mission.Mission).DeliverStop)
+}
+
+//http handler to deliver the medications of a mission
+func (env *environment) completeMission(w http.ResponseWriter, r *http.Request) {
+	env.advanceMission(w, r, "completed", audit.ActionStateChange, (*mission.Mission).Complete)
+}
+
+//http handler to cancel a mission
+func (env *environment) abortMission(w http.ResponseWriter, r *http.Request) {
+	env.advanceMission(w, r, "aborted", audit.ActionStateChange, (*mission.Mission).Abort)
+}
+
+//http handler to close a mission when its drone is back to base
+func (env *environment) returnMission(w http.ResponseWriter, r *http.Request) {
+	env.advanceMission(w, r, "closed with drone back to base", audit.ActionStateChange, (*mission.Mission).Return)
+}
+
+//apply a step of the lifecycle of a mission on its drone, recording it in the audit log as auditAction, and write the response
+func (env *environment) advanceMission(w http.ResponseWriter, r *http.Request, action string, auditAction string, step func(*mission.Mission, *drone.Drone) error) {
+
+	id := mux.Vars(r)["id"]
+	missionObj := env.getMissionByID(id)
+	if missionObj == nil {
+		errMessage := fmt.Sprintf("mission with id '%s' was not found", id)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	droneObj := env.getDrone(missionObj.GetSerialNumber())
+	if droneObj == nil {
+		errMessage := fmt.Sprintf("drone with serial number '%s' was not found", missionObj.GetSerialNumber())
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	previousState := droneObj.GetState()
+	before := snapshotOfDrone(droneObj)
+
+	err := step(missionObj, droneObj)
+	if err != nil {
+		errMessage := fmt.Sprintf("mission %s could not be %s: %s", id, action, err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusConflict, errMessage)
+		return
+	}
+
+	//the reserved units of a cancelled mission are given back to the stock once they are back to base
+	if items := missionObj.TakeReturnedItems(); len(items) > 0 {
+		err = env.catalog.Release(items)
+		if err != nil {
+			log.Printf("stock of mission %s could not be given back to the catalog: %v", id, err)
+		}
+	}
+
+	env.publishStateChange(droneObj, previousState)
+	env.recordAudit(r, auditAction, id, before, droneObj)
+
+	err = env.persistDrone(droneObj)
+	if err != nil {
+		log.Println(err)
+	}
+
+	droneDTO := droneObj.GetDTOWithSerialNumberAndState()
+	droneDTO.Round = droneObj.GetRound()
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:       true,
+		Details:  fmt.Sprintf("mission %s %s", id, action),
+		Drones:   []drone.DroneDTO{droneDTO},
+		Missions: []mission.MissionDTO{missionObj.GetDTO()},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("mission %s %s", id, action)
+}
+
+//load a new mission on its drone, taking from the stock of the catalog the units of its payload, and add it to the list of
+//missions (a drone held by another open mission is refused)
+func (env *environment) loadMission(missionObj *mission.Mission, droneObj *drone.Drone) error {
+
+	env.missionsMutex.Lock()
+	defer env.missionsMutex.Unlock()
+
+	if other := env.openMissionOfDrone(missionObj.GetSerialNumber()); other != nil {
+		return fmt.Errorf("drone is held by the open mission %s", other.GetID())
+	}
+
+	err := missionObj.Load(droneObj)
+	if err != nil {
+		return err
+	}
+
+	items := env.catalog.ItemsOf(missionObj.GetDTO().Medications)
+	if len(items) > 0 {
+		_, err = env.catalog.Reserve(items)
+		if err != nil {
+			abortErr := missionObj.Abort(droneObj)
+			if abortErr != nil {
+				log.Printf("drone %s could not be unloaded after the stock was not reserved: %v", droneObj.GetSerialNumber(), abortErr)
+			}
+			return err
+		}
+		missionObj.SetReservedItems(items)
+	}
+
+	if env.missions == nil {
+		env.missions = make(map[string]*mission.Mission)
+	}
+
+	env.missions[missionObj.GetID()] = missionObj
+
+	return nil
+}
+
+//get the open mission that holds a drone (nil when there is none); the caller must hold the lock of the missions
+func (env *environment) openMissionOfDrone(serialNumber string) *mission.Mission {
+
+	for _, v := range env.missions {
+		if v.GetSerialNumber() == serialNumber && v.IsOpen() {
+			return v
+		}
+	}
+
+	return nil
+}
+
+//write a conflict when a drone is held by an open mission, which is the only one that may move, deliver or unload it,
+//getting whether it was written; the caller must hold the lock of the missions
+func (env *environment) writeHeldByMission(w http.ResponseWriter, serialNumber string) bool {
+
+	missionObj := env.openMissionOfDrone(serialNumber)
+	if missionObj == nil {
+		return false
+	}
+
+	errMessage := fmt.Sprintf("drone is held by the open mission %s", missionObj.GetID())
+	log.Println(errMessage)
+	writeError(w, http.StatusConflict, errMessage)
+
+	return true
+}
+
+//get a mission by its id (nil when there is not such mission)
+func (env *environment) getMissionByID(id string) *mission.Mission {
+
+	env.missionsMutex.RLock()
+	defer env.missionsMutex.RUnlock()
+
+	return env.missions[id]
+}
+
+//get the list of missions
+func (env *environment) getMissions() []*mission.Mission {
+
+	env.missionsMutex.RLock()
+	defer env.missionsMutex.RUnlock()
+
+	missions := make([]*mission.Mission, 0, len(env.missions))
+	for _, v := range env.missions {
+		missions = append(missions, v)
+	}
+
+	return missions
+}
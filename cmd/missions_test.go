@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//send a request with a json body to a test server, getting the status code and the decoded response
+func sendRequest(t *testing.T, server *httptest.Server, method string, path string, body string) (int, Response) {
+
+	request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("error while creating request %s %s:%v", method, path, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatalf("error while sending request %s %s:%v", method, path, err)
+	}
+	defer response.Body.Close()
+
+	result := Response{}
+	_ = json.NewDecoder(response.Body).Decode(&result)
+
+	return response.StatusCode, result
+}
+
+func Test_Missions_droneAndStock(t *testing.T) {
+
+	server := newTestServer(t, "")
+
+	steps := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"POST", "/medications", `{"code":"ASP_20","name":"aspirin","weight":20,"stock":1}`, http.StatusCreated},
+		{"POST", "/api/v1/drones", `{"serial_number":"DRONE-1","model":"Middleweight","weight_limit":300,"battery_capacity":100,"state":"IDLE"}`, http.StatusCreated},
+		{"POST", "/missions", `{"serial_number":"DRONE-1","destination":"Clinic-A","medications":[{"name":"aspirin","code":"ASP_20","weight":20}]}`, http.StatusCreated},
+	}
+	for _, v := range steps {
+		if status, response := sendRequest(t, server, v.method, v.path, v.body); status != v.status {
+			t.Fatalf("%s %s must return %d but returned %d: %s", v.method, v.path, v.status, status, response.Details)
+		}
+	}
+
+	_, response := sendRequest(t, server, "GET", "/medications/ASP_20", "")
+	if len(response.Medications) != 1 || response.Medications[0].Stock != 0 {
+		t.Fatalf("the unit of the mission must be taken from the stock but catalog was %+v", response.Medications)
+	}
+
+	//a drone held by a mission is not taken by another one nor loaded by hand
+	status, _ := sendRequest(t, server, "POST", "/missions", `{"serial_number":"DRONE-1","destination":"Clinic-B","medications":[{"name":"other","code":"OTHER","weight":20}]}`)
+	if status != http.StatusConflict {
+		t.Errorf("a drone held by an open mission must not be taken by another one but status was %d", status)
+	}
+	status, _ = sendRequest(t, server, "POST", "/api/v1/drones/DRONE-1/medications", `{"medications":[{"name":"other","code":"OTHER","weight":20}]}`)
+	if status != http.StatusConflict {
+		t.Errorf("a drone held by an open mission must not be loaded by hand but status was %d", status)
+	}
+	held := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"PUT", "/api/v1/drones/DRONE-1/state", `{"state":"DELIVERING"}`},
+		{"POST", "/api/v1/drones/DRONE-1/stops/next", ""},
+		{"DELETE", "/api/v1/drones/DRONE-1/medications", ""},
+		{"DELETE", "/api/v1/drones/DRONE-1/medications/ASP_20", ""},
+	}
+	for _, v := range held {
+		if status, _ = sendRequest(t, server, v.method, v.path, v.body); status != http.StatusConflict {
+			t.Errorf("a drone held by an open mission must not be changed by %s %s but status was %d", v.method, v.path, status)
+		}
+	}
+
+	_, response = sendRequest(t, server, "GET", "/missions", "")
+	if len(response.Missions) != 1 {
+		t.Fatalf("there must be one mission but there were %d", len(response.Missions))
+	}
+
+	status, _ = sendRequest(t, server, "POST", "/missions/"+response.Missions[0].ID+"/abort", "")
+	if status != http.StatusOK {
+		t.Fatalf("mission must be aborted but status was %d", status)
+	}
+
+	_, response = sendRequest(t, server, "GET", "/medications/ASP_20", "")
+	if len(response.Medications) != 1 || response.Medications[0].Stock != 1 {
+		t.Errorf("the unit of the aborted mission must be given back to the stock but catalog was %+v", response.Medications)
+	}
+}
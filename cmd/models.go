@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/drone"
+)
+
+//add the routes of the drone models to a router
+func (env *environment) addModelRoutes(router *mux.Router) {
+	router.HandleFunc("/models", env.getAllModels).Methods("GET")
+	router.HandleFunc("/models/{name}", env.getModel).Methods("GET")
+}
+
+//http handler to get the capability profiles of all drone models
+func (env *environment) getAllModels(w http.ResponseWriter, r *http.Request) {
+
+	models := drone.GetModelProfiles()
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("this are the %d drone models", len(models)),
+		Models:  models,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to get the capability profile of a drone model
+func (env *environment) getModel(w http.ResponseWriter, r *http.Request) {
+
+	name := mux.Vars(r)["name"]
+	profile, ok := drone.GetModelProfile(name)
+	if !ok {
+		errMessage := fmt.Sprintf("model '%s' was not found", name)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("this is the profile of the %s model", name),
+		Models:  []drone.ModelProfile{profile},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
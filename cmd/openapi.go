@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/catalog"
+	"drones/pkg/dispatch"
+	"drones/pkg/drone"
+	"drones/pkg/geofence"
+	"drones/pkg/mission"
+	"drones/pkg/openapi"
+	"drones/pkg/station"
+	"drones/pkg/telemetry"
+	"drones/pkg/webhook"
+)
+
+//version of the api in its OpenAPI document
+const apiVersion = "1.0.0"
+
+type (
+	//documentation of a route in the OpenAPI document
+	routeDoc struct {
+		ID          string // id of the operation (the legacy routes add "Legacy")
+		Summary     string
+		Request     interface{} // json body of the request (none when nil)
+		Status      int         // status code of a success (200 when empty)
+		Query       []string    // parameters of the query, described in queryParameters
+		Response    interface{} // json body of a success (the Response envelope when nil)
+		ContentType string      // media type of a success that is not json
+	}
+)
+
+var (
+	//parameters of the lists of drones and missions
+	droneListParameters   = []string{"limit", "cursor", "sort", "model", "state", "min_battery", "has_medications", "min_free_capacity"}
+	missionListParameters = []string{"limit", "cursor", "sort", "status", "serial_number"}
+
+	//description of the parameters of the query of the routes
+	queryParameters = map[string]openapi.Parameter{
+		"serial_number":     {Description: "serial number of a drone (several ones repeated or comma separated in the lists)", Schema: &openapi.Schema{Type: "string"}},
+		"limit":             {Description: "max number of items of the page (1 to 1000)", Schema: &openapi.Schema{Type: "integer"}},
+		"cursor":            {Description: "next_cursor of the previous page", Schema: &openapi.Schema{Type: "string"}},
+		"sort":              {Description: "field to sort the list by, with a leading '-' for descending order", Schema: &openapi.Schema{Type: "string"}},
+		"model":             {Description: "models of the drones, repeated or comma separated", Schema: &openapi.Schema{Type: "string"}},
+		"state":             {Description: "states of the drones, repeated or comma separated", Schema: &openapi.Schema{Type: "string"}},
+		"min_battery":       {Description: "min battery level of the drones (percentage)", Schema: &openapi.Schema{Type: "integer"}},
+		"has_medications":   {Description: "whether the drones have medications loaded", Schema: &openapi.Schema{Type: "boolean"}},
+		"min_free_capacity": {Description: "min grams that can still be loaded on the drones", Schema: &openapi.Schema{Type: "integer"}},
+		"status":            {Description: "statuses of the missions, repeated or comma separated", Schema: &openapi.Schema{Type: "string"}},
+		"type":              {Description: "types of the events, repeated or comma separated", Schema: &openapi.Schema{Type: "string"}},
+		"last_event_id":     {Description: "id of the last event received, to resume the stream", Schema: &openapi.Schema{Type: "integer"}},
+		"serial":            {Description: "serial number of a drone", Schema: &openapi.Schema{Type: "string"}},
+		"from":              {Description: "start of the period (RFC 3339)", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+		"to":                {Description: "end of the period (RFC 3339)", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+	}
+
+	//documentation of each route ("METHOD path template", the same in the versioned api and in the legacy routes)
+	routeDocs = map[string]routeDoc{
+		"GET /openapi.json":                                 {ID: "getOpenAPI", Summary: "get the OpenAPI document of the api", Response: map[string]interface{}{}},
+		"POST /drones":                                      {ID: "createDrone", Summary: "register a drone", Request: drone.DroneDTO{}, Status: http.StatusCreated},
+		"GET /drones":                                       {ID: "listDrones", Summary: "get a page of the registered drones", Query: droneListParameters},
+		"GET /drones/{serial_number}":                       {ID: "getDrone", Summary: "get a drone"},
+		"POST /drones/{serial_number}/medications":          {ID: "loadMedications", Summary: "load medications (and items of the catalog) on a drone", Request: drone.DroneDTO{}, Status: http.StatusCreated},
+		"GET /drones/{serial_number}/medications":           {ID: "getMedicationsOfDrone", Summary: "get the medications loaded on a drone"},
+		"DELETE /drones/{serial_number}/medications":        {ID: "unloadMedications", Summary: "unload every medication from a drone"},
+		"DELETE /drones/{serial_number}/medications/{code}": {ID: "unloadMedicationsByCode", Summary: "unload the medications with a code from a drone"},
+		"GET /drones/{serial_number}/battery":               {ID: "getBattery", Summary: "get the battery level of a drone"},
+		"GET /drones/{serial_number}/battery/history":       {ID: "getBatteryHistory", Summary: "get the battery history of a drone", Query: []string{"from", "to"}},
+		"PUT /drones/{serial_number}/state":                 {ID: "changeState", Summary: "move a drone to a new state", Request: drone.DroneDTO{}},
+		"POST /drones/{serial_number}/stops/next":           {ID: "deliverNextStop", Summary: "deliver the medications of the next stop of the round of a drone"},
+		"POST /drone/register":                              {ID: "registerDrone", Summary: "register a drone", Request: drone.DroneDTO{}},
+		"POST /drone/load":                                  {ID: "loadDrone", Summary: "load medications on a drone", Request: drone.DroneDTO{}},
+		"GET /drone/medications":                            {ID: "getMedicationsFromDrone", Summary: "get the medications loaded on a drone", Query: []string{"serial_number"}},
+		"GET /drone/battery":                                {ID: "getBatteryLevelFromDrone", Summary: "get the battery level of a drone", Query: []string{"serial_number"}},
+		"GET /drone/{serial_number}/battery/history":        {ID: "getBatteryHistory", Summary: "get the battery history of a drone", Query: []string{"from", "to"}},
+		"GET /drone/all/availables":                         {ID: "getDronesAvailablesForLoading", Summary: "get the drones availables for loading", Query: droneListParameters},
+		"GET /drone/all/service":                            {ID: "getDronesDueForService", Summary: "get the drones due for service", Query: droneListParameters},
+		"GET /drone/all":                                    {ID: "getAllDrones", Summary: "get the registered drones (the page in the headers X-Total-Count and X-Next-Cursor)", Query: droneListParameters, Response: []drone.DroneDTO{}},
+		"POST /drone/{serial_number}/state":                 {ID: "changeState", Summary: "move a drone to a new state", Request: drone.DroneDTO{}},
+		"POST /drone/{serial_number}/stops/next":            {ID: "deliverNextStop", Summary: "deliver the medications of the next stop of the round of a drone"},
+		"DELETE /drone/{serial_number}/medications":         {ID: "unloadMedications", Summary: "unload every medication from a drone"},
+		"DELETE /drone/{serial_number}/medications/{code}":  {ID: "unloadMedicationsByCode", Summary: "unload the medications with a code from a drone"},
+		"POST /missions":                                    {ID: "createMission", Summary: "create a delivery mission", Request: mission.MissionDTO{}, Status: http.StatusCreated},
+		"GET /missions":                                     {ID: "listMissions", Summary: "get a page of the missions", Query: missionListParameters},
+		"GET /missions/{id}":                                {ID: "getMission", Summary: "get a mission"},
+		"POST /missions/{id}/start":                         {ID: "startMission", Summary: "start a mission"},
+		"POST /missions/{id}/stops/next":                    {ID: "deliverStopOfMission", Summary: "deliver the next stop of a mission"},
+		"POST /missions/{id}/complete":                      {ID: "completeMission", Summary: "complete a mission"},
+		"POST /missions/{id}/abort":                         {ID: "abortMission", Summary: "abort a mission"},
+		"POST /missions/{id}/return":                        {ID: "returnMission", Summary: "bring back the drone of a mission"},
+		"POST /dispatch/plan":                               {ID: "planDispatch", Summary: "plan which drones should carry a set of medications", Request: dispatch.PlanRequest{}},
+		"POST /webhooks":                                    {ID: "subscribeWebhook", Summary: "subscribe a webhook to the fleet events", Request: webhook.SubscriptionDTO{}, Status: http.StatusCreated},
+		"GET /webhooks":                                     {ID: "listWebhooks", Summary: "get the webhooks"},
+		"GET /webhooks/dead-letters":                        {ID: "listWebhookDeadLetters", Summary: "get the deliveries of webhooks that failed"},
+		"GET /webhooks/{id}":                                {ID: "getWebhook", Summary: "get a webhook"},
+		"DELETE /webhooks/{id}":                             {ID: "unsubscribeWebhook", Summary: "unsubscribe a webhook"},
+		"POST /medications":                                 {ID: "registerMedication", Summary: "register a medication in the catalog", Request: catalog.EntryDTO{}, Status: http.StatusCreated},
+		"GET /medications":                                  {ID: "listMedications", Summary: "get the medications of the catalog"},
+		"GET /medications/{code}":                           {ID: "getMedication", Summary: "get a medication of the catalog"},
+		"PUT /medications/{code}/stock":                     {ID: "setStockOfMedication", Summary: "set the stock of a medication of the catalog", Request: catalog.EntryDTO{}},
+		"POST /medications/{code}/image":                    {ID: "uploadImageOfMedication", Summary: "upload the image of a medication (multipart form with the file in the field 'image')", Status: http.StatusCreated},
+		"GET /medications/{code}/image":                     {ID: "getImageOfMedication", Summary: "get the image of a medication", ContentType: "image/*"},
+		"GET /events":                                       {ID: "streamEvents", Summary: "stream the fleet events as server-sent events", Query: []string{"serial_number", "type", "last_event_id"}, ContentType: "text/event-stream"},
+		"GET /events/ws":                                    {ID: "streamEventsOverWebSocket", Summary: "stream the fleet events over a websocket", Query: []string{"serial_number", "type"}, Status: http.StatusSwitchingProtocols},
+		"POST /telemetry":                                   {ID: "ingestTelemetry", Summary: "report a telemetry reading of a drone", Request: telemetry.Reading{}},
+		"POST /telemetry/batch":                             {ID: "ingestTelemetryBatch", Summary: "report several telemetry readings", Request: []telemetry.Reading{}},
+		"POST /geofences":                                   {ID: "addGeofence", Summary: "add a no-fly zone", Request: geofence.Feature{}, Status: http.StatusCreated},
+		"GET /geofences":                                    {ID: "listGeofences", Summary: "get the no-fly zones"},
+		"POST /geofences/check":                             {ID: "checkGeofences", Summary: "check whether a point or a flight enters a no-fly zone", Request: GeofenceCheck{}},
+		"GET /geofences/{id}":                               {ID: "getGeofence", Summary: "get a no-fly zone"},
+		"PUT /geofences/{id}":                               {ID: "updateGeofence", Summary: "update a no-fly zone", Request: geofence.Feature{}},
+		"DELETE /geofences/{id}":                            {ID: "deleteGeofence", Summary: "delete a no-fly zone"},
+		"POST /routes/plan":                                 {ID: "planRoute", Summary: "plan the route of a flight around the no-fly zones", Request: RoutePlanRequest{}},
+		"POST /stations":                                    {ID: "addStation", Summary: "add a charging station", Request: station.StationDTO{}, Status: http.StatusCreated},
+		"GET /stations":                                     {ID: "listStations", Summary: "get the charging stations"},
+		"GET /stations/{id}":                                {ID: "getStation", Summary: "get a charging station"},
+		"DELETE /stations/{id}":                             {ID: "deleteStation", Summary: "delete a charging station"},
+		"GET /models":                                       {ID: "listModels", Summary: "get the capability profiles of the drone models"},
+		"GET /models/{name}":                                {ID: "getModel", Summary: "get the capability profile of a drone model"},
+		"GET /audit":                                        {ID: "listAuditEntries", Summary: "get the entries of the audit log", Query: []string{"serial", "from", "to"}},
+		"GET /audit/verify":                                 {ID: "verifyAuditLog", Summary: "check that the chain of the audit log has not been tampered with"},
+	}
+
+	//variables of the path templates
+	pathVariableRegexp = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+)
+
+//add the route of the OpenAPI document to a router
+func (env *environment) addOpenAPIRoutes(router *mux.Router) {
+	router.HandleFunc("/openapi.json", env.getOpenAPIDocument).Methods("GET")
+}
+
+//http handler to get the OpenAPI document of every route of the api
+func (env *environment) getOpenAPIDocument(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(env.openAPI)
+	if err != nil {
+		log.Printf("could not write OpenAPI document: %v", err)
+	}
+}
+
+//get the OpenAPI document of the routes of the router
+func (env *environment) newOpenAPIDocument() *openapi.Document {
+
+	doc := openapi.NewDocument(openapi.Info{
+		Title:       "Drones Management API",
+		Description: "Registration, loading and delivery of medications with a fleet of drones.",
+		Version:     apiVersion,
+	})
+
+	if env.auth != nil {
+		doc.AddSecurityScheme("apiKey", openapi.SecurityScheme{Type: "apiKey", Name: "X-API-Key", In: "header"})
+		doc.AddSecurityScheme("bearer", openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"})
+	}
+
+	envelope := doc.SchemaOf(Response{})
+
+	_ = env.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		for _, v := range methods {
+			d, ok := routeDocs[permissionKey(v, template)]
+			if !ok {
+				log.Printf("route %s %s is not documented, so it is not in the OpenAPI document", v, template)
+				continue
+			}
+			doc.AddOperation(v, pathVariableRegexp.ReplaceAllString(template, "{$1}"), d.operation(doc, template, envelope))
+		}
+		return nil
+	})
+
+	return doc
+}
+
+//get the operation of a route in the versioned api or in the legacy routes
+func (d routeDoc) operation(doc *openapi.Document, template string, envelope *openapi.Schema) openapi.Operation {
+
+	legacy := !strings.HasPrefix(template, apiV1Prefix+"/")
+
+	operation := openapi.Operation{
+		OperationID: d.ID,
+		Summary:     d.Summary,
+		Tags:        []string{strings.Split(strings.TrimPrefix(strings.TrimPrefix(template, apiV1Prefix), "/"), "/")[0]},
+		Responses:   map[string]openapi.Response{"default": {Description: "error", Content: jsonContent(envelope)}},
+	}
+	if legacy && template != "/openapi.json" {
+		operation.OperationID += "Legacy"
+		operation.Tags = []string{"legacy"}
+	}
+
+	for _, v := range pathVariableRegexp.FindAllStringSubmatch(template, -1) {
+		operation.Parameters = append(operation.Parameters, openapi.Parameter{Name: v[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}})
+	}
+	for _, v := range d.Query {
+		parameter := queryParameters[v]
+		parameter.Name, parameter.In = v, "query"
+		operation.Parameters = append(operation.Parameters, parameter)
+	}
+
+	if d.Request != nil {
+		operation.RequestBody = &openapi.RequestBody{Required: true, Content: jsonContent(doc.SchemaOf(d.Request))}
+	}
+
+	status := d.Status
+	if status == 0 || (legacy && status == http.StatusCreated) {
+		//the legacy routes return 200 instead of 201
+		status = http.StatusOK
+	}
+
+	success := openapi.Response{Description: http.StatusText(status)}
+	switch {
+	case d.ContentType != "":
+		success.Content = map[string]openapi.MediaType{d.ContentType: {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}
+	case status == http.StatusSwitchingProtocols:
+	case d.Response != nil:
+		success.Content = jsonContent(doc.SchemaOf(d.Response))
+	default:
+		success.Content = jsonContent(envelope)
+	}
+	operation.Responses[strconv.Itoa(status)] = success
+
+	return operation
+}
+
+//get the json content of a body with a schema
+func jsonContent(schema *openapi.Schema) map[string]openapi.MediaType {
+	return map[string]openapi.MediaType{"application/json": {Schema: schema}}
+}
+
+//keep the json of the OpenAPI document of the routes of the router
+func (env *environment) setUpOpenAPIDocument() {
+
+	var err error
+	env.openAPI, err = json.Marshal(env.newOpenAPIDocument())
+	if err != nil {
+		log.Printf("could not encode OpenAPI document: %v", err)
+	}
+}
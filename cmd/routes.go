@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/geo"
+	"drones/pkg/geofence"
+	"drones/pkg/route"
+)
+
+type (
+	//a request to plan the route of a flight around the no-fly zones
+	RoutePlanRequest struct {
+		SerialNumber string     `json:"serial_number,omitempty"` // drone flying from its home base (when 'from' is not given)
+		From         *geo.Point `json:"from,omitempty"`
+		To           *geo.Point `json:"to"`
+		MarginMeters float64    `json:"margin_m,omitempty"` // distance kept from the corners of the zones (50 m when empty)
+	}
+)
+
+//add the routes of the planning of flight routes to a router
+func (env *environment) addRoutePlanningRoutes(router *mux.Router) {
+	router.HandleFunc("/routes/plan", env.planRoute).Methods("POST")
+}
+
+//http handler to plan the route of a flight around the no-fly zones, as a GeoJSON LineString
+func (env *environment) planRoute(w http.ResponseWriter, r *http.Request) {
+
+	request := RoutePlanRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		errMessage := "could not decode route plan request json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	if request.To == nil {
+		errMessage := "a destination ('to') is needed to plan a route"
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	from := request.From
+	if from == nil && request.SerialNumber != "" {
+		droneObj := env.getDrone(request.SerialNumber)
+		if droneObj == nil {
+			errMessage := fmt.Sprintf("drone with serial number '%s' was not found", request.SerialNumber)
+			log.Println(errMessage)
+			writeError(w, http.StatusNotFound, errMessage)
+			return
+		}
+		from = droneObj.GetHomeBase()
+	}
+
+	if from == nil {
+		errMessage := "an origin ('from') or a drone with a home base ('serial_number') is needed to plan a route"
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	planned, err := route.Plan(*from, *request.To, env.geofences.Outlines(), request.MarginMeters/1000)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not plan the route: %s", err.Error())
+		log.Println(errMessage)
+		blocked := &route.BlockedError{}
+		if errors.As(err, &blocked) {
+			writeErrorResponse(w, http.StatusConflict, Response{
+				Details:   errMessage,
+				Geofences: []geofence.Feature{blocked.Zone},
+			})
+			return
+		}
+		if from.Validate() == nil && request.To.Validate() == nil {
+			writeError(w, http.StatusConflict, errMessage)
+			return
+		}
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	feature := planned.GetFeature()
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("route of %.3f km with %d waypoints", feature.Properties.DistanceKm, feature.Properties.Waypoints),
+		Route:   &feature,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/station"
+)
+
+//add the routes of the charging stations to a router
+func (env *environment) addStationRoutes(router *mux.Router) {
+	router.HandleFunc("/stations", env.addStation).Methods("POST")
+	router.HandleFunc("/stations", env.getAllStations).Methods("GET")
+	router.HandleFunc("/stations/{id}", env.getStation).Methods("GET")
+	router.HandleFunc("/stations/{id}", env.deleteStation).Methods("DELETE")
+}
+
+//http handler to add a charging station
+func (env *environment) addStation(w http.ResponseWriter, r *http.Request) {
+
+	dto := station.StationDTO{}
+
+	err := json.NewDecoder(r.Body).Decode(&dto)
+	if err != nil {
+		errMessage := "could not decode station json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	if _, ok := env.stations.Get(dto.ID); ok && dto.ID != "" {
+		errMessage := fmt.Sprintf("station with id %s already exists", dto.ID)
+		log.Println(errMessage)
+		writeError(w, http.StatusConflict, errMessage)
+		return
+	}
+
+	dto, err = env.stations.Add(dto)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not add station: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	writeCreated(w, "/stations/"+dto.ID)
+	err = json.NewEncoder(w).Encode(Response{
+		OK:       true,
+		Details:  fmt.Sprintf("new station with id %s added", dto.ID),
+		Stations: []station.StationDTO{dto},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("new station added: %s (%s) with %d slots", dto.ID, dto.Name, dto.Slots)
+}
+
+//http handler to get all charging stations with the drones charging and waiting in them
+func (env *environment) getAllStations(w http.ResponseWriter, r *http.Request) {
+
+	stations := env.stations.GetAll()
+
+	charging, queued := 0, 0
+	for _, v := range stations {
+		charging += len(v.Charging)
+		queued += len(v.Queue)
+	}
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:       true,
+		Details:  fmt.Sprintf("this are the %d stations, with %d drones charging and %d waiting", len(stations), charging, queued),
+		Stations: stations,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to get a charging station with the drones charging and waiting in it
+func (env *environment) getStation(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	dto, ok := env.stations.Get(id)
+	if !ok {
+		errMessage := fmt.Sprintf("station with id '%s' was not found", id)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:       true,
+		Details:  fmt.Sprintf("this is the station with id %s, with %d of %d slots free", id, dto.FreeSlots, dto.Slots),
+		Stations: []station.StationDTO{dto},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to remove a charging station that has no drones
+func (env *environment) deleteStation(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	if _, ok := env.stations.Get(id); !ok {
+		errMessage := fmt.Sprintf("station with id '%s' was not found", id)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	err := env.stations.Delete(id)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not remove station: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusConflict, errMessage)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("station with id %s removed", id),
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("station %s removed", id)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/auth"
+	"drones/pkg/events"
+	"drones/pkg/telemetry"
+)
+
+//add the routes of the telemetry reported by drones to a router
+func (env *environment) addTelemetryRoutes(router *mux.Router) {
+	router.HandleFunc("/telemetry", env.ingestTelemetry).Methods("POST")
+	router.HandleFunc("/telemetry/batch", env.ingestTelemetryBatch).Methods("POST")
+}
+
+//http handler to ingest a reading reported by a drone
+func (env *environment) ingestTelemetry(w http.ResponseWriter, r *http.Request) {
+
+	reading := telemetry.Reading{}
+
+	err := json.NewDecoder(r.Body).Decode(&reading)
+	if err != nil {
+		errMessage := "could not decode telemetry json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	result := env.ingestReading(reportingDevice(r), 0, reading)
+
+	if result.Status != telemetry.StatusAccepted {
+		errMessage := fmt.Sprintf("reading of drone %s was rejected: %s", result.SerialNumber, result.Reason)
+		writeErrorResponse(w, telemetryStatusCode(result.Status), Response{
+			Details:   errMessage,
+			Telemetry: []telemetry.Result{result},
+		})
+		return
+	}
+
+	details := fmt.Sprintf("reading of drone %s accepted", result.SerialNumber)
+	if result.StateMismatch {
+		details = fmt.Sprintf("%s, but it reports %s while it is %s for the controller", details, result.ReportedState, result.ControllerState)
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:        true,
+		Details:   details,
+		Telemetry: []telemetry.Result{result},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to ingest a list of readings (each one is accepted or rejected on its own, in the order of the list)
+func (env *environment) ingestTelemetryBatch(w http.ResponseWriter, r *http.Request) {
+
+	readings := make([]telemetry.Reading, 0)
+
+	err := json.NewDecoder(r.Body).Decode(&readings)
+	if err != nil {
+		errMessage := "could not decode list of telemetry json objects"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	device := reportingDevice(r)
+	results := make([]telemetry.Result, 0, len(readings))
+	accepted := 0
+	for i, v := range readings {
+		result := env.ingestReading(device, i, v)
+		if result.Status == telemetry.StatusAccepted {
+			accepted++
+		}
+		results = append(results, result)
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:        accepted == len(readings),
+		Details:   fmt.Sprintf("%d of %d readings accepted", accepted, len(readings)),
+		Telemetry: results,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//get the serial number of the drone device that reports the readings of a request (empty when the client is not a drone device)
+func reportingDevice(r *http.Request) string {
+
+	principal, ok := auth.FromContext(r.Context())
+	if !ok || principal.Role != auth.RoleDevice {
+		return ""
+	}
+
+	//the subject of the credentials of a drone device is its serial number
+	return principal.Subject
+}
+
+//apply a reading to its drone, persisting and publishing the changes when it is accepted
+//(a drone device may only report the readings of its own drone)
+func (env *environment) ingestReading(device string, index int, reading telemetry.Reading) telemetry.Result {
+
+	if device != "" && reading.SerialNumber != device {
+		result := telemetry.Result{
+			Index:        index,
+			SerialNumber: reading.SerialNumber,
+			Timestamp:    reading.Timestamp,
+			Status:       telemetry.StatusForbidden,
+			Reason:       fmt.Sprintf("drone device %s can not report the readings of another drone", device),
+		}
+		log.Printf("reading %d of drone %s rejected (%s): %s", index, result.SerialNumber, result.Status, result.Reason)
+		return result
+	}
+
+	droneObj := env.getDrone(reading.SerialNumber)
+
+	previousBatteryCapacity := uint8(0)
+	if droneObj != nil {
+		previousBatteryCapacity = droneObj.GetBatteryCapacity()
+	}
+
+	result := env.telemetry.Ingest(index, reading, droneObj)
+	if result.Status != telemetry.StatusAccepted {
+		log.Printf("reading %d of drone %s rejected (%s): %s", index, result.SerialNumber, result.Status, result.Reason)
+		return result
+	}
+
+	if droneObj.GetBatteryCapacity() != previousBatteryCapacity {
+		env.publishEvent(events.TypeBatteryUpdated, droneObj)
+	}
+
+	if result.StateMismatch {
+		log.Printf("drone %s reports %s while it is %s for the controller", result.SerialNumber, result.ReportedState, result.ControllerState)
+		env.publishEvent(events.TypeStateMismatch, droneObj)
+	}
+
+	err := env.persistDrone(droneObj)
+	if err != nil {
+		log.Printf("could not persist reading of drone %s: %v", result.SerialNumber, err)
+	}
+
+	return result
+}
+
+//get the http status code of a rejected reading
+func telemetryStatusCode(status string) int {
+
+	switch status {
+	case telemetry.StatusUnknown:
+		return http.StatusNotFound
+	case telemetry.StatusForbidden:
+		return http.StatusForbidden
+	case telemetry.StatusStale, telemetry.StatusOutOfOrder, telemetry.StatusFromFuture:
+		return http.StatusConflict
+	}
+
+	return http.StatusUnprocessableEntity
+}
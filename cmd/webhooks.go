@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"drones/pkg/webhook"
+)
+
+//add the routes of the webhook notifications to a router
+func (env *environment) addWebhookRoutes(router *mux.Router) {
+	router.HandleFunc("/webhooks", env.subscribeWebhook).Methods("POST")
+	router.HandleFunc("/webhooks", env.getAllWebhooks).Methods("GET")
+	router.HandleFunc("/webhooks/dead-letters", env.getWebhookDeadLetters).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", env.getWebhook).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", env.unsubscribeWebhook).Methods("DELETE")
+}
+
+//http handler to subscribe a receiver to webhook notifications
+func (env *environment) subscribeWebhook(w http.ResponseWriter, r *http.Request) {
+
+	dto := webhook.SubscriptionDTO{}
+
+	err := json.NewDecoder(r.Body).Decode(&dto)
+	if err != nil {
+		errMessage := "could not decode webhook json object"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	subscription, err := env.webhooks.Subscribe(dto)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not subscribe webhook: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusUnprocessableEntity, errMessage)
+		return
+	}
+
+	writeCreated(w, "/webhooks/"+subscription.ID)
+	err = json.NewEncoder(w).Encode(Response{
+		OK:       true,
+		Details:  fmt.Sprintf("new webhook with id %s subscribed", subscription.ID),
+		Webhooks: []webhook.SubscriptionDTO{subscription},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("new webhook subscribed: %s to %v", subscription.URL, subscription.EventTypes)
+}
+
+//http handler to get all webhook subscriptions
+func (env *environment) getAllWebhooks(w http.ResponseWriter, r *http.Request) {
+
+	subscriptions := env.webhooks.GetAll()
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:       true,
+		Details:  fmt.Sprintf("this are the %d webhooks", len(subscriptions)),
+		Webhooks: subscriptions,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to get a webhook subscription
+func (env *environment) getWebhook(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	subscription, ok := env.webhooks.Get(id)
+	if !ok {
+		errMessage := fmt.Sprintf("webhook with id '%s' was not found", id)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:       true,
+		Details:  fmt.Sprintf("this is the webhook with id %s", id),
+		Webhooks: []webhook.SubscriptionDTO{subscription},
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
+
+//http handler to remove a webhook subscription
+func (env *environment) unsubscribeWebhook(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	if _, ok := env.webhooks.Get(id); !ok {
+		errMessage := fmt.Sprintf("webhook with id '%s' was not found", id)
+		log.Println(errMessage)
+		writeError(w, http.StatusNotFound, errMessage)
+		return
+	}
+
+	err := env.webhooks.Unsubscribe(id)
+	if err != nil {
+		errMessage := fmt.Sprintf("could not remove webhook: %s", err.Error())
+		log.Println(errMessage)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(Response{
+		OK:      true,
+		Details: fmt.Sprintf("webhook with id %s removed", id),
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	log.Printf("webhook %s removed", id)
+}
+
+//http handler to get the webhook deliveries that failed on every attempt
+func (env *environment) getWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+
+	deadLetters := env.webhooks.DeadLetters()
+
+	err := json.NewEncoder(w).Encode(Response{
+		OK:          true,
+		Details:     fmt.Sprintf("this are the %d webhook deliveries that failed", len(deadLetters)),
+		DeadLetters: deadLetters,
+	})
+	if err != nil {
+		errMessage := "could not encode response"
+		log.Println(errMessage, ":", err)
+		writeError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+}
@@ -3,7 +3,7 @@ module drones
 go 1.17
 
 require (
-	github.com/Pallinder/go-randomdata v1.2.0 // indirect
-	github.com/gorilla/mux v1.8.0 // indirect
-	github.com/pkg/errors v0.9.1 // indirect
+	github.com/Pallinder/go-randomdata v1.2.0
+	github.com/gorilla/mux v1.8.0
+	github.com/pkg/errors v0.9.1
 )
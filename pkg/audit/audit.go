@@ -0,0 +1,352 @@
+// Implements a tamper-evident audit log of the operations on the drones: every entry is chained to the previous one
+//with its SHA-256 hash, so changing or removing an entry breaks the chain from there on.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/drone"
+)
+
+const (
+	//actions recorded in the log
+	ActionRegister    = "REGISTER"
+	ActionLoad        = "LOAD"
+	ActionUnload      = "UNLOAD"
+	ActionStateChange = "STATE_CHANGE"
+	ActionDeliverStop = "DELIVER_STOP"
+)
+
+type (
+	//an operation on a drone with the data of the drone before and after it
+	Entry struct {
+		Sequence     uint64          `json:"sequence"` // from 1, without gaps
+		Timestamp    time.Time       `json:"timestamp"`
+		Actor        string          `json:"actor"` // subject of the credentials of the request ("anonymous" without authentication)
+		Role         string          `json:"role,omitempty"`
+		RequestID    string          `json:"request_id,omitempty"`
+		Action       string          `json:"action"`
+		SerialNumber string          `json:"serial_number"`
+		MissionID    string          `json:"mission_id,omitempty"`
+		Before       *drone.DroneDTO `json:"before,omitempty"` // empty when the drone is registered
+		After        *drone.DroneDTO `json:"after,omitempty"`
+		PreviousHash string          `json:"previous_hash"` // empty in the first entry
+		Hash         string          `json:"hash,omitempty"`
+	}
+
+	//entries of the log between some limits (zero values mean no limit)
+	Filter struct {
+		SerialNumber string
+		From         time.Time
+		To           time.Time
+	}
+
+	//result of checking the chain of the log file
+	Verification struct {
+		OK       bool   `json:"ok"`
+		Entries  uint64 `json:"entries"`             // entries that were checked
+		LastHash string `json:"last_hash,omitempty"` // to be kept elsewhere: removing the last entries only shows comparing with it
+		BrokenAt uint64 `json:"broken_at,omitempty"` // line of the first entry that does not match the chain
+		Reason   string `json:"reason,omitempty"`
+	}
+
+	//keeps the entries of the log (appended to a file) and adds new ones to the chain
+	Log struct {
+		path     string // file where the entries are appended (empty to keep them only in memory)
+		file     *os.File
+		size     int64   // bytes of the acknowledged entries in the file
+		failed   error   // why the file could not be taken back after a failed write (nil while the log accepts entries)
+		entries  []Entry // oldest first
+		lastHash string
+		sync.Mutex
+	}
+
+	//a line of the log file: the hash is taken from the exact bytes of the entry
+	record struct {
+		Hash  string          `json:"hash"`
+		Entry json.RawMessage `json:"entry"`
+	}
+)
+
+//get a pointer to the log kept in the given file, reading the entries that it already has
+func NewLog(path string) (*Log, error) {
+
+	l := &Log{
+		path:    path,
+		entries: make([]Entry, 0),
+	}
+
+	if path == "" {
+		return l, nil
+	}
+
+	err := l.replay()
+	if err != nil {
+		return nil, err
+	}
+
+	l.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open audit file")
+	}
+
+	info, err := l.file.Stat()
+	if err != nil {
+		l.file.Close()
+		return nil, errors.Wrap(err, "could not read audit file")
+	}
+	l.size = info.Size()
+
+	return l, nil
+}
+
+//add an entry at the end of the chain, returning it with its sequence and hashes
+func (l *Log) Record(entry Entry) (Entry, error) {
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.failed != nil {
+		return Entry{}, errors.Wrap(l.failed, "audit log does not accept entries")
+	}
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	entry.Timestamp = entry.Timestamp.UTC()
+	entry.Sequence = uint64(len(l.entries)) + 1
+	entry.PreviousHash = l.lastHash
+	entry.Hash = ""
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, errors.Wrap(err, "could not marshal audit entry")
+	}
+	entry.Hash = hash(data)
+
+	if l.file != nil {
+		line, err := json.Marshal(record{Hash: entry.Hash, Entry: data})
+		if err != nil {
+			return Entry{}, errors.Wrap(err, "could not marshal audit record")
+		}
+
+		err = l.append(append(line, '\n'))
+		if err != nil {
+			return Entry{}, err
+		}
+	}
+
+	l.entries = append(l.entries, entry)
+	l.lastHash = entry.Hash
+
+	return entry, nil
+}
+
+//write a record at the end of the log file, taking the file back to its size before the write when it fails, so the next
+//records are not written after a partial one (the log stops accepting entries when that is not possible) (the caller must hold the lock)
+func (l *Log) append(line []byte) error {
+
+	_, err := l.file.Write(line)
+	if err != nil {
+		err = errors.Wrap(err, "could not write audit entry")
+	} else {
+		//an entry that was acknowledged must not be lost
+		err = errors.Wrap(l.file.Sync(), "could not sync audit file")
+	}
+	if err == nil {
+		l.size += int64(len(line))
+		return nil
+	}
+
+	rollbackErr := l.file.Truncate(l.size)
+	if rollbackErr == nil {
+		rollbackErr = l.file.Sync()
+	}
+	if rollbackErr != nil {
+		l.failed = errors.Wrapf(rollbackErr, "audit file %s could not be taken back to %d bytes after a failed write", l.path, l.size)
+		log.Printf("ERROR: %v", l.failed)
+	}
+
+	return err
+}
+
+//get the entries that match the filter, oldest first
+func (l *Log) Query(filter Filter) []Entry {
+
+	l.Lock()
+	defer l.Unlock()
+
+	entries := make([]Entry, 0)
+	for _, v := range l.entries {
+		if filter.SerialNumber != "" && v.SerialNumber != filter.SerialNumber {
+			continue
+		}
+		if !filter.From.IsZero() && v.Timestamp.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && v.Timestamp.After(filter.To) {
+			continue
+		}
+		entries = append(entries, v)
+	}
+
+	return entries
+}
+
+//check the chain of the entries in the log file (what is on disk, not what was read when it was opened)
+func (l *Log) Verify() (Verification, error) {
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.path == "" {
+		return Verification{OK: true, Entries: uint64(len(l.entries)), LastHash: l.lastHash}, nil
+	}
+
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return Verification{OK: true}, nil
+	}
+	if err != nil {
+		return Verification{}, errors.Wrap(err, "could not open audit file")
+	}
+	defer f.Close()
+
+	return verify(f), nil
+}
+
+//close the log file
+func (l *Log) Close() error {
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+//read the log file and keep its entries, going on from the last one even when the chain is broken
+func (l *Log) replay() error {
+
+	f, err := os.OpenFile(l.path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not open audit file")
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	for {
+		rec := record{}
+		lastGoodOffset := decoder.InputOffset()
+
+		err = decoder.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			//a partially written record (e.g. the app was killed while writing) was never acknowledged
+			log.Printf("audit file %s is corrupted after offset %d, discarding the rest: %v", l.path, lastGoodOffset, err)
+			err = f.Truncate(lastGoodOffset)
+			if err != nil {
+				return errors.Wrap(err, "could not truncate audit file")
+			}
+			break
+		}
+
+		entry := Entry{}
+		err = json.Unmarshal(rec.Entry, &entry)
+		if err != nil {
+			return errors.Wrapf(err, "entry %d of audit file is not valid", len(l.entries)+1)
+		}
+		entry.Hash = rec.Hash
+
+		l.entries = append(l.entries, entry)
+		l.lastHash = rec.Hash
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return errors.Wrap(err, "could not read audit file")
+	}
+
+	if result := verify(f); !result.OK {
+		log.Printf("WARNING: audit file %s has been tampered with at line %d: %s", l.path, result.BrokenAt, result.Reason)
+	}
+
+	return nil
+}
+
+//check the chain of the records of a log file
+func verify(r io.Reader) Verification {
+
+	result := Verification{OK: true}
+	previousHash := ""
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := result.Entries + 1
+
+		broken := func(reason string) Verification {
+			return Verification{Entries: result.Entries, BrokenAt: line, Reason: reason}
+		}
+
+		rec := record{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return broken("the record is not valid json")
+		}
+
+		if hash(rec.Entry) != rec.Hash {
+			return broken("the entry does not match its hash")
+		}
+
+		entry := Entry{}
+		if err := json.Unmarshal(rec.Entry, &entry); err != nil {
+			return broken("the entry is not valid json")
+		}
+
+		if entry.Sequence != line {
+			return broken(fmt.Sprintf("the entry has the sequence %d", entry.Sequence))
+		}
+
+		if entry.PreviousHash != previousHash {
+			return broken("the entry is not chained to the previous one")
+		}
+
+		previousHash = rec.Hash
+		result.Entries = line
+		result.LastHash = rec.Hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Verification{Entries: result.Entries, BrokenAt: result.Entries + 1, Reason: err.Error()}
+	}
+
+	return result
+}
+
+//get the hex SHA-256 of some data
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
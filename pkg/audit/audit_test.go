@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"drones/pkg/drone"
+)
+
+//record some entries of the operations on two drones
+func recordEntries(t *testing.T, l *Log, start time.Time) {
+
+	idle := drone.DroneDTO{SerialNumber: "DRONE-1", State: drone.StateIdle}
+	loaded := drone.DroneDTO{SerialNumber: "DRONE-1", State: drone.StateLoaded}
+
+	entries := []Entry{
+		{Timestamp: start, Actor: "ops", Action: ActionRegister, SerialNumber: "DRONE-1", After: &idle},
+		{Timestamp: start.Add(time.Minute), Actor: "ops", Action: ActionRegister, SerialNumber: "DRONE-2", After: &drone.DroneDTO{SerialNumber: "DRONE-2"}},
+		{Timestamp: start.Add(2 * time.Minute), Actor: "pharmacy", Action: ActionLoad, SerialNumber: "DRONE-1", Before: &idle, After: &loaded},
+	}
+	for _, v := range entries {
+		if _, err := l.Record(v); err != nil {
+			t.Fatalf("error while recording entry for test:%v", err)
+		}
+	}
+}
+
+func Test_Log(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	start := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+
+	l, err := NewLog(path)
+	if err != nil {
+		t.Fatalf("error while creating log for test:%v", err)
+	}
+	recordEntries(t, l, start)
+
+	entries := l.Query(Filter{SerialNumber: "DRONE-1"})
+	if len(entries) != 2 || entries[1].Action != ActionLoad || entries[1].Sequence != 3 || entries[1].Before.State != drone.StateIdle {
+		t.Fatalf("the entries of DRONE-1 must be returned oldest first but they were %+v", entries)
+	}
+
+	if entries[0].PreviousHash != "" || entries[1].PreviousHash == "" || entries[1].Hash == "" {
+		t.Errorf("entries must be chained with their hashes but they were %+v", entries)
+	}
+
+	if entries = l.Query(Filter{From: start.Add(time.Minute), To: start.Add(time.Minute)}); len(entries) != 1 || entries[0].SerialNumber != "DRONE-2" {
+		t.Errorf("only the entry within the limits must be returned but they were %+v", entries)
+	}
+
+	all := l.Query(Filter{})
+	if err = l.Close(); err != nil {
+		t.Fatalf("error while closing log for test:%v", err)
+	}
+
+	//the chain goes on from the entries in the file
+	l, err = NewLog(path)
+	if err != nil {
+		t.Fatalf("error while opening log for test:%v", err)
+	}
+	defer l.Close()
+
+	entry, err := l.Record(Entry{Actor: "ops", Action: ActionStateChange, SerialNumber: "DRONE-2"})
+	if err != nil {
+		t.Fatalf("error while recording entry for test:%v", err)
+	}
+	if entry.Sequence != 4 || entry.PreviousHash != all[2].Hash {
+		t.Errorf("a new entry must be chained to the last one in the file but it was %+v", entry)
+	}
+
+	result, err := l.Verify()
+	if err != nil || !result.OK || result.Entries != 4 || result.LastHash != entry.Hash {
+		t.Errorf("an untouched log must be verified but result was %+v (%v)", result, err)
+	}
+}
+
+func Test_Log_tampered(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	l, err := NewLog(path)
+	if err != nil {
+		t.Fatalf("error while creating log for test:%v", err)
+	}
+	defer l.Close()
+	recordEntries(t, l, time.Now())
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error while reading log for test:%v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	cases := map[string]struct {
+		lines    []string
+		brokenAt uint64
+	}{
+		"changed":  {[]string{lines[0], strings.Replace(lines[1], `"actor":"ops"`, `"actor":"someone"`, 1), lines[2]}, 2},
+		"removed":  {[]string{lines[0], lines[2]}, 2},
+		"reversed": {[]string{lines[1], lines[0], lines[2]}, 1},
+	}
+	for name, v := range cases {
+		if err = ioutil.WriteFile(path, []byte(strings.Join(v.lines, "\n")+"\n"), 0644); err != nil {
+			t.Fatalf("error while writing log for test:%v", err)
+		}
+
+		result, err := l.Verify()
+		if err != nil || result.OK || result.BrokenAt != v.brokenAt {
+			t.Errorf("a log with an entry %s must be broken at line %d but result was %+v (%v)", name, v.brokenAt, result, err)
+		}
+	}
+}
+
+func Test_Log_failedWrite(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	l, err := NewLog(path)
+	if err != nil {
+		t.Fatalf("error while creating log for test:%v", err)
+	}
+	defer l.Close()
+	recordEntries(t, l, time.Now())
+
+	//a file where nothing can be written nor taken back
+	file := l.file
+	l.file, err = os.Open(path)
+	if err != nil {
+		t.Fatalf("error while opening log for test:%v", err)
+	}
+	defer file.Close()
+
+	if _, err = l.Record(Entry{Actor: "ops", Action: ActionStateChange, SerialNumber: "DRONE-2"}); err == nil {
+		t.Fatalf("an entry that could not be written must not be acknowledged")
+	}
+
+	//the log must not write after what the failed write may have left
+	l.file = file
+	if _, err = l.Record(Entry{Actor: "ops", Action: ActionStateChange, SerialNumber: "DRONE-2"}); err == nil {
+		t.Errorf("a log that could not be taken back after a failed write must not accept entries")
+	}
+
+	result, err := l.Verify()
+	if err != nil || !result.OK || result.Entries != 3 {
+		t.Errorf("the acknowledged entries must be kept but result was %+v (%v)", result, err)
+	}
+}
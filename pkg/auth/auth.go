@@ -0,0 +1,186 @@
+// Implements the authentication of the clients of the api (API keys and signed JWTs) and their roles.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	//roles of the clients
+	RoleOperator   = "operator"     // manages the fleet: drones, missions, geofences, stations and webhooks
+	RolePharmacist = "pharmacist"   // manages the catalog and loads medications on drones
+	RoleViewer     = "viewer"       // only reads
+	RoleDevice     = "drone-device" // a drone reporting its telemetry
+
+	//headers with the credentials of a request
+	APIKeyHeader        = "X-API-Key"
+	AuthorizationHeader = "Authorization" // "Bearer " followed by a JWT
+
+	//parameter of the query with a JWT, for the clients that can not set headers (EventSource and WebSocket in browsers)
+	TokenParameter = "access_token"
+)
+
+var (
+	ErrNoCredentials      = errors.New("the request has no credentials")
+	ErrInvalidCredentials = errors.New("the credentials of the request are not valid")
+)
+
+type (
+	//define an API key given to a client
+	APIKey struct {
+		Key  string `json:"key"`
+		Name string `json:"name"` // who the key was given to
+		Role string `json:"role"`
+	}
+
+	//define a secret to verify the JWTs signed with HS256
+	JWTKey struct {
+		ID     string `json:"id"` // matched against the "kid" of the header of a token (the key is tried when the token has none)
+		Secret string `json:"secret"`
+	}
+
+	//the authenticated client of a request
+	Principal struct {
+		Subject string `json:"subject"` // name of the API key or "sub" of the JWT
+		Role    string `json:"role"`
+	}
+
+	//verifies the credentials of the requests
+	Authenticator struct {
+		apiKeys map[[sha256.Size]byte]APIKey // use the hash of the key as key, so the lookup does not depend on the key itself
+		jwtKeys []JWTKey
+		now     func() time.Time
+	}
+
+	contextKey struct{}
+)
+
+//get an authenticator for the given keys
+func NewAuthenticator(apiKeys []APIKey, jwtKeys []JWTKey) (*Authenticator, error) {
+
+	a := &Authenticator{
+		apiKeys: make(map[[sha256.Size]byte]APIKey),
+		jwtKeys: make([]JWTKey, 0, len(jwtKeys)),
+		now:     time.Now,
+	}
+
+	for i, v := range apiKeys {
+		if len(v.Key) < minSecretLength || v.Name == "" {
+			return nil, errors.Errorf("API key %d must have a name and a key of %d characters at least", i, minSecretLength)
+		}
+		if !IsValidRole(v.Role) {
+			return nil, errors.Errorf("API key %s has a role that is not valid: %s", v.Name, v.Role)
+		}
+		hash := sha256.Sum256([]byte(v.Key))
+		if _, ok := a.apiKeys[hash]; ok {
+			return nil, errors.Errorf("API key %s is repeated", v.Name)
+		}
+		a.apiKeys[hash] = v
+	}
+
+	for i, v := range jwtKeys {
+		if len(v.Secret) < minSecretLength {
+			return nil, errors.Errorf("JWT key %d must have a secret of %d characters at least", i, minSecretLength)
+		}
+		a.jwtKeys = append(a.jwtKeys, v)
+	}
+
+	return a, nil
+}
+
+//get the client of a request from its API key or its bearer token
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return a.authenticateAPIKey(key)
+	}
+
+	authorization := r.Header.Get(AuthorizationHeader)
+	if authorization == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	const bearer = "bearer "
+	if len(authorization) <= len(bearer) || !strings.EqualFold(authorization[:len(bearer)], bearer) {
+		return Principal{}, errors.Wrap(ErrInvalidCredentials, "authorization must be a bearer token")
+	}
+
+	return a.authenticateToken(strings.TrimSpace(authorization[len(bearer):]))
+}
+
+//get the client of a request from the JWT in its query (only for the routes whose clients can not set headers)
+func (a *Authenticator) AuthenticateQuery(r *http.Request) (Principal, error) {
+
+	token := r.URL.Query().Get(TokenParameter)
+	if token == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	return a.authenticateToken(token)
+}
+
+//get the client of an API key
+func (a *Authenticator) authenticateAPIKey(key string) (Principal, error) {
+
+	v, ok := a.apiKeys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return Principal{}, errors.Wrap(ErrInvalidCredentials, "unknown API key")
+	}
+
+	return Principal{Subject: v.Name, Role: v.Role}, nil
+}
+
+//get the client of a JWT
+func (a *Authenticator) authenticateToken(token string) (Principal, error) {
+
+	claims, err := verifyToken(token, a.jwtKeys, a.now())
+	if err != nil {
+		return Principal{}, errors.Wrap(ErrInvalidCredentials, err.Error())
+	}
+
+	if claims.Subject == "" || !IsValidRole(claims.Role) {
+		return Principal{}, errors.Wrap(ErrInvalidCredentials, "the token must have a subject and a valid role")
+	}
+
+	return Principal{Subject: claims.Subject, Role: claims.Role}, nil
+}
+
+//check whether a role exists
+func IsValidRole(role string) bool {
+
+	switch role {
+	case RoleOperator, RolePharmacist, RoleViewer, RoleDevice:
+		return true
+	}
+
+	return false
+}
+
+//check whether the principal has one of the roles
+func (p Principal) HasRole(roles ...string) bool {
+
+	for _, v := range roles {
+		if p.Role == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+//get a context that carries the principal
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+//get the principal carried by a context
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	testAPIKeys = []APIKey{
+		{Key: "pharmacist-key-0123456789", Name: "pharmacy-madrid", Role: RolePharmacist},
+		{Key: "viewer-key-0123456789", Name: "dashboard", Role: RoleViewer},
+	}
+	testJWTKeys = []JWTKey{
+		{ID: "2026-01", Secret: "first-secret-0123456789"},
+		{ID: "2026-02", Secret: "second-secret-0123456789"},
+	}
+)
+
+func Test_NewAuthenticator(t *testing.T) {
+
+	invalid := [][]APIKey{
+		{{Key: "short", Name: "short", Role: RoleViewer}},
+		{{Key: "viewer-key-0123456789", Name: "", Role: RoleViewer}},
+		{{Key: "viewer-key-0123456789", Name: "dashboard", Role: "admin"}},
+		{testAPIKeys[1], {Key: testAPIKeys[1].Key, Name: "copy", Role: RoleOperator}},
+	}
+	for _, v := range invalid {
+		if _, err := NewAuthenticator(v, nil); err == nil {
+			t.Errorf("API keys %+v must not be accepted", v)
+		}
+	}
+
+	if _, err := NewAuthenticator(nil, []JWTKey{{ID: "short", Secret: "short"}}); err == nil {
+		t.Errorf("a JWT key with a short secret must not be accepted")
+	}
+}
+
+func Test_Authenticate_apiKey(t *testing.T) {
+
+	a, err := NewAuthenticator(testAPIKeys, testJWTKeys)
+	if err != nil {
+		t.Fatalf("error while creating authenticator for test:%v", err)
+	}
+
+	r := httptest.NewRequest("GET", "/drone/all", nil)
+	if _, err = a.Authenticate(r); err != ErrNoCredentials {
+		t.Errorf("a request without credentials must return %v but returned %v", ErrNoCredentials, err)
+	}
+
+	r.Header.Set(APIKeyHeader, "unknown-key-0123456789")
+	if _, err = a.Authenticate(r); errors.Cause(err) != ErrInvalidCredentials {
+		t.Errorf("an unknown API key must return %v but returned %v", ErrInvalidCredentials, err)
+	}
+
+	r.Header.Set(APIKeyHeader, testAPIKeys[0].Key)
+	p, err := a.Authenticate(r)
+	if err != nil || p.Subject != "pharmacy-madrid" || p.Role != RolePharmacist {
+		t.Errorf("a known API key must be authenticated as its client but it was %+v (%v)", p, err)
+	}
+}
+
+func Test_Authenticate_token(t *testing.T) {
+
+	a, err := NewAuthenticator(testAPIKeys, testJWTKeys)
+	if err != nil {
+		t.Fatalf("error while creating authenticator for test:%v", err)
+	}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	valid := Claims{Subject: "DRONE-1", Role: RoleDevice, ExpiresAt: now.Add(time.Hour).Unix()}
+
+	token, err := SignToken(testJWTKeys[1], valid)
+	if err != nil {
+		t.Fatalf("error while signing token for test:%v", err)
+	}
+
+	r := httptest.NewRequest("POST", "/telemetry", nil)
+	r.Header.Set(AuthorizationHeader, "Bearer "+token)
+	p, err := a.Authenticate(r)
+	if err != nil || p.Subject != "DRONE-1" || p.Role != RoleDevice {
+		t.Errorf("a valid token must be authenticated as its subject but it was %+v (%v)", p, err)
+	}
+
+	expired := valid
+	expired.ExpiresAt = now.Add(-time.Hour).Unix()
+	notYet := valid
+	notYet.NotBefore = now.Add(time.Hour).Unix()
+	withoutExpiration := valid
+	withoutExpiration.ExpiresAt = 0
+	unknownRole := valid
+	unknownRole.Role = "admin"
+
+	cases := map[string]string{
+		"expired":            mustSign(t, testJWTKeys[0], expired),
+		"not valid yet":      mustSign(t, testJWTKeys[0], notYet),
+		"without expiration": mustSign(t, testJWTKeys[0], withoutExpiration),
+		"with unknown role":  mustSign(t, testJWTKeys[0], unknownRole),
+		"signed by unknown":  mustSign(t, JWTKey{Secret: "unknown-secret-0123456789"}, valid),
+		"with other key id":  mustSign(t, JWTKey{ID: testJWTKeys[0].ID, Secret: testJWTKeys[1].Secret}, valid),
+		"not signed":         strings.Join(strings.Split(token, ".")[:2], ".") + ".",
+		"of algorithm none":  "eyJhbGciOiJub25lIn0." + strings.Split(token, ".")[1] + ".",
+		"malformed":          "not-a-token",
+	}
+	for name, v := range cases {
+		r.Header.Set(AuthorizationHeader, "Bearer "+v)
+		if _, err = a.Authenticate(r); errors.Cause(err) != ErrInvalidCredentials {
+			t.Errorf("a token %s must return %v but returned %v", name, ErrInvalidCredentials, err)
+		}
+	}
+
+	r.Header.Set(AuthorizationHeader, "Basic "+token)
+	if _, err = a.Authenticate(r); errors.Cause(err) != ErrInvalidCredentials {
+		t.Errorf("an authorization that is not a bearer token must return %v but returned %v", ErrInvalidCredentials, err)
+	}
+}
+
+func Test_AuthenticateQuery(t *testing.T) {
+
+	a, err := NewAuthenticator(testAPIKeys, testJWTKeys)
+	if err != nil {
+		t.Fatalf("error while creating authenticator for test:%v", err)
+	}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	token := mustSign(t, testJWTKeys[0], Claims{Subject: "dashboard", Role: RoleViewer, ExpiresAt: now.Add(time.Hour).Unix()})
+
+	r := httptest.NewRequest("GET", "/events", nil)
+	if _, err = a.AuthenticateQuery(r); err != ErrNoCredentials {
+		t.Errorf("a query without token must return %v but returned %v", ErrNoCredentials, err)
+	}
+
+	r = httptest.NewRequest("GET", "/events?"+TokenParameter+"=not-a-token", nil)
+	if _, err = a.AuthenticateQuery(r); errors.Cause(err) != ErrInvalidCredentials {
+		t.Errorf("a query with a malformed token must return %v but returned %v", ErrInvalidCredentials, err)
+	}
+
+	//API keys are not accepted in the query, so they do not end up in logs of urls
+	r = httptest.NewRequest("GET", "/events?"+TokenParameter+"="+testAPIKeys[1].Key, nil)
+	if _, err = a.AuthenticateQuery(r); errors.Cause(err) != ErrInvalidCredentials {
+		t.Errorf("a query with an API key must return %v but returned %v", ErrInvalidCredentials, err)
+	}
+
+	r = httptest.NewRequest("GET", "/events?"+TokenParameter+"="+token, nil)
+	p, err := a.AuthenticateQuery(r)
+	if err != nil || p.Subject != "dashboard" || p.Role != RoleViewer {
+		t.Errorf("a valid token in the query must be authenticated as its subject but it was %+v (%v)", p, err)
+	}
+}
+
+//get a signed token for a test
+func mustSign(t *testing.T, key JWTKey, claims Claims) string {
+
+	token, err := SignToken(key, claims)
+	if err != nil {
+		t.Fatalf("error while signing token for test:%v", err)
+	}
+
+	return token
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	//min length of API keys and JWT secrets
+	minSecretLength = 16
+	//difference allowed between the clock of the issuer of a token and ours
+	clockSkew = 30 * time.Second
+	//the only algorithm accepted in the tokens
+	algorithmHS256 = "HS256"
+)
+
+type (
+	//define the claims of a JWT that are used by the api
+	Claims struct {
+		Subject   string `json:"sub"`
+		Role      string `json:"role"`
+		ExpiresAt int64  `json:"exp"`           // unix time, required
+		NotBefore int64  `json:"nbf,omitempty"` // unix time
+		IssuedAt  int64  `json:"iat,omitempty"` // unix time
+	}
+
+	//header of a JWT
+	header struct {
+		Algorithm string `json:"alg"`
+		Type      string `json:"typ,omitempty"`
+		KeyID     string `json:"kid,omitempty"`
+	}
+)
+
+//get a JWT with the claims signed with HS256 by the key (meant for issuing tokens to clients and for tests)
+func SignToken(key JWTKey, claims Claims) (string, error) {
+
+	headerBytes, err := json.Marshal(header{Algorithm: algorithmHS256, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", errors.Wrap(err, "could not marshal header of token")
+	}
+
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "could not marshal claims of token")
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerBytes) + "." + base64.RawURLEncoding.EncodeToString(claimsBytes)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign(signingInput, key.Secret)), nil
+}
+
+//get the claims of a JWT after checking its signature against the keys and its times against now
+func verifyToken(token string, keys []JWTKey, now time.Time) (Claims, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, errors.New("the token is not a JWT")
+	}
+
+	h := header{}
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, errors.Wrap(err, "header of token is not valid")
+	}
+
+	//any other algorithm (including "none") is refused, so the header can not choose how it is verified
+	if h.Algorithm != algorithmHS256 {
+		return Claims{}, errors.Errorf("algorithm %s of token is not allowed", h.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, errors.Wrap(err, "signature of token is not valid")
+	}
+
+	signingInput := parts[0] + "." + parts[1]
+	verified := false
+	for _, v := range keys {
+		if h.KeyID != "" && h.KeyID != v.ID {
+			continue
+		}
+		if hmac.Equal(signature, sign(signingInput, v.Secret)) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return Claims{}, errors.New("signature of token does not match any key")
+	}
+
+	claims := Claims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, errors.Wrap(err, "claims of token are not valid")
+	}
+
+	if claims.ExpiresAt == 0 {
+		return Claims{}, errors.New("the token has no expiration")
+	}
+
+	if now.Add(-clockSkew).After(time.Unix(claims.ExpiresAt, 0)) {
+		return Claims{}, errors.New("the token has expired")
+	}
+
+	if claims.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(claims.NotBefore, 0)) {
+		return Claims{}, errors.New("the token is not valid yet")
+	}
+
+	return claims, nil
+}
+
+//get the HMAC-SHA256 of the signing input of a token
+func sign(signingInput string, secret string) []byte {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingInput))
+
+	return mac.Sum(nil)
+}
+
+//decode a base64url segment of a token as json
+func decodeSegment(segment string, v interface{}) error {
+
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,419 @@
+// Implements the catalog of medications: their master data (registered once by code) and their stock.
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/imagestore"
+	"drones/pkg/medication"
+)
+
+type (
+	//define a medication registered in the catalog
+	entry struct {
+		medication medication.Medication // canonical data of the medication (weight is the one of a unit)
+		stock      uint                  // units available
+	}
+
+	//define a data transfer object for a medication of the catalog
+	EntryDTO struct {
+		Code   string `json:"code"`            // (allowed only upper case letters, underscore and numbers);
+		Name   string `json:"name"`            // (allowed only letters, numbers, ‘-‘, ‘_’);
+		Weight uint   `json:"weight"`          // weight of a unit
+		Image  string `json:"image,omitempty"` // (picture of the medication case). // reference in the image store
+		Type   string `json:"type,omitempty"`  // (STANDARD when empty)
+		Stock  uint   `json:"stock"`           // units available
+	}
+
+	//a medication or item of a load that does not agree with the catalog and the reason why
+	RejectedItem struct {
+		Index  int    `json:"index"` // position in the list that was checked
+		Code   string `json:"code"`
+		Reason string `json:"reason"`
+	}
+
+	//error of a check against the catalog in which some items were rejected
+	CatalogError struct {
+		Rejected []RejectedItem
+	}
+
+	//keeps the medications registered by code, persisted in a json file
+	Catalog struct {
+		path           string                       // file where the catalog is persisted (empty to keep it only in memory)
+		entries        map[string]*entry            // use Code as key
+		imageReference func(string) (string, error) // turns the image of a medication into its reference (nil to keep it as it is)
+		sync.Mutex
+	}
+)
+
+//get the message of a catalog error
+func (e *CatalogError) Error() string {
+
+	reasons := make([]string, 0, len(e.Rejected))
+	for _, v := range e.Rejected {
+		reasons = append(reasons, fmt.Sprintf("item %d (%s): %s", v.Index, v.Code, v.Reason))
+	}
+
+	return fmt.Sprintf("%d items were rejected by the catalog: %s", len(e.Rejected), strings.Join(reasons, "; "))
+}
+
+//get a pointer to a catalog, reading the file when it already exists
+func NewCatalog(path string, imageReference func(string) (string, error)) (*Catalog, error) {
+
+	c := &Catalog{
+		path:           path,
+		entries:        make(map[string]*entry),
+		imageReference: imageReference,
+	}
+
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read catalog file")
+	}
+
+	dtos := make([]EntryDTO, 0)
+	err = json.Unmarshal(data, &dtos)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal catalog file")
+	}
+
+	for _, v := range dtos {
+		e, err := c.newEntry(v, true)
+		if err != nil {
+			return nil, errors.Wrapf(err, "medication %s of catalog file is not valid", v.Code)
+		}
+		c.entries[v.Code] = e
+	}
+
+	//images of files written before they were kept as references are replaced by their references
+	err = c.save()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+//register a new medication in the catalog
+func (c *Catalog) Register(dto EntryDTO) error {
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.entries[dto.Code] != nil {
+		return fmt.Errorf("medication with code %s is already registered", dto.Code)
+	}
+
+	e, err := c.newEntry(dto, false)
+	if err != nil {
+		return err
+	}
+
+	c.entries[dto.Code] = e
+
+	err = c.save()
+	if err != nil {
+		delete(c.entries, dto.Code)
+		return err
+	}
+
+	return nil
+}
+
+//get a registered medication by its code
+func (c *Catalog) Get(code string) (EntryDTO, bool) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	e := c.entries[code]
+	if e == nil {
+		return EntryDTO{}, false
+	}
+
+	return e.getDTOWithImage(), true
+}
+
+//get all registered medications sorted by code
+func (c *Catalog) GetAll() []EntryDTO {
+
+	c.Lock()
+	defer c.Unlock()
+
+	dtos := make([]EntryDTO, 0, len(c.entries))
+	for _, v := range c.entries {
+		dtos = append(dtos, v.getDTOWithImage())
+	}
+
+	sort.Slice(dtos, func(i, j int) bool {
+		return dtos[i].Code < dtos[j].Code
+	})
+
+	return dtos
+}
+
+//set the units available of a registered medication
+func (c *Catalog) SetStock(code string, stock uint) error {
+
+	c.Lock()
+	defer c.Unlock()
+
+	e := c.entries[code]
+	if e == nil {
+		return fmt.Errorf("medication with code %s is not registered", code)
+	}
+
+	previous := e.stock
+	e.stock = stock
+
+	err := c.save()
+	if err != nil {
+		e.stock = previous
+		return err
+	}
+
+	return nil
+}
+
+//set the reference of the image of a registered medication
+func (c *Catalog) SetImage(code string, image string) error {
+
+	c.Lock()
+	defer c.Unlock()
+
+	e := c.entries[code]
+	if e == nil {
+		return fmt.Errorf("medication with code %s is not registered", code)
+	}
+
+	dto := e.getDTOWithImage()
+	dto.Image = image
+
+	updated, err := c.newEntry(dto, false)
+	if err != nil {
+		return err
+	}
+
+	c.entries[code] = updated
+
+	err = c.save()
+	if err != nil {
+		c.entries[code] = e
+		return err
+	}
+
+	return nil
+}
+
+//take from the stock the units of the items, getting a medication per unit: either all of them are taken or none is
+func (c *Catalog) Reserve(items []medication.ItemDTO) ([]medication.MedicationDTO, error) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	//units requested per code, so the same code in several items is checked against the stock only once
+	requested := make(map[string]uint)
+	catalogErr := &CatalogError{}
+	for i, v := range items {
+		e := c.entries[v.Code]
+		switch {
+		case e == nil:
+			catalogErr.Rejected = append(catalogErr.Rejected, RejectedItem{Index: i, Code: v.Code, Reason: "medication is not registered in the catalog"})
+		case v.Quantity == 0:
+			catalogErr.Rejected = append(catalogErr.Rejected, RejectedItem{Index: i, Code: v.Code, Reason: "quantity must be greater than 0"})
+		case requested[v.Code]+v.Quantity > e.stock:
+			catalogErr.Rejected = append(catalogErr.Rejected, RejectedItem{Index: i, Code: v.Code, Reason: fmt.Sprintf("there are only %d units in stock", e.stock)})
+		default:
+			requested[v.Code] += v.Quantity
+		}
+	}
+
+	if len(catalogErr.Rejected) > 0 {
+		return nil, catalogErr
+	}
+
+	medications := make([]medication.MedicationDTO, 0)
+	for _, v := range items {
+		for i := uint(0); i < v.Quantity; i++ {
+			medications = append(medications, c.entries[v.Code].medication.GetDTOWithImage())
+		}
+	}
+
+	for k, v := range requested {
+		c.entries[k].stock -= v
+	}
+
+	err := c.save()
+	if err != nil {
+		for k, v := range requested {
+			c.entries[k].stock += v
+		}
+		return nil, err
+	}
+
+	return medications, nil
+}
+
+//give back to the stock the units of items that were reserved but not used
+func (c *Catalog) Release(items []medication.ItemDTO) error {
+
+	c.Lock()
+	defer c.Unlock()
+
+	for _, v := range items {
+		if e := c.entries[v.Code]; e != nil {
+			e.stock += v.Quantity
+		}
+	}
+
+	return c.save()
+}
+
+//get the units of the medications whose code is registered, as items to reserve from the stock
+func (c *Catalog) ItemsOf(medications []medication.MedicationDTO) []medication.ItemDTO {
+
+	c.Lock()
+	defer c.Unlock()
+
+	items := make([]medication.ItemDTO, 0)
+	index := make(map[string]int)
+	for _, v := range medications {
+		if c.entries[v.Code] == nil {
+			continue
+		}
+		i, ok := index[v.Code]
+		if !ok {
+			i = len(items)
+			index[v.Code] = i
+			items = append(items, medication.ItemDTO{Code: v.Code})
+		}
+		items[i].Quantity++
+	}
+
+	return items
+}
+
+//check that the medications whose code is registered have the name, weight and type of the catalog (STANDARD when it is empty)
+func (c *Catalog) Check(medications []medication.MedicationDTO) error {
+
+	c.Lock()
+	defer c.Unlock()
+
+	catalogErr := &CatalogError{}
+	for i, v := range medications {
+		e := c.entries[v.Code]
+		if e == nil {
+			continue
+		}
+		payloadType := v.Type
+		if payloadType == "" {
+			payloadType = medication.TypeStandard
+		}
+		if v.Name != e.medication.GetName() || v.Weight != e.medication.GetWeight() || payloadType != e.medication.GetType() {
+			catalogErr.Rejected = append(catalogErr.Rejected, RejectedItem{
+				Index:  i,
+				Code:   v.Code,
+				Reason: fmt.Sprintf("code is registered in the catalog as %s of %d gr (%s)", e.medication.GetName(), e.medication.GetWeight(), e.medication.GetType()),
+			})
+		}
+	}
+
+	if len(catalogErr.Rejected) > 0 {
+		return catalogErr
+	}
+
+	return nil
+}
+
+//write the whole catalog in its file (the caller must hold the lock)
+func (c *Catalog) save() error {
+
+	if c.path == "" {
+		return nil
+	}
+
+	dtos := make([]EntryDTO, 0, len(c.entries))
+	for _, v := range c.entries {
+		dtos = append(dtos, v.getDTOWithImage())
+	}
+
+	sort.Slice(dtos, func(i, j int) bool {
+		return dtos[i].Code < dtos[j].Code
+	})
+
+	data, err := json.MarshalIndent(dtos, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal catalog")
+	}
+
+	//the file is replaced at once, so a crash while writing does not leave it half written
+	tmpPath := c.path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not write catalog file")
+	}
+
+	return errors.Wrap(os.Rename(tmpPath, c.path), "could not replace catalog file")
+}
+
+//get a catalog entry from a DTO (the image references of a stored entry are kept as they are, only its base64 images are replaced)
+func (c *Catalog) newEntry(dto EntryDTO, stored bool) (*entry, error) {
+
+	if dto.Weight == 0 {
+		return nil, errors.New("weight of a unit must be greater than 0")
+	}
+
+	if c.imageReference != nil && !(stored && imagestore.IsReference(dto.Image)) {
+		image, err := c.imageReference(dto.Image)
+		if err != nil {
+			return nil, errors.Wrap(err, "image of medication is not valid")
+		}
+		dto.Image = image
+	}
+
+	medicationObj, err := medication.NewMedication(medication.MedicationDTO{
+		Name:   dto.Name,
+		Weight: dto.Weight,
+		Code:   dto.Code,
+		Image:  dto.Image,
+		Type:   dto.Type,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry{
+		medication: *medicationObj,
+		stock:      dto.Stock,
+	}, nil
+}
+
+//get DTO of a catalog entry including the image
+func (e *entry) getDTOWithImage() EntryDTO {
+
+	m := e.medication.GetDTOWithImage()
+
+	return EntryDTO{
+		Code:   m.Code,
+		Name:   m.Name,
+		Weight: m.Weight,
+		Image:  m.Image,
+		Type:   m.Type,
+		Stock:  e.stock,
+	}
+}
@@ -0,0 +1,141 @@
+package catalog
+
+import (
+	"path/filepath"
+	"testing"
+
+	"drones/pkg/medication"
+)
+
+//get a catalog with two registered medications persisted in a temporary file
+func newCatalog(t *testing.T) (*Catalog, string) {
+
+	path := filepath.Join(t.TempDir(), "catalog.json")
+
+	c, err := NewCatalog(path, nil)
+	if err != nil {
+		t.Fatalf("error while creating catalog for test:%v", err)
+	}
+
+	for _, v := range []EntryDTO{
+		{Code: "DIP_10", Name: "dipirona", Weight: 110, Stock: 3},
+		{Code: "ASP_20", Name: "aspirin", Weight: 20, Stock: 10},
+	} {
+		if err = c.Register(v); err != nil {
+			t.Fatalf("error while registering medication %s:%v", v.Code, err)
+		}
+	}
+
+	return c, path
+}
+
+func Test_Catalog_Register(t *testing.T) {
+
+	c, path := newCatalog(t)
+
+	if err := c.Register(EntryDTO{Code: "DIP_10", Name: "other", Weight: 1}); err == nil {
+		t.Errorf("a code must not be registered twice")
+	}
+
+	if err := c.Register(EntryDTO{Code: "not-valid", Name: "other", Weight: 1}); err == nil {
+		t.Errorf("a medication with a not valid code must not be registered")
+	}
+
+	if err := c.Register(EntryDTO{Code: "NO_WEIGHT", Name: "other"}); err == nil {
+		t.Errorf("a medication without weight must not be registered")
+	}
+
+	reopened, err := NewCatalog(path, nil)
+	if err != nil {
+		t.Fatalf("error while reopening catalog:%v", err)
+	}
+
+	all := reopened.GetAll()
+	if len(all) != 2 || all[0].Code != "ASP_20" || all[1].Stock != 3 {
+		t.Errorf("catalog must keep its 2 medications sorted by code after reopening but kept %+v", all)
+	}
+}
+
+func Test_Catalog_Reserve(t *testing.T) {
+
+	c, _ := newCatalog(t)
+
+	_, err := c.Reserve([]medication.ItemDTO{
+		{Code: "DIP_10", Quantity: 2},
+		{Code: "DIP_10", Quantity: 2},
+		{Code: "UNKNOWN", Quantity: 1},
+		{Code: "ASP_20", Quantity: 0},
+	})
+
+	catalogErr, ok := err.(*CatalogError)
+	if !ok {
+		t.Fatalf("reserving items that do not agree with the catalog must return a *CatalogError but returned %v", err)
+	}
+
+	if len(catalogErr.Rejected) != 3 || catalogErr.Rejected[0].Index != 1 {
+		t.Errorf("items 1, 2 and 3 must be rejected but rejected were %+v", catalogErr.Rejected)
+	}
+
+	if dto, _ := c.Get("DIP_10"); dto.Stock != 3 {
+		t.Errorf("stock must not change after a rejected reservation but it is %d", dto.Stock)
+	}
+
+	medications, err := c.Reserve([]medication.ItemDTO{{Code: "DIP_10", Quantity: 2}, {Code: "ASP_20", Quantity: 1}})
+	if err != nil {
+		t.Fatalf("error while reserving items:%v", err)
+	}
+
+	if len(medications) != 3 || medications[0].Name != "dipirona" || medications[2].Weight != 20 {
+		t.Errorf("a medication with the data of the catalog must be returned per unit but returned %+v", medications)
+	}
+
+	if dto, _ := c.Get("DIP_10"); dto.Stock != 1 {
+		t.Errorf("stock must be 1 after reserving 2 of 3 units but it is %d", dto.Stock)
+	}
+
+	if err = c.Release([]medication.ItemDTO{{Code: "DIP_10", Quantity: 2}}); err != nil {
+		t.Fatalf("error while releasing items:%v", err)
+	}
+
+	if dto, _ := c.Get("DIP_10"); dto.Stock != 3 {
+		t.Errorf("stock must be 3 after releasing the reserved units but it is %d", dto.Stock)
+	}
+}
+
+func Test_Catalog_Check(t *testing.T) {
+
+	c, _ := newCatalog(t)
+
+	err := c.Check([]medication.MedicationDTO{
+		{Name: "dipirona", Code: "DIP_10", Weight: 110},
+		{Name: "other-name", Code: "ASP_20", Weight: 20},
+		{Name: "not-registered", Code: "NEW_1", Weight: 5},
+		{Name: "dipirona", Code: "DIP_10", Weight: 110, Type: medication.TypeRefrigerated},
+		{Name: "aspirin", Code: "ASP_20", Weight: 20, Type: medication.TypeStandard},
+	})
+
+	catalogErr, ok := err.(*CatalogError)
+	if !ok {
+		t.Fatalf("medications that do not agree with the catalog must return a *CatalogError but returned %v", err)
+	}
+
+	if len(catalogErr.Rejected) != 2 || catalogErr.Rejected[0].Code != "ASP_20" || catalogErr.Rejected[1].Index != 3 {
+		t.Errorf("only the medications with a registered code and another name or type must be rejected but rejected were %+v", catalogErr.Rejected)
+	}
+}
+
+func Test_Catalog_ItemsOf(t *testing.T) {
+
+	c, _ := newCatalog(t)
+
+	items := c.ItemsOf([]medication.MedicationDTO{
+		{Name: "aspirin", Code: "ASP_20", Weight: 20},
+		{Name: "not-registered", Code: "NEW_1", Weight: 5},
+		{Name: "dipirona", Code: "DIP_10", Weight: 110},
+		{Name: "aspirin", Code: "ASP_20", Weight: 20},
+	})
+
+	if len(items) != 2 || items[0] != (medication.ItemDTO{Code: "ASP_20", Quantity: 2}) || items[1] != (medication.ItemDTO{Code: "DIP_10", Quantity: 1}) {
+		t.Errorf("only the units of registered codes must be items but they were %+v", items)
+	}
+}
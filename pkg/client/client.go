@@ -0,0 +1,305 @@
+// Implements a typed go client of the versioned api of the drones (/api/v1).
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/drone"
+	"drones/pkg/medication"
+	"drones/pkg/query"
+)
+
+//prefix of the routes of the versioned api
+const apiPrefix = "/api/v1"
+
+type (
+	//client of the api of a server
+	Client struct {
+		baseURL    string
+		httpClient *http.Client
+		apiKey     string
+		token      string
+	}
+
+	//option of a client
+	Option func(*Client)
+
+	//filters, order and page of a list of drones (zero values are not sent)
+	ListOptions struct {
+		Limit           int
+		Cursor          string // next cursor of the previous page
+		Sort            string // serial, battery or free_capacity, with a leading '-' for descending order
+		Models          []string
+		States          []string
+		MinBattery      *int
+		HasMedications  *bool
+		MinFreeCapacity *int // grams
+	}
+
+	//error returned by the api
+	Error struct {
+		StatusCode int
+		Details    string
+		Rejected   []drone.RejectedMedication // medications that were not loaded
+	}
+
+	//envelope of every response of the api
+	envelope struct {
+		OK       bool                       `json:"ok"`
+		Details  string                     `json:"details,omitempty"`
+		Drones   []drone.DroneDTO           `json:"drones,omitempty"`
+		Rejected []drone.RejectedMedication `json:"rejected,omitempty"`
+		Page     *query.Page                `json:"page,omitempty"`
+	}
+)
+
+//get a client of the api of a server (like http://localhost:8099)
+func New(baseURL string, options ...Option) *Client {
+
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+//use a http client to send the requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+//authenticate the requests with an API key
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+//authenticate the requests with a bearer token
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+//get the message of an error of the api
+func (e *Error) Error() string {
+	return fmt.Sprintf("drones api returned %d: %s", e.StatusCode, e.Details)
+}
+
+//register a drone
+func (c *Client) RegisterDrone(ctx context.Context, dto drone.DroneDTO) (drone.DroneDTO, error) {
+
+	response, err := c.do(ctx, http.MethodPost, "/drones", nil, dto)
+	if err != nil {
+		return drone.DroneDTO{}, err
+	}
+
+	return firstDrone(response)
+}
+
+//get a registered drone
+func (c *Client) GetDrone(ctx context.Context, serialNumber string) (drone.DroneDTO, error) {
+
+	response, err := c.do(ctx, http.MethodGet, "/drones/"+url.PathEscape(serialNumber), nil, nil)
+	if err != nil {
+		return drone.DroneDTO{}, err
+	}
+
+	return firstDrone(response)
+}
+
+//get a page of the registered drones
+func (c *Client) ListDrones(ctx context.Context, options ListOptions) ([]drone.DroneDTO, query.Page, error) {
+
+	response, err := c.do(ctx, http.MethodGet, "/drones", options.values(), nil)
+	if err != nil {
+		return nil, query.Page{}, err
+	}
+
+	page := query.Page{Total: len(response.Drones)}
+	if response.Page != nil {
+		page = *response.Page
+	}
+
+	return response.Drones, page, nil
+}
+
+//load medications, and items of the catalog by their code, on a drone (none is loaded when any is rejected)
+func (c *Client) LoadMedications(ctx context.Context, serialNumber string, medications []medication.MedicationDTO, items []medication.ItemDTO) (drone.DroneDTO, error) {
+
+	load := drone.DroneDTO{Medications: medications, Items: items}
+
+	response, err := c.do(ctx, http.MethodPost, "/drones/"+url.PathEscape(serialNumber)+"/medications", nil, load)
+	if err != nil {
+		return drone.DroneDTO{}, err
+	}
+
+	return firstDrone(response)
+}
+
+//get the medications loaded on a drone
+func (c *Client) GetMedications(ctx context.Context, serialNumber string) ([]medication.MedicationDTO, error) {
+
+	response, err := c.do(ctx, http.MethodGet, "/drones/"+url.PathEscape(serialNumber)+"/medications", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dto, err := firstDrone(response)
+	if err != nil {
+		return nil, err
+	}
+
+	if dto.Medications == nil {
+		return []medication.MedicationDTO{}, nil
+	}
+
+	return dto.Medications, nil
+}
+
+//unload the medications with a code from a drone (every medication when the code is empty)
+func (c *Client) UnloadMedications(ctx context.Context, serialNumber string, code string) (drone.DroneDTO, error) {
+
+	path := "/drones/" + url.PathEscape(serialNumber) + "/medications"
+	if code != "" {
+		path += "/" + url.PathEscape(code)
+	}
+
+	response, err := c.do(ctx, http.MethodDelete, path, nil, nil)
+	if err != nil {
+		return drone.DroneDTO{}, err
+	}
+
+	return firstDrone(response)
+}
+
+//get the battery level of a drone (percentage)
+func (c *Client) GetBattery(ctx context.Context, serialNumber string) (uint8, error) {
+
+	response, err := c.do(ctx, http.MethodGet, "/drones/"+url.PathEscape(serialNumber)+"/battery", nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	dto, err := firstDrone(response)
+	if err != nil {
+		return 0, err
+	}
+
+	return dto.BatteryCapacity, nil
+}
+
+//send a request to a path of the versioned api, returning the envelope of a success or the error of the api
+func (c *Client) do(ctx context.Context, method string, path string, values url.Values, body interface{}) (envelope, error) {
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return envelope{}, errors.Wrap(err, "could not encode request")
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := c.baseURL + apiPrefix + path
+	if len(values) > 0 {
+		target += "?" + values.Encode()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return envelope{}, errors.Wrap(err, "could not create request")
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		request.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return envelope{}, errors.Wrapf(err, "could not send request %s %s", method, path)
+	}
+	defer response.Body.Close()
+
+	result := envelope{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil && response.StatusCode < 300 {
+		return envelope{}, errors.Wrapf(err, "could not decode response of %s %s", method, path)
+	}
+
+	if response.StatusCode >= 300 || !result.OK {
+		details := result.Details
+		if details == "" {
+			details = http.StatusText(response.StatusCode)
+		}
+		return envelope{}, &Error{StatusCode: response.StatusCode, Details: details, Rejected: result.Rejected}
+	}
+
+	return result, nil
+}
+
+//get the drone of a response
+func firstDrone(response envelope) (drone.DroneDTO, error) {
+
+	if len(response.Drones) == 0 {
+		return drone.DroneDTO{}, errors.New("response has no drone")
+	}
+
+	return response.Drones[0], nil
+}
+
+//get the parameters of the query of a list
+func (o ListOptions) values() url.Values {
+
+	values := url.Values{}
+
+	if o.Limit > 0 {
+		values.Set(query.LimitParameter, strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		values.Set(query.CursorParameter, o.Cursor)
+	}
+	if o.Sort != "" {
+		values.Set(query.SortParameter, o.Sort)
+	}
+	if len(o.Models) > 0 {
+		values.Set("model", strings.Join(o.Models, ","))
+	}
+	if len(o.States) > 0 {
+		values.Set("state", strings.Join(o.States, ","))
+	}
+	if o.MinBattery != nil {
+		values.Set("min_battery", strconv.Itoa(*o.MinBattery))
+	}
+	if o.HasMedications != nil {
+		values.Set("has_medications", strconv.FormatBool(*o.HasMedications))
+	}
+	if o.MinFreeCapacity != nil {
+		values.Set("min_free_capacity", strconv.Itoa(*o.MinFreeCapacity))
+	}
+
+	return values
+}
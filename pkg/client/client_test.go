@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_ListOptions_values(t *testing.T) {
+
+	minBattery, hasMedications := 25, false
+	options := ListOptions{Limit: 10, Sort: "-battery", States: []string{"IDLE", "LOADING"}, MinBattery: &minBattery, HasMedications: &hasMedications}
+
+	expected := "has_medications=false&limit=10&min_battery=25&sort=-battery&state=IDLE%2CLOADING"
+	if query := options.values().Encode(); query != expected {
+		t.Errorf("query must be %s but it was %s", expected, query)
+	}
+
+	if query := (ListOptions{}).values().Encode(); query != "" {
+		t.Errorf("empty options must not be sent but query was %s", query)
+	}
+}
+
+func Test_Client_error(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer a-token" || r.URL.Path != "/api/v1/drones/DRONE-1/medications" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"ok":false,"details":"none was loaded","rejected":[{"index":0,"code":"DIP_10","reason":"too heavy"}]}`))
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL+"/", WithToken("a-token")).LoadMedications(context.Background(), "DRONE-1", nil, nil)
+
+	apiErr := &Error{}
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.Details != "none was loaded" || len(apiErr.Rejected) != 1 {
+		t.Errorf("error of the api must be returned but it was %v", err)
+	}
+}
@@ -7,6 +7,10 @@ import (
 	"log"
 
 	"github.com/pkg/errors"
+
+	"drones/pkg/auth"
+	"drones/pkg/drone"
+	"drones/pkg/geo"
 )
 
 // represents the configuration for the app
@@ -14,6 +18,42 @@ type Config struct {
 	ApiPort          string `json:"api_port"`
 	LocalURL         string `json:"local_url"`
 	LogPeriodMinutes uint16 `json:"log_period_minutes"`
+	DataFile         string `json:"data_file"`
+	CatalogFile      string `json:"catalog_file"`
+	ImagesDir        string `json:"images_dir"`        // directory of the image store
+	MaxImageSizeKB   uint16 `json:"max_image_size_kb"` // max size of an uploaded image
+	//time series of battery levels taken on every periodic check
+	BatteryHistorySize int    `json:"battery_history_size"` // samples kept per drone
+	BatteryHistoryFile string `json:"battery_history_file"`
+	//simulation of battery drain and charge (meant for staging environments)
+	SimulationEnabled     bool   `json:"simulation_enabled"`
+	SimulationTickSeconds uint16 `json:"simulation_tick_seconds"`
+	//outbound webhooks
+	WebhooksFile          string `json:"webhooks_file"`
+	WebhookMaxAttempts    uint16 `json:"webhook_max_attempts"`    // attempts of a delivery before it is a dead letter
+	WebhookBackoffSeconds uint16 `json:"webhook_backoff_seconds"` // wait before the first retry, doubled on every next one
+	//readings reported by drones older than this are rejected
+	TelemetryMaxAgeSeconds uint16 `json:"telemetry_max_age_seconds"`
+	//home base of the drones registered without one (they can not be sent to destinations with coordinates when empty)
+	HomeBase *geo.Point `json:"home_base"`
+	//GeoJSON file with the no-fly zones (polygons, and points with a radius in meters)
+	GeofencesFile string `json:"geofences_file"`
+	//charging stations and the drones charging or waiting in them
+	StationsFile string `json:"stations_file"`
+	//usage since the last service after which a drone is due for service (a negative value disables the check)
+	ServiceFlightHours   float64 `json:"service_flight_hours"`
+	ServiceCycles        int64   `json:"service_cycles"`         // flights
+	ServiceBatteryCycles float64 `json:"service_battery_cycles"` // full charges of the battery
+	//capability profiles of the models, added to the built-in ones (or replacing them when the name matches)
+	Models []drone.ModelProfile `json:"models"`
+	//append-only log of the operations on the drones, chained with hashes
+	AuditFile string `json:"audit_file"`
+	//authentication of the clients (every route is open when it is disabled)
+	AuthEnabled bool          `json:"auth_enabled"`
+	APIKeys     []auth.APIKey `json:"api_keys"`
+	JWTKeys     []auth.JWTKey `json:"jwt_keys"` // secrets of the HS256 tokens
+	//origins (like https://example.com) of the browser pages allowed to open WebSockets, besides the host of the api
+	AllowedOrigins []string `json:"allowed_origins"`
 }
 
 // returns a parsed json formatted configuration
@@ -46,5 +86,97 @@ func Parse(filepath string) (*Config, error) {
 		config.LogPeriodMinutes = 1
 	}
 
+	//setting a default value for the file where drones are persisted if empty
+	if config.DataFile == "" {
+		config.DataFile = "drones_data.jsonl"
+	}
+
+	//setting a default value for the file of the catalog of medications if empty
+	if config.CatalogFile == "" {
+		config.CatalogFile = "catalog.json"
+	}
+
+	//setting a default value for the directory of the image store if empty
+	if config.ImagesDir == "" {
+		config.ImagesDir = "images"
+	}
+
+	//setting a default value for the max size of images if empty
+	if config.MaxImageSizeKB == 0 {
+		config.MaxImageSizeKB = 1024
+	}
+
+	//setting a default value for the samples of battery history if empty (a day with the default log period)
+	if config.BatteryHistorySize == 0 {
+		config.BatteryHistorySize = 1440
+	}
+
+	//setting a default value for the file of battery history if empty
+	if config.BatteryHistoryFile == "" {
+		config.BatteryHistoryFile = "battery_history.jsonl"
+	}
+
+	//setting a default value for the tick of the simulation if empty
+	if config.SimulationTickSeconds == 0 {
+		config.SimulationTickSeconds = 10
+	}
+
+	//setting a default value for the file of webhooks if empty
+	if config.WebhooksFile == "" {
+		config.WebhooksFile = "webhooks.json"
+	}
+
+	//setting a default value for the attempts of a webhook delivery if empty
+	if config.WebhookMaxAttempts == 0 {
+		config.WebhookMaxAttempts = 5
+	}
+
+	//setting a default value for the backoff of webhook retries if empty
+	if config.WebhookBackoffSeconds == 0 {
+		config.WebhookBackoffSeconds = 2
+	}
+
+	if config.HomeBase != nil {
+		err = config.HomeBase.Validate()
+		if err != nil {
+			return nil, errors.Wrap(err, "home base of config is not valid")
+		}
+	}
+
+	//setting a default value for the file of no-fly zones if empty
+	if config.GeofencesFile == "" {
+		config.GeofencesFile = "geofences.geojson"
+	}
+
+	//setting a default value for the file of charging stations if empty
+	if config.StationsFile == "" {
+		config.StationsFile = "stations.json"
+	}
+
+	//setting a default value for the file of the audit log if empty
+	if config.AuditFile == "" {
+		config.AuditFile = "audit.jsonl"
+	}
+
+	//setting a default value for the flight hours between services if empty
+	if config.ServiceFlightHours == 0 {
+		config.ServiceFlightHours = 50
+	}
+
+	//setting a default value for the flights between services if empty
+	if config.ServiceCycles == 0 {
+		config.ServiceCycles = 500
+	}
+
+	//setting a default value for the battery cycles between services if empty
+	if config.ServiceBatteryCycles == 0 {
+		config.ServiceBatteryCycles = 300
+	}
+
+	//setting a default value for the max age of readings if empty
+	if config.TelemetryMaxAgeSeconds == 0 {
+		config.TelemetryMaxAgeSeconds = 300
+	}
+
 	return &config, nil
 }
@@ -0,0 +1,243 @@
+// Implements the planning of which available drones should carry a set of medications.
+package dispatch
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/drone"
+	"drones/pkg/geo"
+	"drones/pkg/medication"
+)
+
+type (
+	//define a request of planning
+	PlanRequest struct {
+		Medications []medication.MedicationDTO `json:"medications"`
+		Models      []string                   `json:"models,omitempty"`      // allowed models (all of them when empty)
+		Destination *geo.Point                 `json:"destination,omitempty"` // drones must reach it and return to base (not checked when empty)
+	}
+
+	//medications assigned to a drone
+	Assignment struct {
+		SerialNumber string                     `json:"serial_number"`
+		Model        string                     `json:"model"`
+		Medications  []medication.MedicationDTO `json:"medications"`
+		TotalWeight  uint                       `json:"total_weight"`
+		FreeCapacity uint                       `json:"free_capacity"` // weight that the drone could still carry
+	}
+
+	//result of a planning
+	Plan struct {
+		Assignments []Assignment               `json:"assignments"`
+		Unassigned  []medication.MedicationDTO `json:"unassigned,omitempty"` // medications that no available drone can carry (to the destination)
+	}
+
+	//a drone that can take part in the plan
+	bin struct {
+		droneObj *drone.Drone
+		capacity uint
+		items    []medication.MedicationDTO
+		load     uint
+	}
+)
+
+//get a plan that assigns the medications to the drones available for loading, using as few drones as possible
+func PlanLoad(request PlanRequest, drones []*drone.Drone) (Plan, error) {
+
+	if len(request.Medications) == 0 {
+		return Plan{}, errors.New("there are not medications to plan")
+	}
+
+	for _, v := range request.Medications {
+		_, err := medication.NewMedication(v)
+		if err != nil {
+			return Plan{}, err
+		}
+	}
+
+	if request.Destination != nil {
+		err := request.Destination.Validate()
+		if err != nil {
+			return Plan{}, errors.Wrap(err, "destination is not valid")
+		}
+	}
+
+	bins := candidates(drones, request.Models)
+
+	//first fit decreasing: heaviest medications first, opening the biggest drone only when no opened one can take them
+	items := make([]medication.MedicationDTO, len(request.Medications))
+	copy(items, request.Medications)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Weight > items[j].Weight
+	})
+
+	opened := make([]*bin, 0)
+	plan := Plan{
+		Assignments: make([]Assignment, 0),
+	}
+
+	for _, item := range items {
+		item := []medication.MedicationDTO{item}
+		target := bestFit(opened, item, request.Destination)
+		if target == nil {
+			target = firstFit(bins, item, request.Destination)
+			if target != nil {
+				opened = append(opened, target)
+				bins = remove(bins, target)
+			}
+		}
+		if target == nil {
+			plan.Unassigned = append(plan.Unassigned, item...)
+			continue
+		}
+		target.items = append(target.items, item...)
+		target.load += weightOf(item)
+	}
+
+	//every opened drone is replaced by the smallest unused one that can carry the same load, leaving the big ones free
+	for i, v := range opened {
+		smaller := bestFit(bins, v.items, request.Destination)
+		if smaller != nil && smaller.capacity < v.capacity {
+			smaller.items, smaller.load = v.items, v.load
+			bins = remove(bins, smaller)
+			bins = append(bins, &bin{droneObj: v.droneObj, capacity: v.capacity})
+			opened[i] = smaller
+		}
+	}
+
+	for _, v := range opened {
+		plan.Assignments = append(plan.Assignments, Assignment{
+			SerialNumber: v.droneObj.GetSerialNumber(),
+			Model:        v.droneObj.GetModel(),
+			Medications:  v.items,
+			TotalWeight:  v.load,
+			FreeCapacity: v.capacity - v.load,
+		})
+	}
+
+	return plan, nil
+}
+
+//get the drones that are available for loading and have one of the allowed models, biggest capacity first
+func candidates(drones []*drone.Drone, models []string) []*bin {
+
+	bins := make([]*bin, 0)
+	for _, v := range drones {
+		if !v.IsAvailableForLoading() || !allowedModel(v.GetModel(), models) {
+			continue
+		}
+		if v.GetWeightLimit() <= v.CurrentWeight() {
+			continue
+		}
+		bins = append(bins, &bin{
+			droneObj: v,
+			capacity: uint(v.GetWeightLimit() - v.CurrentWeight()),
+		})
+	}
+
+	//on equal capacity, drones with more battery are preferred (and serial number keeps the order stable)
+	sort.Slice(bins, func(i, j int) bool {
+		if bins[i].capacity != bins[j].capacity {
+			return bins[i].capacity > bins[j].capacity
+		}
+		if bins[i].droneObj.GetBatteryCapacity() != bins[j].droneObj.GetBatteryCapacity() {
+			return bins[i].droneObj.GetBatteryCapacity() > bins[j].droneObj.GetBatteryCapacity()
+		}
+		return bins[i].droneObj.GetSerialNumber() < bins[j].droneObj.GetSerialNumber()
+	})
+
+	return bins
+}
+
+//get the first bin that can take the medications (nil when none can take them)
+func firstFit(bins []*bin, medications []medication.MedicationDTO, destination *geo.Point) *bin {
+
+	for _, v := range bins {
+		if v.canTake(medications, destination) {
+			return v
+		}
+	}
+
+	return nil
+}
+
+//get the bin that would have the least free capacity after taking the medications (nil when none can take them)
+func bestFit(bins []*bin, medications []medication.MedicationDTO, destination *geo.Point) *bin {
+
+	var best *bin
+	for _, v := range bins {
+		if !v.canTake(medications, destination) {
+			continue
+		}
+		if best == nil || v.capacity-v.load < best.capacity-best.load {
+			best = v
+		}
+	}
+
+	return best
+}
+
+//check whether the drone of a bin can carry the medications (their weight and their types) and still reach the destination
+//and return to base with them
+func (b *bin) canTake(medications []medication.MedicationDTO, destination *geo.Point) bool {
+
+	weight := weightOf(medications)
+	if b.load+weight > b.capacity {
+		return false
+	}
+
+	for _, v := range medications {
+		if !b.droneObj.CanCarry(v.Type) {
+			return false
+		}
+	}
+
+	if destination == nil {
+		return true
+	}
+
+	payload := uint(b.droneObj.CurrentWeight()) + b.load + weight
+	return b.droneObj.CheckRange(*destination, uint16(payload)) == nil
+}
+
+//get the total weight of a list of medications
+func weightOf(medications []medication.MedicationDTO) uint {
+
+	weight := uint(0)
+	for _, v := range medications {
+		weight += v.Weight
+	}
+
+	return weight
+}
+
+//get the bins without the given one
+func remove(bins []*bin, target *bin) []*bin {
+
+	result := make([]*bin, 0, len(bins))
+	for _, v := range bins {
+		if v != target {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+//check whether a model is one of the allowed ones (any model is allowed when the list is empty)
+func allowedModel(model string, models []string) bool {
+
+	if len(models) == 0 {
+		return true
+	}
+
+	for _, v := range models {
+		if v == model {
+			return true
+		}
+	}
+
+	return false
+}
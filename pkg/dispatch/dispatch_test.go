@@ -0,0 +1,180 @@
+package dispatch
+
+import (
+	"testing"
+
+	"drones/pkg/drone"
+	"drones/pkg/geo"
+	"drones/pkg/medication"
+)
+
+//get a drone with the given data
+func newDrone(t *testing.T, serialNumber string, model string, weightLimit uint16, batteryCapacity uint8, state string) *drone.Drone {
+
+	droneObj, err := drone.RestoreDrone(drone.DroneDTO{
+		SerialNumber:    serialNumber,
+		Model:           model,
+		WeightLimit:     weightLimit,
+		BatteryCapacity: batteryCapacity,
+		State:           state,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	return droneObj
+}
+
+//get a list of medications with the given weights
+func newMedications(weights ...uint) []medication.MedicationDTO {
+
+	medications := make([]medication.MedicationDTO, 0)
+	for _, v := range weights {
+		medications = append(medications, medication.MedicationDTO{Name: "Medication", Code: "CODE", Weight: v})
+	}
+
+	return medications
+}
+
+func Test_PlanLoad(t *testing.T) {
+
+	drones := []*drone.Drone{
+		newDrone(t, "LIGHT-1", drone.ModelLightweight, 100, 100, drone.StateIdle),
+		newDrone(t, "LIGHT-2", drone.ModelLightweight, 100, 100, drone.StateIdle),
+		newDrone(t, "MIDDLE-1", drone.ModelMiddleweight, 300, 100, drone.StateIdle),
+		newDrone(t, "HEAVY-1", drone.ModelHeavyweight, 500, 100, drone.StateIdle),
+		newDrone(t, "HEAVY-LOW-BATTERY", drone.ModelHeavyweight, 500, drone.MinBatteryLevelForLoading-1, drone.StateIdle),
+		newDrone(t, "HEAVY-BUSY", drone.ModelHeavyweight, 500, 100, drone.StateDelivering),
+	}
+
+	plan, err := PlanLoad(PlanRequest{Medications: newMedications(200, 150, 100, 50)}, drones)
+	if err != nil {
+		t.Fatalf("error while planning:%v", err)
+	}
+
+	if len(plan.Unassigned) != 0 {
+		t.Errorf("all medications must be assigned but %+v were not", plan.Unassigned)
+	}
+
+	if len(plan.Assignments) != 1 || plan.Assignments[0].SerialNumber != "HEAVY-1" || plan.Assignments[0].TotalWeight != 500 {
+		t.Errorf("500g of medications must be assigned to the only available heavyweight drone but plan was %+v", plan.Assignments)
+	}
+
+	plan, err = PlanLoad(PlanRequest{Medications: newMedications(90, 80)}, drones)
+	if err != nil {
+		t.Fatalf("error while planning:%v", err)
+	}
+
+	if len(plan.Assignments) != 1 || plan.Assignments[0].SerialNumber != "MIDDLE-1" {
+		t.Errorf("170g of medications must be assigned to the smallest drone that can carry them but plan was %+v", plan.Assignments)
+	}
+
+	plan, err = PlanLoad(PlanRequest{Medications: newMedications(90, 80), Models: []string{drone.ModelLightweight}}, drones)
+	if err != nil {
+		t.Fatalf("error while planning:%v", err)
+	}
+
+	if len(plan.Assignments) != 2 {
+		t.Errorf("medications restricted to lightweight drones must use 2 of them but plan was %+v", plan.Assignments)
+	}
+
+	for _, v := range plan.Assignments {
+		if v.Model != drone.ModelLightweight {
+			t.Errorf("only lightweight drones must be used but %s was", v.Model)
+		}
+	}
+
+	plan, err = PlanLoad(PlanRequest{Medications: newMedications(600, 10)}, drones)
+	if err != nil {
+		t.Fatalf("error while planning:%v", err)
+	}
+
+	if len(plan.Unassigned) != 1 || plan.Unassigned[0].Weight != 600 {
+		t.Errorf("a medication heavier than any drone must be unassigned but unassigned were %+v", plan.Unassigned)
+	}
+}
+
+func Test_PlanLoad_destination(t *testing.T) {
+
+	homeBase := geo.Point{Latitude: 40.4168, Longitude: -3.7038}
+	near := geo.Point{Latitude: 40.4668, Longitude: -3.7038} // about 5.6 km
+	far := geo.Point{Latitude: 40.6168, Longitude: -3.7038}  // about 22.2 km
+
+	drones := make([]*drone.Drone, 0)
+	for _, v := range []drone.DroneDTO{
+		{SerialNumber: "HEAVY-FULL", BatteryCapacity: 100, HomeBase: &homeBase},
+		{SerialNumber: "HEAVY-HALF", BatteryCapacity: 60, HomeBase: &homeBase},
+		{SerialNumber: "HEAVY-NO-BASE", BatteryCapacity: 100},
+	} {
+		v.Model, v.WeightLimit, v.State = drone.ModelHeavyweight, 500, drone.StateIdle
+		droneObj, err := drone.RestoreDrone(v)
+		if err != nil {
+			t.Fatalf("error while creating drone for test:%v", err)
+		}
+		drones = append(drones, droneObj)
+	}
+
+	//the drone with less battery can not carry 100g or more to the destination and return
+	plan, err := PlanLoad(PlanRequest{Medications: newMedications(200, 100), Destination: &near}, drones)
+	if err != nil {
+		t.Fatalf("error while planning:%v", err)
+	}
+
+	if len(plan.Unassigned) != 0 || len(plan.Assignments) != 1 || plan.Assignments[0].SerialNumber != "HEAVY-FULL" {
+		t.Errorf("medications must be assigned to the drone with full battery but plan was %+v", plan)
+	}
+
+	plan, err = PlanLoad(PlanRequest{Medications: newMedications(50), Destination: &far}, drones)
+	if err != nil {
+		t.Fatalf("error while planning:%v", err)
+	}
+
+	if len(plan.Assignments) != 0 || len(plan.Unassigned) != 1 {
+		t.Errorf("medications to a destination out of range must be unassigned but plan was %+v", plan)
+	}
+
+	if _, err = PlanLoad(PlanRequest{Medications: newMedications(50), Destination: &geo.Point{Latitude: 91}}, drones); err == nil {
+		t.Errorf("a request with an invalid destination must not be planned")
+	}
+}
+
+func Test_PlanLoad_invalidRequest(t *testing.T) {
+
+	if _, err := PlanLoad(PlanRequest{}, nil); err == nil {
+		t.Errorf("a request without medications must not be planned")
+	}
+
+	invalid := []medication.MedicationDTO{{Name: "Not valid", Code: "CODE", Weight: 10}}
+	if _, err := PlanLoad(PlanRequest{Medications: invalid}, nil); err == nil {
+		t.Errorf("a request with invalid medications must not be planned")
+	}
+}
+
+func Test_PlanLoad_payloadType(t *testing.T) {
+
+	drones := []*drone.Drone{
+		newDrone(t, "LIGHT-1", drone.ModelLightweight, 200, 100, drone.StateIdle),
+		newDrone(t, "HEAVY-1", drone.ModelHeavyweight, 500, 100, drone.StateIdle),
+	}
+
+	medications := newMedications(50, 40)
+	medications[1].Type = medication.TypeRefrigerated
+
+	plan, err := PlanLoad(PlanRequest{Medications: medications}, drones)
+	if err != nil {
+		t.Fatalf("error while planning load:%v", err)
+	}
+
+	if len(plan.Unassigned) != 0 || len(plan.Assignments) != 1 || plan.Assignments[0].SerialNumber != "HEAVY-1" {
+		t.Errorf("the refrigerated medication must take the load to the heavyweight drone but plan was %+v", plan)
+	}
+
+	plan, err = PlanLoad(PlanRequest{Medications: medications, Models: []string{drone.ModelLightweight}}, drones)
+	if err != nil {
+		t.Fatalf("error while planning load:%v", err)
+	}
+
+	if len(plan.Unassigned) != 1 || plan.Unassigned[0].Type != medication.TypeRefrigerated {
+		t.Errorf("the refrigerated medication must be unassigned when only lightweight drones are used but plan was %+v", plan)
+	}
+}
@@ -2,8 +2,12 @@
 package drone
 
 import (
+	"drones/pkg/geo"
 	"drones/pkg/medication"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/pkg/errors"
@@ -11,9 +15,8 @@ import (
 
 const (
 	maxSerialNumberCharacters = 100
-	maxWeightLimit            = 500
 	maxBatteryCapacity        = 100
-	//allowed models
+	//models known without any config (others can be registered)
 	ModelLightweight   = "Lightweight"
 	ModelMiddleweight  = "Middleweight"
 	ModelCruiserweight = "Cruiserweight"
@@ -25,33 +28,77 @@ const (
 	StateDelivering = "DELIVERING"
 	StateDelivered  = "DELIVERED"
 	StateReturning  = "RETURNING"
+	//states out of service (outside the delivery states)
+	StateMaintenance = "MAINTENANCE"
+	StateRetired     = "RETIRED"
 
 	forbiddenBatteryLevelForStateLoading = 25
+	//min battery level (percentage) a drone needs to be loaded
+	MinBatteryLevelForLoading = forbiddenBatteryLevelForStateLoading
 )
 
+//error of an unload of medications that are not in the load of the drone
+var ErrMedicationNotLoaded = errors.New("medication is not in the load of the drone")
+
 type (
 	//define what is a drone within the system
 	Drone struct {
 		serialNumber    string // (100 characters max);
-		model           string // (Lightweight, Middleweight, Cruiserweight, Heavyweight);
+		model           string // (Lightweight, Middleweight, Cruiserweight, Heavyweight or a registered one);
 		weightLimit     uint16 // (500gr max);
 		batteryCapacity uint8  // (percentage);
-		state           string // (IDLE, LOADING, LOADED, DELIVERING, DELIVERED, RETURNING).
+		state           string // (IDLE, LOADING, LOADED, DELIVERING, DELIVERED, RETURNING, MAINTENANCE, RETIRED).
 		medications     []medication.Medication
+		telemetry       *Telemetry // last reading reported by the drone
+		homeBase        *geo.Point // where the drone returns after a delivery
+		location        *geo.Point // where the drone is
+		round           []Stop     // stops of the delivery round, in the order they are visited
+		usage           Usage      // flight time, flights and battery cycles
 		sync.Mutex
 	}
 
+	//a medication that was not loaded and the reason why
+	RejectedMedication struct {
+		Index  int    `json:"index"` // position of the medication in the load
+		Code   string `json:"code"`
+		Reason string `json:"reason"`
+	}
+
+	//error of a load in which some medications were rejected (so none was loaded)
+	LoadError struct {
+		Rejected []RejectedMedication
+	}
+
 	//define a data transfer object for a drone
 	DroneDTO struct {
 		SerialNumber    string                     `json:"serial_number"`              // (100 characters max);
 		Model           string                     `json:"model,omitempty"`            // (Lightweight, Middleweight, Cruiserweight, Heavyweight);
 		WeightLimit     uint16                     `json:"weight_limit,omitempty"`     // (500gr max);
 		BatteryCapacity uint8                      `json:"battery_capacity,omitempty"` // (percentage);
-		State           string                     `json:"state,omitempty"`            // (IDLE, LOADING, LOADED, DELIVERING, DELIVERED, RETURNING).
+		State           string                     `json:"state,omitempty"`            // (IDLE, LOADING, LOADED, DELIVERING, DELIVERED, RETURNING, MAINTENANCE, RETIRED).
 		Medications     []medication.MedicationDTO `json:"medications,omitempty"`
+		Items           []medication.ItemDTO       `json:"items,omitempty"`     // medications of the catalog to load (only used in load requests)
+		Telemetry       *Telemetry                 `json:"telemetry,omitempty"` // last reading reported by the drone
+		HomeBase        *geo.Point                 `json:"home_base,omitempty"`
+		Location        *geo.Point                 `json:"location,omitempty"`    // (home base when it is not given);
+		RangeKm         float64                    `json:"range_km,omitempty"`    // km that the drone can fly with its battery and payload (ignored in requests)
+		Round           []Stop                     `json:"round,omitempty"`       // stops of the delivery round and their progress (ignored in requests)
+		Usage           *Usage                     `json:"usage,omitempty"`       // (ignored in requests)
+		ServiceDue      []string                   `json:"service_due,omitempty"` // reasons why the drone is due for service (ignored in requests)
 	}
 )
 
+//get the message of a load error
+func (e *LoadError) Error() string {
+
+	reasons := make([]string, 0, len(e.Rejected))
+	for _, v := range e.Rejected {
+		reasons = append(reasons, fmt.Sprintf("medication %d (%s): %s", v.Index, v.Code, v.Reason))
+	}
+
+	return fmt.Sprintf("%d medications were rejected, so none was loaded: %s", len(e.Rejected), strings.Join(reasons, "; "))
+}
+
 //get a pointer to a drone object from a drone DTO
 func NewDrone(dto DroneDTO) (*Drone, error) {
 
@@ -63,8 +110,9 @@ func NewDrone(dto DroneDTO) (*Drone, error) {
 		return nil, errors.New(dto.Model + "is not a valid model")
 	}
 
-	if !validWeightLimit(dto.WeightLimit) {
-		return nil, fmt.Errorf("%d is not a valid weight limit", dto.WeightLimit)
+	if !validWeightLimit(dto.Model, dto.WeightLimit) {
+		profile, _ := GetModelProfile(dto.Model)
+		return nil, fmt.Errorf("%d is not a valid weight limit for a %s drone (%d gr max)", dto.WeightLimit, dto.Model, profile.MaxWeightLimit)
 	}
 
 	if !validBatteryCapacity(dto.BatteryCapacity) {
@@ -87,7 +135,12 @@ func NewDrone(dto DroneDTO) (*Drone, error) {
 		state:           dto.State,
 	}
 
-	err := drone.LoadSetOfMedications(dto.Medications)
+	err := drone.setPosition(dto)
+	if err != nil {
+		return nil, err
+	}
+
+	err = drone.LoadSetOfMedications(dto.Medications)
 	if err != nil {
 		return drone, err
 	}
@@ -95,9 +148,84 @@ func NewDrone(dto DroneDTO) (*Drone, error) {
 	return drone, nil
 }
 
+//get a pointer to a drone object from a previously stored drone DTO, keeping its state and medications as they were
+func RestoreDrone(dto DroneDTO) (*Drone, error) {
+
+	if !validSerialNumber(dto.SerialNumber) {
+		return nil, errors.New(dto.SerialNumber + "is not a valid serial number")
+	}
+
+	if !validModel(dto.Model) {
+		return nil, errors.New(dto.Model + "is not a valid model")
+	}
+
+	if !validWeightLimit(dto.Model, dto.WeightLimit) {
+		return nil, fmt.Errorf("%d is not a valid weight limit for a %s drone", dto.WeightLimit, dto.Model)
+	}
+
+	//a stored drone may have drained its battery completely
+	if dto.BatteryCapacity > maxBatteryCapacity {
+		return nil, fmt.Errorf("%d is not a valid battery capacity", dto.BatteryCapacity)
+	}
+
+	if !validState(dto.State) {
+		return nil, errors.New(dto.State + "is not a valid state")
+	}
+
+	medications, err := medication.NewMedications(dto.Medications)
+	if err != nil {
+		return nil, err
+	}
+
+	drone := &Drone{
+		serialNumber:    dto.SerialNumber,
+		model:           dto.Model,
+		weightLimit:     dto.WeightLimit,
+		batteryCapacity: dto.BatteryCapacity,
+		state:           dto.State,
+		medications:     medications,
+	}
+
+	err = drone.setPosition(dto)
+	if err != nil {
+		return nil, err
+	}
+
+	err = drone.setRound(dto)
+	if err != nil {
+		return nil, err
+	}
+
+	if dto.Usage != nil {
+		drone.usage = dto.Usage.copy()
+	}
+
+	//the last reading is kept, so older ones are still rejected after a restart
+	if dto.Telemetry != nil {
+		err = validTelemetry(*dto.Telemetry)
+		if err != nil {
+			return nil, errors.Wrap(err, "last reading of drone is not valid")
+		}
+		reading := *dto.Telemetry
+		reading.Position = copyPoint(reading.Position)
+		drone.telemetry = &reading
+	}
+
+	return drone, nil
+}
+
 //get the total weight of all medications on the drone
 func (d *Drone) CurrentWeight() uint16 {
 
+	d.Lock()
+	defer d.Unlock()
+
+	return d.currentWeight()
+}
+
+//get the total weight of all medications on the drone (the caller must hold the lock)
+func (d *Drone) currentWeight() uint16 {
+
 	currentWeight := uint16(0)
 
 	for _, v := range d.medications {
@@ -109,66 +237,228 @@ func (d *Drone) CurrentWeight() uint16 {
 
 //check whether the addition of a new medication does not exceed the maximun load capacity of the drone
 func (d *Drone) IsAcceptableLoad(medication medication.Medication) bool {
-	return medication.GetWeight()+uint(d.CurrentWeight()) <= uint(d.weightLimit)
+
+	d.Lock()
+	defer d.Unlock()
+
+	return medication.GetWeight()+uint(d.currentWeight()) <= uint(d.weightLimit)
 }
 
 //load a new medication on the drone
-func (d *Drone) LoadNewMedication(medication medication.Medication) error {
+func (d *Drone) LoadNewMedication(medicationObj medication.Medication) error {
+	return d.LoadNewMedications([]medication.Medication{medicationObj})
+}
+
+//load new medications on the drone: either all of them are loaded or none is
+func (d *Drone) LoadNewMedications(medications []medication.Medication) error {
+
+	indexes := make([]int, len(medications))
+	for i := range medications {
+		indexes[i] = i
+	}
+
+	return d.loadMedications(medications, indexes, nil)
+}
+
+//load new medications on the drone (using a list of DTOs): either all of them are loaded or none is
+func (d *Drone) LoadSetOfMedications(medications []medication.MedicationDTO) error {
+
+	rejected := make([]RejectedMedication, 0)
+	indexes := make([]int, 0, len(medications))
+	medicationObjs := make([]medication.Medication, 0, len(medications))
+	for i, v := range medications {
+		medicationObj, err := medication.NewMedication(v)
+		if err != nil {
+			rejected = append(rejected, RejectedMedication{
+				Index:  i,
+				Code:   v.Code,
+				Reason: err.Error(),
+			})
+			continue
+		}
+		indexes = append(indexes, i)
+		medicationObjs = append(medicationObjs, *medicationObj)
+	}
+
+	return d.loadMedications(medicationObjs, indexes, rejected)
+}
+
+//load the medications only when none of them is rejected (indexes keep the position of each medication in the original load)
+func (d *Drone) loadMedications(medications []medication.Medication, indexes []int, rejected []RejectedMedication) error {
+
+	if len(medications) == 0 && len(rejected) == 0 {
+		return nil
+	}
 
 	d.Lock()
 	defer d.Unlock()
 
+	if !d.canBeLoaded() {
+		return fmt.Errorf("medications can not be loaded while the drone is %s", d.state)
+	}
+
 	if d.batteryCapacity < forbiddenBatteryLevelForStateLoading {
 		return fmt.Errorf("drone should not be %s when the battery level is below %d %%", StateLoading, forbiddenBatteryLevelForStateLoading)
 	}
 
-	if d.IsAcceptableLoad(medication) {
-		d.state = StateLoading
-		d.medications = append(d.medications, medication)
-		d.state = StateLoaded
-		return nil
+	//every medication that the model can not carry, or that does not fit with the previous ones, is rejected
+	profile, _ := GetModelProfile(d.model)
+	totalWeight := uint(d.currentWeight())
+	for i, v := range medications {
+		if !profile.AllowsPayload(v.GetType()) {
+			rejected = append(rejected, RejectedMedication{
+				Index:  indexes[i],
+				Code:   v.GetCode(),
+				Reason: fmt.Sprintf("a %s drone can not carry %s medications", d.model, v.GetType()),
+			})
+			continue
+		}
+		if totalWeight+v.GetWeight() > uint(d.weightLimit) {
+			rejected = append(rejected, RejectedMedication{
+				Index:  indexes[i],
+				Code:   v.GetCode(),
+				Reason: fmt.Sprintf("the drone must not being loaded with more weight that it can carry (%d gr of %d gr already taken)", totalWeight, d.weightLimit),
+			})
+			continue
+		}
+		totalWeight += v.GetWeight()
 	}
 
-	return errors.New("the drone must not being loaded with more weight that it can carry")
-}
-
-//load new medications on the drone
-func (d *Drone) LoadNewMedications(medications []medication.Medication) error {
+	if len(rejected) > 0 {
+		sort.Slice(rejected, func(i, j int) bool {
+			return rejected[i].Index < rejected[j].Index
+		})
+		return &LoadError{Rejected: rejected}
+	}
 
-	successfullyLoaded := 0
-	for _, v := range medications {
-		err := d.LoadNewMedication(v)
+	if d.state != StateLoading {
+		err := d.transition(StateLoading)
 		if err != nil {
-			return errors.Wrapf(err, "successfully loaded medications: %d of %d", successfullyLoaded, len(medications))
+			return err
 		}
-		successfullyLoaded++
 	}
 
-	return nil
+	d.medications = append(d.medications, medications...)
+
+	return d.transition(StateLoaded)
 }
 
-//load new medications on the drone (using a list of DTOs)
-func (d *Drone) LoadSetOfMedications(medications []medication.MedicationDTO) error {
+//remove the medication at the given position of the load (a drone that was being loaded goes back to IDLE when it becomes empty)
+func (d *Drone) Unload(index int) (medication.Medication, error) {
+
+	d.Lock()
+	defer d.Unlock()
+
+	if index < 0 || index >= len(d.medications) {
+		return medication.Medication{}, errors.Wrapf(ErrMedicationNotLoaded, "there is not a medication at position %d of the load", index)
+	}
+
+	unloaded, err := d.unload(func(i int, _ medication.Medication) bool {
+		return i == index
+	})
+	if err != nil {
+		return medication.Medication{}, err
+	}
+
+	return unloaded[0], nil
+}
+
+//remove all medications with the given code (a drone that was being loaded goes back to IDLE when it becomes empty)
+func (d *Drone) UnloadByCode(code string) ([]medication.Medication, error) {
+
+	d.Lock()
+	defer d.Unlock()
+
+	unloaded, err := d.unload(func(_ int, m medication.Medication) bool {
+		return m.GetCode() == code
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unloaded) == 0 {
+		return nil, errors.Wrapf(ErrMedicationNotLoaded, "there is not a medication with code %s in the load", code)
+	}
+
+	return unloaded, nil
+}
+
+//remove one medication of the load for each of the given ones (by code, name and weight), ignoring those that are not on the drone
+//(a drone that was being loaded goes back to IDLE when it becomes empty)
+func (d *Drone) UnloadMedications(medications []medication.MedicationDTO) ([]medication.Medication, error) {
 
-	successfullyLoaded := 0
+	d.Lock()
+	defer d.Unlock()
+
+	pending := make(map[string]int)
 	for _, v := range medications {
-		medication, err := medication.NewMedication(v)
-		if err != nil {
-			return errors.Wrapf(err, "successfully loaded medications: %d of %d", successfullyLoaded, len(medications))
+		pending[medicationKey(v.Code, v.Name, v.Weight)]++
+	}
+
+	return d.unload(func(_ int, m medication.Medication) bool {
+		key := medicationKey(m.GetCode(), m.GetName(), m.GetWeight())
+		if pending[key] == 0 {
+			return false
 		}
-		err = d.LoadNewMedication(*medication)
+		pending[key]--
+		return true
+	})
+}
+
+//remove all medications from the drone (a drone that was being loaded goes back to IDLE)
+func (d *Drone) UnloadAll() ([]medication.Medication, error) {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return d.unload(func(int, medication.Medication) bool {
+		return true
+	})
+}
+
+//remove the medications that match, moving to IDLE a drone being loaded that becomes empty (the caller must hold the lock)
+func (d *Drone) unload(match func(int, medication.Medication) bool) ([]medication.Medication, error) {
+
+	if d.state == StateDelivering {
+		return nil, fmt.Errorf("medications can not be unloaded while the drone is %s", StateDelivering)
+	}
+
+	unloaded := make([]medication.Medication, 0)
+	kept := make([]medication.Medication, 0, len(d.medications))
+	for i, v := range d.medications {
+		if match(i, v) {
+			unloaded = append(unloaded, v)
+			continue
+		}
+		kept = append(kept, v)
+	}
+
+	previous := d.medications
+	d.medications = kept
+
+	if len(kept) == 0 && (d.state == StateLoading || d.state == StateLoaded) {
+		err := d.transition(StateIdle)
 		if err != nil {
-			return errors.Wrapf(err, "successfully loaded medications: %d of %d", successfullyLoaded, len(medications))
+			d.medications = previous
+			return nil, err
 		}
-		successfullyLoaded++
 	}
 
-	return nil
+	return unloaded, nil
 }
 
 //get DTO that represents a drone
 func (d *Drone) GetDTO() DroneDTO {
 
+	d.Lock()
+	defer d.Unlock()
+
+	return d.dto()
+}
+
+//get DTO that represents a drone (the caller must hold the lock)
+func (d *Drone) dto() DroneDTO {
+
 	dto := DroneDTO{
 		SerialNumber:    d.serialNumber,
 		Model:           d.model,
@@ -176,6 +466,17 @@ func (d *Drone) GetDTO() DroneDTO {
 		BatteryCapacity: d.batteryCapacity,
 		State:           d.state,
 		Medications:     make([]medication.MedicationDTO, 0),
+		Telemetry:       d.telemetryCopy(),
+		HomeBase:        copyPoint(d.homeBase),
+		Location:        copyPoint(d.location),
+		RangeKm:         math.Round(d.rangeKm()*10) / 10,
+		Round:           d.roundCopy(),
+	}
+
+	usage := d.usage.copy()
+	dto.Usage = &usage
+	if reasons := d.serviceDue(); len(reasons) > 0 {
+		dto.ServiceDue = reasons
 	}
 
 	for _, v := range d.medications {
@@ -185,6 +486,22 @@ func (d *Drone) GetDTO() DroneDTO {
 	return dto
 }
 
+//get DTO that represents a drone including the images of its medications
+func (d *Drone) GetDTOWithImages() DroneDTO {
+
+	d.Lock()
+	defer d.Unlock()
+
+	dto := d.dto()
+	dto.Medications = make([]medication.MedicationDTO, 0)
+
+	for _, v := range d.medications {
+		dto.Medications = append(dto.Medications, v.GetDTOWithImage())
+	}
+
+	return dto
+}
+
 //get serial number of drone
 func (d *Drone) GetSerialNumber() string {
 	return d.serialNumber
@@ -195,13 +512,45 @@ func (d *Drone) GetModel() string {
 	return d.model
 }
 
+//get weight limit of drone
+func (d *Drone) GetWeightLimit() uint16 {
+	return d.weightLimit
+}
+
 //get state of drone
 func (d *Drone) GetState() string {
+
+	d.Lock()
+	defer d.Unlock()
+
 	return d.state
 }
 
 //get battery capacityo of drone
 func (d *Drone) GetBatteryCapacity() uint8 {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return d.batteryCapacity
+}
+
+//change the battery level by a number of percentage points (negative to drain it), keeping it between 0 and 100
+func (d *Drone) ChangeBatteryCapacity(delta int) uint8 {
+
+	d.Lock()
+	defer d.Unlock()
+
+	level := int(d.batteryCapacity) + delta
+	if level < 0 {
+		level = 0
+	}
+	if level > maxBatteryCapacity {
+		level = maxBatteryCapacity
+	}
+
+	d.setBatteryCapacity(uint8(level))
+
 	return d.batteryCapacity
 }
 
@@ -218,6 +567,9 @@ func (d *Drone) GetDTOWithSerialNumber() DroneDTO {
 //get drone DTO with only the information of the serial number and battery capacity
 func (d *Drone) GetDTOWithSerialNumberAndBatteryCapacity() DroneDTO {
 
+	d.Lock()
+	defer d.Unlock()
+
 	dto := DroneDTO{
 		SerialNumber:    d.serialNumber,
 		BatteryCapacity: d.batteryCapacity,
@@ -226,9 +578,44 @@ func (d *Drone) GetDTOWithSerialNumberAndBatteryCapacity() DroneDTO {
 	return dto
 }
 
-//get drone DTO with only the information of the serial number and medications (without medication's image)
+//get drone DTO with only the information of the serial number and state
+func (d *Drone) GetDTOWithSerialNumberAndState() DroneDTO {
+
+	d.Lock()
+	defer d.Unlock()
+
+	dto := DroneDTO{
+		SerialNumber: d.serialNumber,
+		State:        d.state,
+	}
+
+	return dto
+}
+
+//get drone DTO with only the information of the serial number, state and medications (with the references of their images)
+func (d *Drone) GetDTOWithSerialNumberStateAndMedications() DroneDTO {
+
+	d.Lock()
+	defer d.Unlock()
+
+	dto := d.dtoWithSerialNumberAndMedications()
+	dto.State = d.state
+
+	return dto
+}
+
+//get drone DTO with only the information of the serial number and medications (with the references of their images)
 func (d *Drone) GetDTOWithSerialNumberAndMedications() DroneDTO {
 
+	d.Lock()
+	defer d.Unlock()
+
+	return d.dtoWithSerialNumberAndMedications()
+}
+
+//get drone DTO with only the information of the serial number and medications (the caller must hold the lock)
+func (d *Drone) dtoWithSerialNumberAndMedications() DroneDTO {
+
 	dto := DroneDTO{
 		SerialNumber: d.serialNumber,
 		Medications:  make([]medication.MedicationDTO, 0),
@@ -243,12 +630,30 @@ func (d *Drone) GetDTOWithSerialNumberAndMedications() DroneDTO {
 
 //check whether the drone has loaded medications
 func (d *Drone) HasMedications() bool {
+
+	d.Lock()
+	defer d.Unlock()
+
 	return len(d.medications) > 0
 }
 
-//check whether a drone is available for loading
+//check whether the state of the drone allows loading medications (the caller must hold the lock)
+func (d *Drone) canBeLoaded() bool {
+	return d.state == StateIdle || d.state == StateLoading || d.state == StateLoaded
+}
+
+//check whether a drone is available for loading (drones due for service are not)
 func (d *Drone) IsAvailableForLoading() bool {
-	return d.state == StateIdle && d.batteryCapacity >= forbiddenBatteryLevelForStateLoading
+
+	d.Lock()
+	defer d.Unlock()
+
+	return d.state == StateIdle && d.batteryCapacity >= forbiddenBatteryLevelForStateLoading && len(d.serviceDue()) == 0
+}
+
+//get the key that tells apart the medications of a load
+func medicationKey(code string, name string, weight uint) string {
+	return fmt.Sprintf("%s|%s|%d", code, name, weight)
 }
 
 //check whether a serial number of drone is valid
@@ -256,9 +661,10 @@ func validSerialNumber(serialNumber string) bool {
 	return len(serialNumber) > 0 && len(serialNumber) <= maxSerialNumberCharacters
 }
 
-//check whether a weight limit of drone is valid
-func validWeightLimit(weightLimit uint16) bool {
-	return weightLimit <= maxWeightLimit
+//check whether a weight limit of drone is valid for its model (up to the max weight limit of the model)
+func validWeightLimit(model string, weightLimit uint16) bool {
+	profile, ok := GetModelProfile(model)
+	return ok && weightLimit <= profile.MaxWeightLimit
 }
 
 //check whether a battery capacity of drone is valid
@@ -266,22 +672,17 @@ func validBatteryCapacity(batteryCapacity uint8) bool {
 	return batteryCapacity > 0 && batteryCapacity <= maxBatteryCapacity
 }
 
-//check whether a model of drone is valid
+//check whether a model of drone is valid (it is in the registry of models)
 func validModel(model string) bool {
-
-	switch model {
-	case ModelLightweight, ModelMiddleweight, ModelCruiserweight, ModelHeavyweight:
-		return true
-	}
-
-	return false
+	_, ok := GetModelProfile(model)
+	return ok
 }
 
 //check whether a state of drone is valid
 func validState(state string) bool {
 
 	switch state {
-	case StateIdle, StateLoading, StateLoaded, StateDelivering, StateDelivered, StateReturning:
+	case StateIdle, StateLoading, StateLoaded, StateDelivering, StateDelivered, StateReturning, StateMaintenance, StateRetired:
 		return true
 	}
 
@@ -1,6 +1,7 @@
 package drone
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -114,3 +115,132 @@ func Test_NewDrone(t *testing.T) {
 		t.Errorf("code of first medications of droneDTO and droneDTOB must not be the same but code of first medication on droneDTO's was %s and code of first medication on droneDTOB's was %s", droneDTO.Medications[0].Code, droneDTOB.Medications[0].Code)
 	}
 }
+
+func Test_LoadSetOfMedications(t *testing.T) {
+
+	droneObj, err := NewDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelLightweight,
+		WeightLimit:     100,
+		BatteryCapacity: 100,
+		State:           StateIdle,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	err = droneObj.LoadSetOfMedications([]medication.MedicationDTO{
+		{Name: "Medication-A", Code: "CODE_A", Weight: 60},
+		{Name: "Medication-B", Code: "CODE_B", Weight: 50},
+		{Name: "Medication-C", Code: "CODE_C", Weight: 30},
+		{Name: "Not valid", Code: "CODE_D", Weight: 10},
+	})
+
+	loadErr, ok := err.(*LoadError)
+	if !ok {
+		t.Fatalf("an overweight load must return a *LoadError but returned %v", err)
+	}
+
+	if len(loadErr.Rejected) != 2 || loadErr.Rejected[0].Code != "CODE_B" || loadErr.Rejected[1].Index != 3 {
+		t.Errorf("the medication that exceeds the weight limit and the one with an invalid name must be rejected but rejected were %+v", loadErr.Rejected)
+	}
+
+	err = droneObj.LoadSetOfMedications([]medication.MedicationDTO{
+		{Name: "Medication-A", Code: "CODE_A", Weight: 60},
+		{Name: "Medication-B", Code: "CODE_B", Weight: 50},
+		{Name: "Medication-C", Code: "CODE_C", Weight: 30},
+	})
+
+	loadErr, ok = err.(*LoadError)
+	if !ok {
+		t.Fatalf("an overweight load must return a *LoadError but returned %v", err)
+	}
+
+	if len(loadErr.Rejected) != 1 || loadErr.Rejected[0].Code != "CODE_B" {
+		t.Errorf("only the medication that exceeds the weight limit must be rejected but rejected were %+v", loadErr.Rejected)
+	}
+
+	if droneObj.HasMedications() || droneObj.GetState() != StateIdle {
+		t.Errorf("a rejected load must leave the drone %s and empty but it was %s with %d gr", StateIdle, droneObj.GetState(), droneObj.CurrentWeight())
+	}
+
+	err = droneObj.LoadSetOfMedications([]medication.MedicationDTO{
+		{Name: "Medication-A", Code: "CODE_A", Weight: 60},
+		{Name: "Medication-C", Code: "CODE_C", Weight: 30},
+	})
+	if err != nil {
+		t.Fatalf("a load within the weight limit must be accepted:%v", err)
+	}
+
+	if droneObj.CurrentWeight() != 90 || droneObj.GetState() != StateLoaded {
+		t.Errorf("drone must be %s with 90 gr but it was %s with %d gr", StateLoaded, droneObj.GetState(), droneObj.CurrentWeight())
+	}
+}
+
+func Test_Unload(t *testing.T) {
+
+	droneObj, err := NewDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelHeavyweight,
+		WeightLimit:     500,
+		BatteryCapacity: 100,
+		State:           StateIdle,
+		Medications: []medication.MedicationDTO{
+			{Name: "Medication-A", Code: "CODE_A", Weight: 10},
+			{Name: "Medication-B", Code: "CODE_B", Weight: 20},
+			{Name: "Medication-B", Code: "CODE_B", Weight: 30},
+			{Name: "Medication-C", Code: "CODE_C", Weight: 40},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	unloaded, err := droneObj.Unload(0)
+	if err != nil || unloaded.GetCode() != "CODE_A" {
+		t.Errorf("medication at position 0 must be unloaded but got %+v (%v)", unloaded, err)
+	}
+
+	if _, err = droneObj.Unload(3); err == nil {
+		t.Errorf("unloading a position that is not in the load must fail")
+	}
+
+	unloadedByCode, err := droneObj.UnloadByCode("CODE_B")
+	if err != nil || len(unloadedByCode) != 2 {
+		t.Errorf("the 2 medications with code CODE_B must be unloaded but got %d (%v)", len(unloadedByCode), err)
+	}
+
+	if _, err = droneObj.UnloadByCode("CODE_B"); !errors.Is(err, ErrMedicationNotLoaded) {
+		t.Errorf("unloading a code that is not in the load must fail with %v but it was %v", ErrMedicationNotLoaded, err)
+	}
+
+	if droneObj.CurrentWeight() != 40 || droneObj.GetState() != StateLoaded {
+		t.Errorf("drone must be %s with 40 gr but it was %s with %d gr", StateLoaded, droneObj.GetState(), droneObj.CurrentWeight())
+	}
+
+	if err = droneObj.Transition(StateDelivering); err != nil {
+		t.Fatalf("error while moving drone to %s:%v", StateDelivering, err)
+	}
+
+	if _, err = droneObj.UnloadAll(); err == nil || errors.Is(err, ErrMedicationNotLoaded) {
+		t.Errorf("medications must not be unloaded while the drone is %s but error was %v", StateDelivering, err)
+	}
+
+	droneObj, _ = NewDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelHeavyweight,
+		WeightLimit:     500,
+		BatteryCapacity: 100,
+		State:           StateIdle,
+		Medications:     []medication.MedicationDTO{{Name: "Medication-A", Code: "CODE_A", Weight: 10}},
+	})
+
+	all, err := droneObj.UnloadAll()
+	if err != nil || len(all) != 1 {
+		t.Errorf("the only medication must be unloaded but got %d (%v)", len(all), err)
+	}
+
+	if droneObj.HasMedications() || droneObj.GetState() != StateIdle {
+		t.Errorf("an empty drone must go back to %s but it was %s", StateIdle, droneObj.GetState())
+	}
+}
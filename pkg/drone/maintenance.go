@@ -0,0 +1,154 @@
+// Implements how much a drone is used (flight time, flights and battery charge cycles) and when it is due for service.
+package drone
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	//define how much a drone has been used, in total and since its last service
+	Usage struct {
+		FlightSeconds   float64    `json:"flight_seconds"`              // time flying (DELIVERING, DELIVERED and RETURNING)
+		Cycles          uint32     `json:"cycles"`                      // flights (departures)
+		BatteryCycles   float64    `json:"battery_cycles"`              // full charges of the battery (percentage points charged / 100)
+		FlightStartedAt *time.Time `json:"flight_started_at,omitempty"` // start of the flight in progress
+		LastServiceAt   *time.Time `json:"last_service_at,omitempty"`
+		//usage when the last service was done
+		FlightSecondsAtService float64 `json:"flight_seconds_at_service,omitempty"`
+		CyclesAtService        uint32  `json:"cycles_at_service,omitempty"`
+		BatteryCyclesAtService float64 `json:"battery_cycles_at_service,omitempty"`
+	}
+
+	//define the usage since the last service after which a drone is due for service (zero values are not checked: the config
+	//fills the empty ones with its defaults, so it disables a check with a negative value that is set here as zero)
+	ServiceThresholds struct {
+		FlightHours   float64 `json:"flight_hours"`
+		Cycles        uint32  `json:"cycles"`
+		BatteryCycles float64 `json:"battery_cycles"`
+	}
+)
+
+var (
+	serviceThresholds      ServiceThresholds
+	serviceThresholdsMutex sync.RWMutex
+)
+
+//set the usage after which the drones are due for service
+func SetServiceThresholds(thresholds ServiceThresholds) {
+
+	serviceThresholdsMutex.Lock()
+	defer serviceThresholdsMutex.Unlock()
+
+	serviceThresholds = thresholds
+}
+
+//get the usage after which the drones are due for service
+func GetServiceThresholds() ServiceThresholds {
+
+	serviceThresholdsMutex.RLock()
+	defer serviceThresholdsMutex.RUnlock()
+
+	return serviceThresholds
+}
+
+//get the usage of the drone
+func (d *Drone) GetUsage() Usage {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return d.usage.copy()
+}
+
+//get the reasons why the drone is due for service (empty when it is not)
+func (d *Drone) ServiceDue() []string {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return d.serviceDue()
+}
+
+//get the reasons why the drone is due for service (the caller must hold the lock)
+func (d *Drone) serviceDue() []string {
+
+	if d.state == StateMaintenance || d.state == StateRetired {
+		return nil
+	}
+
+	thresholds := GetServiceThresholds()
+	reasons := make([]string, 0)
+
+	flightHours := (d.usage.FlightSeconds - d.usage.FlightSecondsAtService) / 3600
+	if thresholds.FlightHours > 0 && flightHours >= thresholds.FlightHours {
+		reasons = append(reasons, fmt.Sprintf("%.1f flight hours since last service (max %.1f)", flightHours, thresholds.FlightHours))
+	}
+
+	cycles := d.usage.Cycles - d.usage.CyclesAtService
+	if thresholds.Cycles > 0 && cycles >= thresholds.Cycles {
+		reasons = append(reasons, fmt.Sprintf("%d flights since last service (max %d)", cycles, thresholds.Cycles))
+	}
+
+	batteryCycles := d.usage.BatteryCycles - d.usage.BatteryCyclesAtService
+	if thresholds.BatteryCycles > 0 && batteryCycles >= thresholds.BatteryCycles {
+		reasons = append(reasons, fmt.Sprintf("%.1f battery cycles since last service (max %.1f)", batteryCycles, thresholds.BatteryCycles))
+	}
+
+	return reasons
+}
+
+//keep the usage of a change of state: a flight starts on departure and ends back at base, and leaving maintenance is a service
+//(the caller must hold the lock)
+func (d *Drone) recordUsage(from string, to string) {
+
+	now := time.Now()
+
+	switch {
+	case !isFlying(from) && isFlying(to):
+		d.usage.Cycles++
+		d.usage.FlightStartedAt = &now
+	case isFlying(from) && !isFlying(to):
+		if d.usage.FlightStartedAt != nil {
+			d.usage.FlightSeconds += now.Sub(*d.usage.FlightStartedAt).Seconds()
+		}
+		d.usage.FlightStartedAt = nil
+	case from == StateMaintenance && to == StateIdle:
+		d.usage.LastServiceAt = &now
+		d.usage.FlightSecondsAtService = d.usage.FlightSeconds
+		d.usage.CyclesAtService = d.usage.Cycles
+		d.usage.BatteryCyclesAtService = d.usage.BatteryCycles
+	}
+}
+
+//set the battery level of the drone, counting what it charged in its battery cycles (the caller must hold the lock)
+func (d *Drone) setBatteryCapacity(level uint8) {
+
+	if level > d.batteryCapacity {
+		d.usage.BatteryCycles += float64(level-d.batteryCapacity) / maxBatteryCapacity
+	}
+
+	d.batteryCapacity = level
+}
+
+//check whether the drone is flying in a state
+func isFlying(state string) bool {
+	return state == StateDelivering || state == StateDelivered || state == StateReturning
+}
+
+//get a copy of the usage
+func (u Usage) copy() Usage {
+
+	usage := u
+	if u.FlightStartedAt != nil {
+		flightStartedAt := *u.FlightStartedAt
+		usage.FlightStartedAt = &flightStartedAt
+	}
+	if u.LastServiceAt != nil {
+		lastServiceAt := *u.LastServiceAt
+		usage.LastServiceAt = &lastServiceAt
+	}
+
+	return usage
+}
@@ -0,0 +1,105 @@
+package drone
+
+import (
+	"testing"
+
+	"github.com/Pallinder/go-randomdata"
+
+	"drones/pkg/medication"
+)
+
+func Test_Usage(t *testing.T) {
+
+	droneObj, err := RestoreDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelMiddleweight,
+		WeightLimit:     300,
+		BatteryCapacity: 50,
+		State:           StateLoaded,
+		Medications:     []medication.MedicationDTO{{Name: "Medication-A", Code: "CODE_A", Weight: 100}},
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	//a whole flight: departure, delivery and back to base
+	for _, v := range []string{StateDelivering, StateDelivered, StateReturning} {
+		if err = droneObj.Transition(v); err != nil {
+			t.Fatalf("error while flying drone for test:%v", err)
+		}
+	}
+	if usage := droneObj.GetUsage(); usage.FlightStartedAt == nil || usage.Cycles != 1 {
+		t.Errorf("a flight must be in progress but usage was %+v", usage)
+	}
+	if _, err = droneObj.UnloadAll(); err != nil {
+		t.Fatalf("error while unloading drone for test:%v", err)
+	}
+	if err = droneObj.Transition(StateIdle); err != nil {
+		t.Fatalf("error while landing drone for test:%v", err)
+	}
+
+	droneObj.ChangeBatteryCapacity(30)
+	droneObj.ChangeBatteryCapacity(-10)
+	droneObj.ChangeBatteryCapacity(20)
+
+	usage := droneObj.GetUsage()
+	if usage.Cycles != 1 || usage.FlightStartedAt != nil || usage.FlightSeconds <= 0 {
+		t.Errorf("drone must have a finished flight but usage was %+v", usage)
+	}
+	if usage.BatteryCycles != 0.5 {
+		t.Errorf("drone must have charged half a battery cycle but was %.2f", usage.BatteryCycles)
+	}
+}
+
+func Test_ServiceDue(t *testing.T) {
+
+	defer SetServiceThresholds(GetServiceThresholds())
+	SetServiceThresholds(ServiceThresholds{Cycles: 2, BatteryCycles: 1})
+
+	droneObj, err := RestoreDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelMiddleweight,
+		WeightLimit:     300,
+		BatteryCapacity: 100,
+		State:           StateIdle,
+		Usage:           &Usage{Cycles: 2, BatteryCycles: 0.5},
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	if reasons := droneObj.ServiceDue(); len(reasons) != 1 {
+		t.Errorf("drone must be due for service because of its flights but reasons were %v", reasons)
+	}
+	if droneObj.IsAvailableForLoading() {
+		t.Errorf("drone due for service must not be available for loading")
+	}
+	if err = droneObj.Transition(StateLoading); err == nil {
+		t.Errorf("drone due for service must not be loaded")
+	}
+
+	if err = droneObj.Transition(StateMaintenance); err != nil {
+		t.Fatalf("drone must go to %s: %v", StateMaintenance, err)
+	}
+	if droneObj.IsAvailableForLoading() || len(droneObj.ServiceDue()) != 0 {
+		t.Errorf("drone in %s must not be available nor due for service", StateMaintenance)
+	}
+
+	//leaving maintenance is a service, so the usage is counted again from there
+	if err = droneObj.Transition(StateIdle); err != nil {
+		t.Fatalf("drone must go back to %s: %v", StateIdle, err)
+	}
+	if reasons := droneObj.ServiceDue(); len(reasons) != 0 || !droneObj.IsAvailableForLoading() {
+		t.Errorf("drone must be available after its service but reasons were %v", reasons)
+	}
+	if usage := droneObj.GetUsage(); usage.LastServiceAt == nil || usage.Cycles != 2 {
+		t.Errorf("service must be recorded keeping the total usage but was %+v", usage)
+	}
+
+	if err = droneObj.Transition(StateRetired); err != nil {
+		t.Fatalf("drone must be retired: %v", err)
+	}
+	if err = droneObj.Transition(StateIdle); err == nil {
+		t.Errorf("a retired drone must not go back to service")
+	}
+}
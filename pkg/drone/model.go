@@ -0,0 +1,171 @@
+// Implements the registry of drone models: what each model can carry and how far and fast it flies.
+package drone
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/medication"
+)
+
+type (
+	//define the capabilities of a drone model
+	ModelProfile struct {
+		Name                string   `json:"name"`
+		MaxWeightLimit      uint16   `json:"max_weight_limit"` // (gr)
+		CruiseSpeedKmh      float64  `json:"cruise_speed_kmh"`
+		BatteryWh           float64  `json:"battery_wh"`            // size of the battery
+		RangeKm             float64  `json:"range_km"`              // km flown on a full battery without payload
+		DrainPerMinute      float64  `json:"drain_per_minute"`      // percentage points of battery drained per minute while flying empty
+		AllowedPayloadTypes []string `json:"allowed_payload_types"` // types of medications it can carry (all of them when empty)
+	}
+)
+
+//profiles of the models known without any config
+var defaultModelProfiles = []ModelProfile{
+	{Name: ModelLightweight, MaxWeightLimit: 200, CruiseSpeedKmh: 60, BatteryWh: 90, RangeKm: 40, DrainPerMinute: 1.0,
+		AllowedPayloadTypes: []string{medication.TypeStandard}},
+	{Name: ModelMiddleweight, MaxWeightLimit: 300, CruiseSpeedKmh: 55, BatteryWh: 130, RangeKm: 35, DrainPerMinute: 1.2,
+		AllowedPayloadTypes: []string{medication.TypeStandard, medication.TypeControlled}},
+	{Name: ModelCruiserweight, MaxWeightLimit: 400, CruiseSpeedKmh: 50, BatteryWh: 180, RangeKm: 30, DrainPerMinute: 1.5},
+	{Name: ModelHeavyweight, MaxWeightLimit: 500, CruiseSpeedKmh: 45, BatteryWh: 250, RangeKm: 25, DrainPerMinute: 2.0},
+}
+
+var (
+	modelProfiles      = newModelProfiles(defaultModelProfiles)
+	modelProfilesMutex sync.RWMutex
+)
+
+//add models to the registry, replacing the ones with the same name
+func RegisterModels(profiles []ModelProfile) error {
+
+	for i, v := range profiles {
+		err := v.Validate()
+		if err != nil {
+			return errors.Wrapf(err, "model %d (%s) is not valid", i, v.Name)
+		}
+	}
+
+	modelProfilesMutex.Lock()
+	defer modelProfilesMutex.Unlock()
+
+	for _, v := range profiles {
+		modelProfiles[v.Name] = v.copy()
+	}
+
+	return nil
+}
+
+//get the profile of a model
+func GetModelProfile(model string) (ModelProfile, bool) {
+
+	modelProfilesMutex.RLock()
+	defer modelProfilesMutex.RUnlock()
+
+	profile, ok := modelProfiles[model]
+	if !ok {
+		return ModelProfile{}, false
+	}
+
+	return profile.copy(), true
+}
+
+//get the profiles of all models sorted by name
+func GetModelProfiles() []ModelProfile {
+
+	modelProfilesMutex.RLock()
+	defer modelProfilesMutex.RUnlock()
+
+	profiles := make([]ModelProfile, 0, len(modelProfiles))
+	for _, v := range modelProfiles {
+		profiles = append(profiles, v.copy())
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+
+	return profiles
+}
+
+//check whether the values of a profile are valid
+func (p ModelProfile) Validate() error {
+
+	if len(p.Name) == 0 || len(p.Name) > maxSerialNumberCharacters {
+		return errors.New(p.Name + " is not a valid name of model")
+	}
+
+	if p.MaxWeightLimit == 0 {
+		return fmt.Errorf("%d is not a valid max weight limit", p.MaxWeightLimit)
+	}
+
+	if p.RangeKm <= 0 {
+		return fmt.Errorf("%.1f is not a valid range", p.RangeKm)
+	}
+
+	if p.DrainPerMinute <= 0 {
+		return fmt.Errorf("%.2f is not a valid drain of battery", p.DrainPerMinute)
+	}
+
+	if p.CruiseSpeedKmh < 0 || p.BatteryWh < 0 {
+		return errors.New("cruise speed and battery size can not be negative")
+	}
+
+	for _, v := range p.AllowedPayloadTypes {
+		if !medication.IsValidType(v) {
+			return errors.New(v + " is not a valid payload type")
+		}
+	}
+
+	return nil
+}
+
+//check whether the model can carry a type of medication
+func (p ModelProfile) AllowsPayload(payloadType string) bool {
+
+	if len(p.AllowedPayloadTypes) == 0 {
+		return true
+	}
+
+	for _, v := range p.AllowedPayloadTypes {
+		if v == payloadType {
+			return true
+		}
+	}
+
+	return false
+}
+
+//check whether the model of the drone can carry a type of medication (STANDARD when it is empty)
+func (d *Drone) CanCarry(payloadType string) bool {
+
+	if payloadType == "" {
+		payloadType = medication.TypeStandard
+	}
+
+	profile, _ := GetModelProfile(d.model)
+	return profile.AllowsPayload(payloadType)
+}
+
+//get a copy of a profile
+func (p ModelProfile) copy() ModelProfile {
+
+	profile := p
+	profile.AllowedPayloadTypes = append([]string{}, p.AllowedPayloadTypes...)
+
+	return profile
+}
+
+//get the registry of models from a list of profiles
+func newModelProfiles(profiles []ModelProfile) map[string]ModelProfile {
+
+	registry := make(map[string]ModelProfile)
+	for _, v := range profiles {
+		registry[v.Name] = v.copy()
+	}
+
+	return registry
+}
@@ -0,0 +1,99 @@
+package drone
+
+import (
+	"testing"
+
+	"github.com/Pallinder/go-randomdata"
+
+	"drones/pkg/medication"
+)
+
+func Test_RegisterModels(t *testing.T) {
+
+	invalid := []ModelProfile{
+		{Name: "", MaxWeightLimit: 100, RangeKm: 10, DrainPerMinute: 1},
+		{Name: "Weightless", MaxWeightLimit: 0, RangeKm: 10, DrainPerMinute: 1},
+		{Name: "Grounded", MaxWeightLimit: 100, RangeKm: 0, DrainPerMinute: 1},
+		{Name: "Unknown-Payload", MaxWeightLimit: 100, RangeKm: 10, DrainPerMinute: 1, AllowedPayloadTypes: []string{"not valid"}},
+	}
+	for _, v := range invalid {
+		if err := RegisterModels([]ModelProfile{v}); err == nil {
+			t.Errorf("model %+v must not be registered", v)
+		}
+		if _, ok := GetModelProfile(v.Name); ok && v.Name != "" {
+			t.Errorf("model %s must not be in the registry", v.Name)
+		}
+	}
+
+	err := RegisterModels([]ModelProfile{{Name: "Featherweight", MaxWeightLimit: 100, CruiseSpeedKmh: 70, RangeKm: 50, DrainPerMinute: 0.8,
+		AllowedPayloadTypes: []string{medication.TypeStandard}}})
+	if err != nil {
+		t.Fatalf("a valid model must be registered:%v", err)
+	}
+
+	profile, ok := GetModelProfile("Featherweight")
+	if !ok || profile.MaxWeightLimit != 100 || profile.RangeKm != 50 {
+		t.Errorf("registered model must be in the registry but it was %+v", profile)
+	}
+
+	names := make([]string, 0)
+	for _, v := range GetModelProfiles() {
+		names = append(names, v.Name)
+	}
+	if len(names) != 5 || names[0] != ModelCruiserweight || names[1] != "Featherweight" {
+		t.Errorf("all models must be returned sorted by name but they were %v", names)
+	}
+
+	_, err = NewDrone(DroneDTO{SerialNumber: randomdata.Alphanumeric(50), Model: "Featherweight", WeightLimit: 100, BatteryCapacity: 100, State: StateIdle})
+	if err != nil {
+		t.Errorf("a drone of a registered model must be created:%v", err)
+	}
+
+	_, err = NewDrone(DroneDTO{SerialNumber: randomdata.Alphanumeric(50), Model: "Featherweight", WeightLimit: 150, BatteryCapacity: 100, State: StateIdle})
+	if err == nil {
+		t.Errorf("a drone with a weight limit over the max of its model must not be created")
+	}
+
+	//a model may carry more than the built-in ones
+	err = RegisterModels([]ModelProfile{{Name: "Featherweight", MaxWeightLimit: 1000, CruiseSpeedKmh: 70, RangeKm: 50, DrainPerMinute: 0.8}})
+	if err != nil {
+		t.Fatalf("a model with a max weight limit over the built-in ones must be registered:%v", err)
+	}
+	_, err = NewDrone(DroneDTO{SerialNumber: randomdata.Alphanumeric(50), Model: "Featherweight", WeightLimit: 1000, BatteryCapacity: 100, State: StateIdle})
+	if err != nil {
+		t.Errorf("a drone with the max weight limit of its model must be created:%v", err)
+	}
+}
+
+func Test_LoadSetOfMedications_payloadType(t *testing.T) {
+
+	droneObj, err := NewDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelMiddleweight,
+		WeightLimit:     300,
+		BatteryCapacity: 100,
+		State:           StateIdle,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	err = droneObj.LoadSetOfMedications([]medication.MedicationDTO{
+		{Name: "Medication-A", Code: "CODE_A", Weight: 60},
+		{Name: "Medication-B", Code: "CODE_B", Weight: 50, Type: medication.TypeControlled},
+		{Name: "Medication-C", Code: "CODE_C", Weight: 30, Type: medication.TypeRefrigerated},
+	})
+
+	loadErr, ok := err.(*LoadError)
+	if !ok {
+		t.Fatalf("a load with a payload the model can not carry must return a *LoadError but returned %v", err)
+	}
+
+	if len(loadErr.Rejected) != 1 || loadErr.Rejected[0].Code != "CODE_C" {
+		t.Errorf("only the refrigerated medication must be rejected but rejected were %+v", loadErr.Rejected)
+	}
+
+	if droneObj.CanCarry(medication.TypeRefrigerated) || !droneObj.CanCarry("") {
+		t.Errorf("a %s drone must carry standard medications but not refrigerated ones", ModelMiddleweight)
+	}
+}
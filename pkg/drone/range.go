@@ -0,0 +1,139 @@
+// Implements where a drone is and how far it can fly with its battery and payload.
+package drone
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/geo"
+)
+
+//battery level (percentage) that a drone must still have when it is back at its home base
+const RangeReserveBatteryLevel = 10
+
+//get the km that a drone of a model can fly with a battery level and a payload (in gr)
+func RangeKm(model string, batteryCapacity uint8, payload uint16) float64 {
+	return float64(batteryCapacity) * kmPerBatteryPoint(model, payload)
+}
+
+//get the km flown with each percentage point of battery, from the range of the model on a full battery without payload,
+//reduced by the payload as much as it increases the drain of the battery (it halves with the max weight limit of the model)
+func kmPerBatteryPoint(model string, payload uint16) float64 {
+	profile, _ := GetModelProfile(model)
+	return profile.RangeKm / maxBatteryCapacity / (1 + float64(payload)/float64(profile.MaxWeightLimit))
+}
+
+//check whether the drone can fly with a payload from where it is to a destination and then back to its home base empty,
+//keeping the battery reserve
+func (d *Drone) CheckRange(destination geo.Point, payload uint16) error {
+
+	err := destination.Validate()
+	if err != nil {
+		return errors.Wrap(err, "destination is not valid")
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.homeBase == nil || d.location == nil {
+		return errors.New("drone has not a known home base and location")
+	}
+
+	outbound := geo.Distance(*d.location, destination)
+	inbound := geo.Distance(destination, *d.homeBase)
+	needed := outbound/kmPerBatteryPoint(d.model, payload) + inbound/kmPerBatteryPoint(d.model, 0) + RangeReserveBatteryLevel
+
+	if needed > float64(d.batteryCapacity) {
+		return fmt.Errorf("drone can not fly %.1f km to destination and %.1f km back to base: it needs %.0f%% of battery (reserve included) and has %d%%",
+			outbound, inbound, needed, d.batteryCapacity)
+	}
+
+	return nil
+}
+
+//set the home base of the drone (it is also its location when it is not known yet)
+func (d *Drone) SetHomeBase(homeBase geo.Point) error {
+
+	err := homeBase.Validate()
+	if err != nil {
+		return errors.Wrap(err, "home base is not valid")
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.homeBase = &homeBase
+	if d.location == nil {
+		location := homeBase
+		d.location = &location
+	}
+
+	return nil
+}
+
+//get the home base of the drone (nil if it is not known)
+func (d *Drone) GetHomeBase() *geo.Point {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return copyPoint(d.homeBase)
+}
+
+//get the location of the drone (nil if it is not known)
+func (d *Drone) GetLocation() *geo.Point {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return copyPoint(d.location)
+}
+
+//get the km that the drone can fly with its battery and payload
+func (d *Drone) GetRangeKm() float64 {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return d.rangeKm()
+}
+
+//get the km that the drone can fly with its battery and payload (the caller must hold the lock)
+func (d *Drone) rangeKm() float64 {
+	return RangeKm(d.model, d.batteryCapacity, d.currentWeight())
+}
+
+//set the home base and location of a drone from a DTO (the home base is its location when that is not given)
+func (d *Drone) setPosition(dto DroneDTO) error {
+
+	if dto.HomeBase != nil {
+		err := dto.HomeBase.Validate()
+		if err != nil {
+			return errors.Wrap(err, "home base is not valid")
+		}
+		d.homeBase = copyPoint(dto.HomeBase)
+		d.location = copyPoint(dto.HomeBase)
+	}
+
+	if dto.Location != nil {
+		err := dto.Location.Validate()
+		if err != nil {
+			return errors.Wrap(err, "location is not valid")
+		}
+		d.location = copyPoint(dto.Location)
+	}
+
+	return nil
+}
+
+//get a copy of a point (nil if it is nil)
+func copyPoint(p *geo.Point) *geo.Point {
+
+	if p == nil {
+		return nil
+	}
+
+	point := *p
+	return &point
+}
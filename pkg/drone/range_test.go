@@ -0,0 +1,92 @@
+package drone
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Pallinder/go-randomdata"
+
+	"drones/pkg/geo"
+)
+
+func Test_RangeKm(t *testing.T) {
+
+	tests := []struct {
+		model           string
+		batteryCapacity uint8
+		payload         uint16
+		km              float64
+	}{
+		{ModelLightweight, 100, 0, 40},
+		{ModelLightweight, 50, 0, 20},
+		{ModelLightweight, 100, 200, 20},
+		{ModelHeavyweight, 100, 250, 25 / 1.5},
+		{ModelHeavyweight, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		km := RangeKm(tt.model, tt.batteryCapacity, tt.payload)
+		if math.Abs(km-tt.km) > 1e-9 {
+			t.Errorf("range of %s with %d%% and %d gr must be %.2f km but was %.2f km", tt.model, tt.batteryCapacity, tt.payload, tt.km, km)
+		}
+	}
+}
+
+func Test_CheckRange(t *testing.T) {
+
+	homeBase := geo.Point{Latitude: 40.4168, Longitude: -3.7038}
+	near := geo.Point{Latitude: 40.4668, Longitude: -3.7038} // about 5.6 km
+	far := geo.Point{Latitude: 40.6168, Longitude: -3.7038}  // about 22.2 km
+
+	newDrone := func(batteryCapacity uint8, homeBase *geo.Point) *Drone {
+		droneObj, err := NewDrone(DroneDTO{
+			SerialNumber:    randomdata.Alphanumeric(50),
+			Model:           ModelLightweight,
+			WeightLimit:     200,
+			BatteryCapacity: batteryCapacity,
+			State:           StateIdle,
+			HomeBase:        homeBase,
+		})
+		if err != nil {
+			t.Fatalf("error while creating drone for test:%v", err)
+		}
+		return droneObj
+	}
+
+	droneObj := newDrone(100, &homeBase)
+	if droneObj.GetLocation() == nil || *droneObj.GetLocation() != homeBase {
+		t.Fatalf("drone without location must be at its home base but is at %v", droneObj.GetLocation())
+	}
+
+	if err := droneObj.CheckRange(near, 0); err != nil {
+		t.Errorf("drone must reach a near destination: %v", err)
+	}
+	if err := droneObj.CheckRange(near, 200); err != nil {
+		t.Errorf("drone must reach a near destination with max payload: %v", err)
+	}
+	if err := droneObj.CheckRange(far, 0); err == nil {
+		t.Errorf("drone must not reach a far destination and return")
+	}
+	if err := droneObj.CheckRange(geo.Point{Latitude: 100}, 0); err == nil {
+		t.Errorf("an invalid destination must be refused")
+	}
+
+	//5.6 km out with max payload and back empty need about 28 + 14 points, plus the reserve
+	if err := newDrone(52, &homeBase).CheckRange(near, 200); err != nil {
+		t.Errorf("drone with 52%% must reach a near destination with max payload: %v", err)
+	}
+	if err := newDrone(51, &homeBase).CheckRange(near, 200); err == nil {
+		t.Errorf("drone with 51%% must not reach a near destination with max payload")
+	}
+
+	if err := newDrone(100, nil).CheckRange(near, 0); err == nil {
+		t.Errorf("drone without home base must not be sent to a destination")
+	}
+
+	//a drone that is already near the destination needs less battery for the outbound flight
+	droneObj = newDrone(100, &homeBase)
+	droneObj.location = &near
+	if err := droneObj.CheckRange(near, 0); err != nil {
+		t.Errorf("drone at the destination must be able to return: %v", err)
+	}
+}
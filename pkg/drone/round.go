@@ -0,0 +1,295 @@
+// Implements the delivery rounds of a drone: the stops where its medications are dropped off, in the order they are visited.
+package drone
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/geo"
+	"drones/pkg/medication"
+	"drones/pkg/route"
+)
+
+const (
+	//allowed status of a stop
+	StopPending   = "PENDING"
+	StopDelivered = "DELIVERED"
+)
+
+type (
+	//define a stop of a delivery round
+	Stop struct {
+		Location    geo.Point  `json:"location"`
+		Medications []string   `json:"medications"` // codes of the medications dropped off at the stop
+		Weight      uint16     `json:"weight"`      // (gr)
+		Status      string     `json:"status"`      // (PENDING, DELIVERED)
+		DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	}
+)
+
+var (
+	//check of the straight flight of each leg of the rounds (nil when the legs are not checked)
+	legCheck      func(from geo.Point, to geo.Point) error
+	legCheckMutex sync.RWMutex
+)
+
+//set the check of the straight flight of each leg of the rounds, like the one against the no-fly zones (nil to not check them)
+func SetLegCheck(check func(from geo.Point, to geo.Point) error) {
+
+	legCheckMutex.Lock()
+	defer legCheckMutex.Unlock()
+
+	legCheck = check
+}
+
+//plan the round that delivers the loaded medications at their drop-offs, ordering the stops from where the drone is
+//and back to its home base, and checking that the battery is enough for the whole round (reserve included) and that every leg
+//passes the leg check
+func (d *Drone) PlanRound() error {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return d.planRound()
+}
+
+//plan the round of a LOADED drone and make it depart to deliver it, in one step so its payload can not change in between
+func (d *Drone) Depart() error {
+
+	d.Lock()
+	defer d.Unlock()
+
+	err := d.planRound()
+	if err != nil {
+		return errors.Wrap(err, "round of the drone can not be planned")
+	}
+
+	return d.transition(StateDelivering)
+}
+
+//plan the round that delivers the loaded medications at their drop-offs (the caller must hold the lock)
+func (d *Drone) planRound() error {
+
+	stops := d.stopsOfLoad()
+	if len(stops) == 0 {
+		d.round = nil
+		return nil
+	}
+
+	if d.state != StateLoaded {
+		return fmt.Errorf("a round can not be planned while the drone is %s", d.state)
+	}
+
+	if d.homeBase == nil || d.location == nil {
+		return errors.New("drone has not a known home base and location")
+	}
+
+	locations := make([]geo.Point, 0, len(stops))
+	for _, v := range stops {
+		locations = append(locations, v.Location)
+	}
+
+	round := make([]Stop, 0, len(stops))
+	for _, v := range route.OrderStops(*d.location, d.homeBase, locations) {
+		round = append(round, stops[v])
+	}
+
+	//the payload gets lighter on every stop
+	payload := d.currentWeight()
+	current := *d.location
+	km := 0.0
+	needed := float64(RangeReserveBatteryLevel)
+	for _, v := range round {
+		distance := geo.Distance(current, v.Location)
+		km += distance
+		needed += distance / kmPerBatteryPoint(d.model, payload)
+		payload -= v.Weight
+		current = v.Location
+	}
+	distance := geo.Distance(current, *d.homeBase)
+	km += distance
+	needed += distance / kmPerBatteryPoint(d.model, payload)
+
+	if needed > float64(d.batteryCapacity) {
+		return fmt.Errorf("drone can not fly the %.1f km of a round of %d stops and back to base: it needs %.0f%% of battery (reserve included) and has %d%%",
+			km, len(round), needed, d.batteryCapacity)
+	}
+
+	err := checkLegs(*d.location, round, *d.homeBase)
+	if err != nil {
+		return err
+	}
+
+	d.round = round
+
+	return nil
+}
+
+//check every leg of a round, from where the drone departs through the stops and back to its home base
+func checkLegs(from geo.Point, round []Stop, homeBase geo.Point) error {
+
+	legCheckMutex.RLock()
+	check := legCheck
+	legCheckMutex.RUnlock()
+
+	if check == nil {
+		return nil
+	}
+
+	current := from
+	for i, v := range round {
+		err := check(current, v.Location)
+		if err != nil {
+			return errors.Wrapf(err, "leg %d of the round can not be flown", i+1)
+		}
+		current = v.Location
+	}
+
+	return errors.Wrap(check(current, homeBase), "leg back to base of the round can not be flown")
+}
+
+//drop off the medications of the next stop of the round, leaving the drone at the stop
+func (d *Drone) DeliverNextStop() (Stop, error) {
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.state != StateDelivering {
+		return Stop{}, fmt.Errorf("medications can not be dropped off while the drone is %s", d.state)
+	}
+
+	next := -1
+	for i, v := range d.round {
+		if v.Status == StopPending {
+			next = i
+			break
+		}
+	}
+	if next < 0 {
+		return Stop{}, errors.New("drone has not pending stops in its round")
+	}
+
+	stop := &d.round[next]
+	kept := make([]medication.Medication, 0, len(d.medications))
+	for _, v := range d.medications {
+		dropOff := v.GetDropOff()
+		if dropOff != nil && *dropOff == stop.Location {
+			continue
+		}
+		kept = append(kept, v)
+	}
+	d.medications = kept
+
+	deliveredAt := time.Now()
+	stop.Status = StopDelivered
+	stop.DeliveredAt = &deliveredAt
+	location := stop.Location
+	d.location = &location
+
+	return copyStop(*stop), nil
+}
+
+//check whether the round of the drone still has stops to deliver
+func (d *Drone) HasPendingStops() bool {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return d.hasPendingStops()
+}
+
+//check whether the round of the drone still has stops to deliver (the caller must hold the lock)
+func (d *Drone) hasPendingStops() bool {
+
+	for _, v := range d.round {
+		if v.Status == StopPending {
+			return true
+		}
+	}
+
+	return false
+}
+
+//get the stops of the round of the drone, in the order they are visited (nil when there is not a round)
+func (d *Drone) GetRound() []Stop {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return d.roundCopy()
+}
+
+//get a copy of the stops of the round of the drone (the caller must hold the lock)
+func (d *Drone) roundCopy() []Stop {
+
+	if len(d.round) == 0 {
+		return nil
+	}
+
+	round := make([]Stop, 0, len(d.round))
+	for _, v := range d.round {
+		round = append(round, copyStop(v))
+	}
+
+	return round
+}
+
+//get the stops of the loaded medications that have a drop-off, in the order of the load (the caller must hold the lock)
+func (d *Drone) stopsOfLoad() []Stop {
+
+	stops := make([]Stop, 0)
+	positions := make(map[geo.Point]int)
+	for _, v := range d.medications {
+		dropOff := v.GetDropOff()
+		if dropOff == nil {
+			continue
+		}
+		i, ok := positions[*dropOff]
+		if !ok {
+			i = len(stops)
+			positions[*dropOff] = i
+			stops = append(stops, Stop{
+				Location:    *dropOff,
+				Medications: make([]string, 0),
+				Status:      StopPending,
+			})
+		}
+		stops[i].Medications = append(stops[i].Medications, v.GetCode())
+		stops[i].Weight += uint16(v.GetWeight())
+	}
+
+	return stops
+}
+
+//set the round of a drone from a DTO, as it was stored
+func (d *Drone) setRound(dto DroneDTO) error {
+
+	for i, v := range dto.Round {
+		err := v.Location.Validate()
+		if err != nil {
+			return errors.Wrapf(err, "stop %d of round is not valid", i)
+		}
+		if v.Status != StopPending && v.Status != StopDelivered {
+			return fmt.Errorf("%s is not a valid status of stop %d of round", v.Status, i)
+		}
+		d.round = append(d.round, copyStop(v))
+	}
+
+	return nil
+}
+
+//get a copy of a stop
+func copyStop(s Stop) Stop {
+
+	stop := s
+	stop.Medications = append([]string{}, s.Medications...)
+	if s.DeliveredAt != nil {
+		deliveredAt := *s.DeliveredAt
+		stop.DeliveredAt = &deliveredAt
+	}
+
+	return stop
+}
@@ -0,0 +1,182 @@
+package drone
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Pallinder/go-randomdata"
+
+	"drones/pkg/geo"
+	"drones/pkg/medication"
+)
+
+func Test_PlanRound(t *testing.T) {
+
+	homeBase := geo.Point{Latitude: 40.40, Longitude: -3.70}
+	near := geo.Point{Latitude: 40.41, Longitude: -3.70}
+	far := geo.Point{Latitude: 40.43, Longitude: -3.70}
+
+	droneObj, err := NewDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelHeavyweight,
+		WeightLimit:     500,
+		BatteryCapacity: 100,
+		State:           StateIdle,
+		HomeBase:        &homeBase,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	//the far clinic is loaded first, but the near one must be visited first
+	err = droneObj.LoadSetOfMedications([]medication.MedicationDTO{
+		{Name: "Medication-A", Code: "CODE_A", Weight: 100, DropOff: &far},
+		{Name: "Medication-B", Code: "CODE_B", Weight: 150, DropOff: &near},
+		{Name: "Medication-C", Code: "CODE_C", Weight: 50, DropOff: &far},
+		{Name: "Medication-D", Code: "CODE_D", Weight: 50},
+	})
+	if err != nil {
+		t.Fatalf("error while loading drone for test:%v", err)
+	}
+
+	if err = droneObj.PlanRound(); err != nil {
+		t.Fatalf("round must be planned: %v", err)
+	}
+
+	round := droneObj.GetDTO().Round
+	if len(round) != 2 || round[0].Location != near || round[1].Location != far {
+		t.Fatalf("round must visit the near clinic and then the far one but was %+v", round)
+	}
+	if len(round[1].Medications) != 2 || round[1].Weight != 150 || round[1].Status != StopPending {
+		t.Errorf("far stop must drop off 2 medications of 150 gr but was %+v", round[1])
+	}
+
+	if _, err = droneObj.DeliverNextStop(); err == nil {
+		t.Errorf("stops must not be delivered before the drone departs")
+	}
+
+	if err = droneObj.Depart(); err != nil {
+		t.Fatalf("error while making drone depart for test:%v", err)
+	}
+
+	stop, err := droneObj.DeliverNextStop()
+	if err != nil {
+		t.Fatalf("next stop must be delivered: %v", err)
+	}
+	if stop.Location != near || stop.Status != StopDelivered || stop.DeliveredAt == nil {
+		t.Errorf("near stop must be delivered but was %+v", stop)
+	}
+	if droneObj.CurrentWeight() != 200 || *droneObj.GetLocation() != near || !droneObj.HasPendingStops() {
+		t.Errorf("drone must be at the near clinic with 200 gr left and a pending stop but has %d gr at %v", droneObj.CurrentWeight(), droneObj.GetLocation())
+	}
+	if err = droneObj.Transition(StateDelivered); err == nil {
+		t.Errorf("drone with pending stops must not move to %s", StateDelivered)
+	}
+
+	if _, err = droneObj.DeliverNextStop(); err != nil {
+		t.Fatalf("last stop must be delivered: %v", err)
+	}
+	if droneObj.HasPendingStops() || droneObj.CurrentWeight() != 50 {
+		t.Errorf("only the medication without drop-off must be left but there are %d gr", droneObj.CurrentWeight())
+	}
+	if _, err = droneObj.DeliverNextStop(); err == nil {
+		t.Errorf("a round without pending stops must not deliver more")
+	}
+	//the medication without drop-off is the one left at the destination
+	if err = droneObj.Transition(StateDelivered); err != nil {
+		t.Errorf("drone must move to %s once every stop is delivered: %v", StateDelivered, err)
+	}
+
+	//the progress is kept when the drone is stored
+	restored, err := RestoreDrone(droneObj.GetDTO())
+	if err != nil {
+		t.Fatalf("drone must be restored: %v", err)
+	}
+	if round = restored.GetRound(); len(round) != 2 || round[1].Status != StopDelivered {
+		t.Errorf("restored round must have its stops delivered but was %+v", round)
+	}
+}
+
+func Test_PlanRound_outOfRange(t *testing.T) {
+
+	homeBase := geo.Point{Latitude: 40.40, Longitude: -3.70}
+
+	droneObj, err := NewDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelHeavyweight,
+		WeightLimit:     500,
+		BatteryCapacity: 30,
+		State:           StateIdle,
+		HomeBase:        &homeBase,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	//each clinic is in range on its own, but not the round through both of them
+	err = droneObj.LoadSetOfMedications([]medication.MedicationDTO{
+		{Name: "Medication-A", Code: "CODE_A", Weight: 100, DropOff: &geo.Point{Latitude: 40.42, Longitude: -3.70}},
+		{Name: "Medication-B", Code: "CODE_B", Weight: 100, DropOff: &geo.Point{Latitude: 40.40, Longitude: -3.676}},
+	})
+	if err != nil {
+		t.Fatalf("error while loading drone for test:%v", err)
+	}
+
+	if err = droneObj.PlanRound(); err == nil {
+		t.Errorf("a round out of range must not be planned")
+	}
+	if round := droneObj.GetRound(); round != nil {
+		t.Errorf("drone must not have a round when it is out of range but was %+v", round)
+	}
+	if err = droneObj.Depart(); err == nil || droneObj.GetState() != StateLoaded {
+		t.Errorf("a drone out of range must not depart but it is %s", droneObj.GetState())
+	}
+}
+
+func Test_PlanRound_legCheck(t *testing.T) {
+
+	homeBase := geo.Point{Latitude: 40.40, Longitude: -3.70}
+	first := geo.Point{Latitude: 40.41, Longitude: -3.70}
+	second := geo.Point{Latitude: 40.41, Longitude: -3.69}
+
+	droneObj, err := NewDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelHeavyweight,
+		WeightLimit:     500,
+		BatteryCapacity: 100,
+		State:           StateIdle,
+		HomeBase:        &homeBase,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	err = droneObj.LoadSetOfMedications([]medication.MedicationDTO{
+		{Name: "Medication-A", Code: "CODE_A", Weight: 100, DropOff: &first},
+		{Name: "Medication-B", Code: "CODE_B", Weight: 100, DropOff: &second},
+	})
+	if err != nil {
+		t.Fatalf("error while loading drone for test:%v", err)
+	}
+
+	//only the leg from the last stop back to base is not allowed
+	legs := make([][2]geo.Point, 0)
+	SetLegCheck(func(from geo.Point, to geo.Point) error {
+		legs = append(legs, [2]geo.Point{from, to})
+		if to == homeBase {
+			return errors.New("leg crosses a no-fly zone")
+		}
+		return nil
+	})
+	defer SetLegCheck(nil)
+
+	if err = droneObj.PlanRound(); err == nil {
+		t.Fatalf("a round with a leg that is not allowed must not be planned")
+	}
+	if len(legs) != 3 || legs[0][0] != homeBase || legs[2][1] != homeBase {
+		t.Errorf("every leg from base through the stops and back must be checked but they were %+v", legs)
+	}
+	if droneObj.GetRound() != nil {
+		t.Errorf("a refused round must not be kept but it was %+v", droneObj.GetRound())
+	}
+}
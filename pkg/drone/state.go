@@ -0,0 +1,129 @@
+// Implements the state machine that rules how a drone moves between its states.
+package drone
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//allowed transitions between states (from -> list of destinations)
+var allowedTransitions = map[string][]string{
+	StateIdle:        {StateLoading, StateMaintenance, StateRetired},
+	StateLoading:     {StateLoaded, StateIdle},
+	StateLoaded:      {StateLoading, StateDelivering, StateIdle},
+	StateDelivering:  {StateDelivered, StateReturning},
+	StateDelivered:   {StateReturning},
+	StateReturning:   {StateIdle},
+	StateMaintenance: {StateIdle, StateRetired},
+	StateRetired:     {},
+}
+
+//check whether the state machine allows moving from one state to another
+func IsAllowedTransition(from string, to string) bool {
+
+	for _, v := range allowedTransitions[from] {
+		if v == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+//move the drone to a new state, checking the transition table and the guard conditions
+func (d *Drone) Transition(to string) error {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return d.transition(to)
+}
+
+//start a new load of an IDLE and empty drone, failing in any other case (so a drone that is already loaded is not taken twice)
+func (d *Drone) StartLoading() error {
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.state != StateIdle || len(d.medications) > 0 {
+		return fmt.Errorf("drone must be %s and empty to start a new load but it is %s with %d medications", StateIdle, d.state, len(d.medications))
+	}
+
+	return d.transition(StateLoading)
+}
+
+//move the drone to a new state (the caller must hold the lock of the drone)
+func (d *Drone) transition(to string) error {
+
+	if !validState(to) {
+		return errors.New(to + " is not a valid state")
+	}
+
+	if !IsAllowedTransition(d.state, to) {
+		return fmt.Errorf("drone can not move from %s to %s", d.state, to)
+	}
+
+	err := d.checkGuardConditions(to)
+	if err != nil {
+		return errors.Wrapf(err, "drone can not move from %s to %s", d.state, to)
+	}
+
+	from := d.state
+	d.state = to
+	d.recordUsage(from, to)
+
+	switch {
+	case from == StateIdle && to == StateLoading:
+		//a new load starts a new round
+		d.round = nil
+	case from == StateReturning && to == StateIdle && d.homeBase != nil:
+		//a drone that is back to base is at its home base
+		d.location = copyPoint(d.homeBase)
+	}
+
+	return nil
+}
+
+//check the conditions the drone must fulfill before entering a state
+func (d *Drone) checkGuardConditions(to string) error {
+
+	switch to {
+	case StateLoading:
+		if d.batteryCapacity < forbiddenBatteryLevelForStateLoading {
+			return fmt.Errorf("drone should not be %s when the battery level is below %d %%", StateLoading, forbiddenBatteryLevelForStateLoading)
+		}
+		if reasons := d.serviceDue(); d.state == StateIdle && len(reasons) > 0 {
+			return fmt.Errorf("drone is due for service: %s", strings.Join(reasons, ", "))
+		}
+	case StateLoaded:
+		if len(d.medications) == 0 {
+			return errors.New("drone has not loaded medications")
+		}
+	case StateDelivering:
+		if len(d.medications) == 0 {
+			return errors.New("drone has not medications to deliver")
+		}
+		if d.batteryCapacity < forbiddenBatteryLevelForStateLoading {
+			return fmt.Errorf("drone should not start a delivery when the battery level is below %d %%", forbiddenBatteryLevelForStateLoading)
+		}
+		if d.currentWeight() > d.weightLimit {
+			return errors.New("drone is carrying more weight that it can carry")
+		}
+	case StateDelivered:
+		//the medications without drop-off are the ones left at the destination, but every stop must be dropped off before
+		if d.hasPendingStops() {
+			return errors.New("drone has pending stops in its round")
+		}
+		if len(d.stopsOfLoad()) > 0 {
+			return errors.New("drone still has medications to drop off")
+		}
+	case StateIdle:
+		if len(d.medications) > 0 {
+			return errors.New("drone still has loaded medications")
+		}
+	}
+
+	return nil
+}
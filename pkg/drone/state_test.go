@@ -0,0 +1,118 @@
+package drone
+
+import (
+	"testing"
+
+	"github.com/Pallinder/go-randomdata"
+
+	"drones/pkg/medication"
+)
+
+func Test_IsAllowedTransition(t *testing.T) {
+
+	allowed := [][2]string{
+		{StateIdle, StateLoading},
+		{StateLoading, StateLoaded},
+		{StateLoaded, StateDelivering},
+		{StateDelivering, StateDelivered},
+		{StateDelivered, StateReturning},
+		{StateReturning, StateIdle},
+		{StateIdle, StateMaintenance},
+		{StateMaintenance, StateIdle},
+		{StateMaintenance, StateRetired},
+		{StateIdle, StateRetired},
+	}
+
+	for _, v := range allowed {
+		if !IsAllowedTransition(v[0], v[1]) {
+			t.Errorf("transition from %s to %s must be allowed", v[0], v[1])
+		}
+	}
+
+	forbidden := [][2]string{
+		{StateIdle, StateDelivering},
+		{StateIdle, StateIdle},
+		{StateLoading, StateDelivered},
+		{StateDelivered, StateIdle},
+		{StateReturning, StateLoading},
+		{StateIdle, "FLYING"},
+		{StateLoaded, StateMaintenance},
+		{StateDelivering, StateMaintenance},
+		{StateRetired, StateIdle},
+		{StateRetired, StateMaintenance},
+	}
+
+	for _, v := range forbidden {
+		if IsAllowedTransition(v[0], v[1]) {
+			t.Errorf("transition from %s to %s must not be allowed", v[0], v[1])
+		}
+	}
+}
+
+func Test_Transition(t *testing.T) {
+
+	droneObj, err := NewDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelMiddleweight,
+		WeightLimit:     300,
+		BatteryCapacity: 100,
+		State:           StateIdle,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	if err = droneObj.Transition(StateDelivering); err == nil {
+		t.Errorf("drone must not move from %s to %s", StateIdle, StateDelivering)
+	}
+
+	if err = droneObj.Transition(StateLoading); err != nil {
+		t.Errorf("drone must move from %s to %s: %v", StateIdle, StateLoading, err)
+	}
+
+	if err = droneObj.Transition(StateLoaded); err == nil {
+		t.Errorf("drone without medications must not move to %s", StateLoaded)
+	}
+
+	err = droneObj.LoadSetOfMedications([]medication.MedicationDTO{{Name: "Medication-A", Code: "CODE_A", Weight: 100}})
+	if err != nil {
+		t.Fatalf("error while loading medications for test:%v", err)
+	}
+
+	if droneObj.GetState() != StateLoaded {
+		t.Errorf("state of drone must be %s after loading but was %s", StateLoaded, droneObj.GetState())
+	}
+
+	if err = droneObj.Transition(StateIdle); err == nil {
+		t.Errorf("drone with medications must not move to %s", StateIdle)
+	}
+
+	for _, v := range []string{StateDelivering, StateDelivered, StateReturning} {
+		if err = droneObj.Transition(v); err != nil {
+			t.Errorf("drone must move to %s: %v", v, err)
+		}
+	}
+
+	err = droneObj.LoadSetOfMedications([]medication.MedicationDTO{{Name: "Medication-B", Code: "CODE_B", Weight: 10}})
+	if err == nil {
+		t.Errorf("drone must not be loaded while %s", StateReturning)
+	}
+}
+
+func Test_Transition_lowBattery(t *testing.T) {
+
+	droneObj, err := NewDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelLightweight,
+		WeightLimit:     100,
+		BatteryCapacity: forbiddenBatteryLevelForStateLoading - 1,
+		State:           StateIdle,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	if err = droneObj.Transition(StateLoading); err == nil {
+		t.Errorf("drone must not move to %s when battery level is %d %%", StateLoading, droneObj.GetBatteryCapacity())
+	}
+}
@@ -0,0 +1,122 @@
+// Implements the readings that a drone reports about itself (battery, position, speed and state).
+package drone
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/geo"
+)
+
+//error of a reading that is not newer than the last one applied to the drone
+var ErrOutOfOrderTelemetry = errors.New("reading is not newer than the last one of the drone")
+
+type (
+	//define a reading reported by a drone
+	Telemetry struct {
+		Timestamp       time.Time  `json:"timestamp"`                  // when the drone took the reading
+		BatteryCapacity *uint8     `json:"battery_capacity,omitempty"` // (percentage); nil when the reading does not tell it
+		Position        *geo.Point `json:"position,omitempty"`         // where the drone is (nil when the reading does not tell it)
+		Altitude        float64    `json:"altitude"`                   // meters
+		Speed           float64    `json:"speed"`                      // meters per second
+		State           string     `json:"state,omitempty"`            // state reported by the drone
+		StateMismatch   bool       `json:"state_mismatch,omitempty"`   // the reported state is not the one of the controller
+	}
+)
+
+//apply a reading to the drone: its battery level and position are taken from it (when it has them), but its state is only compared
+//with the one of the controller
+func (d *Drone) ApplyTelemetry(reading Telemetry) (Telemetry, error) {
+
+	err := validTelemetry(reading)
+	if err != nil {
+		return Telemetry{}, err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.telemetry != nil && !reading.Timestamp.After(d.telemetry.Timestamp) {
+		return Telemetry{}, ErrOutOfOrderTelemetry
+	}
+
+	reading.StateMismatch = reading.State != "" && reading.State != d.state
+
+	reading.BatteryCapacity = copyBatteryCapacity(reading.BatteryCapacity)
+	reading.Position = copyPoint(reading.Position)
+	d.telemetry = &reading
+	//a reading without battery level (like a position only one) leaves the battery as it was
+	if reading.BatteryCapacity != nil {
+		d.setBatteryCapacity(*reading.BatteryCapacity)
+	}
+	//a reading without position (like a battery only one) leaves the drone where it was
+	if reading.Position != nil {
+		d.location = copyPoint(reading.Position)
+	}
+
+	return reading, nil
+}
+
+//get the last reading applied to the drone (nil if there is none)
+func (d *Drone) GetTelemetry() *Telemetry {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return d.telemetryCopy()
+}
+
+//get a copy of the last reading applied to the drone (the caller must hold the lock)
+func (d *Drone) telemetryCopy() *Telemetry {
+
+	if d.telemetry == nil {
+		return nil
+	}
+
+	reading := *d.telemetry
+	reading.BatteryCapacity = copyBatteryCapacity(reading.BatteryCapacity)
+	reading.Position = copyPoint(reading.Position)
+	return &reading
+}
+
+//get a copy of the battery level of a reading (nil when it has none)
+func copyBatteryCapacity(batteryCapacity *uint8) *uint8 {
+
+	if batteryCapacity == nil {
+		return nil
+	}
+
+	c := *batteryCapacity
+	return &c
+}
+
+//check whether the values of a reading are valid
+func validTelemetry(reading Telemetry) error {
+
+	if reading.Timestamp.IsZero() {
+		return errors.New("reading lacks of timestamp")
+	}
+
+	if reading.BatteryCapacity != nil && *reading.BatteryCapacity > maxBatteryCapacity {
+		return fmt.Errorf("%d is not a valid battery capacity", *reading.BatteryCapacity)
+	}
+
+	if reading.Position != nil {
+		err := reading.Position.Validate()
+		if err != nil {
+			return errors.Wrap(err, "position is not valid")
+		}
+	}
+
+	if reading.Speed < 0 {
+		return fmt.Errorf("%f is not a valid speed", reading.Speed)
+	}
+
+	if reading.State != "" && !validState(reading.State) {
+		return errors.New(reading.State + " is not a valid state")
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package drone
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Pallinder/go-randomdata"
+
+	"drones/pkg/geo"
+)
+
+//get the battery level of a reading of the tests
+func battery(v uint8) *uint8 {
+	return &v
+}
+
+func Test_ApplyTelemetry(t *testing.T) {
+
+	droneObj, err := NewDrone(DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           ModelMiddleweight,
+		WeightLimit:     300,
+		BatteryCapacity: 100,
+		State:           StateIdle,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	start := time.Date(2021, 11, 26, 10, 0, 0, 0, time.UTC)
+
+	invalid := []Telemetry{
+		{BatteryCapacity: battery(50)},
+		{Timestamp: start, BatteryCapacity: battery(101)},
+		{Timestamp: start, Position: &geo.Point{Latitude: 91}},
+		{Timestamp: start, Position: &geo.Point{Longitude: -181}},
+		{Timestamp: start, Speed: -1},
+		{Timestamp: start, State: "FLYING"},
+	}
+	for i, v := range invalid {
+		if _, err = droneObj.ApplyTelemetry(v); err == nil {
+			t.Errorf("reading %d must be rejected", i)
+		}
+	}
+
+	reading, err := droneObj.ApplyTelemetry(Telemetry{Timestamp: start, BatteryCapacity: battery(80), Position: &geo.Point{Latitude: 40.4, Longitude: -3.7}, State: StateIdle})
+	if err != nil {
+		t.Fatalf("valid reading was rejected: %v", err)
+	}
+	if reading.StateMismatch || droneObj.GetBatteryCapacity() != 80 {
+		t.Errorf("reading must update the battery level without state mismatch: %+v", reading)
+	}
+
+	if _, err = droneObj.ApplyTelemetry(Telemetry{Timestamp: start, BatteryCapacity: battery(70)}); err != ErrOutOfOrderTelemetry {
+		t.Errorf("reading with the same timestamp must be out of order but got %v", err)
+	}
+	if _, err = droneObj.ApplyTelemetry(Telemetry{Timestamp: start.Add(-time.Second), BatteryCapacity: battery(70)}); err != ErrOutOfOrderTelemetry {
+		t.Errorf("older reading must be out of order but got %v", err)
+	}
+	if droneObj.GetBatteryCapacity() != 80 {
+		t.Errorf("rejected readings must not change the battery level")
+	}
+
+	//the state of the controller is kept even when the drone reports another one
+	reading, err = droneObj.ApplyTelemetry(Telemetry{Timestamp: start.Add(time.Second), BatteryCapacity: battery(79), State: StateDelivering})
+	if err != nil {
+		t.Fatalf("valid reading was rejected: %v", err)
+	}
+	if location := droneObj.GetLocation(); location == nil || *location != (geo.Point{Latitude: 40.4, Longitude: -3.7}) {
+		t.Errorf("a reading without position must leave the drone where it was but it is at %+v", location)
+	}
+	if !reading.StateMismatch || droneObj.GetState() != StateIdle {
+		t.Errorf("reading must be flagged as state mismatch and keep state %s: %+v", StateIdle, reading)
+	}
+
+	//a reading without battery level leaves the battery as it was
+	reading, err = droneObj.ApplyTelemetry(Telemetry{Timestamp: start.Add(2 * time.Second), Position: &geo.Point{Latitude: 40.5, Longitude: -3.7}})
+	if err != nil {
+		t.Fatalf("valid reading was rejected: %v", err)
+	}
+	if reading.BatteryCapacity != nil || droneObj.GetBatteryCapacity() != 79 {
+		t.Errorf("a reading without battery level must leave the battery at 79 but it is at %d", droneObj.GetBatteryCapacity())
+	}
+	if location := droneObj.GetLocation(); location == nil || *location != (geo.Point{Latitude: 40.5, Longitude: -3.7}) {
+		t.Errorf("a reading without battery level must still move the drone but it is at %+v", location)
+	}
+
+	//the last reading survives a restore
+	restored, err := RestoreDrone(droneObj.GetDTO())
+	if err != nil {
+		t.Fatalf("error while restoring drone:%v", err)
+	}
+	if restored.GetTelemetry() == nil || !restored.GetTelemetry().Timestamp.Equal(start.Add(2*time.Second)) {
+		t.Errorf("restored drone must keep its last reading but has %+v", restored.GetTelemetry())
+	}
+	if _, err = restored.ApplyTelemetry(Telemetry{Timestamp: start, BatteryCapacity: battery(70)}); err != ErrOutOfOrderTelemetry {
+		t.Errorf("restored drone must reject older readings but got %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+// Implements an internal bus of fleet events that subscribers receive filtered by drone and type.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"drones/pkg/drone"
+)
+
+const (
+	//allowed types
+	TypeDroneRegistered     = "DRONE_REGISTERED"
+	TypeMedicationsLoaded   = "MEDICATIONS_LOADED"
+	TypeMedicationsUnloaded = "MEDICATIONS_UNLOADED"
+	TypeStateChanged        = "STATE_CHANGED"
+	TypeBatteryUpdated      = "BATTERY_UPDATED"
+	TypeStateMismatch       = "STATE_MISMATCH" // the state reported by a drone is not the one of the controller
+
+	//events kept to be replayed to subscribers that reconnect
+	replaySize = 256
+	//events waiting to be read by a subscriber before new ones are dropped for it
+	subscriptionBufferSize = 64
+)
+
+type (
+	//something that happened to a drone of the fleet
+	Event struct {
+		ID           uint64          `json:"id"`
+		Type         string          `json:"type"`
+		SerialNumber string          `json:"serial_number"`
+		Timestamp    time.Time       `json:"timestamp"`
+		Drone        *drone.DroneDTO `json:"drone,omitempty"` // data of the drone after the event
+	}
+
+	//selects the events a subscriber wants (empty lists select everything)
+	Filter struct {
+		SerialNumbers []string
+		Types         []string
+	}
+
+	//a receiver of the events of the bus
+	Subscription struct {
+		id     uint64
+		filter Filter
+		events chan Event
+		queue  *queue // events waiting to be forwarded to the channel (nil when the subscription drops them)
+	}
+
+	//unbounded list of the events of a subscription that does not lose them
+	queue struct {
+		pending []Event
+		closed  bool
+		wake    chan struct{} // signaled when events are added or the queue is closed
+		sync.Mutex
+	}
+
+	//delivers the published events to the subscribers
+	Bus struct {
+		lastID        uint64 // id of the last published event
+		lastSubID     uint64 // id of the last subscription
+		subscriptions map[uint64]*Subscription
+		recent        []Event // last published events, oldest first
+		sync.Mutex
+	}
+)
+
+//get a pointer to an empty bus
+func NewBus() *Bus {
+	return &Bus{
+		subscriptions: make(map[uint64]*Subscription),
+	}
+}
+
+//publish an event of a drone, getting it with its id and timestamp
+func (b *Bus) Publish(eventType string, dto drone.DroneDTO) Event {
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.lastID++
+	event := Event{
+		ID:           b.lastID,
+		Type:         eventType,
+		SerialNumber: dto.SerialNumber,
+		Timestamp:    time.Now(),
+		Drone:        &dto,
+	}
+
+	b.recent = append(b.recent, event)
+	if len(b.recent) > replaySize {
+		b.recent = b.recent[len(b.recent)-replaySize:]
+	}
+
+	for _, v := range b.subscriptions {
+		if !v.filter.Match(event) {
+			continue
+		}
+		if v.queue != nil {
+			v.queue.push(event)
+			continue
+		}
+		//a subscriber that does not keep up loses events instead of blocking the bus
+		select {
+		case v.events <- event:
+		default:
+		}
+	}
+
+	return event
+}
+
+//subscribe to the events that match the filter
+func (b *Bus) Subscribe(filter Filter) *Subscription {
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.lastSubID++
+	s := &Subscription{
+		id:     b.lastSubID,
+		filter: filter,
+		events: make(chan Event, subscriptionBufferSize),
+	}
+	b.subscriptions[s.id] = s
+
+	return s
+}
+
+//subscribe to the events that match the filter without losing any when the subscriber falls behind
+//(the subscriber must read the channel until it is closed)
+func (b *Bus) SubscribeLossless(filter Filter) *Subscription {
+
+	s := b.Subscribe(filter)
+	s.queue = &queue{wake: make(chan struct{}, 1)}
+
+	go s.forward()
+
+	return s
+}
+
+//stop receiving events on a subscription
+func (b *Bus) Unsubscribe(s *Subscription) {
+
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.subscriptions[s.id]; ok {
+		delete(b.subscriptions, s.id)
+		if s.queue != nil {
+			//the events already queued are still delivered before the channel is closed
+			s.queue.close()
+			return
+		}
+		close(s.events)
+	}
+}
+
+//get the recent events published after the given id that match the filter (used to replay them on reconnection)
+func (b *Bus) Since(id uint64, filter Filter) []Event {
+
+	b.Lock()
+	defer b.Unlock()
+
+	events := make([]Event, 0)
+	for _, v := range b.recent {
+		if v.ID > id && filter.Match(v) {
+			events = append(events, v)
+		}
+	}
+
+	return events
+}
+
+//get the channel where the events of the subscription are received (closed on unsubscribe)
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+//forward the queued events of a lossless subscription to its channel, closing it once the queue is closed and empty
+func (s *Subscription) forward() {
+
+	defer close(s.events)
+
+	for {
+		pending, closed := s.queue.take()
+		for _, v := range pending {
+			s.events <- v
+		}
+		if closed {
+			return
+		}
+		if len(pending) == 0 {
+			<-s.queue.wake
+		}
+	}
+}
+
+//add an event to the queue
+func (q *queue) push(event Event) {
+
+	q.Lock()
+	q.pending = append(q.pending, event)
+	q.Unlock()
+
+	q.signal()
+}
+
+//get the queued events, emptying the queue, and whether it is closed
+func (q *queue) take() ([]Event, bool) {
+
+	q.Lock()
+	defer q.Unlock()
+
+	pending := q.pending
+	q.pending = nil
+
+	return pending, q.closed
+}
+
+//close the queue, so no more events are added to it
+func (q *queue) close() {
+
+	q.Lock()
+	q.closed = true
+	q.Unlock()
+
+	q.signal()
+}
+
+//wake the forwarding of the queue when it is waiting
+func (q *queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+//check whether an event is selected by the filter
+func (f Filter) Match(event Event) bool {
+	return contains(f.SerialNumbers, event.SerialNumber) && contains(f.Types, event.Type)
+}
+
+//check whether a value is in the list (any value is when the list is empty)
+func contains(list []string, value string) bool {
+
+	if len(list) == 0 {
+		return true
+	}
+
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
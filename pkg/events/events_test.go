@@ -0,0 +1,98 @@
+package events
+
+import (
+	"testing"
+
+	"drones/pkg/drone"
+)
+
+func Test_Bus(t *testing.T) {
+
+	b := NewBus()
+
+	all := b.Subscribe(Filter{})
+	filtered := b.Subscribe(Filter{SerialNumbers: []string{"SERIAL-A"}, Types: []string{TypeStateChanged}})
+
+	b.Publish(TypeDroneRegistered, drone.DroneDTO{SerialNumber: "SERIAL-A"})
+	b.Publish(TypeStateChanged, drone.DroneDTO{SerialNumber: "SERIAL-B"})
+	last := b.Publish(TypeStateChanged, drone.DroneDTO{SerialNumber: "SERIAL-A", State: "LOADING"})
+
+	if len(all.Events()) != 3 {
+		t.Errorf("subscription without filter must receive 3 events but received %d", len(all.Events()))
+	}
+
+	if len(filtered.Events()) != 1 {
+		t.Fatalf("filtered subscription must receive 1 event but received %d", len(filtered.Events()))
+	}
+
+	event := <-filtered.Events()
+	if event.ID != last.ID || event.SerialNumber != "SERIAL-A" || event.Drone.State != "LOADING" {
+		t.Errorf("filtered subscription received unexpected event %+v", event)
+	}
+
+	b.Unsubscribe(filtered)
+	b.Unsubscribe(filtered)
+	b.Publish(TypeStateChanged, drone.DroneDTO{SerialNumber: "SERIAL-A"})
+	for range filtered.Events() {
+		t.Errorf("closed subscription must not receive events")
+	}
+}
+
+func Test_SubscribeLossless(t *testing.T) {
+
+	b := NewBus()
+
+	lossy := b.Subscribe(Filter{})
+	lossless := b.SubscribeLossless(Filter{Types: []string{TypeBatteryUpdated}})
+
+	published := subscriptionBufferSize * 3
+	for i := 0; i < published; i++ {
+		b.Publish(TypeBatteryUpdated, drone.DroneDTO{SerialNumber: "SERIAL-A"})
+	}
+	b.Publish(TypeStateChanged, drone.DroneDTO{SerialNumber: "SERIAL-A"})
+	b.Unsubscribe(lossless)
+
+	if len(lossy.Events()) != subscriptionBufferSize {
+		t.Errorf("subscription that falls behind must keep %d events but kept %d", subscriptionBufferSize, len(lossy.Events()))
+	}
+
+	received := 0
+	lastID := uint64(0)
+	for v := range lossless.Events() {
+		if v.ID <= lastID || v.Type != TypeBatteryUpdated {
+			t.Fatalf("lossless subscription received unexpected event %+v after %d", v, lastID)
+		}
+		lastID = v.ID
+		received++
+	}
+	if received != published {
+		t.Errorf("lossless subscription must receive %d events but received %d", published, received)
+	}
+}
+
+func Test_Since(t *testing.T) {
+
+	b := NewBus()
+
+	for i := 0; i < replaySize+10; i++ {
+		b.Publish(TypeBatteryUpdated, drone.DroneDTO{SerialNumber: "SERIAL-A"})
+	}
+
+	events := b.Since(0, Filter{})
+	if len(events) != replaySize {
+		t.Fatalf("bus must replay its last %d events but replayed %d", replaySize, len(events))
+	}
+	if events[0].ID != 11 {
+		t.Errorf("first replayed event must be 11 but was %d", events[0].ID)
+	}
+
+	events = b.Since(uint64(replaySize+5), Filter{})
+	if len(events) != 5 {
+		t.Errorf("bus must replay 5 events after id %d but replayed %d", replaySize+5, len(events))
+	}
+
+	events = b.Since(0, Filter{SerialNumbers: []string{"SERIAL-B"}})
+	if len(events) != 0 {
+		t.Errorf("bus must not replay events of other drones but replayed %d", len(events))
+	}
+}
@@ -0,0 +1,50 @@
+// Implements geographic points and the distance between them.
+package geo
+
+import (
+	"fmt"
+	"math"
+)
+
+//mean radius of the Earth in km
+const earthRadiusKm = 6371.0
+
+type (
+	//define a point on the Earth
+	Point struct {
+		Latitude  float64 `json:"latitude"`  // degrees (-90 to 90)
+		Longitude float64 `json:"longitude"` // degrees (-180 to 180)
+	}
+)
+
+//check whether the coordinates of the point are valid
+func (p Point) Validate() error {
+
+	if math.IsNaN(p.Latitude) || p.Latitude < -90 || p.Latitude > 90 {
+		return fmt.Errorf("%f is not a valid latitude", p.Latitude)
+	}
+
+	if math.IsNaN(p.Longitude) || p.Longitude < -180 || p.Longitude > 180 {
+		return fmt.Errorf("%f is not a valid longitude", p.Longitude)
+	}
+
+	return nil
+}
+
+//get the great-circle distance in km between two points (haversine formula)
+func Distance(a Point, b Point) float64 {
+
+	lat1 := radians(a.Latitude)
+	lat2 := radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(b.Longitude - a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+//get an angle in radians from degrees
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
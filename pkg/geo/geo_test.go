@@ -0,0 +1,87 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_Distance(t *testing.T) {
+
+	tests := []struct {
+		name string
+		a    Point
+		b    Point
+		km   float64
+	}{
+		{"same point", Point{40.4168, -3.7038}, Point{40.4168, -3.7038}, 0},
+		{"madrid to barcelona", Point{40.4168, -3.7038}, Point{41.3874, 2.1686}, 505},
+		{"quarter of equator", Point{0, 0}, Point{0, 90}, 10007.5},
+		{"antipodes", Point{0, 0}, Point{0, 180}, 20015.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := Distance(tt.a, tt.b)
+			if math.Abs(km-tt.km) > 1 {
+				t.Errorf("distance must be about %.1f km but was %.1f km", tt.km, km)
+			}
+			if math.Abs(Distance(tt.b, tt.a)-km) > 1e-9 {
+				t.Errorf("distance must be symmetric")
+			}
+		})
+	}
+}
+
+func Test_Validate(t *testing.T) {
+
+	valid := []Point{{0, 0}, {90, 180}, {-90, -180}, {40.4168, -3.7038}}
+	for _, v := range valid {
+		if err := v.Validate(); err != nil {
+			t.Errorf("point %v must be valid: %v", v, err)
+		}
+	}
+
+	invalid := []Point{{91, 0}, {-91, 0}, {0, 181}, {0, -181}, {math.NaN(), 0}}
+	for _, v := range invalid {
+		if v.Validate() == nil {
+			t.Errorf("point %v must not be valid", v)
+		}
+	}
+}
+
+func Test_Plane(t *testing.T) {
+
+	origin := Point{Latitude: 40.4168, Longitude: -3.7038}
+	plane := NewPlane(origin)
+
+	point := Point{Latitude: 40.45, Longitude: -3.65}
+	xy := plane.Project(point)
+
+	if math.Abs(xy.Distance(XY{})-Distance(origin, point)) > 0.01 {
+		t.Errorf("distance on the plane must be about %f km but was %f km", Distance(origin, point), xy.Distance(XY{}))
+	}
+
+	back := plane.Unproject(xy)
+	if math.Abs(back.Latitude-point.Latitude) > 1e-9 || math.Abs(back.Longitude-point.Longitude) > 1e-9 {
+		t.Errorf("point must be the same after projecting it and back but was %v", back)
+	}
+
+	if !SegmentsIntersect(XY{0, 0}, XY{2, 2}, XY{0, 2}, XY{2, 0}) {
+		t.Errorf("crossing segments must intersect")
+	}
+	if !SegmentsIntersect(XY{0, 0}, XY{2, 0}, XY{2, 0}, XY{3, 1}) {
+		t.Errorf("segments that touch must intersect")
+	}
+	if SegmentsIntersect(XY{0, 0}, XY{1, 0}, XY{0, 1}, XY{1, 1}) {
+		t.Errorf("parallel segments must not intersect")
+	}
+
+	if d := DistanceToSegment(XY{1, 1}, XY{0, 0}, XY{2, 0}); d != 1 {
+		t.Errorf("distance to segment must be 1 but was %f", d)
+	}
+
+	square := []XY{{0, 0}, {2, 0}, {2, 2}, {0, 2}}
+	if !InsidePolygon(square, XY{1, 1}) || InsidePolygon(square, XY{3, 1}) {
+		t.Errorf("unexpected result of point in polygon")
+	}
+}
@@ -0,0 +1,102 @@
+// Implements a flat projection of the Earth around a point, where short distances and segments are handled as on a plane.
+package geo
+
+import (
+	"math"
+)
+
+type (
+	//define a position in km on a plane (x to the east, y to the north)
+	XY [2]float64
+
+	//define a flat projection around an origin (valid for the short distances a drone flies)
+	Plane struct {
+		origin Point
+		cosLat float64
+	}
+)
+
+//get a plane centered on an origin
+func NewPlane(origin Point) Plane {
+	return Plane{
+		origin: origin,
+		cosLat: math.Cos(radians(origin.Latitude)),
+	}
+}
+
+//get the position of a point on the plane
+func (p Plane) Project(point Point) XY {
+	return XY{
+		radians(point.Longitude-p.origin.Longitude) * earthRadiusKm * p.cosLat,
+		radians(point.Latitude-p.origin.Latitude) * earthRadiusKm,
+	}
+}
+
+//get the point of a position on the plane
+func (p Plane) Unproject(xy XY) Point {
+	return Point{
+		Latitude:  p.origin.Latitude + degrees(xy[1]/earthRadiusKm),
+		Longitude: p.origin.Longitude + degrees(xy[0]/(earthRadiusKm*p.cosLat)),
+	}
+}
+
+//get the distance between two positions
+func (a XY) Distance(b XY) float64 {
+	return math.Hypot(b[0]-a[0], b[1]-a[1])
+}
+
+//get the distance from a position to a segment
+func DistanceToSegment(p XY, a XY, b XY) float64 {
+
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, ((p[0]-a[0])*dx+(p[1]-a[1])*dy)/length))
+	}
+
+	return p.Distance(XY{a[0] + t*dx, a[1] + t*dy})
+}
+
+//check whether two segments touch
+func SegmentsIntersect(a XY, b XY, c XY, d XY) bool {
+
+	d1, d2 := cross(c, d, a), cross(c, d, b)
+	d3, d4 := cross(a, b, c), cross(a, b, d)
+
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+
+	return (d1 == 0 && onSegment(c, d, a)) || (d2 == 0 && onSegment(c, d, b)) ||
+		(d3 == 0 && onSegment(a, b, c)) || (d4 == 0 && onSegment(a, b, d))
+}
+
+//check whether a position is inside a polygon (ray casting, the polygon may be closed or not)
+func InsidePolygon(polygon []XY, p XY) bool {
+
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a[1] > p[1]) != (b[1] > p[1]) && p[0] < (b[0]-a[0])*(p[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+//get the cross product of (b - a) and (p - a)
+func cross(a XY, b XY, p XY) float64 {
+	return (b[0]-a[0])*(p[1]-a[1]) - (b[1]-a[1])*(p[0]-a[0])
+}
+
+//check whether a position that is collinear with a segment is on it
+func onSegment(a XY, b XY, p XY) bool {
+	return math.Min(a[0], b[0]) <= p[0] && p[0] <= math.Max(a[0], b[0]) &&
+		math.Min(a[1], b[1]) <= p[1] && p[1] <= math.Max(a[1], b[1])
+}
+
+//get an angle in degrees from radians
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
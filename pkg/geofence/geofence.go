@@ -0,0 +1,537 @@
+// Implements no-fly zones (geofences) read from GeoJSON, and the check of points and straight flights against them.
+package geofence
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/geo"
+)
+
+const (
+	//GeoJSON types
+	TypeFeatureCollection = "FeatureCollection"
+	TypeFeature           = "Feature"
+	GeometryPolygon       = "Polygon"
+	GeometryPoint         = "Point" // a circle, with its radius in the properties
+
+	//sides of the polygons that outline circles
+	circleOutlineSides = 24
+)
+
+type (
+	//define a GeoJSON collection of zones (the format of the file)
+	FeatureCollection struct {
+		Type     string    `json:"type"`
+		Features []Feature `json:"features"`
+	}
+
+	//define a zone as a GeoJSON feature
+	Feature struct {
+		Type       string     `json:"type"`
+		ID         string     `json:"id,omitempty"`
+		Geometry   Geometry   `json:"geometry"`
+		Properties Properties `json:"properties"`
+	}
+
+	//define the geometry of a zone
+	Geometry struct {
+		Type        string          `json:"type"`        // (Polygon, Point);
+		Coordinates json.RawMessage `json:"coordinates"` // positions as [longitude, latitude]
+	}
+
+	//define the properties of a zone
+	Properties struct {
+		Name   string  `json:"name"`
+		Radius float64 `json:"radius,omitempty"` // meters (only for Point)
+	}
+
+	//define the outline of a zone as a polygon (circles are turned into polygons that contain them)
+	Outline struct {
+		Zone Feature
+		Ring []geo.Point // closed
+	}
+
+	//error of a point or flight that enters a zone
+	ViolationError struct {
+		Zone    Feature
+		Subject string // what enters the zone
+	}
+
+	//a zone ready to be checked
+	zone struct {
+		feature  Feature
+		rings    [][]geo.Point // outer ring and holes (polygons)
+		center   geo.Point     // (circles)
+		radiusKm float64       // (circles)
+	}
+
+	//keeps the zones by id, persisted in a GeoJSON file
+	Store struct {
+		path  string           // file where the zones are persisted (empty to keep them only in memory)
+		zones map[string]*zone // use ID as key
+		sync.Mutex
+	}
+)
+
+//get the message of a violation
+func (e *ViolationError) Error() string {
+	return fmt.Sprintf("%s enters the no-fly zone %s (%s)", e.Subject, e.Zone.ID, e.Zone.Properties.Name)
+}
+
+//get a pointer to a store of zones, reading the file when it already exists
+func NewStore(path string) (*Store, error) {
+
+	s := &Store{
+		path:  path,
+		zones: make(map[string]*zone),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read geofences file")
+	}
+
+	collection := FeatureCollection{}
+	err = json.Unmarshal(data, &collection)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal geofences file")
+	}
+
+	if collection.Type != TypeFeatureCollection {
+		return nil, fmt.Errorf("geofences file must be a %s but it is a %s", TypeFeatureCollection, collection.Type)
+	}
+
+	for i, v := range collection.Features {
+		if v.ID == "" {
+			v.ID = fmt.Sprintf("zone-%d", i+1)
+		}
+		if s.zones[v.ID] != nil {
+			return nil, fmt.Errorf("zone %s of geofences file is repeated", v.ID)
+		}
+		z, err := newZone(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "zone %s of geofences file is not valid", v.ID)
+		}
+		s.zones[v.ID] = z
+	}
+
+	return s, nil
+}
+
+//add a zone, getting it with its id (a random one when it has none)
+func (s *Store) Add(feature Feature) (Feature, error) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if feature.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return Feature{}, err
+		}
+		feature.ID = id
+	}
+
+	if s.zones[feature.ID] != nil {
+		return Feature{}, fmt.Errorf("zone with id %s already exists", feature.ID)
+	}
+
+	z, err := newZone(feature)
+	if err != nil {
+		return Feature{}, err
+	}
+
+	s.zones[feature.ID] = z
+
+	err = s.save()
+	if err != nil {
+		delete(s.zones, feature.ID)
+		return Feature{}, err
+	}
+
+	return z.feature, nil
+}
+
+//replace a zone by its id
+func (s *Store) Update(id string, feature Feature) (Feature, error) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	previous := s.zones[id]
+	if previous == nil {
+		return Feature{}, fmt.Errorf("there is not a zone with id %s", id)
+	}
+
+	feature.ID = id
+	z, err := newZone(feature)
+	if err != nil {
+		return Feature{}, err
+	}
+
+	s.zones[id] = z
+
+	err = s.save()
+	if err != nil {
+		s.zones[id] = previous
+		return Feature{}, err
+	}
+
+	return z.feature, nil
+}
+
+//remove a zone by its id
+func (s *Store) Delete(id string) error {
+
+	s.Lock()
+	defer s.Unlock()
+
+	previous := s.zones[id]
+	if previous == nil {
+		return fmt.Errorf("there is not a zone with id %s", id)
+	}
+
+	delete(s.zones, id)
+
+	err := s.save()
+	if err != nil {
+		s.zones[id] = previous
+		return err
+	}
+
+	return nil
+}
+
+//get a zone by its id
+func (s *Store) Get(id string) (Feature, bool) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	z := s.zones[id]
+	if z == nil {
+		return Feature{}, false
+	}
+
+	return z.feature, true
+}
+
+//get all zones sorted by id
+func (s *Store) GetAll() []Feature {
+
+	s.Lock()
+	defer s.Unlock()
+
+	return s.features()
+}
+
+//check that a point is outside every zone (the error is a *ViolationError when it is inside one)
+func (s *Store) CheckPoint(point geo.Point) error {
+
+	err := point.Validate()
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, v := range s.sortedZones() {
+		if v.contains(point) {
+			return &ViolationError{
+				Zone:    v.feature,
+				Subject: fmt.Sprintf("point (%f, %f)", point.Latitude, point.Longitude),
+			}
+		}
+	}
+
+	return nil
+}
+
+//check that a straight flight between two points does not enter any zone (the error is a *ViolationError when it does)
+func (s *Store) CheckFlight(from geo.Point, to geo.Point) error {
+
+	err := from.Validate()
+	if err != nil {
+		return errors.Wrap(err, "origin is not valid")
+	}
+
+	err = to.Validate()
+	if err != nil {
+		return errors.Wrap(err, "destination is not valid")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, v := range s.sortedZones() {
+		if v.crosses(from, to) {
+			return &ViolationError{
+				Zone:    v.feature,
+				Subject: fmt.Sprintf("flight from (%f, %f) to (%f, %f)", from.Latitude, from.Longitude, to.Latitude, to.Longitude),
+			}
+		}
+	}
+
+	return nil
+}
+
+//get the outlines of all zones sorted by id (holes of polygons are not part of them)
+func (s *Store) Outlines() []Outline {
+
+	s.Lock()
+	defer s.Unlock()
+
+	outlines := make([]Outline, 0, len(s.zones))
+	for _, v := range s.sortedZones() {
+		outlines = append(outlines, Outline{Zone: v.feature, Ring: v.outline()})
+	}
+
+	return outlines
+}
+
+//write all zones to the file as a feature collection (must be called with the lock taken)
+func (s *Store) save() error {
+
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(FeatureCollection{Type: TypeFeatureCollection, Features: s.features()}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal geofences")
+	}
+
+	//the file is replaced at once, so a crash while writing does not leave it half written
+	tmpPath := s.path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not write geofences file")
+	}
+
+	return errors.Wrap(os.Rename(tmpPath, s.path), "could not replace geofences file")
+}
+
+//get the features of all zones sorted by id (must be called with the lock taken)
+func (s *Store) features() []Feature {
+
+	features := make([]Feature, 0, len(s.zones))
+	for _, v := range s.sortedZones() {
+		features = append(features, v.feature)
+	}
+
+	return features
+}
+
+//get all zones sorted by id, so checks always report the same zone (must be called with the lock taken)
+func (s *Store) sortedZones() []*zone {
+
+	zones := make([]*zone, 0, len(s.zones))
+	for _, v := range s.zones {
+		zones = append(zones, v)
+	}
+
+	sort.Slice(zones, func(i, j int) bool {
+		return zones[i].feature.ID < zones[j].feature.ID
+	})
+
+	return zones
+}
+
+//get a zone from a GeoJSON feature
+func newZone(feature Feature) (*zone, error) {
+
+	if feature.Type == "" {
+		feature.Type = TypeFeature
+	}
+	if feature.Type != TypeFeature {
+		return nil, fmt.Errorf("zone must be a %s but it is a %s", TypeFeature, feature.Type)
+	}
+
+	z := &zone{feature: feature}
+
+	switch feature.Geometry.Type {
+	case GeometryPolygon:
+		positions := make([][][]float64, 0)
+		err := json.Unmarshal(feature.Geometry.Coordinates, &positions)
+		if err != nil {
+			return nil, errors.Wrap(err, "coordinates of polygon are not valid")
+		}
+		if len(positions) == 0 {
+			return nil, errors.New("polygon needs at least one ring")
+		}
+		for i, v := range positions {
+			ring, err := newRing(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "ring %d of polygon is not valid", i)
+			}
+			z.rings = append(z.rings, ring)
+		}
+		if feature.Properties.Radius != 0 {
+			return nil, errors.New("radius is only allowed for circles (Point)")
+		}
+	case GeometryPoint:
+		position := make([]float64, 0)
+		err := json.Unmarshal(feature.Geometry.Coordinates, &position)
+		if err != nil {
+			return nil, errors.Wrap(err, "coordinates of point are not valid")
+		}
+		center, err := newPoint(position)
+		if err != nil {
+			return nil, err
+		}
+		if feature.Properties.Radius <= 0 {
+			return nil, errors.New("a circle (Point) needs a radius in meters greater than 0")
+		}
+		z.center = center
+		z.radiusKm = feature.Properties.Radius / 1000
+	default:
+		return nil, fmt.Errorf("geometry %s is not valid, allowed ones are %s and %s", feature.Geometry.Type, GeometryPolygon, GeometryPoint)
+	}
+
+	//coordinates are kept as they were sent, without extra spaces
+	var compacted interface{}
+	_ = json.Unmarshal(feature.Geometry.Coordinates, &compacted)
+	z.feature.Geometry.Coordinates, _ = json.Marshal(compacted)
+
+	return z, nil
+}
+
+//get a closed ring of points from GeoJSON positions
+func newRing(positions [][]float64) ([]geo.Point, error) {
+
+	if len(positions) < 4 {
+		return nil, errors.New("a ring needs at least 4 positions")
+	}
+
+	ring := make([]geo.Point, 0, len(positions))
+	for _, v := range positions {
+		point, err := newPoint(v)
+		if err != nil {
+			return nil, err
+		}
+		ring = append(ring, point)
+	}
+
+	if ring[0] != ring[len(ring)-1] {
+		return nil, errors.New("a ring must end in the same position it starts")
+	}
+
+	return ring, nil
+}
+
+//get a point from a GeoJSON position ([longitude, latitude], an altitude is ignored)
+func newPoint(position []float64) (geo.Point, error) {
+
+	if len(position) < 2 {
+		return geo.Point{}, errors.New("a position needs longitude and latitude")
+	}
+
+	point := geo.Point{Latitude: position[1], Longitude: position[0]}
+	return point, point.Validate()
+}
+
+//check whether a point is inside the zone
+func (z *zone) contains(point geo.Point) bool {
+
+	if z.rings == nil {
+		return geo.Distance(z.center, point) <= z.radiusKm
+	}
+
+	if !insideRing(z.rings[0], point) {
+		return false
+	}
+
+	for _, v := range z.rings[1:] {
+		if insideRing(v, point) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//get the outer ring of the zone, or a polygon around it when it is a circle
+func (z *zone) outline() []geo.Point {
+
+	if z.rings != nil {
+		return append([]geo.Point{}, z.rings[0]...)
+	}
+
+	//the vertices are placed so the sides of the polygon are tangent to the circle
+	plane := geo.NewPlane(z.center)
+	radius := z.radiusKm / math.Cos(math.Pi/circleOutlineSides)
+	ring := make([]geo.Point, 0, circleOutlineSides+1)
+	for i := 0; i < circleOutlineSides; i++ {
+		angle := 2 * math.Pi * float64(i) / circleOutlineSides
+		ring = append(ring, plane.Unproject(geo.XY{radius * math.Cos(angle), radius * math.Sin(angle)}))
+	}
+
+	return append(ring, ring[0])
+}
+
+//check whether a straight flight between two points enters the zone
+func (z *zone) crosses(from geo.Point, to geo.Point) bool {
+
+	if z.contains(from) || z.contains(to) {
+		return true
+	}
+
+	//flights are short, so they are checked on a flat projection around their origin
+	plane := geo.NewPlane(from)
+	a, b := plane.Project(from), plane.Project(to)
+
+	if z.rings == nil {
+		return geo.DistanceToSegment(plane.Project(z.center), a, b) <= z.radiusKm
+	}
+
+	for _, ring := range z.rings {
+		for i := 0; i < len(ring)-1; i++ {
+			if geo.SegmentsIntersect(a, b, plane.Project(ring[i]), plane.Project(ring[i+1])) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//check whether a point is inside a ring (ray casting on the coordinates)
+func insideRing(ring []geo.Point, point geo.Point) bool {
+
+	polygon := make([]geo.XY, 0, len(ring))
+	for _, v := range ring {
+		polygon = append(polygon, geo.XY{v.Longitude, v.Latitude})
+	}
+
+	return geo.InsidePolygon(polygon, geo.XY{point.Longitude, point.Latitude})
+}
+
+//get a random identifier for a zone
+func newID() (string, error) {
+
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "could not generate zone id")
+	}
+
+	return hex.EncodeToString(b), nil
+}
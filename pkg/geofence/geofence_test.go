@@ -0,0 +1,200 @@
+package geofence
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"drones/pkg/geo"
+)
+
+//zones around Madrid: a square airport with a hole and a circular helipad
+const testCollection = `{
+  "type": "FeatureCollection",
+  "features": [
+    {
+      "type": "Feature",
+      "id": "airport",
+      "properties": {"name": "Airport"},
+      "geometry": {
+        "type": "Polygon",
+        "coordinates": [
+          [[-3.60, 40.45], [-3.50, 40.45], [-3.50, 40.55], [-3.60, 40.55], [-3.60, 40.45]],
+          [[-3.56, 40.49], [-3.54, 40.49], [-3.54, 40.51], [-3.56, 40.51], [-3.56, 40.49]]
+        ]
+      }
+    },
+    {
+      "type": "Feature",
+      "id": "helipad",
+      "properties": {"name": "Hospital helipad", "radius": 500},
+      "geometry": {"type": "Point", "coordinates": [-3.70, 40.40]}
+    }
+  ]
+}`
+
+//get a store with the test zones
+func newTestStore(t *testing.T) (*Store, string) {
+
+	path := filepath.Join(t.TempDir(), "geofences.geojson")
+	err := ioutil.WriteFile(path, []byte(testCollection), 0644)
+	if err != nil {
+		t.Fatalf("error while writing geofences file for test:%v", err)
+	}
+
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("error while creating store for test:%v", err)
+	}
+
+	return s, path
+}
+
+func Test_CheckPoint(t *testing.T) {
+
+	s, _ := newTestStore(t)
+
+	tests := []struct {
+		name  string
+		point geo.Point
+		zone  string
+	}{
+		{"inside airport", geo.Point{Latitude: 40.46, Longitude: -3.59}, "airport"},
+		{"inside hole of airport", geo.Point{Latitude: 40.50, Longitude: -3.55}, ""},
+		{"inside helipad", geo.Point{Latitude: 40.403, Longitude: -3.70}, "helipad"},
+		{"near helipad", geo.Point{Latitude: 40.406, Longitude: -3.70}, ""},
+		{"outside", geo.Point{Latitude: 40.30, Longitude: -3.80}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.CheckPoint(tt.point)
+			checkViolation(t, err, tt.zone)
+		})
+	}
+
+	if s.CheckPoint(geo.Point{Latitude: 95}) == nil {
+		t.Errorf("an invalid point must be refused")
+	}
+}
+
+func Test_CheckFlight(t *testing.T) {
+
+	s, _ := newTestStore(t)
+
+	tests := []struct {
+		name string
+		from geo.Point
+		to   geo.Point
+		zone string
+	}{
+		{"across airport", geo.Point{Latitude: 40.50, Longitude: -3.65}, geo.Point{Latitude: 40.50, Longitude: -3.45}, "airport"},
+		{"into airport", geo.Point{Latitude: 40.40, Longitude: -3.55}, geo.Point{Latitude: 40.46, Longitude: -3.55}, "airport"},
+		{"inside hole only", geo.Point{Latitude: 40.495, Longitude: -3.555}, geo.Point{Latitude: 40.505, Longitude: -3.545}, ""},
+		{"across helipad", geo.Point{Latitude: 40.40, Longitude: -3.75}, geo.Point{Latitude: 40.40, Longitude: -3.65}, "helipad"},
+		{"beside helipad", geo.Point{Latitude: 40.41, Longitude: -3.75}, geo.Point{Latitude: 40.41, Longitude: -3.65}, ""},
+		{"around everything", geo.Point{Latitude: 40.30, Longitude: -3.80}, geo.Point{Latitude: 40.60, Longitude: -3.80}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.CheckFlight(tt.from, tt.to)
+			checkViolation(t, err, tt.zone)
+		})
+	}
+}
+
+func Test_Store(t *testing.T) {
+
+	s, path := newTestStore(t)
+
+	invalid := []string{
+		`{"type":"Feature","properties":{"name":"open ring"},"geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1]]]}}`,
+		`{"type":"Feature","properties":{"name":"short ring"},"geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[0,0]]]}}`,
+		`{"type":"Feature","properties":{"name":"no radius"},"geometry":{"type":"Point","coordinates":[0,0]}}`,
+		`{"type":"Feature","properties":{"name":"line"},"geometry":{"type":"LineString","coordinates":[[0,0],[1,1]]}}`,
+		`{"type":"Feature","properties":{"name":"bad latitude"},"geometry":{"type":"Point","coordinates":[0,95]},"properties":{"radius":10}}`,
+		`{"type":"Feature","id":"airport","properties":{"name":"repeated","radius":10},"geometry":{"type":"Point","coordinates":[0,0]}}`,
+	}
+	for i, v := range invalid {
+		feature := Feature{}
+		if err := json.Unmarshal([]byte(v), &feature); err != nil {
+			t.Fatalf("error while decoding feature %d:%v", i, err)
+		}
+		if _, err := s.Add(feature); err == nil {
+			t.Errorf("feature %d must be refused", i)
+		}
+	}
+
+	feature := Feature{}
+	err := json.Unmarshal([]byte(`{"properties":{"name":"Stadium","radius":300},"geometry":{"type":"Point","coordinates":[-3.69, 40.45]}}`), &feature)
+	if err != nil {
+		t.Fatalf("error while decoding feature:%v", err)
+	}
+
+	added, err := s.Add(feature)
+	if err != nil {
+		t.Fatalf("valid feature was refused: %v", err)
+	}
+	if added.ID == "" || added.Type != TypeFeature {
+		t.Errorf("added feature must get an id and type: %+v", added)
+	}
+
+	feature.Properties.Radius = 1000
+	_, err = s.Update(added.ID, feature)
+	if err != nil {
+		t.Errorf("feature could not be updated: %v", err)
+	}
+
+	err = s.Delete("helipad")
+	if err != nil {
+		t.Errorf("feature could not be deleted: %v", err)
+	}
+	if s.Delete("helipad") == nil {
+		t.Errorf("deleting an unknown feature must fail")
+	}
+
+	//zones are read again from the file
+	s, err = NewStore(path)
+	if err != nil {
+		t.Fatalf("error while reopening store:%v", err)
+	}
+
+	all := s.GetAll()
+	if len(all) != 2 {
+		t.Fatalf("reopened store must have 2 zones but has %d", len(all))
+	}
+
+	stadium, ok := s.Get(added.ID)
+	if !ok || stadium.Properties.Radius != 1000 || stadium.Properties.Name != "Stadium" {
+		t.Errorf("reopened store must have the updated zone but has %+v", stadium)
+	}
+
+	checkViolation(t, s.CheckPoint(geo.Point{Latitude: 40.455, Longitude: -3.69}), added.ID)
+	checkViolation(t, s.CheckPoint(geo.Point{Latitude: 40.40, Longitude: -3.70}), "")
+}
+
+//check that an error is a violation of the given zone (or nil when there is no zone)
+func checkViolation(t *testing.T, err error, zone string) {
+
+	t.Helper()
+
+	if zone == "" {
+		if err != nil {
+			t.Errorf("no zone must be violated but got %v", err)
+		}
+		return
+	}
+
+	violation := &ViolationError{}
+	if !errors.As(err, &violation) {
+		t.Errorf("zone %s must be violated but got %v", zone, err)
+		return
+	}
+
+	if violation.Zone.ID != zone {
+		t.Errorf("zone %s must be violated but %s was", zone, violation.Zone.ID)
+	}
+}
@@ -0,0 +1,306 @@
+// Implements a time series of the battery levels of the drones, kept in a ring buffer per drone and persisted in a file.
+package history
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	//the file is compacted at runtime when it keeps this many records and several times more records than fit in the buffers
+	compactMinRecords = 1000
+	compactRatio      = 4
+)
+
+type (
+	//a battery level of a drone at a given moment
+	Sample struct {
+		Timestamp       time.Time `json:"timestamp"`
+		BatteryCapacity uint8     `json:"battery_capacity"` // (percentage);
+		State           string    `json:"state"`            // state of the drone when the sample was taken
+	}
+
+	//keeps the last samples of every drone
+	BatteryHistory struct {
+		size    int              // max number of samples kept per drone
+		series  map[string]*ring // use SerialNumber as key
+		path    string           // file where samples are persisted (empty to keep them only in memory)
+		file    *os.File
+		records int // number of records in the history file
+		sync.Mutex
+	}
+
+	//a line of the history file
+	record struct {
+		SerialNumber string `json:"serial_number"`
+		Sample
+	}
+
+	//fixed size buffer of samples where the oldest one is overwritten when it is full
+	ring struct {
+		samples []Sample
+		start   int // position of the oldest sample
+		count   int
+	}
+)
+
+//get a pointer to a battery history keeping the given number of samples per drone, replaying the file when it already exists
+func NewBatteryHistory(size int, path string) (*BatteryHistory, error) {
+
+	if size <= 0 {
+		return nil, errors.New("size of battery history must be greater than 0")
+	}
+
+	h := &BatteryHistory{
+		size:   size,
+		series: make(map[string]*ring),
+		path:   path,
+	}
+
+	if path == "" {
+		return h, nil
+	}
+
+	err := h.replay()
+	if err != nil {
+		return nil, err
+	}
+
+	//the file is rewritten with only the samples that fit in the buffers, so it does not grow forever
+	err = h.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+//add a sample to the history of a drone
+func (h *BatteryHistory) Record(serialNumber string, sample Sample) error {
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.add(serialNumber, sample)
+
+	if h.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(record{SerialNumber: serialNumber, Sample: sample})
+	if err != nil {
+		return errors.Wrap(err, "could not marshal battery sample")
+	}
+
+	_, err = h.file.Write(append(data, '\n'))
+	if err != nil {
+		return errors.Wrap(err, "could not write battery sample")
+	}
+	h.records++
+
+	return h.compactIfNeeded()
+}
+
+//get the samples of a drone taken between from and to (both included, zero values mean no limit), oldest first
+func (h *BatteryHistory) Get(serialNumber string, from time.Time, to time.Time) []Sample {
+
+	h.Lock()
+	defer h.Unlock()
+
+	samples := make([]Sample, 0)
+
+	r := h.series[serialNumber]
+	if r == nil {
+		return samples
+	}
+
+	for _, v := range r.list() {
+		if !from.IsZero() && v.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && v.Timestamp.After(to) {
+			continue
+		}
+		samples = append(samples, v)
+	}
+
+	return samples
+}
+
+//close the history file
+func (h *BatteryHistory) Close() error {
+
+	h.Lock()
+	defer h.Unlock()
+
+	if h.file == nil {
+		return nil
+	}
+
+	err := h.file.Close()
+	h.file = nil
+
+	return err
+}
+
+//open the history file to append records (the caller must hold the lock)
+func (h *BatteryHistory) open() error {
+
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not open battery history file")
+	}
+	h.file = file
+
+	return nil
+}
+
+//rewrite the history file when it keeps too many samples that were already overwritten in the buffers (the caller must hold the lock)
+func (h *BatteryHistory) compactIfNeeded() error {
+
+	if h.records < compactMinRecords || h.records <= compactRatio*h.size*len(h.series) {
+		return nil
+	}
+
+	err := h.file.Close()
+	h.file = nil
+	if err != nil {
+		return errors.Wrap(err, "could not close battery history file")
+	}
+
+	err = h.compact()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+
+	return h.open()
+}
+
+//add a sample to the buffer of a drone (the caller must hold the lock)
+func (h *BatteryHistory) add(serialNumber string, sample Sample) {
+
+	r := h.series[serialNumber]
+	if r == nil {
+		r = &ring{samples: make([]Sample, h.size)}
+		h.series[serialNumber] = r
+	}
+
+	r.push(sample)
+}
+
+//read the history file and rebuild the buffers from its records
+func (h *BatteryHistory) replay() error {
+
+	f, err := os.OpenFile(h.path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not open battery history file")
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	for {
+		rec := record{}
+		lastGoodOffset := decoder.InputOffset()
+
+		err = decoder.Decode(&rec)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			//a partially written record (e.g. the app was killed while writing) is discarded
+			log.Printf("battery history file %s is corrupted after offset %d, discarding the rest: %v", h.path, lastGoodOffset, err)
+			return errors.Wrap(f.Truncate(lastGoodOffset), "could not truncate battery history file")
+		}
+
+		h.add(rec.SerialNumber, rec.Sample)
+		h.records++
+	}
+}
+
+//rewrite the history file with only the samples kept in the buffers
+func (h *BatteryHistory) compact() error {
+
+	tmpPath := h.path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not create temporary battery history file")
+	}
+
+	serialNumbers := make([]string, 0, len(h.series))
+	for k := range h.series {
+		serialNumbers = append(serialNumbers, k)
+	}
+	sort.Strings(serialNumbers)
+
+	records := 0
+	encoder := json.NewEncoder(f)
+	for _, k := range serialNumbers {
+		for _, v := range h.series[k].list() {
+			err = encoder.Encode(record{SerialNumber: k, Sample: v})
+			if err != nil {
+				f.Close()
+				return errors.Wrap(err, "could not write temporary battery history file")
+			}
+			records++
+		}
+	}
+
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "could not sync temporary battery history file")
+	}
+
+	err = f.Close()
+	if err != nil {
+		return errors.Wrap(err, "could not close temporary battery history file")
+	}
+
+	err = os.Rename(tmpPath, h.path)
+	if err != nil {
+		return errors.Wrap(err, "could not replace battery history file")
+	}
+
+	h.records = records
+
+	return nil
+}
+
+//add a sample, overwriting the oldest one when the buffer is full
+func (r *ring) push(sample Sample) {
+
+	end := (r.start + r.count) % len(r.samples)
+	r.samples[end] = sample
+
+	if r.count < len(r.samples) {
+		r.count++
+	} else {
+		r.start = (r.start + 1) % len(r.samples)
+	}
+}
+
+//get the samples of the buffer, oldest first
+func (r *ring) list() []Sample {
+
+	samples := make([]Sample, 0, r.count)
+	for i := 0; i < r.count; i++ {
+		samples = append(samples, r.samples[(r.start+i)%len(r.samples)])
+	}
+
+	return samples
+}
@@ -0,0 +1,111 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_ring(t *testing.T) {
+
+	r := &ring{samples: make([]Sample, 3)}
+
+	for i := uint8(1); i <= 5; i++ {
+		r.push(Sample{BatteryCapacity: i})
+	}
+
+	samples := r.list()
+	if len(samples) != 3 {
+		t.Fatalf("ring of size 3 must keep 3 samples but kept %d", len(samples))
+	}
+
+	for i, v := range samples {
+		if v.BatteryCapacity != uint8(i+3) {
+			t.Errorf("sample %d must have battery level %d but had %d", i, i+3, v.BatteryCapacity)
+		}
+	}
+}
+
+func Test_BatteryHistory(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "battery_history.jsonl")
+
+	h, err := NewBatteryHistory(4, path)
+	if err != nil {
+		t.Fatalf("error while creating battery history for test:%v", err)
+	}
+
+	start := time.Date(2021, 11, 26, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		err = h.Record("SERIAL-A", Sample{Timestamp: start.Add(time.Duration(i) * time.Minute), BatteryCapacity: uint8(100 - i), State: "IDLE"})
+		if err != nil {
+			t.Fatalf("error while recording sample:%v", err)
+		}
+	}
+	_ = h.Record("SERIAL-B", Sample{Timestamp: start, BatteryCapacity: 30, State: "IDLE"})
+
+	if err = h.Close(); err != nil {
+		t.Fatalf("error while closing battery history:%v", err)
+	}
+
+	reopened, err := NewBatteryHistory(4, path)
+	if err != nil {
+		t.Fatalf("error while reopening battery history:%v", err)
+	}
+	defer reopened.Close()
+
+	samples := reopened.Get("SERIAL-A", time.Time{}, time.Time{})
+	if len(samples) != 4 {
+		t.Fatalf("history must keep the last 4 samples after reopening but kept %d", len(samples))
+	}
+
+	if samples[0].BatteryCapacity != 98 || samples[3].BatteryCapacity != 95 {
+		t.Errorf("history must keep the newest samples oldest first but kept %+v", samples)
+	}
+
+	samples = reopened.Get("SERIAL-A", start.Add(3*time.Minute), start.Add(4*time.Minute))
+	if len(samples) != 2 {
+		t.Errorf("history must return 2 samples between minutes 3 and 4 but returned %+v", samples)
+	}
+
+	if len(reopened.Get("SERIAL-C", time.Time{}, time.Time{})) != 0 {
+		t.Errorf("history of an unknown drone must be empty")
+	}
+}
+
+func Test_BatteryHistory_compactionAtRuntime(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "battery_history.jsonl")
+
+	h, err := NewBatteryHistory(4, path)
+	if err != nil {
+		t.Fatalf("error while creating battery history for test:%v", err)
+	}
+
+	start := time.Date(2021, 11, 26, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < compactMinRecords+10; i++ {
+		err = h.Record("SERIAL-A", Sample{Timestamp: start.Add(time.Duration(i) * time.Minute), BatteryCapacity: uint8(i % 100), State: "IDLE"})
+		if err != nil {
+			t.Fatalf("error while recording sample:%v", err)
+		}
+	}
+
+	if h.records > 4+10 {
+		t.Errorf("history file must be compacted while it is open but has %d records", h.records)
+	}
+
+	if err = h.Close(); err != nil {
+		t.Fatalf("error while closing battery history:%v", err)
+	}
+
+	reopened, err := NewBatteryHistory(4, path)
+	if err != nil {
+		t.Fatalf("error while reopening battery history:%v", err)
+	}
+	defer reopened.Close()
+
+	samples := reopened.Get("SERIAL-A", time.Time{}, time.Time{})
+	if len(samples) != 4 || samples[3].BatteryCapacity != uint8((compactMinRecords+9)%100) {
+		t.Errorf("the last samples must be kept after compacting but they were %+v", samples)
+	}
+}
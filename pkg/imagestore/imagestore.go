@@ -0,0 +1,159 @@
+// Implements a content-addressed storage of images in a local directory, where images are referenced by the hash of their content.
+package imagestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	MimeJPEG = "image/jpeg"
+	MimePNG  = "image/png"
+)
+
+var (
+	ErrTooLarge        = errors.New("image is larger than the allowed size")
+	ErrUnsupportedType = errors.New("image must be a JPEG or a PNG")
+	ErrNotFound        = errors.New("image was not found")
+
+	referencePattern = regexp.MustCompile("^[a-f0-9]{64}$")
+)
+
+type (
+	//keeps images in a directory, one file per distinct content
+	Store struct {
+		dir     string
+		maxSize int // max size of an image in bytes
+	}
+)
+
+//get a pointer to a store of images in a directory (created when it does not exist)
+func NewStore(dir string, maxSize int) (*Store, error) {
+
+	if maxSize <= 0 {
+		return nil, errors.New("max size of images must be greater than 0")
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create directory of images")
+	}
+
+	return &Store{
+		dir:     dir,
+		maxSize: maxSize,
+	}, nil
+}
+
+//get the max size of an image in bytes
+func (s *Store) MaxSize() int {
+	return s.maxSize
+}
+
+//keep an image, getting its reference (the same content is kept only once)
+func (s *Store) Put(data []byte) (string, error) {
+
+	if len(data) > s.maxSize {
+		return "", ErrTooLarge
+	}
+
+	mime := http.DetectContentType(data)
+	if mime != MimeJPEG && mime != MimePNG {
+		return "", errors.Wrapf(ErrUnsupportedType, "content type is %s", mime)
+	}
+
+	sum := sha256.Sum256(data)
+	ref := hex.EncodeToString(sum[:])
+	path := s.path(ref)
+
+	if _, err := os.Stat(path); err == nil {
+		return ref, nil
+	}
+
+	//the file is written with a temporary name first, so a half written image never gets its reference
+	//(the name is unique, so concurrent uploads of the same image do not write on the same file)
+	err := writeImage(ref, data, path)
+	if err != nil {
+		//another upload of the same image may have kept it in the meantime
+		if _, statErr := os.Stat(path); statErr == nil {
+			return ref, nil
+		}
+		return "", errors.Wrap(err, "could not write image")
+	}
+
+	return ref, nil
+}
+
+//write the content of an image in a temporary file next to its path and give it that path
+func writeImage(ref string, data []byte, path string) error {
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ref+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+
+	return err
+}
+
+//get the content of an image and its MIME type
+func (s *Store) Get(ref string) ([]byte, string, error) {
+
+	if !IsReference(ref) {
+		return nil, "", errors.Wrapf(ErrNotFound, "%s is not a valid reference", ref)
+	}
+
+	data, err := ioutil.ReadFile(s.path(ref))
+	if os.IsNotExist(err) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", errors.Wrap(err, "could not read image")
+	}
+
+	return data, http.DetectContentType(data), nil
+}
+
+//check whether an image is kept in the store
+func (s *Store) Exists(ref string) bool {
+
+	if !IsReference(ref) {
+		return false
+	}
+
+	_, err := os.Stat(s.path(ref))
+
+	return err == nil
+}
+
+//check whether a string is a reference of an image
+func IsReference(ref string) bool {
+	return referencePattern.MatchString(ref)
+}
+
+//get the path of the file of an image
+func (s *Store) path(ref string) string {
+	return filepath.Join(s.dir, ref)
+}
@@ -0,0 +1,122 @@
+package imagestore
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+//get the content of a small image encoded with the given function
+func newImage(t *testing.T, encode func(*bytes.Buffer, image.Image) error) []byte {
+
+	buffer := &bytes.Buffer{}
+	err := encode(buffer, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	if err != nil {
+		t.Fatalf("error while encoding image for test:%v", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func Test_Store(t *testing.T) {
+
+	store, err := NewStore(t.TempDir(), 4096)
+	if err != nil {
+		t.Fatalf("error while creating store for test:%v", err)
+	}
+
+	pngImage := newImage(t, func(b *bytes.Buffer, i image.Image) error { return png.Encode(b, i) })
+	jpegImage := newImage(t, func(b *bytes.Buffer, i image.Image) error { return jpeg.Encode(b, i, nil) })
+
+	pngRef, err := store.Put(pngImage)
+	if err != nil {
+		t.Fatalf("a PNG image must be accepted:%v", err)
+	}
+
+	if !IsReference(pngRef) {
+		t.Errorf("%s must be a valid reference", pngRef)
+	}
+
+	again, err := store.Put(pngImage)
+	if err != nil || again != pngRef {
+		t.Errorf("the same image must get the same reference but got %s and %s (%v)", pngRef, again, err)
+	}
+
+	jpegRef, err := store.Put(jpegImage)
+	if err != nil || jpegRef == pngRef {
+		t.Errorf("a different JPEG image must be accepted with another reference but got %s (%v)", jpegRef, err)
+	}
+
+	content, mime, err := store.Get(jpegRef)
+	if err != nil || mime != MimeJPEG || !bytes.Equal(content, jpegImage) {
+		t.Errorf("JPEG image must be read back with type %s but got type %s (%v)", MimeJPEG, mime, err)
+	}
+
+	if _, err = store.Put([]byte("this is not an image")); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("content that is not an image must be rejected with ErrUnsupportedType but got %v", err)
+	}
+
+	if _, err = store.Put(append(pngImage, make([]byte, 4096)...)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("an image larger than the max size must be rejected with ErrTooLarge but got %v", err)
+	}
+
+	if _, _, err = store.Get("0000000000000000000000000000000000000000000000000000000000000000"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("an unknown reference must return ErrNotFound but got %v", err)
+	}
+
+	if _, _, err = store.Get("../catalog.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("a reference that is not valid must return ErrNotFound but got %v", err)
+	}
+
+	if !store.Exists(pngRef) || store.Exists("0000000000000000000000000000000000000000000000000000000000000000") || store.Exists("../catalog.json") {
+		t.Errorf("only the references of the images kept in the store must exist")
+	}
+}
+
+func Test_Store_concurrentPut(t *testing.T) {
+
+	dir := t.TempDir()
+	store, err := NewStore(dir, 4096)
+	if err != nil {
+		t.Fatalf("error while creating store for test:%v", err)
+	}
+
+	pngImage := newImage(t, func(b *bytes.Buffer, i image.Image) error { return png.Encode(b, i) })
+
+	const uploads = 10
+	refs := make(chan string, uploads)
+	var wg sync.WaitGroup
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ref, err := store.Put(pngImage)
+			if err != nil {
+				t.Errorf("every upload of the same image must be accepted:%v", err)
+			}
+			refs <- ref
+		}()
+	}
+	wg.Wait()
+	close(refs)
+
+	first := <-refs
+	for v := range refs {
+		if v != first {
+			t.Errorf("every upload of the same image must get the same reference but got %s and %s", first, v)
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("error while reading store for test:%v", err)
+	}
+	if len(files) != 1 || files[0].Name() != first {
+		t.Errorf("only the image must be kept in the store, without temporary files, but there were %d files", len(files))
+	}
+}
@@ -5,23 +5,42 @@ import (
 	"regexp"
 
 	"github.com/pkg/errors"
+
+	"drones/pkg/geo"
+)
+
+const (
+	//known types of medication (a model of drone may carry only some of them)
+	TypeStandard     = "STANDARD"
+	TypeControlled   = "CONTROLLED"
+	TypeRefrigerated = "REFRIGERATED"
 )
 
 type (
 	//define what is a medication within the system
 	Medication struct {
-		name   string // (allowed only letters, numbers, ‘-‘, ‘_’);
-		weight uint   //
-		code   string // (allowed only upper case letters, underscore and numbers);
-		image  string // (picture of the medication case). // *base64
+		name        string     // (allowed only letters, numbers, ‘-‘, ‘_’);
+		weight      uint       //
+		code        string     // (allowed only upper case letters, underscore and numbers);
+		image       string     // (picture of the medication case). // reference in the image store
+		dropOff     *geo.Point // where the medication is delivered (nil when it goes to the destination of the mission)
+		payloadType string     // (STANDARD, CONTROLLED, REFRIGERATED or any other upper case name)
 	}
 
 	//define a data transfer object for a medication
 	MedicationDTO struct {
-		Name   string `json:"name"`   // (allowed only letters, numbers, ‘-‘, ‘_’);
-		Weight uint   `json:"weight"` //
-		Code   string `json:"code"`   // (allowed only upper case letters, underscore and numbers);
-		Image  string `json:"image"`  // (picture of the medication case). // *base64
+		Name    string     `json:"name"`               // (allowed only letters, numbers, ‘-‘, ‘_’);
+		Weight  uint       `json:"weight"`             //
+		Code    string     `json:"code"`               // (allowed only upper case letters, underscore and numbers);
+		Image   string     `json:"image"`              // (picture of the medication case). // reference in the image store
+		DropOff *geo.Point `json:"drop_off,omitempty"` // where the medication is delivered
+		Type    string     `json:"type,omitempty"`     // (STANDARD when empty)
+	}
+
+	//define a quantity of a medication of the catalog, referenced by its code
+	ItemDTO struct {
+		Code     string `json:"code"`
+		Quantity uint   `json:"quantity"`
 	}
 )
 
@@ -37,11 +56,35 @@ func NewMedication(dto MedicationDTO) (*Medication, error) {
 		return nil, errors.New(dto.Code + "is not a valid code")
 	}
 
+	if !isValidImage(dto.Image) {
+		return nil, errors.New("image of medication must be a reference of the image store")
+	}
+
+	payloadType := dto.Type
+	if payloadType == "" {
+		payloadType = TypeStandard
+	}
+	if !IsValidType(payloadType) {
+		return nil, errors.New(dto.Type + " is not a valid type of medication")
+	}
+
+	var dropOff *geo.Point
+	if dto.DropOff != nil {
+		err := dto.DropOff.Validate()
+		if err != nil {
+			return nil, errors.Wrap(err, "drop-off of medication is not valid")
+		}
+		point := *dto.DropOff
+		dropOff = &point
+	}
+
 	return &Medication{
-		name:   dto.Name,
-		weight: dto.Weight,
-		code:   dto.Code,
-		image:  dto.Image,
+		name:        dto.Name,
+		weight:      dto.Weight,
+		code:        dto.Code,
+		image:       dto.Image,
+		dropOff:     dropOff,
+		payloadType: payloadType,
 	}, nil
 }
 
@@ -65,22 +108,51 @@ func (m *Medication) GetWeight() uint {
 	return m.weight
 }
 
-//get DTO of medication object excluding the image information in base64
-func (m *Medication) GetDTO() MedicationDTO {
-	return MedicationDTO{
-		Name:   m.name,
-		Weight: m.weight,
-		Code:   m.code,
+//get code of medication
+func (m *Medication) GetCode() string {
+	return m.code
+}
+
+//get name of medication
+func (m *Medication) GetName() string {
+	return m.name
+}
+
+//get type of medication
+func (m *Medication) GetType() string {
+
+	if m.payloadType == "" {
+		return TypeStandard
 	}
+
+	return m.payloadType
+}
+
+//get where the medication is delivered (nil when it goes to the destination of the mission)
+func (m *Medication) GetDropOff() *geo.Point {
+
+	if m.dropOff == nil {
+		return nil
+	}
+
+	point := *m.dropOff
+	return &point
 }
 
-//get DTO of medication object including the image information in base64
+//get DTO of medication object (images are only references, so they are included)
+func (m *Medication) GetDTO() MedicationDTO {
+	return m.GetDTOWithImage()
+}
+
+//get DTO of medication object including the reference of the image
 func (m *Medication) GetDTOWithImage() MedicationDTO {
 	return MedicationDTO{
-		Name:   m.name,
-		Weight: m.weight,
-		Code:   m.code,
-		Image:  m.image,
+		Name:    m.name,
+		Weight:  m.weight,
+		Code:    m.code,
+		Image:   m.image,
+		DropOff: m.GetDropOff(),
+		Type:    m.GetType(),
 	}
 }
 
@@ -93,6 +165,24 @@ func isValidName(name string) bool {
 	return match
 }
 
+//check whether an image of medication is valid (empty or a reference of the image store)
+func isValidImage(image string) bool {
+	match, err := regexp.MatchString("^([a-f0-9]{64})?$", image)
+	if err != nil {
+		return false
+	}
+	return match
+}
+
+//check whether a type of medication is valid (new types only need an upper case name)
+func IsValidType(payloadType string) bool {
+	match, err := regexp.MatchString("^[A-Z][A-Z_]{0,49}$", payloadType)
+	if err != nil {
+		return false
+	}
+	return match
+}
+
 //check whether a code of medication is valid
 func isValidCode(name string) bool {
 	match, err := regexp.MatchString("^[A-Z0-9?_]+$", name)
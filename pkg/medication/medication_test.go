@@ -69,3 +69,29 @@ func Test_isValidCode(t *testing.T) {
 		}
 	}
 }
+
+func Test_isValidImage(t *testing.T) {
+
+	validStrings := []string{
+		"",
+		"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+
+	for _, v := range validStrings {
+		if !isValidImage(v) {
+			t.Errorf("%s must be a valid image and was asserted as a wrong one", v)
+		}
+	}
+
+	noValidStrings := []string{
+		"/9j/4AAQSkZJRgABAQAAAQABAAD",
+		"9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08",
+		"9f86d081884c7d659a2feaa0c55ad015",
+	}
+
+	for _, v := range noValidStrings {
+		if isValidImage(v) {
+			t.Errorf("%s must be a no valid image and was asserted as a wrong one", v)
+		}
+	}
+}
@@ -0,0 +1,475 @@
+// Implements routines for manipulating delivery missions, driving the drone through its states.
+package mission
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/drone"
+	"drones/pkg/geo"
+	"drones/pkg/medication"
+)
+
+const (
+	maxDestinationCharacters = 200
+	//allowed status
+	StatusCreated    = "CREATED"     // medications loaded, waiting for departure
+	StatusInProgress = "IN_PROGRESS" // drone flying to the destination (or to the stops of its round)
+	StatusReturning  = "RETURNING"   // medications delivered, drone flying back to base
+	StatusCompleted  = "COMPLETED"   // medications delivered and drone back to base
+	StatusAborted    = "ABORTED"     // mission cancelled before the delivery
+)
+
+type (
+	//define what is a delivery mission within the system
+	Mission struct {
+		id           string
+		serialNumber string // serial number of the drone doing the delivery
+		destination  string
+		coordinates  *geo.Point // where the destination is (the range of the drone is not checked when it is unknown)
+		payload      []medication.MedicationDTO
+		reserved     []medication.ItemDTO       // units of the payload taken from the stock of the catalog
+		returned     []medication.MedicationDTO // medications of the payload brought back to base without being delivered
+		status       string                     // (CREATED, IN_PROGRESS, RETURNING, COMPLETED, ABORTED)
+		timestamps   map[string]time.Time       // moment in which the drone reached each state during the mission
+		createdAt    time.Time
+		sync.Mutex
+	}
+
+	//define a data transfer object for a mission
+	MissionDTO struct {
+		ID           string                     `json:"id,omitempty"`
+		SerialNumber string                     `json:"serial_number"`
+		Destination  string                     `json:"destination"`
+		Coordinates  *geo.Point                 `json:"coordinates,omitempty"` // where the destination is
+		Medications  []medication.MedicationDTO `json:"medications,omitempty"`
+		Status       string                     `json:"status,omitempty"`
+		Timestamps   map[string]time.Time       `json:"timestamps,omitempty"`
+		CreatedAt    *time.Time                 `json:"created_at,omitempty"`
+	}
+)
+
+//get a pointer to a mission object from a mission DTO
+func NewMission(dto MissionDTO) (*Mission, error) {
+
+	if dto.SerialNumber == "" {
+		return nil, errors.New("a mission needs the serial number of a drone")
+	}
+
+	if !validDestination(dto.Destination) {
+		return nil, errors.New(dto.Destination + " is not a valid destination")
+	}
+
+	if dto.Coordinates != nil {
+		err := dto.Coordinates.Validate()
+		if err != nil {
+			return nil, errors.Wrap(err, "coordinates of destination are not valid")
+		}
+	}
+
+	if len(dto.Medications) == 0 {
+		return nil, errors.New("a mission needs at least one medication to deliver")
+	}
+
+	//medications without a drop-off are delivered at the destination
+	payload := make([]medication.MedicationDTO, 0, len(dto.Medications))
+	for i, v := range dto.Medications {
+		if v.DropOff == nil {
+			v.DropOff = dto.Coordinates
+		}
+		if v.DropOff != nil {
+			err := v.DropOff.Validate()
+			if err != nil {
+				return nil, errors.Wrapf(err, "drop-off of medication %d is not valid", i)
+			}
+		}
+		payload = append(payload, v)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mission{
+		id:           id,
+		serialNumber: dto.SerialNumber,
+		destination:  dto.Destination,
+		coordinates:  dto.Coordinates,
+		payload:      payload,
+		status:       StatusCreated,
+		timestamps:   make(map[string]time.Time),
+		createdAt:    time.Now(),
+	}, nil
+}
+
+//load the payload of the mission on an IDLE and empty drone, leaving it LOADED (or IDLE again when loading fails)
+func (m *Mission) Load(d *drone.Drone) error {
+
+	m.Lock()
+	defer m.Unlock()
+
+	err := m.checkDrone(d, StatusCreated)
+	if err != nil {
+		return err
+	}
+
+	//claiming the drone by moving it from IDLE to LOADING prevents other missions from loading it too
+	err = d.StartLoading()
+	if err != nil {
+		return err
+	}
+	m.record(drone.StateLoading)
+
+	err = d.LoadSetOfMedications(m.payload)
+	if err == nil {
+		err = m.planRound(d)
+	}
+	if err != nil {
+		_, unloadErr := d.UnloadMedications(m.payload)
+		if unloadErr != nil {
+			return errors.Wrapf(err, "drone could not be unloaded after a failed load: %v", unloadErr)
+		}
+		return err
+	}
+	m.record(drone.StateLoaded)
+
+	return nil
+}
+
+//make the drone depart to the destination
+func (m *Mission) Start(d *drone.Drone) error {
+
+	m.Lock()
+	defer m.Unlock()
+
+	err := m.checkDrone(d, StatusCreated)
+	if err != nil {
+		return err
+	}
+
+	//the battery and the location may have changed since the drone was loaded
+	err = d.Depart()
+	if err != nil {
+		return errors.Wrap(err, "drone can not depart to the destination")
+	}
+	m.record(drone.StateDelivering)
+	m.status = StatusInProgress
+
+	return nil
+}
+
+//drop off the medications of the next stop of the round, making the drone fly back to base after the last one
+func (m *Mission) DeliverStop(d *drone.Drone) error {
+
+	m.Lock()
+	defer m.Unlock()
+
+	err := m.checkDrone(d, StatusInProgress)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.DeliverNextStop()
+	if err != nil {
+		return err
+	}
+
+	if d.HasPendingStops() {
+		return nil
+	}
+
+	return m.finishDelivery(d)
+}
+
+//deliver the medications at the destination (or at all the stops that are left) and make the drone fly back to base
+func (m *Mission) Complete(d *drone.Drone) error {
+
+	m.Lock()
+	defer m.Unlock()
+
+	err := m.checkDrone(d, StatusInProgress)
+	if err != nil {
+		return err
+	}
+
+	for d.HasPendingStops() {
+		_, err = d.DeliverNextStop()
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.finishDelivery(d)
+}
+
+//leave what is left of the payload and make the drone fly back to base (the caller must hold the lock)
+func (m *Mission) finishDelivery(d *drone.Drone) error {
+
+	err := d.Transition(drone.StateDelivered)
+	if err != nil {
+		return err
+	}
+	m.record(drone.StateDelivered)
+
+	_, err = d.UnloadMedications(m.payload)
+	if err != nil {
+		return err
+	}
+
+	err = d.Transition(drone.StateReturning)
+	if err != nil {
+		return err
+	}
+	m.record(drone.StateReturning)
+	m.status = StatusReturning
+
+	return nil
+}
+
+//cancel the mission: a drone waiting for departure is unloaded and a flying one returns to base with its payload
+func (m *Mission) Abort(d *drone.Drone) error {
+
+	m.Lock()
+	defer m.Unlock()
+
+	switch m.status {
+	case StatusCreated:
+		err := m.checkDrone(d, StatusCreated)
+		if err != nil {
+			return err
+		}
+		err = m.unloadReturned(d)
+		if err != nil {
+			return err
+		}
+		m.record(drone.StateIdle)
+	case StatusInProgress:
+		err := m.checkDrone(d, StatusInProgress)
+		if err != nil {
+			return err
+		}
+		err = d.Transition(drone.StateReturning)
+		if err != nil {
+			return err
+		}
+		m.record(drone.StateReturning)
+	default:
+		return fmt.Errorf("a mission can not be aborted when it is %s", m.status)
+	}
+
+	m.status = StatusAborted
+
+	return nil
+}
+
+//close the mission when the drone is back to base, unloading what was not delivered
+func (m *Mission) Return(d *drone.Drone) error {
+
+	m.Lock()
+	defer m.Unlock()
+
+	if m.status != StatusReturning && m.status != StatusAborted {
+		return fmt.Errorf("drone of a mission that is %s is not returning to base", m.status)
+	}
+
+	if _, ok := m.timestamps[drone.StateIdle]; ok {
+		return errors.New("drone of the mission is already back to base")
+	}
+
+	err := m.checkDrone(d, m.status)
+	if err != nil {
+		return err
+	}
+
+	if m.status == StatusAborted {
+		err = m.unloadReturned(d)
+	} else {
+		_, err = d.UnloadMedications(m.payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = d.Transition(drone.StateIdle)
+	if err != nil {
+		return err
+	}
+	m.record(drone.StateIdle)
+
+	if m.status == StatusReturning {
+		m.status = StatusCompleted
+	}
+
+	return nil
+}
+
+//keep the units of the payload that were taken from the stock of the catalog, to give back those that are not delivered
+func (m *Mission) SetReservedItems(items []medication.ItemDTO) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.reserved = items
+}
+
+//get the reserved units of the payload that were brought back to base without being delivered, so they are given back to
+//the stock only once (none until the mission is aborted and its drone is unloaded)
+func (m *Mission) TakeReturnedItems() []medication.ItemDTO {
+
+	m.Lock()
+	defer m.Unlock()
+
+	if _, back := m.timestamps[drone.StateIdle]; m.status != StatusAborted || !back {
+		return nil
+	}
+
+	returned := make(map[string]uint)
+	for _, v := range m.returned {
+		returned[v.Code]++
+	}
+
+	items := make([]medication.ItemDTO, 0)
+	for _, v := range m.reserved {
+		quantity := v.Quantity
+		if returned[v.Code] < quantity {
+			quantity = returned[v.Code]
+		}
+		returned[v.Code] -= quantity
+		if quantity > 0 {
+			items = append(items, medication.ItemDTO{Code: v.Code, Quantity: quantity})
+		}
+	}
+
+	m.reserved = nil
+	m.returned = nil
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	return items
+}
+
+//whether the mission still holds its drone (it is released when the mission is completed or the drone is back to base)
+func (m *Mission) IsOpen() bool {
+
+	m.Lock()
+	defer m.Unlock()
+
+	_, back := m.timestamps[drone.StateIdle]
+
+	return m.status != StatusCompleted && !back
+}
+
+//get id of mission
+func (m *Mission) GetID() string {
+	return m.id
+}
+
+//get serial number of the drone of the mission
+func (m *Mission) GetSerialNumber() string {
+	return m.serialNumber
+}
+
+//get status of mission
+func (m *Mission) GetStatus() string {
+
+	m.Lock()
+	defer m.Unlock()
+
+	return m.status
+}
+
+//get DTO that represents a mission
+func (m *Mission) GetDTO() MissionDTO {
+
+	m.Lock()
+	defer m.Unlock()
+
+	createdAt := m.createdAt
+	dto := MissionDTO{
+		ID:           m.id,
+		SerialNumber: m.serialNumber,
+		Destination:  m.destination,
+		Coordinates:  m.coordinates,
+		Medications:  make([]medication.MedicationDTO, 0),
+		Status:       m.status,
+		Timestamps:   make(map[string]time.Time),
+		CreatedAt:    &createdAt,
+	}
+
+	for _, v := range m.payload {
+		//images are not part of the mission information
+		v.Image = ""
+		dto.Medications = append(dto.Medications, v)
+	}
+
+	for k, v := range m.timestamps {
+		dto.Timestamps[k] = v
+	}
+
+	return dto
+}
+
+//check that the drone is the one of the mission and the mission is in the expected status (the caller must hold the lock)
+func (m *Mission) checkDrone(d *drone.Drone, status string) error {
+
+	if d == nil || d.GetSerialNumber() != m.serialNumber {
+		return fmt.Errorf("drone is not the one assigned to the mission (%s)", m.serialNumber)
+	}
+
+	if m.status != status {
+		return fmt.Errorf("mission must be %s but it is %s", status, m.status)
+	}
+
+	return nil
+}
+
+//unload from the drone what is left of the payload of a cancelled mission, keeping it as returned (the caller must hold the lock)
+func (m *Mission) unloadReturned(d *drone.Drone) error {
+
+	unloaded, err := d.UnloadMedications(m.payload)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range unloaded {
+		m.returned = append(m.returned, v.GetDTO())
+	}
+
+	return nil
+}
+
+//plan the round of the drone through the drop-offs of the medications, checking that it can fly it and back to base
+//(the range of the drone is not checked when no medication has a drop-off)
+func (m *Mission) planRound(d *drone.Drone) error {
+	return errors.Wrap(d.PlanRound(), "drone can not reach the destination")
+}
+
+//keep the moment in which the drone reached a state (the caller must hold the lock)
+func (m *Mission) record(state string) {
+	m.timestamps[state] = time.Now()
+}
+
+//check whether a destination of mission is valid
+func validDestination(destination string) bool {
+	return len(destination) > 0 && len(destination) <= maxDestinationCharacters
+}
+
+//get a random identifier for a mission
+func newID() (string, error) {
+
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "could not generate mission id")
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,334 @@
+package mission
+
+import (
+	"testing"
+
+	"github.com/Pallinder/go-randomdata"
+
+	"drones/pkg/drone"
+	"drones/pkg/geo"
+	"drones/pkg/medication"
+)
+
+//get an IDLE drone and a mission for it
+func newDroneAndMission(t *testing.T, weight uint) (*drone.Drone, *Mission) {
+
+	droneObj, err := drone.NewDrone(drone.DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           drone.ModelMiddleweight,
+		WeightLimit:     300,
+		BatteryCapacity: 100,
+		State:           drone.StateIdle,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	missionObj, err := NewMission(MissionDTO{
+		SerialNumber: droneObj.GetSerialNumber(),
+		Destination:  "Clinic-A",
+		Medications: []medication.MedicationDTO{
+			{Name: "Medication-A", Code: "CODE_A", Weight: weight},
+			{Name: "Medication-B", Code: "CODE_B", Weight: weight},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error while creating mission for test:%v", err)
+	}
+
+	return droneObj, missionObj
+}
+
+func Test_NewMission(t *testing.T) {
+
+	invalid := []MissionDTO{
+		{Destination: "Clinic-A", Medications: []medication.MedicationDTO{{Name: "A", Code: "A", Weight: 1}}},
+		{SerialNumber: "SERIAL", Medications: []medication.MedicationDTO{{Name: "A", Code: "A", Weight: 1}}},
+		{SerialNumber: "SERIAL", Destination: "Clinic-A"},
+	}
+
+	for _, v := range invalid {
+		if _, err := NewMission(v); err == nil {
+			t.Errorf("mission %+v must not be valid", v)
+		}
+	}
+}
+
+func Test_Mission_lifecycle(t *testing.T) {
+
+	droneObj, missionObj := newDroneAndMission(t, 50)
+
+	if err := missionObj.Start(droneObj); err == nil {
+		t.Errorf("mission must not start before loading the drone")
+	}
+
+	steps := []struct {
+		name   string
+		step   func(*Mission, *drone.Drone) error
+		status string
+		state  string
+	}{
+		{"load", (*Mission).Load, StatusCreated, drone.StateLoaded},
+		{"start", (*Mission).Start, StatusInProgress, drone.StateDelivering},
+		{"complete", (*Mission).Complete, StatusReturning, drone.StateReturning},
+		{"return", (*Mission).Return, StatusCompleted, drone.StateIdle},
+	}
+
+	for _, v := range steps {
+		if err := v.step(missionObj, droneObj); err != nil {
+			t.Fatalf("mission step %s failed:%v", v.name, err)
+		}
+		if missionObj.GetStatus() != v.status {
+			t.Errorf("status of mission after %s must be %s but was %s", v.name, v.status, missionObj.GetStatus())
+		}
+		if droneObj.GetState() != v.state {
+			t.Errorf("state of drone after %s must be %s but was %s", v.name, v.state, droneObj.GetState())
+		}
+	}
+
+	if droneObj.HasMedications() {
+		t.Errorf("drone must not have medications after the mission is completed")
+	}
+
+	if len(missionObj.GetDTO().Timestamps) != 6 {
+		t.Errorf("mission must record a timestamp for each of the 6 states but recorded %v", missionObj.GetDTO().Timestamps)
+	}
+
+	if err := missionObj.Return(droneObj); err == nil {
+		t.Errorf("mission must not be closed twice")
+	}
+}
+
+func Test_Mission_abort(t *testing.T) {
+
+	droneObj, missionObj := newDroneAndMission(t, 50)
+
+	if err := missionObj.Load(droneObj); err != nil {
+		t.Fatalf("error while loading drone:%v", err)
+	}
+
+	if err := missionObj.Abort(droneObj); err != nil {
+		t.Fatalf("error while aborting mission:%v", err)
+	}
+
+	if droneObj.GetState() != drone.StateIdle || droneObj.HasMedications() {
+		t.Errorf("drone must be %s and empty after aborting a mission before departure but was %s", drone.StateIdle, droneObj.GetState())
+	}
+
+	droneObj, missionObj = newDroneAndMission(t, 50)
+	for _, step := range []func(*Mission, *drone.Drone) error{(*Mission).Load, (*Mission).Start, (*Mission).Abort} {
+		if err := step(missionObj, droneObj); err != nil {
+			t.Fatalf("mission step failed:%v", err)
+		}
+	}
+
+	if droneObj.GetState() != drone.StateReturning || !droneObj.HasMedications() {
+		t.Errorf("drone must be %s with its payload after aborting a mission in flight but was %s", drone.StateReturning, droneObj.GetState())
+	}
+
+	if err := missionObj.Return(droneObj); err != nil {
+		t.Fatalf("error while closing aborted mission:%v", err)
+	}
+
+	if missionObj.GetStatus() != StatusAborted || droneObj.GetState() != drone.StateIdle {
+		t.Errorf("mission must stay %s and drone must be %s but were %s and %s", StatusAborted, drone.StateIdle, missionObj.GetStatus(), droneObj.GetState())
+	}
+}
+
+func Test_Mission_loadFailure(t *testing.T) {
+
+	droneObj, missionObj := newDroneAndMission(t, 200)
+
+	if err := missionObj.Load(droneObj); err == nil {
+		t.Fatalf("a payload heavier than the weight limit must not be loaded")
+	}
+
+	if droneObj.GetState() != drone.StateIdle || droneObj.HasMedications() {
+		t.Errorf("drone must be %s and empty after a failed load but was %s", drone.StateIdle, droneObj.GetState())
+	}
+}
+
+func Test_Mission_droneHeldByAnotherMission(t *testing.T) {
+
+	droneObj, missionObj := newDroneAndMission(t, 50)
+
+	if err := missionObj.Load(droneObj); err != nil {
+		t.Fatalf("error while loading drone:%v", err)
+	}
+
+	other, err := NewMission(MissionDTO{
+		SerialNumber: droneObj.GetSerialNumber(),
+		Destination:  "Clinic-B",
+		Medications:  []medication.MedicationDTO{{Name: "Medication-C", Code: "CODE_C", Weight: 50}},
+	})
+	if err != nil {
+		t.Fatalf("error while creating mission for test:%v", err)
+	}
+
+	if err := other.Load(droneObj); err == nil {
+		t.Fatalf("a drone that is %s must not be loaded by another mission", droneObj.GetState())
+	}
+
+	if droneObj.CurrentWeight() != 100 || droneObj.GetState() != drone.StateLoaded {
+		t.Errorf("payload of the first mission must be kept but drone was %s with %d gr", droneObj.GetState(), droneObj.CurrentWeight())
+	}
+}
+
+func Test_Mission_returnedItems(t *testing.T) {
+
+	droneObj, missionObj := newDroneAndMission(t, 50)
+	missionObj.SetReservedItems([]medication.ItemDTO{{Code: "CODE_A", Quantity: 1}, {Code: "CODE_B", Quantity: 1}})
+
+	for _, step := range []func(*Mission, *drone.Drone) error{(*Mission).Load, (*Mission).Start, (*Mission).Abort} {
+		if err := step(missionObj, droneObj); err != nil {
+			t.Fatalf("mission step failed:%v", err)
+		}
+	}
+
+	if items := missionObj.TakeReturnedItems(); items != nil {
+		t.Errorf("items must not be returned before the drone is back to base but they were %+v", items)
+	}
+
+	if err := missionObj.Return(droneObj); err != nil {
+		t.Fatalf("error while closing aborted mission:%v", err)
+	}
+
+	items := missionObj.TakeReturnedItems()
+	if len(items) != 2 || items[0].Code != "CODE_A" || items[0].Quantity != 1 || items[1].Code != "CODE_B" {
+		t.Errorf("reserved items must be returned when the drone is back to base but they were %+v", items)
+	}
+
+	if items := missionObj.TakeReturnedItems(); items != nil {
+		t.Errorf("items must be returned only once but they were %+v", items)
+	}
+
+	if missionObj.IsOpen() {
+		t.Errorf("mission must not hold its drone after it is back to base")
+	}
+}
+
+func Test_Mission_outOfRange(t *testing.T) {
+
+	homeBase := geo.Point{Latitude: 40.4168, Longitude: -3.7038}
+
+	droneObj, err := drone.NewDrone(drone.DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           drone.ModelMiddleweight,
+		WeightLimit:     300,
+		BatteryCapacity: 100,
+		State:           drone.StateIdle,
+		HomeBase:        &homeBase,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	newMission := func(coordinates geo.Point) *Mission {
+		missionObj, err := NewMission(MissionDTO{
+			SerialNumber: droneObj.GetSerialNumber(),
+			Destination:  "Clinic-A",
+			Coordinates:  &coordinates,
+			Medications:  []medication.MedicationDTO{{Name: "Medication-A", Code: "CODE_A", Weight: 100}},
+		})
+		if err != nil {
+			t.Fatalf("error while creating mission for test:%v", err)
+		}
+		return missionObj
+	}
+
+	far := newMission(geo.Point{Latitude: 40.6168, Longitude: -3.7038}) // about 22.2 km
+	if err = far.Load(droneObj); err == nil {
+		t.Fatalf("a destination out of range must be refused")
+	}
+	if droneObj.GetState() != drone.StateIdle || droneObj.HasMedications() {
+		t.Errorf("drone must stay %s and empty when the destination is out of range but was %s", drone.StateIdle, droneObj.GetState())
+	}
+
+	near := newMission(geo.Point{Latitude: 40.4668, Longitude: -3.7038}) // about 5.6 km
+	if err = near.Load(droneObj); err != nil {
+		t.Fatalf("a destination in range must be accepted: %v", err)
+	}
+
+	//the battery drained since the drone was loaded, so it can not depart anymore
+	droneObj.ChangeBatteryCapacity(-60)
+	if err = near.Start(droneObj); err == nil {
+		t.Errorf("drone must not depart when its battery is not enough to return")
+	}
+	if droneObj.GetState() != drone.StateLoaded {
+		t.Errorf("drone must stay %s when it can not depart but was %s", drone.StateLoaded, droneObj.GetState())
+	}
+
+	if _, err = NewMission(MissionDTO{
+		SerialNumber: droneObj.GetSerialNumber(),
+		Destination:  "Clinic-A",
+		Coordinates:  &geo.Point{Latitude: 91},
+		Medications:  []medication.MedicationDTO{{Name: "Medication-A", Code: "CODE_A", Weight: 100}},
+	}); err == nil {
+		t.Errorf("a mission with invalid coordinates must not be valid")
+	}
+}
+
+func Test_Mission_round(t *testing.T) {
+
+	homeBase := geo.Point{Latitude: 40.40, Longitude: -3.70}
+	clinicA := geo.Point{Latitude: 40.43, Longitude: -3.70}
+	clinicB := geo.Point{Latitude: 40.41, Longitude: -3.70}
+
+	droneObj, err := drone.NewDrone(drone.DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           drone.ModelHeavyweight,
+		WeightLimit:     500,
+		BatteryCapacity: 100,
+		State:           drone.StateIdle,
+		HomeBase:        &homeBase,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	//the medication without drop-off goes to the destination of the mission
+	missionObj, err := NewMission(MissionDTO{
+		SerialNumber: droneObj.GetSerialNumber(),
+		Destination:  "Clinic-A",
+		Coordinates:  &clinicA,
+		Medications: []medication.MedicationDTO{
+			{Name: "Medication-A", Code: "CODE_A", Weight: 200},
+			{Name: "Medication-B", Code: "CODE_B", Weight: 100, DropOff: &clinicB},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error while creating mission for test:%v", err)
+	}
+
+	if err = missionObj.Load(droneObj); err != nil {
+		t.Fatalf("error while loading mission for test:%v", err)
+	}
+	if err = missionObj.Start(droneObj); err != nil {
+		t.Fatalf("error while starting mission for test:%v", err)
+	}
+
+	if err = missionObj.DeliverStop(droneObj); err != nil {
+		t.Fatalf("first stop must be delivered: %v", err)
+	}
+	round := droneObj.GetRound()
+	if len(round) != 2 || round[0].Location != clinicB || round[0].Status != drone.StopDelivered || round[1].Status != drone.StopPending {
+		t.Fatalf("clinic B must be delivered first and clinic A must be pending but round was %+v", round)
+	}
+	if missionObj.GetStatus() != StatusInProgress || droneObj.GetState() != drone.StateDelivering {
+		t.Errorf("mission must go on while there are stops but was %s", missionObj.GetStatus())
+	}
+
+	if err = missionObj.DeliverStop(droneObj); err != nil {
+		t.Fatalf("last stop must be delivered: %v", err)
+	}
+	if missionObj.GetStatus() != StatusReturning || droneObj.GetState() != drone.StateReturning || droneObj.HasMedications() {
+		t.Errorf("drone must return empty after the last stop but mission was %s and drone %s", missionObj.GetStatus(), droneObj.GetState())
+	}
+
+	if err = missionObj.Return(droneObj); err != nil {
+		t.Fatalf("error while returning drone for test:%v", err)
+	}
+	if *droneObj.GetLocation() != homeBase {
+		t.Errorf("drone must be at its home base when it is back but was at %v", droneObj.GetLocation())
+	}
+}
@@ -0,0 +1,258 @@
+// Implements an OpenAPI 3 document of the api, with the schemas of its json objects taken from their go types.
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//version of the OpenAPI specification of the documents
+const Version = "3.0.3"
+
+type (
+	//OpenAPI document
+	Document struct {
+		OpenAPI    string                          `json:"openapi"`
+		Info       Info                            `json:"info"`
+		Paths      map[string]map[string]Operation `json:"paths"` // operations by path and method (lowercase)
+		Components Components                      `json:"components"`
+		Security   []map[string][]string           `json:"security,omitempty"`
+
+		types map[string]reflect.Type // go type of each schema of the components
+	}
+
+	//data of the api
+	Info struct {
+		Title       string `json:"title"`
+		Description string `json:"description,omitempty"`
+		Version     string `json:"version"`
+	}
+
+	//operation of a method on a path
+	Operation struct {
+		OperationID string              `json:"operationId,omitempty"`
+		Summary     string              `json:"summary,omitempty"`
+		Tags        []string            `json:"tags,omitempty"`
+		Parameters  []Parameter         `json:"parameters,omitempty"`
+		RequestBody *RequestBody        `json:"requestBody,omitempty"`
+		Responses   map[string]Response `json:"responses"` // by status code ("default" for the rest)
+	}
+
+	//parameter of an operation, in the path or in the query
+	Parameter struct {
+		Name        string  `json:"name"`
+		In          string  `json:"in"`
+		Description string  `json:"description,omitempty"`
+		Required    bool    `json:"required,omitempty"`
+		Schema      *Schema `json:"schema"`
+	}
+
+	//body of the request of an operation
+	RequestBody struct {
+		Required bool                 `json:"required,omitempty"`
+		Content  map[string]MediaType `json:"content"` // by media type
+	}
+
+	//response of an operation
+	Response struct {
+		Description string               `json:"description"`
+		Content     map[string]MediaType `json:"content,omitempty"` // by media type
+	}
+
+	//content of a body
+	MediaType struct {
+		Schema *Schema `json:"schema"`
+	}
+
+	//schemas and security schemes referenced by the operations
+	Components struct {
+		Schemas         map[string]*Schema        `json:"schemas"`
+		SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+	}
+
+	//way in which the clients are authenticated
+	SecurityScheme struct {
+		Type         string `json:"type"`
+		Name         string `json:"name,omitempty"`
+		In           string `json:"in,omitempty"`
+		Scheme       string `json:"scheme,omitempty"`
+		BearerFormat string `json:"bearerFormat,omitempty"`
+	}
+
+	//json schema of a value (a reference to a schema of the components when Ref is given)
+	Schema struct {
+		Ref                  string             `json:"$ref,omitempty"`
+		Type                 string             `json:"type,omitempty"`
+		Format               string             `json:"format,omitempty"`
+		Description          string             `json:"description,omitempty"`
+		Enum                 []string           `json:"enum,omitempty"`
+		Properties           map[string]*Schema `json:"properties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+		Items                *Schema            `json:"items,omitempty"`
+		AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	}
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+//get a new document without operations
+func NewDocument(info Info) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      make(map[string]map[string]Operation),
+		Components: Components{Schemas: make(map[string]*Schema)},
+		types:      make(map[string]reflect.Type),
+	}
+}
+
+//add the operation of a method on a path (a template like /drones/{serial_number})
+func (d *Document) AddOperation(method string, path string, operation Operation) {
+
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(map[string]Operation)
+	}
+
+	d.Paths[path][strings.ToLower(method)] = operation
+}
+
+//add a security scheme, required by every operation
+func (d *Document) AddSecurityScheme(name string, scheme SecurityScheme) {
+
+	if d.Components.SecuritySchemes == nil {
+		d.Components.SecuritySchemes = make(map[string]SecurityScheme)
+	}
+
+	d.Components.SecuritySchemes[name] = scheme
+	d.Security = append(d.Security, map[string][]string{name: {}})
+}
+
+//get the schema of the json of a value, adding the schemas of its structs to the components
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	return d.schemaOfType(reflect.TypeOf(v))
+}
+
+//get the schema of the json of a go type
+func (d *Document) schemaOfType(t reflect.Type) *Schema {
+
+	if t == nil || t == rawType {
+		//any json value
+		return &Schema{}
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		return &Schema{Ref: "#/components/schemas/" + d.addStruct(t)}
+	case t.Kind() == reflect.Struct:
+		return d.schemaOfStruct(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schemaOfType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOfType(t.Elem())}
+	}
+
+	return &Schema{}
+}
+
+//add the schema of a named struct to the components, returning its name
+func (d *Document) addStruct(t reflect.Type) string {
+
+	name := t.Name()
+	if other, ok := d.types[name]; ok && other != t {
+		//structs with the same name in several packages are told apart by the package
+		path := strings.Split(t.PkgPath(), "/")
+		name = strings.Title(path[len(path)-1]) + name
+	}
+
+	if _, ok := d.types[name]; ok {
+		return name
+	}
+
+	//the type is added before its fields, so a struct may refer to itself
+	d.types[name] = t
+	d.Components.Schemas[name] = &Schema{}
+	*d.Components.Schemas[name] = *d.schemaOfStruct(t)
+
+	return name
+}
+
+//get the schema of the json object of a struct, from the json tags of its fields
+func (d *Document) schemaOfStruct(t reflect.Type) *Schema {
+
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			//unexported (the exported fields of an embedded struct are encoded even when it is not)
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, options = tag[:i], tag[i+1:]
+		}
+
+		if field.Anonymous && name == "" {
+			//the fields of an embedded struct are fields of the object
+			embedded := d.schemaOfStruct(indirect(field.Type))
+			for k, v := range embedded.Properties {
+				schema.Properties[k] = v
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = d.schemaOfType(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+//get the type pointed by a pointer type
+func indirect(t reflect.Type) reflect.Type {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
@@ -0,0 +1,67 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type (
+	stop struct {
+		Destination string `json:"destination"`
+		Next        *stop  `json:"next,omitempty"`
+	}
+
+	audited struct {
+		Actor string `json:"actor"`
+	}
+
+	round struct {
+		audited
+		Stops     []stop            `json:"stops,omitempty"`
+		StartedAt *time.Time        `json:"started_at,omitempty"`
+		Labels    map[string]string `json:"labels,omitempty"`
+		Geometry  json.RawMessage   `json:"geometry,omitempty"`
+		Ignored   string            `json:"-"`
+		internal  string
+	}
+)
+
+func Test_SchemaOf(t *testing.T) {
+
+	d := NewDocument(Info{Title: "test", Version: "1"})
+
+	schema := d.SchemaOf(round{})
+	if schema.Ref != "#/components/schemas/round" {
+		t.Fatalf("a named struct must be a reference to the components but it was %+v", schema)
+	}
+
+	r := d.Components.Schemas["round"]
+	if r == nil || r.Type != "object" || len(r.Properties) != 5 || len(r.Required) != 1 || r.Required[0] != "actor" {
+		t.Fatalf("the schema of round must have the json fields of the struct but it was %+v", r)
+	}
+
+	if p := r.Properties["stops"]; p.Type != "array" || p.Items.Ref != "#/components/schemas/stop" {
+		t.Errorf("stops must be an array of references to stop but it was %+v", p)
+	}
+	if p := r.Properties["started_at"]; p.Type != "string" || p.Format != "date-time" {
+		t.Errorf("started_at must be a date-time but it was %+v", p)
+	}
+	if p := r.Properties["labels"]; p.Type != "object" || p.AdditionalProperties.Type != "string" {
+		t.Errorf("labels must be a map of strings but it was %+v", p)
+	}
+	if p := r.Properties["geometry"]; p.Type != "" || p.Ref != "" {
+		t.Errorf("geometry must be any json value but it was %+v", p)
+	}
+
+	//a struct that refers to itself
+	s := d.Components.Schemas["stop"]
+	if s == nil || s.Properties["next"].Ref != "#/components/schemas/stop" {
+		t.Errorf("the schema of stop must refer to itself but it was %+v", s)
+	}
+
+	_, err := json.Marshal(d)
+	if err != nil {
+		t.Errorf("document must be encoded to json: %v", err)
+	}
+}
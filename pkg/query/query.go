@@ -0,0 +1,255 @@
+// Implements the query layer of the list endpoints: parsing of the parameters, stable sorting and cursor pagination.
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	//parameters of a list request
+	LimitParameter  = "limit"
+	CursorParameter = "cursor"
+	SortParameter   = "sort" // name of a field, with a leading '-' to sort in descending order
+
+	//max number of items of a page
+	MaxLimit = 1000
+)
+
+type (
+	//items to be sorted and paged (the endpoints apply their filters before)
+	Collection interface {
+		Len() int
+		ID(i int) string                 // unique, it breaks the ties and positions the cursor
+		Value(i int, field string) Value // value of a sortable field of an item
+	}
+
+	//value of a sortable field: numbers are compared before texts
+	Value struct {
+		Number float64 `json:"n,omitempty"`
+		Text   string  `json:"t,omitempty"`
+	}
+
+	//order and page requested
+	Params struct {
+		Limit      int // 0 means every item
+		Sort       string
+		Descending bool
+		after      *position // last item of the previous page
+	}
+
+	//page of a list returned to the client
+	Page struct {
+		Limit      int    `json:"limit,omitempty"`
+		Total      int    `json:"total"`                 // items that match the filters, in every page
+		NextCursor string `json:"next_cursor,omitempty"` // empty in the last page
+	}
+
+	//position of an item in a sorted list, encoded in a cursor
+	position struct {
+		Sort       string `json:"s"`
+		Descending bool   `json:"d,omitempty"`
+		Value      Value  `json:"v"`
+		ID         string `json:"id"`
+	}
+)
+
+//get the params of a list request, checking that the sort field is one of the given ones (the first is the default)
+func Parse(values url.Values, fields []string, defaultLimit int) (Params, error) {
+
+	params := Params{Limit: defaultLimit}
+	if len(fields) > 0 {
+		params.Sort = fields[0]
+	}
+
+	if value := values.Get(LimitParameter); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return Params{}, errors.Errorf("parameter '%s' must be a number from 1 to %d", LimitParameter, MaxLimit)
+		}
+		params.Limit = limit
+	}
+
+	if value := values.Get(SortParameter); value != "" {
+		params.Descending = strings.HasPrefix(value, "-")
+		params.Sort = strings.TrimPrefix(value, "-")
+		if !contains(fields, params.Sort) {
+			return Params{}, errors.Errorf("parameter '%s' must be one of %s (with a leading '-' to sort in descending order)", SortParameter, strings.Join(fields, ", "))
+		}
+	}
+
+	if value := values.Get(CursorParameter); value != "" {
+		after, err := decodeCursor(value)
+		if err != nil {
+			return Params{}, errors.Wrapf(err, "parameter '%s' is not valid", CursorParameter)
+		}
+		//a cursor only makes sense in the order in which it was given
+		if after.Sort != params.Sort || after.Descending != params.Descending {
+			return Params{}, errors.Errorf("parameter '%s' was given for another sort", CursorParameter)
+		}
+		params.after = &after
+	}
+
+	return params, nil
+}
+
+//get the positions of the items of the requested page, in order, and the page to return to the client
+func Apply(items Collection, params Params) ([]int, Page) {
+
+	indexes := make([]int, 0, items.Len())
+	for i := 0; i < items.Len(); i++ {
+		indexes = append(indexes, i)
+	}
+
+	less := func(a Value, aID string, b Value, bID string) bool {
+		if c := compare(a, b); c != 0 {
+			return (c < 0) != params.Descending
+		}
+		return aID < bID
+	}
+
+	sort.SliceStable(indexes, func(i, j int) bool {
+		a, b := indexes[i], indexes[j]
+		return less(items.Value(a, params.Sort), items.ID(a), items.Value(b, params.Sort), items.ID(b))
+	})
+
+	page := Page{Limit: params.Limit, Total: len(indexes)}
+
+	//the page starts after the item of the cursor, even when that item is not in the list anymore
+	start := 0
+	if params.after != nil {
+		start = sort.Search(len(indexes), func(i int) bool {
+			return less(params.after.Value, params.after.ID, items.Value(indexes[i], params.Sort), items.ID(indexes[i]))
+		})
+	}
+	indexes = indexes[start:]
+
+	if params.Limit > 0 && len(indexes) > params.Limit {
+		indexes = indexes[:params.Limit]
+		last := indexes[len(indexes)-1]
+		page.NextCursor = encodeCursor(position{
+			Sort:       params.Sort,
+			Descending: params.Descending,
+			Value:      items.Value(last, params.Sort),
+			ID:         items.ID(last),
+		})
+	}
+
+	return indexes, page
+}
+
+//get the values of a parameter that may be repeated or comma separated
+func Strings(values url.Values, parameter string) []string {
+
+	result := make([]string, 0)
+	for _, v := range values[parameter] {
+		for _, value := range strings.Split(v, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				result = append(result, value)
+			}
+		}
+	}
+
+	return result
+}
+
+//get the value of a number parameter (nil when it is not given)
+func Int(values url.Values, parameter string) (*int, error) {
+
+	value := values.Get(parameter)
+	if value == "" {
+		return nil, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, errors.Errorf("parameter '%s' must be a number", parameter)
+	}
+
+	return &number, nil
+}
+
+//get the value of a boolean parameter (nil when it is not given)
+func Bool(values url.Values, parameter string) (*bool, error) {
+
+	value := values.Get(parameter)
+	if value == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.Errorf("parameter '%s' must be true or false", parameter)
+	}
+
+	return &b, nil
+}
+
+//get the value of a number field
+func Number(n float64) Value {
+	return Value{Number: n}
+}
+
+//get the value of a text field
+func Text(s string) Value {
+	return Value{Text: s}
+}
+
+//compare two values (-1 when a goes first, 1 when b goes first)
+func compare(a Value, b Value) int {
+
+	switch {
+	case a.Number < b.Number:
+		return -1
+	case a.Number > b.Number:
+		return 1
+	}
+
+	return strings.Compare(a.Text, b.Text)
+}
+
+//get the opaque cursor of a position
+func encodeCursor(p position) string {
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+//get the position of a cursor
+func decodeCursor(cursor string) (position, error) {
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return position{}, err
+	}
+
+	p := position{}
+	err = json.Unmarshal(data, &p)
+	if err != nil {
+		return position{}, err
+	}
+
+	return p, nil
+}
+
+//check whether a list of strings contains a value
+func contains(list []string, value string) bool {
+
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,101 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+//drones with their battery levels, as a collection
+type batteries struct {
+	ids    []string
+	levels []float64
+}
+
+func (b batteries) Len() int        { return len(b.ids) }
+func (b batteries) ID(i int) string { return b.ids[i] }
+func (b batteries) Value(i int, field string) Value {
+	if field == "battery" {
+		return Number(b.levels[i])
+	}
+	return Text(b.ids[i])
+}
+
+//get the ids of the items of a page
+func (b batteries) page(indexes []int) []string {
+
+	ids := make([]string, 0, len(indexes))
+	for _, v := range indexes {
+		ids = append(ids, b.ids[v])
+	}
+
+	return ids
+}
+
+func Test_Parse(t *testing.T) {
+
+	fields := []string{"serial", "battery"}
+
+	params, err := Parse(url.Values{}, fields, 100)
+	if err != nil || params.Limit != 100 || params.Sort != "serial" || params.Descending {
+		t.Errorf("params without parameters must have the defaults but they were %+v (%v)", params, err)
+	}
+
+	params, err = Parse(url.Values{"limit": {"5"}, "sort": {"-battery"}}, fields, 100)
+	if err != nil || params.Limit != 5 || params.Sort != "battery" || !params.Descending {
+		t.Errorf("params must be parsed but they were %+v (%v)", params, err)
+	}
+
+	invalid := []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"1001"}},
+		{"limit": {"ten"}},
+		{"sort": {"model"}},
+		{"cursor": {"not a cursor"}},
+		{"cursor": {encodeCursor(position{Sort: "battery"})}},
+	}
+	for _, v := range invalid {
+		if _, err = Parse(v, fields, 100); err == nil {
+			t.Errorf("params %v must not be parsed", v)
+		}
+	}
+}
+
+func Test_Apply(t *testing.T) {
+
+	items := batteries{
+		ids:    []string{"D", "B", "A", "E", "C"},
+		levels: []float64{50, 90, 50, 10, 50},
+	}
+
+	params, _ := Parse(url.Values{"sort": {"-battery"}, "limit": {"2"}}, []string{"serial", "battery"}, 0)
+
+	pages := make([][]string, 0)
+	for {
+		indexes, page := Apply(items, params)
+		if page.Total != 5 {
+			t.Fatalf("total must be 5 but it was %d", page.Total)
+		}
+		pages = append(pages, items.page(indexes))
+		if page.NextCursor == "" {
+			break
+		}
+		params, _ = Parse(url.Values{"sort": {"-battery"}, "limit": {"2"}, "cursor": {page.NextCursor}}, []string{"serial", "battery"}, 0)
+	}
+
+	//ties are sorted by id, so every item is in one page only
+	expected := [][]string{{"B", "A"}, {"C", "D"}, {"E"}}
+	if fmt.Sprint(pages) != fmt.Sprint(expected) {
+		t.Errorf("pages must be %v but they were %v", expected, pages)
+	}
+
+	//the next page starts after the item of the cursor even when it was removed
+	params, _ = Parse(url.Values{"limit": {"2"}}, []string{"serial", "battery"}, 0)
+	_, page := Apply(items, params)
+	items = batteries{ids: []string{"D", "E", "C"}, levels: []float64{50, 10, 50}}
+	params, _ = Parse(url.Values{"limit": {"2"}, "cursor": {page.NextCursor}}, []string{"serial", "battery"}, 0)
+	indexes, page := Apply(items, params)
+	if ids := items.page(indexes); len(ids) != 2 || ids[0] != "C" || ids[1] != "D" || page.NextCursor == "" {
+		t.Errorf("page after B must be [C D] but it was %v", ids)
+	}
+}
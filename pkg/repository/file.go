@@ -0,0 +1,351 @@
+// Implements a repository of drones backed by an append-only JSON log file.
+package repository
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/drone"
+)
+
+const (
+	operationSave   = "save"
+	operationDelete = "delete"
+
+	//the records written within this interval are synced to disk together
+	syncInterval = time.Second
+
+	//the log is compacted at runtime when it keeps this many records and several times more records than drones
+	compactMinRecords = 1000
+	compactRatio      = 4
+)
+
+type (
+	//repository that keeps every change as a line of json in a file and replays them on opening
+	FileRepository struct {
+		path    string
+		file    *os.File
+		drones  map[string]drone.DroneDTO // use SerialNumber as key
+		records int                       // number of records in the log file
+		dirty   bool                      // records written since the last sync
+		stop    chan struct{}             // closed to stop the periodic sync
+		done    chan struct{}             // closed when the periodic sync has stopped
+		sync.Mutex
+	}
+
+	//a line of the log file
+	record struct {
+		Operation    string          `json:"operation"`
+		SerialNumber string          `json:"serial_number"`
+		Drone        *drone.DroneDTO `json:"drone,omitempty"`
+	}
+)
+
+//get a pointer to a file repository, replaying the content of the log file when it already exists
+func NewFileRepository(path string) (*FileRepository, error) {
+
+	repo := &FileRepository{
+		path:   path,
+		drones: make(map[string]drone.DroneDTO),
+	}
+
+	err := repo.replay()
+	if err != nil {
+		return nil, err
+	}
+
+	//the log is rewritten when it keeps more records than drones, so it does not grow forever
+	if repo.records > len(repo.drones) {
+		err = repo.compact()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = repo.open()
+	if err != nil {
+		return nil, err
+	}
+
+	repo.stop = make(chan struct{})
+	repo.done = make(chan struct{})
+	go repo.syncPeriodically()
+
+	return repo, nil
+}
+
+//insert or replace a drone
+func (r *FileRepository) Save(dto drone.DroneDTO) error {
+
+	r.Lock()
+	defer r.Unlock()
+
+	err := r.append(record{Operation: operationSave, SerialNumber: dto.SerialNumber, Drone: &dto})
+	if err != nil {
+		return err
+	}
+
+	r.drones[dto.SerialNumber] = dto
+
+	return r.compactIfNeeded()
+}
+
+//get a drone by its serial number
+func (r *FileRepository) Get(serialNumber string) (drone.DroneDTO, bool, error) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	dto, ok := r.drones[serialNumber]
+
+	return dto, ok, nil
+}
+
+//get all the stored drones sorted by serial number
+func (r *FileRepository) GetAll() ([]drone.DroneDTO, error) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	drones := make([]drone.DroneDTO, 0, len(r.drones))
+	for _, v := range r.drones {
+		drones = append(drones, v)
+	}
+
+	sort.Slice(drones, func(i, j int) bool {
+		return drones[i].SerialNumber < drones[j].SerialNumber
+	})
+
+	return drones, nil
+}
+
+//remove a drone
+func (r *FileRepository) Delete(serialNumber string) error {
+
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.drones[serialNumber]; !ok {
+		return errors.New("there is not a drone with serial number " + serialNumber)
+	}
+
+	err := r.append(record{Operation: operationDelete, SerialNumber: serialNumber})
+	if err != nil {
+		return err
+	}
+
+	delete(r.drones, serialNumber)
+
+	return r.compactIfNeeded()
+}
+
+//close the log file, syncing the pending records
+func (r *FileRepository) Close() error {
+
+	r.Lock()
+	if r.file == nil {
+		r.Unlock()
+		return nil
+	}
+	close(r.stop)
+	r.Unlock()
+	<-r.done
+
+	r.Lock()
+	defer r.Unlock()
+
+	err := r.sync()
+	if err != nil {
+		r.file.Close()
+		r.file = nil
+		return err
+	}
+
+	err = r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+//open the log file to append records (the caller must hold the lock)
+func (r *FileRepository) open() error {
+
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not open repository file")
+	}
+	r.file = file
+
+	return nil
+}
+
+//sync the records written since the last sync (the caller must hold the lock)
+func (r *FileRepository) sync() error {
+
+	if !r.dirty || r.file == nil {
+		return nil
+	}
+
+	err := r.file.Sync()
+	if err != nil {
+		return errors.Wrap(err, "could not sync repository file")
+	}
+	r.dirty = false
+
+	return nil
+}
+
+//sync the written records once per interval, so frequent saves do not wait for the disk one by one
+func (r *FileRepository) syncPeriodically() {
+
+	defer close(r.done)
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.Lock()
+			err := r.sync()
+			r.Unlock()
+			if err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		}
+	}
+}
+
+//write a record at the end of the log file, compacting it when it has grown too much (the caller must hold the lock)
+func (r *FileRepository) append(rec record) error {
+
+	if r.file == nil {
+		return errors.New("repository is closed")
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal record")
+	}
+
+	_, err = r.file.Write(append(data, '\n'))
+	if err != nil {
+		return errors.Wrap(err, "could not write record")
+	}
+
+	r.dirty = true
+	r.records++
+
+	return nil
+}
+
+//rewrite the log file when it keeps too many records of the same drones (the caller must hold the lock)
+func (r *FileRepository) compactIfNeeded() error {
+
+	if r.records < compactMinRecords || r.records <= compactRatio*len(r.drones) {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return errors.Wrap(err, "could not close repository file")
+	}
+
+	//the compacted file is synced, so there is nothing pending unless it failed
+	err = r.compact()
+	r.dirty = err != nil
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+
+	return r.open()
+}
+
+//read the log file and rebuild the drones from its records
+func (r *FileRepository) replay() error {
+
+	f, err := os.OpenFile(r.path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not open repository file")
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	for {
+		rec := record{}
+		lastGoodOffset := decoder.InputOffset()
+
+		err = decoder.Decode(&rec)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			//a partially written record (e.g. the app was killed while writing) is discarded
+			log.Printf("repository file %s is corrupted after offset %d, discarding the rest: %v", r.path, lastGoodOffset, err)
+			return errors.Wrap(f.Truncate(lastGoodOffset), "could not truncate repository file")
+		}
+
+		switch rec.Operation {
+		case operationSave:
+			if rec.Drone != nil {
+				r.drones[rec.SerialNumber] = *rec.Drone
+			}
+		case operationDelete:
+			delete(r.drones, rec.SerialNumber)
+		}
+		r.records++
+	}
+}
+
+//rewrite the log file with only one record per stored drone
+func (r *FileRepository) compact() error {
+
+	tmpPath := r.path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not create temporary repository file")
+	}
+
+	encoder := json.NewEncoder(f)
+	for k := range r.drones {
+		dto := r.drones[k]
+		err = encoder.Encode(record{Operation: operationSave, SerialNumber: k, Drone: &dto})
+		if err != nil {
+			f.Close()
+			return errors.Wrap(err, "could not write temporary repository file")
+		}
+	}
+
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "could not sync temporary repository file")
+	}
+
+	err = f.Close()
+	if err != nil {
+		return errors.Wrap(err, "could not close temporary repository file")
+	}
+
+	err = os.Rename(tmpPath, r.path)
+	if err != nil {
+		return errors.Wrap(err, "could not replace repository file")
+	}
+
+	r.records = len(r.drones)
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"drones/pkg/drone"
+	"drones/pkg/medication"
+)
+
+func Test_FileRepository(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "drones.jsonl")
+
+	repo, err := NewFileRepository(path)
+	if err != nil {
+		t.Fatalf("error while creating repository for test:%v", err)
+	}
+
+	droneA := drone.DroneDTO{
+		SerialNumber:    "SERIAL-A",
+		Model:           drone.ModelHeavyweight,
+		WeightLimit:     500,
+		BatteryCapacity: 80,
+		State:           drone.StateLoaded,
+		Medications: []medication.MedicationDTO{
+			{Name: "Medication-A", Code: "CODE_A", Weight: 20, Image: "aW1hZ2U="},
+		},
+	}
+	droneB := drone.DroneDTO{
+		SerialNumber:    "SERIAL-B",
+		Model:           drone.ModelLightweight,
+		WeightLimit:     100,
+		BatteryCapacity: 100,
+		State:           drone.StateIdle,
+	}
+
+	for _, v := range []drone.DroneDTO{droneB, droneA} {
+		if err = repo.Save(v); err != nil {
+			t.Fatalf("error while saving drone %s:%v", v.SerialNumber, err)
+		}
+	}
+
+	droneA.State = drone.StateDelivering
+	if err = repo.Save(droneA); err != nil {
+		t.Fatalf("error while saving drone %s:%v", droneA.SerialNumber, err)
+	}
+
+	if err = repo.Delete(droneB.SerialNumber); err != nil {
+		t.Fatalf("error while deleting drone %s:%v", droneB.SerialNumber, err)
+	}
+
+	if err = repo.Delete(droneB.SerialNumber); err == nil {
+		t.Errorf("deleting a drone that is not stored must fail")
+	}
+
+	if err = repo.Close(); err != nil {
+		t.Fatalf("error while closing repository:%v", err)
+	}
+
+	reopened, err := NewFileRepository(path)
+	if err != nil {
+		t.Fatalf("error while reopening repository:%v", err)
+	}
+	defer reopened.Close()
+
+	drones, err := reopened.GetAll()
+	if err != nil {
+		t.Fatalf("error while reading drones:%v", err)
+	}
+
+	if len(drones) != 1 {
+		t.Fatalf("repository must keep 1 drone after reopening but kept %d", len(drones))
+	}
+
+	stored, ok, _ := reopened.Get(droneA.SerialNumber)
+	if !ok {
+		t.Fatalf("drone %s must be found after reopening", droneA.SerialNumber)
+	}
+
+	if stored.State != drone.StateDelivering {
+		t.Errorf("state of drone must be %s after reopening but was %s", drone.StateDelivering, stored.State)
+	}
+
+	if len(stored.Medications) != 1 || stored.Medications[0].Image != droneA.Medications[0].Image {
+		t.Errorf("medications of drone must be kept with their images after reopening but were %+v", stored.Medications)
+	}
+
+	if reopened.records != 1 {
+		t.Errorf("log file must be compacted to 1 record after reopening but has %d", reopened.records)
+	}
+}
+
+func Test_FileRepository_truncatedRecord(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "drones.jsonl")
+
+	content := `{"operation":"save","serial_number":"SERIAL-A","drone":{"serial_number":"SERIAL-A","model":"Lightweight","weight_limit":100,"battery_capacity":50,"state":"IDLE"}}
+{"operation":"save","serial_number":"SERIAL-B","drone":{"serial_num`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("error while writing file for test:%v", err)
+	}
+
+	repo, err := NewFileRepository(path)
+	if err != nil {
+		t.Fatalf("a truncated last record must be discarded but opening failed:%v", err)
+	}
+	defer repo.Close()
+
+	drones, _ := repo.GetAll()
+	if len(drones) != 1 || drones[0].SerialNumber != "SERIAL-A" {
+		t.Errorf("repository must keep only the complete record but kept %+v", drones)
+	}
+
+	if err = repo.Save(drone.DroneDTO{SerialNumber: "SERIAL-C", Model: drone.ModelLightweight, State: drone.StateIdle}); err != nil {
+		t.Errorf("repository must accept new records after discarding a truncated one:%v", err)
+	}
+}
+
+func Test_FileRepository_compactionAtRuntime(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "drones.jsonl")
+
+	repo, err := NewFileRepository(path)
+	if err != nil {
+		t.Fatalf("error while creating repository for test:%v", err)
+	}
+
+	dto := drone.DroneDTO{SerialNumber: "SERIAL-A", Model: drone.ModelLightweight, WeightLimit: 100, State: drone.StateIdle}
+	for i := 0; i < compactMinRecords+10; i++ {
+		dto.BatteryCapacity = uint8(i % 100)
+		if err = repo.Save(dto); err != nil {
+			t.Fatalf("error while saving drone:%v", err)
+		}
+	}
+
+	if repo.records > 10+1 {
+		t.Errorf("log file must be compacted while it is open but has %d records", repo.records)
+	}
+
+	if err = repo.Close(); err != nil {
+		t.Fatalf("error while closing repository:%v", err)
+	}
+
+	reopened, err := NewFileRepository(path)
+	if err != nil {
+		t.Fatalf("error while reopening repository:%v", err)
+	}
+	defer reopened.Close()
+
+	stored, ok, _ := reopened.Get(dto.SerialNumber)
+	if !ok || stored.BatteryCapacity != dto.BatteryCapacity {
+		t.Errorf("the last save must be kept after compacting but drone was %+v", stored)
+	}
+}
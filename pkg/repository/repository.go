@@ -0,0 +1,17 @@
+// Implements the persistence of the registered drones.
+package repository
+
+import (
+	"drones/pkg/drone"
+)
+
+type (
+	//define what a storage of drones must offer to the app
+	Repository interface {
+		Save(dto drone.DroneDTO) error                         // insert or replace a drone (including its state and loaded medications)
+		Get(serialNumber string) (drone.DroneDTO, bool, error) // get a drone by its serial number
+		GetAll() ([]drone.DroneDTO, error)                     // get all the stored drones sorted by serial number
+		Delete(serialNumber string) error                      // remove a drone
+		Close() error                                          // release the resources used by the storage
+	}
+)
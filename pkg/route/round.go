@@ -0,0 +1,92 @@
+// Implements the ordering of the stops of a delivery round (nearest neighbour improved with 2-opt).
+package route
+
+import (
+	"drones/pkg/geo"
+)
+
+//max passes of 2-opt over the whole round (each pass that improves nothing ends the search)
+const maxTwoOptPasses = 50
+
+//get the order in which to visit the stops flying from an origin (and then to an end, when it is not nil),
+//as the positions of the stops in the given list
+func OrderStops(from geo.Point, to *geo.Point, stops []geo.Point) []int {
+
+	order := nearestNeighbour(from, stops)
+
+	//the origin and the end are fixed, so they are added around the stops while improving the round
+	points := make([]geo.Point, 0, len(stops)+2)
+	points = append(points, from)
+	for _, v := range order {
+		points = append(points, stops[v])
+	}
+	if to != nil {
+		points = append(points, *to)
+	}
+
+	for pass := 0; pass < maxTwoOptPasses; pass++ {
+		improved := false
+		for i := 1; i < len(order); i++ {
+			for j := i + 1; j <= len(order); j++ {
+				if twoOptGain(points, i, j) > 1e-9 {
+					reverse(points[i:j+1], order[i-1:j])
+					improved = true
+				}
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+
+	return order
+}
+
+//get the stops ordered by flying each time to the nearest one that was not visited yet
+func nearestNeighbour(from geo.Point, stops []geo.Point) []int {
+
+	order := make([]int, 0, len(stops))
+	visited := make([]bool, len(stops))
+	current := from
+	for range stops {
+		next := -1
+		for i, v := range stops {
+			if visited[i] {
+				continue
+			}
+			if next < 0 || geo.Distance(current, v) < geo.Distance(current, stops[next]) {
+				next = i
+			}
+		}
+		visited[next] = true
+		order = append(order, next)
+		current = stops[next]
+	}
+
+	return order
+}
+
+//get the km saved by reversing the stops from i to j of the round (a round without end has no leg after its last stop)
+func twoOptGain(points []geo.Point, i int, j int) float64 {
+
+	before := geo.Distance(points[i-1], points[i])
+	after := geo.Distance(points[i-1], points[j])
+	if j+1 < len(points) {
+		before += geo.Distance(points[j], points[j+1])
+		after += geo.Distance(points[i], points[j+1])
+	}
+
+	return before - after
+}
+
+//reverse the points of a part of the round and the positions of its stops
+func reverse(points []geo.Point, order []int) {
+
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+}
@@ -0,0 +1,309 @@
+// Implements the planning of flight routes around no-fly zones (shortest path on a visibility graph, found with A*).
+package route
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/geo"
+	"drones/pkg/geofence"
+)
+
+const (
+	//distance in km kept from the corners of the zones when no other margin is set
+	DefaultMarginKm = 0.05
+	//min share of the margin that a corner is pushed out when the angle is very sharp
+	minMiterFactor = 0.3
+)
+
+type (
+	//define a planned route
+	Route struct {
+		Waypoints  []geo.Point `json:"waypoints"` // from origin to destination
+		DistanceKm float64     `json:"distance_km"`
+	}
+
+	//define a route as a GeoJSON feature with a LineString
+	Feature struct {
+		Type       string     `json:"type"`
+		Geometry   LineString `json:"geometry"`
+		Properties Properties `json:"properties"`
+	}
+
+	//define a GeoJSON LineString
+	LineString struct {
+		Type        string      `json:"type"`
+		Coordinates [][]float64 `json:"coordinates"` // positions as [longitude, latitude]
+	}
+
+	//define the properties of a route feature
+	Properties struct {
+		DistanceKm float64 `json:"distance_km"`
+		Waypoints  int     `json:"waypoints"`
+	}
+
+	//error of a route that can not be planned because of a zone
+	BlockedError struct {
+		Zone   geofence.Feature
+		Reason string
+	}
+
+	//an obstacle on the plane of the route
+	obstacle struct {
+		zone    geofence.Feature
+		polygon []geo.XY // without the closing vertex
+	}
+
+	//a node of the search
+	node struct {
+		index    int
+		priority float64 // distance from the origin plus estimate to the destination
+	}
+
+	//queue of nodes by priority
+	queue []node
+)
+
+//get the message of a blocked route
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%s: it is inside the no-fly zone %s (%s)", e.Reason, e.Zone.ID, e.Zone.Properties.Name)
+}
+
+//get the shortest route from an origin to a destination that does not enter any zone, keeping a margin (km) from their corners
+func Plan(from geo.Point, to geo.Point, outlines []geofence.Outline, marginKm float64) (Route, error) {
+
+	err := from.Validate()
+	if err != nil {
+		return Route{}, errors.Wrap(err, "origin is not valid")
+	}
+
+	err = to.Validate()
+	if err != nil {
+		return Route{}, errors.Wrap(err, "destination is not valid")
+	}
+
+	if marginKm <= 0 {
+		marginKm = DefaultMarginKm
+	}
+
+	plane := geo.NewPlane(from)
+	obstacles := make([]obstacle, 0, len(outlines))
+	for _, v := range outlines {
+		o := obstacle{zone: v.Zone}
+		for _, p := range v.Ring[:len(v.Ring)-1] {
+			o.polygon = append(o.polygon, plane.Project(p))
+		}
+		obstacles = append(obstacles, o)
+	}
+
+	start, end := plane.Project(from), plane.Project(to)
+	for _, v := range obstacles {
+		if geo.InsidePolygon(v.polygon, start) {
+			return Route{}, &BlockedError{Zone: v.zone, Reason: "origin can not be left"}
+		}
+		if geo.InsidePolygon(v.polygon, end) {
+			return Route{}, &BlockedError{Zone: v.zone, Reason: "destination can not be reached"}
+		}
+	}
+
+	//the graph is made of the origin, the destination and the corners of the zones pushed out by the margin
+	nodes := []geo.XY{start, end}
+	for _, v := range obstacles {
+		for _, corner := range v.corners(marginKm) {
+			if !insideAny(obstacles, corner) {
+				nodes = append(nodes, corner)
+			}
+		}
+	}
+
+	path, ok := search(nodes, obstacles)
+	if !ok {
+		return Route{}, errors.New("there is not a route to the destination that avoids the no-fly zones")
+	}
+
+	route := Route{
+		Waypoints: make([]geo.Point, 0, len(path)),
+	}
+	for i, v := range path {
+		point := plane.Unproject(nodes[v])
+		//origin and destination are kept exactly as they were given
+		switch i {
+		case 0:
+			point = from
+		case len(path) - 1:
+			point = to
+		}
+		if i > 0 {
+			route.DistanceKm += geo.Distance(route.Waypoints[i-1], point)
+		}
+		route.Waypoints = append(route.Waypoints, point)
+	}
+
+	return route, nil
+}
+
+//get the route as a GeoJSON feature
+func (r Route) GetFeature() Feature {
+
+	coordinates := make([][]float64, 0, len(r.Waypoints))
+	for _, v := range r.Waypoints {
+		coordinates = append(coordinates, []float64{v.Longitude, v.Latitude})
+	}
+
+	return Feature{
+		Type: "Feature",
+		Geometry: LineString{
+			Type:        "LineString",
+			Coordinates: coordinates,
+		},
+		Properties: Properties{
+			DistanceKm: math.Round(r.DistanceKm*1000) / 1000,
+			Waypoints:  len(r.Waypoints),
+		},
+	}
+}
+
+//get the shortest path between the first two nodes (A* on the visibility graph), as indexes of nodes
+func search(nodes []geo.XY, obstacles []obstacle) ([]int, bool) {
+
+	start, end := 0, 1
+	distances := make([]float64, len(nodes))
+	previous := make([]int, len(nodes))
+	done := make([]bool, len(nodes))
+	for i := range distances {
+		distances[i] = math.Inf(1)
+		previous[i] = -1
+	}
+	distances[start] = 0
+
+	open := &queue{{index: start, priority: nodes[start].Distance(nodes[end])}}
+	for open.Len() > 0 {
+		current := heap.Pop(open).(node).index
+		if done[current] {
+			continue
+		}
+		done[current] = true
+
+		if current == end {
+			path := make([]int, 0)
+			for v := end; v != -1; v = previous[v] {
+				path = append([]int{v}, path...)
+			}
+			return path, true
+		}
+
+		for next := range nodes {
+			if done[next] || next == current {
+				continue
+			}
+			distance := distances[current] + nodes[current].Distance(nodes[next])
+			if distance >= distances[next] || !visible(nodes[current], nodes[next], obstacles) {
+				continue
+			}
+			distances[next] = distance
+			previous[next] = current
+			heap.Push(open, node{index: next, priority: distance + nodes[next].Distance(nodes[end])})
+		}
+	}
+
+	return nil, false
+}
+
+//check whether a straight flight between two positions does not touch any obstacle
+func visible(a geo.XY, b geo.XY, obstacles []obstacle) bool {
+
+	middle := geo.XY{(a[0] + b[0]) / 2, (a[1] + b[1]) / 2}
+	for _, v := range obstacles {
+		if geo.InsidePolygon(v.polygon, middle) {
+			return false
+		}
+		for i := range v.polygon {
+			if geo.SegmentsIntersect(a, b, v.polygon[i], v.polygon[(i+1)%len(v.polygon)]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+//check whether a position is inside any obstacle
+func insideAny(obstacles []obstacle, p geo.XY) bool {
+
+	for _, v := range obstacles {
+		if geo.InsidePolygon(v.polygon, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//get the corners of the obstacle pushed out by the margin along their bisectors
+func (o obstacle) corners(marginKm float64) []geo.XY {
+
+	//outward normals are on the right of the edges of a counterclockwise polygon
+	orientation := 1.0
+	if area(o.polygon) < 0 {
+		orientation = -1
+	}
+
+	corners := make([]geo.XY, 0, len(o.polygon))
+	for i, v := range o.polygon {
+		prev := o.polygon[(i+len(o.polygon)-1)%len(o.polygon)]
+		next := o.polygon[(i+1)%len(o.polygon)]
+
+		n1 := normal(prev, v, orientation)
+		n2 := normal(v, next, orientation)
+		bisector := geo.XY{n1[0] + n2[0], n1[1] + n2[1]}
+		length := math.Hypot(bisector[0], bisector[1])
+		if length < 1e-9 {
+			bisector, length = n1, 1
+		}
+		bisector = geo.XY{bisector[0] / length, bisector[1] / length}
+
+		//the corner is pushed enough so both of its sides keep the margin
+		miter := math.Max(bisector[0]*n1[0]+bisector[1]*n1[1], minMiterFactor)
+		corners = append(corners, geo.XY{v[0] + bisector[0]*marginKm/miter, v[1] + bisector[1]*marginKm/miter})
+	}
+
+	return corners
+}
+
+//get the outward unit normal of an edge
+func normal(a geo.XY, b geo.XY, orientation float64) geo.XY {
+
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return geo.XY{}
+	}
+
+	return geo.XY{orientation * dy / length, -orientation * dx / length}
+}
+
+//get the signed area of a polygon (positive when it is counterclockwise)
+func area(polygon []geo.XY) float64 {
+
+	sum := 0.0
+	for i, v := range polygon {
+		next := polygon[(i+1)%len(polygon)]
+		sum += v[0]*next[1] - next[0]*v[1]
+	}
+
+	return sum / 2
+}
+
+func (q queue) Len() int            { return len(q) }
+func (q queue) Less(i, j int) bool  { return q[i].priority < q[j].priority }
+func (q queue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *queue) Push(x interface{}) { *q = append(*q, x.(node)) }
+func (q *queue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
@@ -0,0 +1,178 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"drones/pkg/geo"
+	"drones/pkg/geofence"
+)
+
+//get a store with rectangular zones given as [west, south, east, north]
+func newTestStore(t *testing.T, rectangles ...[4]float64) *geofence.Store {
+
+	s, err := geofence.NewStore("")
+	if err != nil {
+		t.Fatalf("error while creating store for test:%v", err)
+	}
+
+	for i, v := range rectangles {
+		coordinates := fmt.Sprintf("[[[%f,%f],[%f,%f],[%f,%f],[%f,%f],[%f,%f]]]",
+			v[0], v[1], v[2], v[1], v[2], v[3], v[0], v[3], v[0], v[1])
+		feature := geofence.Feature{
+			ID:         fmt.Sprintf("zone-%d", i),
+			Geometry:   geofence.Geometry{Type: geofence.GeometryPolygon, Coordinates: json.RawMessage(coordinates)},
+			Properties: geofence.Properties{Name: "Zone"},
+		}
+		if _, err = s.Add(feature); err != nil {
+			t.Fatalf("error while adding zone for test:%v", err)
+		}
+	}
+
+	return s
+}
+
+func Test_Plan_straight(t *testing.T) {
+
+	from := geo.Point{Latitude: 40.40, Longitude: -3.70}
+	to := geo.Point{Latitude: 40.45, Longitude: -3.70}
+
+	route, err := Plan(from, to, nil, 0)
+	if err != nil {
+		t.Fatalf("error while planning:%v", err)
+	}
+
+	if len(route.Waypoints) != 2 || route.Waypoints[0] != from || route.Waypoints[1] != to {
+		t.Errorf("route without zones must be straight but was %+v", route.Waypoints)
+	}
+	if route.DistanceKm != geo.Distance(from, to) {
+		t.Errorf("distance of straight route must be %f but was %f", geo.Distance(from, to), route.DistanceKm)
+	}
+
+	feature := route.GetFeature()
+	if feature.Geometry.Type != "LineString" || len(feature.Geometry.Coordinates) != 2 || feature.Geometry.Coordinates[0][0] != from.Longitude {
+		t.Errorf("unexpected GeoJSON feature %+v", feature)
+	}
+}
+
+func Test_Plan_around(t *testing.T) {
+
+	//a wall between origin and destination, and a circle on the way around its east end
+	s := newTestStore(t, [4]float64{-3.75, 40.42, -3.68, 40.43})
+	helipad := geofence.Feature{
+		ID:         "helipad",
+		Geometry:   geofence.Geometry{Type: geofence.GeometryPoint, Coordinates: json.RawMessage("[-3.675, 40.425]")},
+		Properties: geofence.Properties{Name: "Helipad", Radius: 300},
+	}
+	if _, err := s.Add(helipad); err != nil {
+		t.Fatalf("error while adding zone for test:%v", err)
+	}
+
+	from := geo.Point{Latitude: 40.40, Longitude: -3.70}
+	to := geo.Point{Latitude: 40.45, Longitude: -3.70}
+
+	route, err := Plan(from, to, s.Outlines(), 0)
+	if err != nil {
+		t.Fatalf("error while planning:%v", err)
+	}
+
+	if len(route.Waypoints) < 3 {
+		t.Fatalf("route must go around the wall but was %+v", route.Waypoints)
+	}
+
+	for i := 1; i < len(route.Waypoints); i++ {
+		if err := s.CheckFlight(route.Waypoints[i-1], route.Waypoints[i]); err != nil {
+			t.Errorf("leg %d of route must avoid the zones: %v", i, err)
+		}
+	}
+
+	//the shortest way is around the east end of the wall, which is nearer
+	for _, v := range route.Waypoints[1 : len(route.Waypoints)-1] {
+		if v.Longitude < -3.70 {
+			t.Errorf("route must go around the east end of the wall but has waypoint %v", v)
+		}
+	}
+
+	if route.DistanceKm <= geo.Distance(from, to) {
+		t.Errorf("route around the wall must be longer than the straight flight")
+	}
+}
+
+func Test_Plan_blocked(t *testing.T) {
+
+	s := newTestStore(t, [4]float64{-3.72, 40.42, -3.66, 40.43})
+
+	_, err := Plan(geo.Point{Latitude: 40.40, Longitude: -3.70}, geo.Point{Latitude: 40.425, Longitude: -3.70}, s.Outlines(), 0)
+	blocked := &BlockedError{}
+	if !errors.As(err, &blocked) || blocked.Zone.ID != "zone-0" {
+		t.Errorf("destination inside a zone must be blocked by it but got %v", err)
+	}
+
+	//a closed box of zones around the origin
+	s = newTestStore(t,
+		[4]float64{-3.72, 40.38, -3.68, 40.39},
+		[4]float64{-3.72, 40.41, -3.68, 40.42},
+		[4]float64{-3.72, 40.38, -3.71, 40.42},
+		[4]float64{-3.69, 40.38, -3.68, 40.42},
+	)
+
+	_, err = Plan(geo.Point{Latitude: 40.40, Longitude: -3.70}, geo.Point{Latitude: 40.45, Longitude: -3.70}, s.Outlines(), 0)
+	if err == nil {
+		t.Errorf("origin enclosed by zones must not have a route")
+	}
+
+	if _, err = Plan(geo.Point{Latitude: 91}, geo.Point{}, nil, 0); err == nil {
+		t.Errorf("an invalid origin must be refused")
+	}
+}
+
+func Test_OrderStops(t *testing.T) {
+
+	from := geo.Point{Latitude: 40.40, Longitude: -3.70}
+
+	//stops along a line, given out of order: the round must visit them from the nearest to the farthest
+	stops := []geo.Point{
+		{Latitude: 40.43, Longitude: -3.70},
+		{Latitude: 40.41, Longitude: -3.70},
+		{Latitude: 40.44, Longitude: -3.70},
+		{Latitude: 40.42, Longitude: -3.70},
+	}
+	order := OrderStops(from, nil, stops)
+	if fmt.Sprint(order) != fmt.Sprint([]int{1, 3, 0, 2}) {
+		t.Errorf("stops along a line must be visited in order but were %v", order)
+	}
+
+	//nearest neighbour goes to the near stop in the east first and then crosses its own path, 2-opt fixes it
+	square := []geo.Point{
+		{Latitude: 40.40, Longitude: -3.69},
+		{Latitude: 40.42, Longitude: -3.71},
+		{Latitude: 40.42, Longitude: -3.69},
+		{Latitude: 40.40, Longitude: -3.71},
+	}
+	order = OrderStops(from, &from, square)
+	if len(order) != len(square) {
+		t.Fatalf("all stops must be in the round but were %v", order)
+	}
+	if roundKm(from, square, order) > roundKm(from, square, []int{0, 2, 1, 3})+1e-9 {
+		t.Errorf("round %v must not be longer than going around the square (%.3f km)", order, roundKm(from, square, []int{0, 2, 1, 3}))
+	}
+
+	if order = OrderStops(from, nil, nil); len(order) != 0 {
+		t.Errorf("a round without stops must be empty but was %v", order)
+	}
+}
+
+//get the km of a round that goes back to its origin
+func roundKm(from geo.Point, stops []geo.Point, order []int) float64 {
+
+	km := 0.0
+	current := from
+	for _, v := range order {
+		km += geo.Distance(current, stops[v])
+		current = stops[v]
+	}
+
+	return km + geo.Distance(current, from)
+}
@@ -0,0 +1,113 @@
+// Implements an engine that simulates how the battery of the drones drains while flying and charges while idle.
+package simulation
+
+import (
+	"sync"
+	"time"
+
+	"drones/pkg/drone"
+)
+
+const (
+	//percentage points of battery charged per minute while the drone is IDLE
+	chargeRatePerMinute = 5.0
+	//extra drain (as a fraction of the drain of the model) when carrying the max weight limit of the model
+	fullPayloadDrainFactor = 1.0
+)
+
+type (
+	//simulates the battery of the drones on every tick
+	Engine struct {
+		interval   time.Duration
+		remainder  map[string]float64 // fraction of percentage point not yet applied, use SerialNumber as key
+		chargeRate ChargeRateFunc     // rate of the drones that charge in a station (nil when there are not stations)
+		sync.Mutex
+	}
+
+	//get the percentage points per minute that an IDLE drone charges, false when the drone does not charge in a station
+	ChargeRateFunc func(serialNumber string) (float64, bool)
+)
+
+//get a pointer to an engine that ticks on the given interval
+func NewEngine(interval time.Duration) *Engine {
+	return &Engine{
+		interval:  interval,
+		remainder: make(map[string]float64),
+	}
+}
+
+//charge the IDLE drones assigned to a station at the rate of the station (the others charge at the default rate)
+func (e *Engine) SetChargeRate(chargeRate ChargeRateFunc) {
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.chargeRate = chargeRate
+}
+
+//tick on the interval of the engine until stop is closed, calling changed on every tick with the drones whose battery level changed
+func (e *Engine) Run(stop <-chan struct{}, drones func() []*drone.Drone, changed func([]*drone.Drone)) {
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			changed(e.Tick(drones(), e.interval))
+		}
+	}
+}
+
+//apply the battery changes of an elapsed period of time to the drones, returning the ones whose level changed
+func (e *Engine) Tick(drones []*drone.Drone, elapsed time.Duration) []*drone.Drone {
+
+	e.Lock()
+	defer e.Unlock()
+
+	changedDrones := make([]*drone.Drone, 0)
+	for _, v := range drones {
+		previousLevel := v.GetBatteryCapacity()
+
+		//only whole percentage points are applied, the rest is kept for next ticks
+		delta := e.remainder[v.GetSerialNumber()] + e.rate(v)*elapsed.Minutes()
+		points := int(delta)
+		e.remainder[v.GetSerialNumber()] = delta - float64(points)
+
+		if points != 0 && v.ChangeBatteryCapacity(points) != previousLevel {
+			changedDrones = append(changedDrones, v)
+		}
+	}
+
+	return changedDrones
+}
+
+//get the percentage points per minute that the battery of a drone changes, using the rate of its station while it charges in one
+//(the caller must hold the lock)
+func (e *Engine) rate(d *drone.Drone) float64 {
+
+	if e.chargeRate != nil && d.GetState() == drone.StateIdle {
+		if rate, ok := e.chargeRate(d.GetSerialNumber()); ok {
+			return rate
+		}
+	}
+
+	return Rate(d)
+}
+
+//get the percentage points per minute that the battery of a drone changes in its current state (negative when draining)
+func Rate(d *drone.Drone) float64 {
+
+	switch d.GetState() {
+	case drone.StateDelivering, drone.StateReturning:
+		//the drain of each model while flying empty, and the payload that doubles it, are in its profile
+		profile, _ := drone.GetModelProfile(d.GetModel())
+		payload := float64(d.CurrentWeight()) / float64(profile.MaxWeightLimit)
+		return -profile.DrainPerMinute * (1 + fullPayloadDrainFactor*payload)
+	case drone.StateIdle:
+		return chargeRatePerMinute
+	}
+
+	return 0
+}
@@ -0,0 +1,129 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Pallinder/go-randomdata"
+
+	"drones/pkg/drone"
+	"drones/pkg/medication"
+)
+
+//get a drone in the given state carrying the given weight
+func newDrone(t *testing.T, model string, batteryCapacity uint8, weight uint, state string) *drone.Drone {
+
+	profile, _ := drone.GetModelProfile(model)
+	dto := drone.DroneDTO{
+		SerialNumber:    randomdata.Alphanumeric(50),
+		Model:           model,
+		WeightLimit:     profile.MaxWeightLimit,
+		BatteryCapacity: batteryCapacity,
+		State:           state,
+	}
+	if weight > 0 {
+		dto.Medications = []medication.MedicationDTO{{Name: "Medication-A", Code: "CODE_A", Weight: weight}}
+	}
+
+	droneObj, err := drone.RestoreDrone(dto)
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	return droneObj
+}
+
+func Test_Rate(t *testing.T) {
+
+	empty := newDrone(t, drone.ModelHeavyweight, 80, 0, drone.StateReturning)
+	loaded := newDrone(t, drone.ModelHeavyweight, 80, 400, drone.StateDelivering)
+	light := newDrone(t, drone.ModelLightweight, 80, 150, drone.StateDelivering)
+	idle := newDrone(t, drone.ModelHeavyweight, 80, 0, drone.StateIdle)
+	loadedOnGround := newDrone(t, drone.ModelHeavyweight, 80, 400, drone.StateLoaded)
+
+	if Rate(empty) >= 0 || Rate(loaded) >= 0 {
+		t.Errorf("battery must drain while flying but rates were %f and %f", Rate(empty), Rate(loaded))
+	}
+
+	if Rate(loaded) >= Rate(empty) {
+		t.Errorf("battery must drain faster with payload: %f with payload and %f without it", Rate(loaded), Rate(empty))
+	}
+
+	if Rate(light) <= Rate(loaded) {
+		t.Errorf("battery of a %s drone must drain slower than a %s one: %f and %f", drone.ModelLightweight, drone.ModelHeavyweight, Rate(light), Rate(loaded))
+	}
+
+	if Rate(idle) <= 0 {
+		t.Errorf("battery must charge while %s but rate was %f", drone.StateIdle, Rate(idle))
+	}
+
+	if Rate(loadedOnGround) != 0 {
+		t.Errorf("battery must not change while %s but rate was %f", drone.StateLoaded, Rate(loadedOnGround))
+	}
+}
+
+func Test_Engine_Tick(t *testing.T) {
+
+	engine := NewEngine(10 * time.Second)
+
+	flying := newDrone(t, drone.ModelLightweight, 50, 0, drone.StateDelivering)
+	idle := newDrone(t, drone.ModelLightweight, 98, 0, drone.StateIdle)
+	full := newDrone(t, drone.ModelLightweight, 100, 0, drone.StateIdle)
+	drones := []*drone.Drone{flying, idle, full}
+
+	//a lightweight drone drains 1 point per minute, so 30 seconds are not enough to drain a whole point
+	engine.Tick(drones, 30*time.Second)
+	if flying.GetBatteryCapacity() != 50 {
+		t.Errorf("battery level must be 50 after 30 seconds but was %d", flying.GetBatteryCapacity())
+	}
+
+	changed := engine.Tick(drones, 30*time.Second)
+	if flying.GetBatteryCapacity() != 49 {
+		t.Errorf("battery level must be 49 after 60 seconds but was %d", flying.GetBatteryCapacity())
+	}
+
+	if idle.GetBatteryCapacity() != 100 {
+		t.Errorf("battery level of idle drone must be charged up to 100 but was %d", idle.GetBatteryCapacity())
+	}
+
+	for _, v := range changed {
+		if v == full {
+			t.Errorf("a drone whose battery was already full must not be reported as changed")
+		}
+	}
+
+	engine.Tick(drones, time.Hour)
+	if flying.GetBatteryCapacity() != 0 {
+		t.Errorf("battery level must not go below 0 but was %d", flying.GetBatteryCapacity())
+	}
+}
+
+func Test_Engine_SetChargeRate(t *testing.T) {
+
+	charging := newDrone(t, drone.ModelHeavyweight, 50, 0, drone.StateIdle)
+	queued := newDrone(t, drone.ModelHeavyweight, 50, 0, drone.StateIdle)
+	unmanaged := newDrone(t, drone.ModelHeavyweight, 50, 0, drone.StateIdle)
+
+	engine := NewEngine(time.Minute)
+	engine.SetChargeRate(func(serialNumber string) (float64, bool) {
+		switch serialNumber {
+		case charging.GetSerialNumber():
+			return 10, true
+		case queued.GetSerialNumber():
+			return 0, true
+		}
+		return 0, false
+	})
+
+	engine.Tick([]*drone.Drone{charging, queued, unmanaged}, time.Minute)
+
+	if charging.GetBatteryCapacity() != 60 {
+		t.Errorf("drone in a slot must charge at the rate of its station but has %d%%", charging.GetBatteryCapacity())
+	}
+	if queued.GetBatteryCapacity() != 50 {
+		t.Errorf("drone waiting for a slot must not charge but has %d%%", queued.GetBatteryCapacity())
+	}
+	if unmanaged.GetBatteryCapacity() != 55 {
+		t.Errorf("drone out of the stations must charge at the default rate but has %d%%", unmanaged.GetBatteryCapacity())
+	}
+}
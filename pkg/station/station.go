@@ -0,0 +1,496 @@
+// Implements the charging stations where drones recharge: slots assigned to the drones back at base, and queues when they are full.
+package station
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/drone"
+	"drones/pkg/events"
+	"drones/pkg/geo"
+)
+
+const (
+	//percentage points of battery charged per minute in a slot when the station has no other rate
+	DefaultChargeRatePerMinute = 5.0
+	//a drone is only assigned to stations this close to where it is
+	maxDockingDistanceKm = 2.0
+	maxNameCharacters    = 100
+	maxSlots             = 100
+	//allowed status of an assignment
+	StatusCharging = "CHARGING"
+	StatusQueued   = "QUEUED"
+)
+
+//error of a drone that has not a station close enough to be assigned to
+var ErrNoStationInReach = errors.New("there is not a charging station in reach")
+
+type (
+	//define what is a charging station within the system
+	Station struct {
+		id         string
+		name       string
+		location   geo.Point
+		slots      int
+		chargeRate float64  // percentage points per minute
+		charging   []string // serial numbers of the drones in the slots
+		queue      []string // serial numbers of the drones waiting for a slot, first come first served
+	}
+
+	//define a data transfer object for a station
+	StationDTO struct {
+		ID                  string    `json:"id,omitempty"`
+		Name                string    `json:"name"`
+		Location            geo.Point `json:"location"`
+		Slots               int       `json:"slots"`
+		ChargeRatePerMinute float64   `json:"charge_rate_per_minute,omitempty"` // (5 when empty)
+		Charging            []string  `json:"charging"`                         // drones in the slots (ignored in requests)
+		Queue               []string  `json:"queue"`                            // drones waiting for a slot (ignored in requests)
+		FreeSlots           int       `json:"free_slots"`                       // (ignored in requests)
+	}
+
+	//define where a drone charges
+	Assignment struct {
+		StationID string `json:"station_id"`
+		Status    string `json:"status"`             // (CHARGING, QUEUED)
+		Position  int    `json:"position,omitempty"` // place in the queue (from 1)
+	}
+
+	//keeps the stations and the drones assigned to them
+	Manager struct {
+		path     string
+		stations map[string]*Station
+		states   map[string]string // last state known of each drone, use SerialNumber as key
+		sync.Mutex
+	}
+)
+
+//get a pointer to a manager of the stations kept in a json file (no file is used when the path is empty)
+func NewManager(path string) (*Manager, error) {
+
+	m := &Manager{
+		path:     path,
+		stations: make(map[string]*Station),
+		states:   make(map[string]string),
+	}
+
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read stations file")
+	}
+
+	dtos := make([]StationDTO, 0)
+	err = json.Unmarshal(data, &dtos)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal stations file")
+	}
+
+	for _, v := range dtos {
+		s, err := newStation(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "station %s of stations file is not valid", v.ID)
+		}
+		if m.stations[s.id] != nil {
+			return nil, fmt.Errorf("station %s of stations file is repeated", s.id)
+		}
+		//the drones assigned before a restart keep their places
+		s.charging = append(s.charging, v.Charging...)
+		s.queue = append(s.queue, v.Queue...)
+		m.stations[s.id] = s
+	}
+
+	return m, nil
+}
+
+//add a station, getting it with its id (a random one when it has none)
+func (m *Manager) Add(dto StationDTO) (StationDTO, error) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	if dto.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return StationDTO{}, err
+		}
+		dto.ID = id
+	}
+
+	if m.stations[dto.ID] != nil {
+		return StationDTO{}, fmt.Errorf("station with id %s already exists", dto.ID)
+	}
+
+	s, err := newStation(dto)
+	if err != nil {
+		return StationDTO{}, err
+	}
+
+	m.stations[s.id] = s
+
+	err = m.save()
+	if err != nil {
+		delete(m.stations, s.id)
+		return StationDTO{}, err
+	}
+
+	return s.getDTO(), nil
+}
+
+//remove a station by its id (only when no drone is charging or waiting in it)
+func (m *Manager) Delete(id string) error {
+
+	m.Lock()
+	defer m.Unlock()
+
+	s := m.stations[id]
+	if s == nil {
+		return fmt.Errorf("there is not a station with id %s", id)
+	}
+
+	if len(s.charging) > 0 || len(s.queue) > 0 {
+		return fmt.Errorf("station %s has %d drones charging and %d waiting", id, len(s.charging), len(s.queue))
+	}
+
+	delete(m.stations, id)
+
+	err := m.save()
+	if err != nil {
+		m.stations[id] = s
+		return err
+	}
+
+	return nil
+}
+
+//get a station by its id, with its occupancy
+func (m *Manager) Get(id string) (StationDTO, bool) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	s := m.stations[id]
+	if s == nil {
+		return StationDTO{}, false
+	}
+
+	return s.getDTO(), true
+}
+
+//get all stations sorted by id, with their occupancy
+func (m *Manager) GetAll() []StationDTO {
+
+	m.Lock()
+	defer m.Unlock()
+
+	dtos := make([]StationDTO, 0, len(m.stations))
+	for _, v := range m.sortedStations() {
+		dtos = append(dtos, v.getDTO())
+	}
+
+	return dtos
+}
+
+//assign a drone to a free slot of the nearest station in reach that has one, or to the queue of the nearest one when all are full
+//(a drone that is already assigned keeps its place)
+func (m *Manager) Dock(serialNumber string, location geo.Point) (Assignment, error) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	if assignment, ok := m.assignment(serialNumber); ok {
+		return assignment, nil
+	}
+
+	inReach := make([]*Station, 0)
+	for _, v := range m.sortedStations() {
+		if geo.Distance(location, v.location) <= maxDockingDistanceKm {
+			inReach = append(inReach, v)
+		}
+	}
+	if len(inReach) == 0 {
+		return Assignment{}, ErrNoStationInReach
+	}
+
+	sort.SliceStable(inReach, func(i, j int) bool {
+		return geo.Distance(location, inReach[i].location) < geo.Distance(location, inReach[j].location)
+	})
+
+	chosen := inReach[0]
+	for _, v := range inReach {
+		if len(v.charging) < v.slots {
+			chosen = v
+			break
+		}
+	}
+
+	if len(chosen.charging) < chosen.slots {
+		chosen.charging = append(chosen.charging, serialNumber)
+	} else {
+		chosen.queue = append(chosen.queue, serialNumber)
+	}
+
+	err := m.save()
+	if err != nil {
+		return Assignment{}, err
+	}
+
+	assignment, _ := m.assignment(serialNumber)
+
+	return assignment, nil
+}
+
+//free the slot (or the place in the queue) of a drone, giving the slot to the first drone of the queue,
+//getting the serial number of that drone (empty when nobody was waiting)
+func (m *Manager) Release(serialNumber string) (string, error) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, v := range m.stations {
+		if position := indexOf(v.queue, serialNumber); position >= 0 {
+			v.queue = append(v.queue[:position], v.queue[position+1:]...)
+			return "", m.save()
+		}
+		if slot := indexOf(v.charging, serialNumber); slot >= 0 {
+			v.charging = append(v.charging[:slot], v.charging[slot+1:]...)
+			promoted := ""
+			if len(v.queue) > 0 && len(v.charging) < v.slots {
+				promoted = v.queue[0]
+				v.queue = v.queue[1:]
+				v.charging = append(v.charging, promoted)
+			}
+			return promoted, m.save()
+		}
+	}
+
+	return "", fmt.Errorf("drone %s is not assigned to any station", serialNumber)
+}
+
+//get where a drone charges
+func (m *Manager) GetAssignment(serialNumber string) (Assignment, bool) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	return m.assignment(serialNumber)
+}
+
+//get the percentage points per minute that a drone assigned to a station charges (none while it waits for a slot),
+//false when the drone is not assigned to any station
+func (m *Manager) ChargeRate(serialNumber string) (float64, bool) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, v := range m.stations {
+		if indexOf(v.charging, serialNumber) >= 0 {
+			return v.chargeRate, true
+		}
+		if indexOf(v.queue, serialNumber) >= 0 {
+			return 0, true
+		}
+	}
+
+	return 0, false
+}
+
+//follow the fleet events until the channel is closed
+func (m *Manager) Run(fleetEvents <-chan events.Event) {
+	for v := range fleetEvents {
+		m.HandleEvent(v)
+	}
+}
+
+//dock the drones that are back to base (RETURNING to IDLE), and release the ones that are fully charged or leave the base
+func (m *Manager) HandleEvent(event events.Event) {
+
+	if event.Drone == nil {
+		return
+	}
+	dto := *event.Drone
+
+	m.Lock()
+	previousState, known := m.states[dto.SerialNumber]
+	if dto.State != "" {
+		m.states[dto.SerialNumber] = dto.State
+	}
+	_, assigned := m.assignment(dto.SerialNumber)
+	m.Unlock()
+
+	if !known {
+		previousState = dto.State
+	}
+
+	switch {
+	case assigned && (dto.State != drone.StateIdle || dto.BatteryCapacity >= 100):
+		promoted, err := m.Release(dto.SerialNumber)
+		if err != nil {
+			log.Printf("could not release the station of drone %s: %v", dto.SerialNumber, err)
+		}
+		if promoted != "" {
+			log.Printf("drone %s takes the slot released by drone %s", promoted, dto.SerialNumber)
+		}
+	case !assigned && previousState == drone.StateReturning && dto.State == drone.StateIdle && dto.BatteryCapacity < 100:
+		location := dto.Location
+		if location == nil {
+			location = dto.HomeBase
+		}
+		if location == nil {
+			log.Printf("could not dock drone %s back at base: its location is not known", dto.SerialNumber)
+			return
+		}
+		assignment, err := m.Dock(dto.SerialNumber, *location)
+		if err != nil {
+			log.Printf("could not dock drone %s back at base: %v", dto.SerialNumber, err)
+			return
+		}
+		log.Printf("drone %s docked at station %s (%s)", dto.SerialNumber, assignment.StationID, assignment.Status)
+	}
+}
+
+//get where a drone charges (the caller must hold the lock)
+func (m *Manager) assignment(serialNumber string) (Assignment, bool) {
+
+	for _, v := range m.stations {
+		if indexOf(v.charging, serialNumber) >= 0 {
+			return Assignment{StationID: v.id, Status: StatusCharging}, true
+		}
+		if position := indexOf(v.queue, serialNumber); position >= 0 {
+			return Assignment{StationID: v.id, Status: StatusQueued, Position: position + 1}, true
+		}
+	}
+
+	return Assignment{}, false
+}
+
+//write all stations in the file (the caller must hold the lock)
+func (m *Manager) save() error {
+
+	if m.path == "" {
+		return nil
+	}
+
+	dtos := make([]StationDTO, 0, len(m.stations))
+	for _, v := range m.sortedStations() {
+		dtos = append(dtos, v.getDTO())
+	}
+
+	data, err := json.MarshalIndent(dtos, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal stations")
+	}
+
+	//the file is replaced at once, so a crash while writing does not leave it half written
+	tmpPath := m.path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not write stations file")
+	}
+
+	return errors.Wrap(os.Rename(tmpPath, m.path), "could not replace stations file")
+}
+
+//get all stations sorted by id (the caller must hold the lock)
+func (m *Manager) sortedStations() []*Station {
+
+	stations := make([]*Station, 0, len(m.stations))
+	for _, v := range m.stations {
+		stations = append(stations, v)
+	}
+
+	sort.Slice(stations, func(i, j int) bool {
+		return stations[i].id < stations[j].id
+	})
+
+	return stations
+}
+
+//get a pointer to a station object from a station DTO, without drones
+func newStation(dto StationDTO) (*Station, error) {
+
+	if len(dto.Name) == 0 || len(dto.Name) > maxNameCharacters {
+		return nil, errors.New(dto.Name + " is not a valid name of station")
+	}
+
+	err := dto.Location.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "location of station is not valid")
+	}
+
+	if dto.Slots < 1 || dto.Slots > maxSlots {
+		return nil, fmt.Errorf("%d is not a valid number of slots (from 1 to %d)", dto.Slots, maxSlots)
+	}
+
+	if dto.ChargeRatePerMinute < 0 {
+		return nil, fmt.Errorf("%.2f is not a valid charge rate", dto.ChargeRatePerMinute)
+	}
+
+	chargeRate := dto.ChargeRatePerMinute
+	if chargeRate == 0 {
+		chargeRate = DefaultChargeRatePerMinute
+	}
+
+	return &Station{
+		id:         dto.ID,
+		name:       dto.Name,
+		location:   dto.Location,
+		slots:      dto.Slots,
+		chargeRate: chargeRate,
+		charging:   make([]string, 0),
+		queue:      make([]string, 0),
+	}, nil
+}
+
+//get DTO that represents a station with its occupancy
+func (s *Station) getDTO() StationDTO {
+	return StationDTO{
+		ID:                  s.id,
+		Name:                s.name,
+		Location:            s.location,
+		Slots:               s.slots,
+		ChargeRatePerMinute: s.chargeRate,
+		Charging:            append(make([]string, 0), s.charging...),
+		Queue:               append(make([]string, 0), s.queue...),
+		FreeSlots:           s.slots - len(s.charging),
+	}
+}
+
+//get the position of a value in a list (-1 when it is not there)
+func indexOf(values []string, value string) int {
+
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+
+	return -1
+}
+
+//get a random identifier for a station
+func newID() (string, error) {
+
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "could not generate station id")
+	}
+
+	return hex.EncodeToString(b), nil
+}
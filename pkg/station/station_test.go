@@ -0,0 +1,132 @@
+package station
+
+import (
+	"path/filepath"
+	"testing"
+
+	"drones/pkg/drone"
+	"drones/pkg/events"
+	"drones/pkg/geo"
+)
+
+var base = geo.Point{Latitude: 40.4168, Longitude: -3.7038}
+
+//get a manager with a station of the given slots at the base
+func newTestManager(t *testing.T, path string, slots int) *Manager {
+
+	m, err := NewManager(path)
+	if err != nil {
+		t.Fatalf("error while creating manager for test:%v", err)
+	}
+
+	_, err = m.Add(StationDTO{ID: "base", Name: "Base", Location: base, Slots: slots})
+	if err != nil {
+		t.Fatalf("error while adding station for test:%v", err)
+	}
+
+	return m
+}
+
+func Test_Manager_Add(t *testing.T) {
+
+	m := newTestManager(t, "", 2)
+
+	tests := []struct {
+		name string
+		dto  StationDTO
+	}{
+		{"without name", StationDTO{Location: base, Slots: 1}},
+		{"without slots", StationDTO{Name: "North", Location: base}},
+		{"invalid location", StationDTO{Name: "North", Location: geo.Point{Latitude: 91}, Slots: 1}},
+		{"negative rate", StationDTO{Name: "North", Location: base, Slots: 1, ChargeRatePerMinute: -1}},
+		{"repeated id", StationDTO{ID: "base", Name: "North", Location: base, Slots: 1}},
+	}
+
+	for _, tt := range tests {
+		if _, err := m.Add(tt.dto); err == nil {
+			t.Errorf("station %s must not be added", tt.name)
+		}
+	}
+
+	dto, ok := m.Get("base")
+	if !ok || dto.FreeSlots != 2 || dto.ChargeRatePerMinute != DefaultChargeRatePerMinute {
+		t.Errorf("station must have 2 free slots and the default rate but was %+v", dto)
+	}
+}
+
+func Test_Manager_Dock(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "stations.json")
+	m := newTestManager(t, path, 1)
+
+	first, err := m.Dock("DRONE-1", base)
+	if err != nil || first.Status != StatusCharging {
+		t.Fatalf("first drone must get the free slot but got %+v (%v)", first, err)
+	}
+
+	second, err := m.Dock("DRONE-2", base)
+	if err != nil || second.Status != StatusQueued || second.Position != 1 {
+		t.Fatalf("second drone must wait first in the queue but got %+v (%v)", second, err)
+	}
+
+	if rate, ok := m.ChargeRate("DRONE-2"); !ok || rate != 0 {
+		t.Errorf("drone waiting for a slot must not charge but its rate was %f", rate)
+	}
+
+	if _, err = m.Dock("DRONE-3", geo.Point{Latitude: 40.60, Longitude: -3.70}); err != ErrNoStationInReach {
+		t.Errorf("drone far from the stations must not be docked but got %v", err)
+	}
+
+	if err = m.Delete("base"); err == nil {
+		t.Errorf("station with drones must not be deleted")
+	}
+
+	//the occupancy is kept after a restart
+	restored, err := NewManager(path)
+	if err != nil {
+		t.Fatalf("manager must be restored: %v", err)
+	}
+
+	promoted, err := restored.Release("DRONE-1")
+	if err != nil || promoted != "DRONE-2" {
+		t.Fatalf("drone waiting must get the slot when it is released but got '%s' (%v)", promoted, err)
+	}
+
+	if assignment, ok := restored.GetAssignment("DRONE-2"); !ok || assignment.Status != StatusCharging {
+		t.Errorf("promoted drone must be charging but was %+v", assignment)
+	}
+	if _, ok := restored.GetAssignment("DRONE-1"); ok {
+		t.Errorf("released drone must not be assigned")
+	}
+}
+
+func Test_Manager_HandleEvent(t *testing.T) {
+
+	m := newTestManager(t, "", 1)
+
+	event := func(state string, batteryCapacity uint8) events.Event {
+		location := base
+		return events.Event{
+			Type:         events.TypeStateChanged,
+			SerialNumber: "DRONE-1",
+			Drone:        &drone.DroneDTO{SerialNumber: "DRONE-1", State: state, BatteryCapacity: batteryCapacity, Location: &location},
+		}
+	}
+
+	//an IDLE drone that was not returning stays out of the stations
+	m.HandleEvent(event(drone.StateIdle, 50))
+	if _, ok := m.GetAssignment("DRONE-1"); ok {
+		t.Errorf("drone must only be docked when it is back to base")
+	}
+
+	m.HandleEvent(event(drone.StateReturning, 40))
+	m.HandleEvent(event(drone.StateIdle, 40))
+	if assignment, ok := m.GetAssignment("DRONE-1"); !ok || assignment.Status != StatusCharging {
+		t.Fatalf("drone back to base must be charging but was %+v", assignment)
+	}
+
+	m.HandleEvent(event(drone.StateIdle, 100))
+	if _, ok := m.GetAssignment("DRONE-1"); ok {
+		t.Errorf("drone fully charged must leave its slot")
+	}
+}
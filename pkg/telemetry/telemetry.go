@@ -0,0 +1,113 @@
+// Implements the ingestion of the readings that drones report, rejecting the stale and out of order ones.
+package telemetry
+
+import (
+	"time"
+
+	"drones/pkg/drone"
+)
+
+const (
+	//outcomes of a reading
+	StatusAccepted   = "ACCEPTED"
+	StatusInvalid    = "INVALID"
+	StatusUnknown    = "UNKNOWN_DRONE"
+	StatusStale      = "STALE"
+	StatusOutOfOrder = "OUT_OF_ORDER"
+	StatusFromFuture = "FROM_FUTURE"
+	StatusForbidden  = "FORBIDDEN" // the reading is of a drone other than the device that reports it
+
+	//readings ahead of the clock of the controller by more than this are rejected
+	maxClockSkew = time.Minute
+	//readings older than this are rejected when no other max age is set
+	defaultMaxAge = 5 * time.Minute
+)
+
+type (
+	//define a reading sent to the controller
+	Reading struct {
+		SerialNumber string `json:"serial_number"`
+		drone.Telemetry
+	}
+
+	//define the outcome of the ingestion of a reading
+	Result struct {
+		Index           int       `json:"index"` // position of the reading in the request
+		SerialNumber    string    `json:"serial_number"`
+		Timestamp       time.Time `json:"timestamp"`
+		Status          string    `json:"status"` // (ACCEPTED, INVALID, UNKNOWN_DRONE, STALE, OUT_OF_ORDER, FROM_FUTURE, FORBIDDEN)
+		StateMismatch   bool      `json:"state_mismatch,omitempty"`
+		ReportedState   string    `json:"reported_state,omitempty"`
+		ControllerState string    `json:"controller_state,omitempty"`
+		Reason          string    `json:"reason,omitempty"`
+	}
+
+	//applies readings to drones
+	Ingestor struct {
+		maxAge time.Duration // readings older than this are stale
+		now    func() time.Time
+	}
+)
+
+//get a pointer to an ingestor that rejects readings older than max age (5 minutes when it is 0)
+func NewIngestor(maxAge time.Duration) *Ingestor {
+
+	if maxAge <= 0 {
+		maxAge = defaultMaxAge
+	}
+
+	return &Ingestor{
+		maxAge: maxAge,
+		now:    time.Now,
+	}
+}
+
+//apply a reading to its drone (nil when there is not such a drone), getting the outcome
+func (i *Ingestor) Ingest(index int, reading Reading, droneObj *drone.Drone) Result {
+
+	result := Result{
+		Index:         index,
+		SerialNumber:  reading.SerialNumber,
+		Timestamp:     reading.Timestamp,
+		ReportedState: reading.State,
+	}
+
+	if droneObj == nil {
+		result.Status = StatusUnknown
+		result.Reason = "there is not a drone with that serial number"
+		return result
+	}
+
+	now := i.now()
+	switch {
+	case now.Sub(reading.Timestamp) > i.maxAge:
+		result.Status = StatusStale
+		result.Reason = "reading is older than the max age allowed"
+		return result
+	case reading.Timestamp.Sub(now) > maxClockSkew:
+		result.Status = StatusFromFuture
+		result.Reason = "reading is ahead of the clock of the controller"
+		return result
+	}
+
+	applied, err := droneObj.ApplyTelemetry(reading.Telemetry)
+	result.ControllerState = droneObj.GetState()
+	if err == drone.ErrOutOfOrderTelemetry {
+		result.Status = StatusOutOfOrder
+		result.Reason = err.Error()
+		return result
+	}
+	if err != nil {
+		result.Status = StatusInvalid
+		result.Reason = err.Error()
+		return result
+	}
+
+	result.Status = StatusAccepted
+	result.StateMismatch = applied.StateMismatch
+	if applied.StateMismatch {
+		result.Reason = "state reported by the drone is not the one of the controller"
+	}
+
+	return result
+}
@@ -0,0 +1,65 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"drones/pkg/drone"
+)
+
+func Test_Ingest(t *testing.T) {
+
+	droneObj, err := drone.NewDrone(drone.DroneDTO{
+		SerialNumber:    "SERIAL-A",
+		Model:           drone.ModelLightweight,
+		WeightLimit:     100,
+		BatteryCapacity: 90,
+		State:           drone.StateIdle,
+	})
+	if err != nil {
+		t.Fatalf("error while creating drone for test:%v", err)
+	}
+
+	now := time.Date(2021, 11, 26, 10, 0, 0, 0, time.UTC)
+	i := NewIngestor(time.Minute)
+	i.now = func() time.Time { return now }
+
+	reading := func(offset time.Duration, battery uint8, state string) Reading {
+		return Reading{
+			SerialNumber: "SERIAL-A",
+			Telemetry:    drone.Telemetry{Timestamp: now.Add(offset), BatteryCapacity: &battery, State: state},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		reading  Reading
+		droneObj *drone.Drone
+		status   string
+		mismatch bool
+	}{
+		{"unknown drone", reading(0, 80, ""), nil, StatusUnknown, false},
+		{"stale", reading(-2*time.Minute, 80, ""), droneObj, StatusStale, false},
+		{"from future", reading(2*time.Minute, 80, ""), droneObj, StatusFromFuture, false},
+		{"invalid", reading(0, 120, ""), droneObj, StatusInvalid, false},
+		{"accepted", reading(-30*time.Second, 80, drone.StateIdle), droneObj, StatusAccepted, false},
+		{"out of order", reading(-40*time.Second, 70, ""), droneObj, StatusOutOfOrder, false},
+		{"state mismatch", reading(-20*time.Second, 75, drone.StateReturning), droneObj, StatusAccepted, true},
+	}
+
+	for k, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := i.Ingest(k, tt.reading, tt.droneObj)
+			if result.Index != k || result.Status != tt.status || result.StateMismatch != tt.mismatch {
+				t.Errorf("unexpected result %+v", result)
+			}
+			if result.Status != StatusAccepted && result.Reason == "" {
+				t.Errorf("rejected reading must have a reason")
+			}
+		})
+	}
+
+	if droneObj.GetBatteryCapacity() != 75 {
+		t.Errorf("battery level must be the one of the last accepted reading but is %d", droneObj.GetBatteryCapacity())
+	}
+}
@@ -0,0 +1,509 @@
+// Implements outbound webhooks: subscriptions to drone events that are delivered as signed json payloads, with retries.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"drones/pkg/drone"
+	"drones/pkg/events"
+)
+
+const (
+	//allowed event types
+	EventDroneLoaded    = "DRONE_LOADED"
+	EventDroneDeparted  = "DRONE_DEPARTED"
+	EventDroneDelivered = "DRONE_DELIVERED"
+	EventBatteryLow     = "BATTERY_LOW"
+
+	//headers of a delivery
+	SignatureHeader = "X-Drones-Signature" // "sha256=" followed by the hex HMAC-SHA256 of the body with the secret of the subscription
+	EventHeader     = "X-Drones-Event"
+	DeliveryHeader  = "X-Drones-Delivery"
+
+	//failed deliveries kept to be checked (the oldest ones are dropped)
+	deadLettersSize = 100
+	//time that a receiver has to answer a delivery
+	deliveryTimeout = 10 * time.Second
+)
+
+type (
+	//define a subscription of a receiver to some event types
+	SubscriptionDTO struct {
+		ID         string    `json:"id,omitempty"`
+		URL        string    `json:"url"`
+		EventTypes []string  `json:"event_types"`
+		Secret     string    `json:"secret,omitempty"` // only written, it is never returned by the api
+		CreatedAt  time.Time `json:"created_at"`
+	}
+
+	//body of a delivery
+	Payload struct {
+		ID        string         `json:"id"` // id of the delivery, the same on every retry
+		Event     string         `json:"event"`
+		Timestamp time.Time      `json:"timestamp"`
+		Drone     drone.DroneDTO `json:"drone"`
+	}
+
+	//a delivery that failed on every attempt
+	DeadLetter struct {
+		SubscriptionID string    `json:"subscription_id"`
+		URL            string    `json:"url"`
+		Payload        Payload   `json:"payload"`
+		Attempts       int       `json:"attempts"`
+		LastError      string    `json:"last_error"`
+		FailedAt       time.Time `json:"failed_at"`
+	}
+
+	//keeps the subscriptions (persisted in a json file) and delivers the events to them
+	Dispatcher struct {
+		path          string                      // file where the subscriptions are persisted (empty to keep them only in memory)
+		subscriptions map[string]*SubscriptionDTO // use ID as key
+		deadLetters   []DeadLetter                // oldest first
+		maxAttempts   int
+		backoff       time.Duration // wait before the first retry, doubled on every next one
+		client        *http.Client
+		batteryLow    map[string]bool // drones already notified of low battery
+		stop          chan struct{}   // closed to cancel the pending retries
+		deliveries    sync.WaitGroup
+		sync.Mutex
+	}
+)
+
+//get a pointer to a dispatcher, reading the file of subscriptions when it already exists
+func NewDispatcher(path string, maxAttempts int, backoff time.Duration) (*Dispatcher, error) {
+
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	d := &Dispatcher{
+		path:          path,
+		subscriptions: make(map[string]*SubscriptionDTO),
+		deadLetters:   make([]DeadLetter, 0),
+		maxAttempts:   maxAttempts,
+		backoff:       backoff,
+		client:        &http.Client{Timeout: deliveryTimeout},
+		batteryLow:    make(map[string]bool),
+		stop:          make(chan struct{}),
+	}
+
+	if path == "" {
+		return d, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read webhooks file")
+	}
+
+	dtos := make([]SubscriptionDTO, 0)
+	err = json.Unmarshal(data, &dtos)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal webhooks file")
+	}
+
+	for i := range dtos {
+		d.subscriptions[dtos[i].ID] = &dtos[i]
+	}
+
+	return d, nil
+}
+
+//subscribe a receiver, getting the subscription with its id
+func (d *Dispatcher) Subscribe(dto SubscriptionDTO) (SubscriptionDTO, error) {
+
+	err := validSubscription(dto)
+	if err != nil {
+		return SubscriptionDTO{}, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return SubscriptionDTO{}, err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	s := &SubscriptionDTO{
+		ID:         id,
+		URL:        dto.URL,
+		EventTypes: append([]string{}, dto.EventTypes...),
+		Secret:     dto.Secret,
+		CreatedAt:  time.Now(),
+	}
+	d.subscriptions[id] = s
+
+	err = d.save()
+	if err != nil {
+		delete(d.subscriptions, id)
+		return SubscriptionDTO{}, err
+	}
+
+	return s.withoutSecret(), nil
+}
+
+//remove a subscription by its id
+func (d *Dispatcher) Unsubscribe(id string) error {
+
+	d.Lock()
+	defer d.Unlock()
+
+	s := d.subscriptions[id]
+	if s == nil {
+		return fmt.Errorf("there is not a webhook with id %s", id)
+	}
+
+	delete(d.subscriptions, id)
+
+	err := d.save()
+	if err != nil {
+		d.subscriptions[id] = s
+		return err
+	}
+
+	return nil
+}
+
+//get a subscription by its id (without its secret)
+func (d *Dispatcher) Get(id string) (SubscriptionDTO, bool) {
+
+	d.Lock()
+	defer d.Unlock()
+
+	s := d.subscriptions[id]
+	if s == nil {
+		return SubscriptionDTO{}, false
+	}
+
+	return s.withoutSecret(), true
+}
+
+//get all subscriptions sorted by creation (without their secrets)
+func (d *Dispatcher) GetAll() []SubscriptionDTO {
+
+	d.Lock()
+	defer d.Unlock()
+
+	dtos := make([]SubscriptionDTO, 0, len(d.subscriptions))
+	for _, v := range d.subscriptions {
+		dtos = append(dtos, v.withoutSecret())
+	}
+
+	sortSubscriptions(dtos)
+
+	return dtos
+}
+
+//get the deliveries that failed on every attempt, oldest first
+func (d *Dispatcher) DeadLetters() []DeadLetter {
+
+	d.Lock()
+	defer d.Unlock()
+
+	return append([]DeadLetter{}, d.deadLetters...)
+}
+
+//deliver the fleet events received on the channel until it is closed
+func (d *Dispatcher) Run(fleetEvents <-chan events.Event) {
+	for v := range fleetEvents {
+		d.HandleEvent(v)
+	}
+}
+
+//turn a fleet event into the webhook events it means and notify them
+func (d *Dispatcher) HandleEvent(event events.Event) {
+
+	if event.Drone == nil {
+		return
+	}
+	dto := *event.Drone
+
+	switch {
+	case event.Type == events.TypeMedicationsLoaded:
+		d.Notify(EventDroneLoaded, dto)
+	case event.Type == events.TypeStateChanged && dto.State == drone.StateDelivering:
+		d.Notify(EventDroneDeparted, dto)
+	case event.Type == events.TypeStateChanged && dto.State == drone.StateDelivered:
+		d.Notify(EventDroneDelivered, dto)
+	}
+
+	//low battery is notified once when the level drops below the threshold, and again only after it went back above it
+	low := dto.BatteryCapacity < drone.MinBatteryLevelForLoading
+
+	d.Lock()
+	notify := low && !d.batteryLow[dto.SerialNumber]
+	if low {
+		d.batteryLow[dto.SerialNumber] = true
+	} else {
+		delete(d.batteryLow, dto.SerialNumber)
+	}
+	d.Unlock()
+
+	if notify {
+		d.Notify(EventBatteryLow, dto)
+	}
+}
+
+//deliver an event of a drone to every subscription of its type (in background)
+func (d *Dispatcher) Notify(eventType string, dto drone.DroneDTO) {
+
+	d.Lock()
+	defer d.Unlock()
+
+	for _, v := range d.subscriptions {
+		if !contains(v.EventTypes, eventType) {
+			continue
+		}
+
+		id, err := newID()
+		if err != nil {
+			d.addDeadLetter(DeadLetter{SubscriptionID: v.ID, URL: v.URL, LastError: err.Error(), FailedAt: time.Now()})
+			continue
+		}
+
+		payload := Payload{
+			ID:        id,
+			Event:     eventType,
+			Timestamp: time.Now(),
+			Drone:     dto,
+		}
+
+		d.deliveries.Add(1)
+		go d.deliver(*v, payload)
+	}
+}
+
+//cancel the pending retries and wait for the deliveries in progress
+func (d *Dispatcher) Close() {
+
+	d.Lock()
+	select {
+	case <-d.stop:
+	default:
+		close(d.stop)
+	}
+	d.Unlock()
+
+	d.deliveries.Wait()
+}
+
+//get the signature of a body with a secret, as it is sent in the signature header
+func Sign(secret string, body []byte) string {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//check the signature header of a delivery (meant for receivers)
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+//deliver a payload to a subscription, retrying with exponential backoff, and keep it as dead letter when every attempt fails
+func (d *Dispatcher) deliver(s SubscriptionDTO, payload Payload) {
+
+	defer d.deliveries.Done()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.Lock()
+		d.addDeadLetter(DeadLetter{SubscriptionID: s.ID, URL: s.URL, Payload: payload, LastError: err.Error(), FailedAt: time.Now()})
+		d.Unlock()
+		return
+	}
+
+	wait := d.backoff
+	attempts := 0
+	for {
+		attempts++
+		err = d.post(s, payload, body)
+		if err == nil {
+			return
+		}
+
+		if attempts >= d.maxAttempts {
+			break
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-d.stop:
+			timer.Stop()
+			err = errors.Wrap(err, "retries cancelled on shutdown")
+		case <-timer.C:
+			wait *= 2
+			continue
+		}
+		break
+	}
+
+	d.Lock()
+	d.addDeadLetter(DeadLetter{
+		SubscriptionID: s.ID,
+		URL:            s.URL,
+		Payload:        payload,
+		Attempts:       attempts,
+		LastError:      err.Error(),
+		FailedAt:       time.Now(),
+	})
+	d.Unlock()
+}
+
+//do one attempt of a delivery (any status other than 2xx is a failure)
+func (d *Dispatcher) post(s SubscriptionDTO, payload Payload, body []byte) error {
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not create request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(s.Secret, body))
+	req.Header.Set(EventHeader, payload.Event)
+	req.Header.Set(DeliveryHeader, payload.ID)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not reach receiver")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver answered with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+//keep a dead letter, dropping the oldest ones beyond the limit (must be called with the lock taken)
+func (d *Dispatcher) addDeadLetter(deadLetter DeadLetter) {
+
+	d.deadLetters = append(d.deadLetters, deadLetter)
+	if len(d.deadLetters) > deadLettersSize {
+		d.deadLetters = d.deadLetters[len(d.deadLetters)-deadLettersSize:]
+	}
+}
+
+//write all subscriptions to the file (must be called with the lock taken)
+func (d *Dispatcher) save() error {
+
+	if d.path == "" {
+		return nil
+	}
+
+	dtos := make([]SubscriptionDTO, 0, len(d.subscriptions))
+	for _, v := range d.subscriptions {
+		dtos = append(dtos, *v)
+	}
+
+	sortSubscriptions(dtos)
+
+	data, err := json.MarshalIndent(dtos, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal webhooks")
+	}
+
+	//the file is replaced at once, so a crash while writing does not leave it half written
+	tmpPath := d.path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0600) // it keeps the secrets
+	if err != nil {
+		return errors.Wrap(err, "could not write webhooks file")
+	}
+
+	return errors.Wrap(os.Rename(tmpPath, d.path), "could not replace webhooks file")
+}
+
+//get a copy of a subscription without its secret
+func (s *SubscriptionDTO) withoutSecret() SubscriptionDTO {
+
+	dto := *s
+	dto.Secret = ""
+	dto.EventTypes = append([]string{}, s.EventTypes...)
+
+	return dto
+}
+
+//check whether a subscription is valid
+func validSubscription(dto SubscriptionDTO) error {
+
+	u, err := url.Parse(dto.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q is not a valid http or https url", dto.URL)
+	}
+
+	if len(dto.EventTypes) == 0 {
+		return errors.New("at least one event type is needed")
+	}
+
+	for _, v := range dto.EventTypes {
+		switch v {
+		case EventDroneLoaded, EventDroneDeparted, EventDroneDelivered, EventBatteryLow:
+		default:
+			return fmt.Errorf("event type %s is not valid, allowed ones are %s, %s, %s and %s",
+				v, EventDroneLoaded, EventDroneDeparted, EventDroneDelivered, EventBatteryLow)
+		}
+	}
+
+	if dto.Secret == "" {
+		return errors.New("a secret is needed to sign the payloads")
+	}
+
+	return nil
+}
+
+//sort subscriptions by creation and id
+func sortSubscriptions(dtos []SubscriptionDTO) {
+	sort.Slice(dtos, func(i, j int) bool {
+		if !dtos[i].CreatedAt.Equal(dtos[j].CreatedAt) {
+			return dtos[i].CreatedAt.Before(dtos[j].CreatedAt)
+		}
+		return dtos[i].ID < dtos[j].ID
+	})
+}
+
+//check whether a value is in a list
+func contains(list []string, value string) bool {
+
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+//get a random identifier
+func newID() (string, error) {
+
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "could not generate id")
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"drones/pkg/drone"
+	"drones/pkg/events"
+)
+
+//receiver that fails the first deliveries and keeps the payloads it accepts
+type receiver struct {
+	failures int
+	calls    int
+	payloads []Payload
+	sync.Mutex
+}
+
+func (rv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	rv.Lock()
+	defer rv.Unlock()
+
+	rv.calls++
+	if rv.calls <= rv.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if !Verify("secret", body, r.Header.Get(SignatureHeader)) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	payload := Payload{}
+	_ = json.Unmarshal(body, &payload)
+	if r.Header.Get(EventHeader) != payload.Event || r.Header.Get(DeliveryHeader) != payload.ID {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rv.payloads = append(rv.payloads, payload)
+}
+
+func Test_Subscribe(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+
+	d, err := NewDispatcher(path, 3, time.Millisecond)
+	if err != nil {
+		t.Fatalf("error while creating dispatcher for test:%v", err)
+	}
+
+	invalid := []SubscriptionDTO{
+		{URL: "ftp://example.com", EventTypes: []string{EventDroneLoaded}, Secret: "secret"},
+		{URL: "http://example.com", Secret: "secret"},
+		{URL: "http://example.com", EventTypes: []string{"UNKNOWN"}, Secret: "secret"},
+		{URL: "http://example.com", EventTypes: []string{EventDroneLoaded}},
+	}
+	for i, v := range invalid {
+		if _, err := d.Subscribe(v); err == nil {
+			t.Errorf("subscription %d must be rejected", i)
+		}
+	}
+
+	s, err := d.Subscribe(SubscriptionDTO{URL: "http://example.com/hook", EventTypes: []string{EventBatteryLow}, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("valid subscription was rejected: %v", err)
+	}
+	if s.ID == "" || s.Secret != "" {
+		t.Errorf("subscription must get an id and be returned without its secret: %+v", s)
+	}
+
+	//subscriptions are read again from the file
+	d, err = NewDispatcher(path, 3, time.Millisecond)
+	if err != nil {
+		t.Fatalf("error while reopening dispatcher:%v", err)
+	}
+	all := d.GetAll()
+	if len(all) != 1 || all[0].ID != s.ID || all[0].Secret != "" {
+		t.Fatalf("reopened dispatcher must have the subscription without its secret but has %+v", all)
+	}
+	if d.subscriptions[s.ID].Secret != "secret" {
+		t.Errorf("reopened dispatcher must keep the secret of the subscription")
+	}
+
+	err = d.Unsubscribe(s.ID)
+	if err != nil {
+		t.Errorf("subscription could not be removed: %v", err)
+	}
+	if _, ok := d.Get(s.ID); ok {
+		t.Errorf("removed subscription must not be found")
+	}
+	if d.Unsubscribe(s.ID) == nil {
+		t.Errorf("removing an unknown subscription must fail")
+	}
+}
+
+func Test_Notify(t *testing.T) {
+
+	rv := &receiver{failures: 2}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	d, err := NewDispatcher("", 3, time.Millisecond)
+	if err != nil {
+		t.Fatalf("error while creating dispatcher for test:%v", err)
+	}
+
+	_, err = d.Subscribe(SubscriptionDTO{URL: server.URL, EventTypes: []string{EventDroneLoaded}, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("error while subscribing test receiver:%v", err)
+	}
+
+	d.Notify(EventDroneDelivered, drone.DroneDTO{SerialNumber: "SERIAL-A"})
+	d.Notify(EventDroneLoaded, drone.DroneDTO{SerialNumber: "SERIAL-A"})
+	d.deliveries.Wait()
+
+	//it is delivered on the third attempt
+	if rv.calls != 3 || len(rv.payloads) != 1 {
+		t.Fatalf("receiver must be called 3 times and accept 1 payload but was called %d times and accepted %d", rv.calls, len(rv.payloads))
+	}
+	if rv.payloads[0].Event != EventDroneLoaded || rv.payloads[0].Drone.SerialNumber != "SERIAL-A" {
+		t.Errorf("unexpected payload %+v", rv.payloads[0])
+	}
+	if len(d.DeadLetters()) != 0 {
+		t.Errorf("a delivered payload must not be a dead letter")
+	}
+}
+
+func Test_DeadLetters(t *testing.T) {
+
+	rv := &receiver{failures: 10}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	d, err := NewDispatcher("", 3, time.Millisecond)
+	if err != nil {
+		t.Fatalf("error while creating dispatcher for test:%v", err)
+	}
+
+	s, err := d.Subscribe(SubscriptionDTO{URL: server.URL, EventTypes: []string{EventDroneDelivered}, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("error while subscribing test receiver:%v", err)
+	}
+
+	d.Notify(EventDroneDelivered, drone.DroneDTO{SerialNumber: "SERIAL-A"})
+	d.deliveries.Wait()
+
+	deadLetters := d.DeadLetters()
+	if len(deadLetters) != 1 {
+		t.Fatalf("failed delivery must be kept as 1 dead letter but there are %d", len(deadLetters))
+	}
+	if deadLetters[0].SubscriptionID != s.ID || deadLetters[0].Attempts != 3 || deadLetters[0].Payload.Event != EventDroneDelivered {
+		t.Errorf("unexpected dead letter %+v", deadLetters[0])
+	}
+	if rv.calls != 3 {
+		t.Errorf("receiver must be called 3 times but was called %d", rv.calls)
+	}
+}
+
+func Test_HandleEvent(t *testing.T) {
+
+	rv := &receiver{}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	d, err := NewDispatcher("", 1, time.Millisecond)
+	if err != nil {
+		t.Fatalf("error while creating dispatcher for test:%v", err)
+	}
+
+	_, err = d.Subscribe(SubscriptionDTO{
+		URL:        server.URL,
+		EventTypes: []string{EventDroneLoaded, EventDroneDeparted, EventDroneDelivered, EventBatteryLow},
+		Secret:     "secret",
+	})
+	if err != nil {
+		t.Fatalf("error while subscribing test receiver:%v", err)
+	}
+
+	fleetEvents := []events.Event{
+		{Type: events.TypeDroneRegistered, Drone: &drone.DroneDTO{SerialNumber: "A", State: "IDLE", BatteryCapacity: 90}},
+		{Type: events.TypeMedicationsLoaded, Drone: &drone.DroneDTO{SerialNumber: "A", State: "LOADED", BatteryCapacity: 90}},
+		{Type: events.TypeStateChanged, Drone: &drone.DroneDTO{SerialNumber: "A", State: "LOADED", BatteryCapacity: 90}},
+		{Type: events.TypeStateChanged, Drone: &drone.DroneDTO{SerialNumber: "A", State: "DELIVERING", BatteryCapacity: 90}},
+		{Type: events.TypeBatteryUpdated, Drone: &drone.DroneDTO{SerialNumber: "A", State: "DELIVERING", BatteryCapacity: 24}},
+		{Type: events.TypeBatteryUpdated, Drone: &drone.DroneDTO{SerialNumber: "A", State: "DELIVERING", BatteryCapacity: 20}},
+		{Type: events.TypeStateChanged, Drone: &drone.DroneDTO{SerialNumber: "A", State: "DELIVERED", BatteryCapacity: 20}},
+		{Type: events.TypeBatteryUpdated, Drone: &drone.DroneDTO{SerialNumber: "A", State: "IDLE", BatteryCapacity: 30}},
+		{Type: events.TypeBatteryUpdated, Drone: &drone.DroneDTO{SerialNumber: "A", State: "IDLE", BatteryCapacity: 10}},
+	}
+	for _, v := range fleetEvents {
+		d.HandleEvent(v)
+	}
+	d.deliveries.Wait()
+
+	count := make(map[string]int)
+	for _, v := range rv.payloads {
+		count[v.Event]++
+	}
+
+	expected := map[string]int{EventDroneLoaded: 1, EventDroneDeparted: 1, EventDroneDelivered: 1, EventBatteryLow: 2}
+	for k, v := range expected {
+		if count[k] != v {
+			t.Errorf("receiver must get %d %s payloads but got %d", v, k, count[k])
+		}
+	}
+}
+
+func Test_Close(t *testing.T) {
+
+	rv := &receiver{failures: 10}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	d, err := NewDispatcher("", 5, time.Hour)
+	if err != nil {
+		t.Fatalf("error while creating dispatcher for test:%v", err)
+	}
+
+	_, err = d.Subscribe(SubscriptionDTO{URL: server.URL, EventTypes: []string{EventDroneLoaded}, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("error while subscribing test receiver:%v", err)
+	}
+
+	d.Notify(EventDroneLoaded, drone.DroneDTO{SerialNumber: "SERIAL-A"})
+
+	//closing does not wait for the pending retries, it keeps their deliveries as dead letters
+	closed := make(chan struct{})
+	go func() {
+		for {
+			rv.Lock()
+			calls := rv.calls
+			rv.Unlock()
+			if calls > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		d.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("dispatcher must cancel the pending retries on close")
+	}
+
+	deadLetters := d.DeadLetters()
+	if len(deadLetters) != 1 || deadLetters[0].Attempts != 1 {
+		t.Errorf("cancelled delivery must be kept as dead letter after 1 attempt but got %+v", deadLetters)
+	}
+}
+
+func Test_Sign(t *testing.T) {
+
+	body := []byte(`{"event":"DRONE_LOADED"}`)
+	signature := Sign("secret", body)
+
+	if !Verify("secret", body, signature) {
+		t.Errorf("signature must be verified with the same secret")
+	}
+	if Verify("other", body, signature) {
+		t.Errorf("signature must not be verified with another secret")
+	}
+	if Verify("secret", []byte(`{"event":"DRONE_DELIVERED"}`), signature) {
+		t.Errorf("signature must not be verified with another body")
+	}
+}
@@ -0,0 +1,261 @@
+// Implements the server side of the WebSocket protocol (RFC 6455), enough to push text messages to clients.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	//GUID that the protocol appends to the key of the client to get the accept value
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	opcodeText  = 0x1
+	opcodeClose = 0x8
+	opcodePing  = 0x9
+	opcodePong  = 0xA
+
+	//max size of a frame sent by a client (clients of this app only send control frames)
+	maxClientPayload = 4096
+)
+
+//error of a handshake sent by a browser from an origin that is not allowed
+var ErrOriginNotAllowed = errors.New("origin of the request is not allowed")
+
+type (
+	//a WebSocket connection with a client
+	Conn struct {
+		conn       net.Conn
+		reader     *bufio.Reader
+		sync.Mutex // serializes writes
+	}
+)
+
+//upgrade an http request to a WebSocket connection, only when it comes from an allowed origin (like https://example.com):
+//requests without Origin (not sent by a browser) and from the host of the request are always allowed
+func Upgrade(w http.ResponseWriter, r *http.Request, allowedOrigins []string) (*Conn, error) {
+
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, errors.New("request is not a WebSocket handshake")
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, errors.New("only version 13 of WebSocket is supported")
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("request lacks of header Sec-WebSocket-Key")
+	}
+
+	if !isAllowedOrigin(r, allowedOrigins) {
+		return nil, errors.Wrapf(ErrOriginNotAllowed, "origin %s", r.Header.Get("Origin"))
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("connection does not support being upgraded")
+	}
+
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not take over connection")
+	}
+
+	//the deadlines of the http server do not apply to a long lived connection
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "could not clear deadlines of connection")
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+
+	_, err = conn.Write([]byte(response))
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "could not write handshake response")
+	}
+
+	return &Conn{
+		conn:   conn,
+		reader: buffer.Reader,
+	}, nil
+}
+
+//check whether the origin of a request is allowed (a browser page can not open a WebSocket of another site unless it is allowed)
+func isAllowedOrigin(r *http.Request, allowedOrigins []string) bool {
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, v := range allowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(v, "/"), origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//get the value of Sec-WebSocket-Accept for a Sec-WebSocket-Key
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+//send a text message
+func (c *Conn) WriteText(data []byte) error {
+	return c.writeFrame(opcodeText, data)
+}
+
+//send a ping, so dead connections are detected
+func (c *Conn) WritePing() error {
+	return c.writeFrame(opcodePing, nil)
+}
+
+//read frames from the client until it closes the connection or fails, answering pings (text messages are discarded)
+func (c *Conn) ReadUntilClosed() error {
+
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case opcodeClose:
+			//the close frame is echoed as the protocol asks for
+			_ = c.writeFrame(opcodeClose, payload)
+			return nil
+		case opcodePing:
+			err = c.writeFrame(opcodePong, payload)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+//close the connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+//write a frame (server frames are not masked)
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+
+	c.Lock()
+	defer c.Unlock()
+
+	header := []byte{0x80 | opcode} // FIN bit and opcode
+	length := len(payload)
+	switch {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	_, err := c.conn.Write(append(header, payload...))
+
+	return err
+}
+
+//read a frame sent by the client (client frames must be masked)
+func (c *Conn) readFrame() (byte, []byte, error) {
+
+	header := make([]byte, 2)
+	_, err := io.ReadFull(c.reader, header)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		_, err = io.ReadFull(c.reader, extended)
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		_, err = io.ReadFull(c.reader, extended)
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if !masked {
+		return 0, nil, errors.New("frames sent by clients must be masked")
+	}
+
+	if length > maxClientPayload {
+		return 0, nil, errors.New("frame sent by client is too large")
+	}
+
+	mask := make([]byte, 4)
+	_, err = io.ReadFull(c.reader, mask)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.reader, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return opcode, payload, nil
+}
+
+//check whether a header has a value among its comma separated tokens (case insensitive)
+func headerContains(header http.Header, name string, value string) bool {
+
+	for _, v := range header.Values(name) {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_AcceptKey(t *testing.T) {
+
+	//example of RFC 6455
+	accept := AcceptKey("dGhlIHNhbXBsZSBub25jZQ==")
+	if accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected accept key %s", accept)
+	}
+}
+
+func Test_Upgrade(t *testing.T) {
+
+	done := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, []string{"https://allowed.example.com"})
+		if errors.Is(err, ErrOriginNotAllowed) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer conn.Close()
+
+		err = conn.WriteText([]byte("hello"))
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- conn.ReadUntilClosed()
+	}))
+	defer server.Close()
+
+	//a plain request is refused
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("error while doing plain request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain request must be refused with 400 but got %d", resp.StatusCode)
+	}
+
+	//a handshake from a page of another site is refused
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	for k, v := range map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13",
+		"Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ==", "Origin": "https://other.example.com"} {
+		request.Header.Set(k, v)
+	}
+	resp, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("error while doing handshake from another origin: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("handshake from an origin that is not allowed must be refused with 403 but got %d", resp.StatusCode)
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("error while connecting to test server: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\nOrigin: https://allowed.example.com\r\nConnection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	if err != nil {
+		t.Fatalf("error while writing handshake: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("error while reading handshake response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected handshake response %d %v", resp.StatusCode, resp.Header)
+	}
+
+	frame := make([]byte, 7)
+	_, err = io.ReadFull(reader, frame)
+	if err != nil {
+		t.Fatalf("error while reading text frame: %v", err)
+	}
+	if frame[0] != 0x80|opcodeText || frame[1] != 5 || string(frame[2:]) != "hello" {
+		t.Errorf("unexpected text frame %v", frame)
+	}
+
+	//masked close frame with an empty payload
+	_, err = conn.Write([]byte{0x80 | opcodeClose, 0x80, 1, 2, 3, 4})
+	if err != nil {
+		t.Fatalf("error while writing close frame: %v", err)
+	}
+
+	echo := make([]byte, 2)
+	_, err = io.ReadFull(reader, echo)
+	if err != nil {
+		t.Fatalf("error while reading close frame: %v", err)
+	}
+	if echo[0] != 0x80|opcodeClose {
+		t.Errorf("close frame must be echoed but got %v", echo)
+	}
+
+	err = <-done
+	if err != nil {
+		t.Errorf("connection must be closed cleanly but got %v", err)
+	}
+}